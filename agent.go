@@ -0,0 +1,127 @@
+package cstats
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/saveugene/cstats/collector"
+	"github.com/saveugene/cstats/sink"
+)
+
+// runAgent collects like daemon and pushes the samples to an aggregator,
+// keeping them while it is unreachable.
+func runAgent(args []string) {
+	var interval *int
+	var outfile, push, source, hostName, token *string
+	var buffer *int
+	var newCollector func(ctx context.Context) (collector.Collector, error)
+	var debugFlag *bool
+	register := func(fs *flag.FlagSet, kind collector.Kind) {
+		interval = fs.Int("interval", 5, "Collection interval in seconds")
+		outfile = fs.String("outfile", kind.Outfile, "Local copy of the capture")
+		push = fs.String("push", "", "Aggregator `URL` to push the samples to (required)")
+		source = fs.String("source", "", "Source of the aggregator to push to (default: its first)")
+		hostName = fs.String("host-name", "", "Host name stamped on the samples (default: this machine's)")
+		token = fs.String("ingest-token", os.Getenv("CSTATS_INGEST_TOKEN"), "The aggregator's --ingest-token (default $CSTATS_INGEST_TOKEN)")
+		buffer = fs.Int("buffer", 100000, "Samples kept while the aggregator is unreachable (the oldest are dropped)")
+		sinksFlag(fs)
+		newCollector = kind.Flags(fs)
+		debugFlag = fs.Bool("debug", false, "Enable debug logging")
+		pprofFlag(fs)
+		selfFlag(fs)
+	}
+	kind := collectorCommand("agent", `Collects like "cstats daemon" and pushes the samples to a "cstats aggregator",
+so many hosts can be watched from one dashboard.
+
+`, args, register)
+
+	fs := newFlagSet("agent " + kind.Name)
+	register(fs, kind)
+	parseFlags(fs, args[1:])
+	if *debugFlag {
+		minLevel = levelDebug
+	}
+	if *push == "" {
+		log.Fatal("--push is required")
+	}
+	pusher, err := newPushSink(*push, *source, *token, *hostName, *buffer)
+	if err != nil {
+		log.Fatalf("--push: %v", err)
+	}
+	startDiagnostics()
+
+	stopCh := make(chan struct{})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		logf("Received shutdown signal")
+		close(stopCh)
+	}()
+	ctx, cancel := stopContext(stopCh)
+	defer cancel()
+
+	c, err := newCollector(ctx)
+	if err != nil {
+		log.Fatalf("%s agent: %v", kind.Name, err)
+	}
+	fmt.Printf("Pushing to %s as %s\n", pusher.url, pusher.host)
+	if err := runCollector(ctx, kind, c, *interval, *outfile, sink.Async("push", pusher, sinkQueue)); err != nil {
+		log.Fatalf("%s agent: %v", kind.Name, err)
+	}
+}
+
+// runAggregator serves the live dashboard of the samples pushed by agents,
+// gathered in one capture with a host column and keyed by host. Serving
+// beyond loopback, as agents on other machines need, requires --auth or
+// --token: the dashboard can pause, mark and snapshot.
+func runAggregator(args []string) {
+	fs := newFlagSet("aggregator")
+	outfile := fs.String("outfile", "fleet.csv", "Capture the pushed samples are appended to")
+	token := fs.String("ingest-token", os.Getenv("CSTATS_INGEST_TOKEN"), "Bearer token agents push with (required; default $CSTATS_INGEST_TOKEN)")
+	host := fs.String("host", "127.0.0.1", "Host for the server: 0.0.0.0 or an address of this machine lets agents elsewhere push (requires --auth or --token)")
+	port := fs.Int("port", 8088, "Port for the server")
+	interval := fs.Float64("interval", 5, "Dashboard refresh in seconds")
+	themeName := fs.String("theme", "dark", "Dashboard theme: dark, light or auto (follow the browser)")
+	open := fs.Bool("open-browser", false, "Open the dashboard in a browser")
+	auth := authFlags(fs)
+	retentionFlag(fs)
+	dedupeFlag(fs)
+	unitsFlag(fs)
+	parseFlags(fs, args)
+	if *token == "" {
+		log.Fatal("--ingest-token is required")
+	}
+	if !auth.enabled() && !isLoopbackHost(*host) {
+		log.Fatalf("--host %s serves the dashboard beyond this machine: set --auth or --token", *host)
+	}
+
+	plotArgs := []string{
+		"--live",
+		"--ingest-token", *token,
+		"--series-key", "host",
+		"--interval", strconv.FormatFloat(*interval, 'f', -1, 64),
+		"--host", *host,
+		"--port", strconv.Itoa(*port),
+		"--theme", *themeName,
+		"--window", retention.String(),
+		"--dedupe", dedupe.String(),
+		"--units", units.String(),
+	}
+	if auth.basic != "" {
+		plotArgs = append(plotArgs, "--auth", auth.basic)
+	}
+	if auth.token != "" {
+		plotArgs = append(plotArgs, "--token", auth.token)
+	}
+	if !*open {
+		plotArgs = append(plotArgs, "--no-open-browser")
+	}
+	runPlot(append(plotArgs, *outfile))
+}
@@ -0,0 +1,160 @@
+package cstats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeJSON writes v as an uncached JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+// summaryHandler serves /api/summary: the per-container stats in the same
+// shape as `cstats summary --format json`.
+func summaryHandler(load func() []record, opts FigureOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		records := load()
+		writeJSON(w, summaryEntries(containerNames(records), summarize(records, opts)))
+	}
+}
+
+// seriesEntry is one container's time series served by /api/series.
+type seriesEntry struct {
+	Container  string               `json:"container"`
+	Timestamps []time.Time          `json:"timestamps"`
+	CPUPct     []float64            `json:"cpu_pct"`
+	MemUsageMB []float64            `json:"mem_usage_mb"`
+	MemLimitMB []float64            `json:"mem_limit_mb"`
+	MemPct     []float64            `json:"mem_pct"`
+	Extra      map[string][]float64 `json:"extra,omitempty"`
+}
+
+// seriesHandler serves /api/series: per-container sample arrays, optionally
+// downsampled with ?points=N (indices are picked on CPU so all metrics share
+// timestamps).
+func seriesHandler(load func() []record) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		points := 0
+		if v := r.URL.Query().Get("points"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid points parameter", http.StatusBadRequest)
+				return
+			}
+			points = n
+		}
+
+		records := load()
+		grouped := groupByContainer(records)
+		out := []seriesEntry{}
+		for _, c := range containerNames(records) {
+			recs := grouped[c]
+			idx, _ := downsampleSeries(recs, func(r record) float64 { return r.CPUPct }, points)
+			e := seriesEntry{
+				Container:  c,
+				Timestamps: make([]time.Time, len(idx)),
+				CPUPct:     make([]float64, len(idx)),
+				MemUsageMB: make([]float64, len(idx)),
+				MemLimitMB: make([]float64, len(idx)),
+				MemPct:     make([]float64, len(idx)),
+			}
+			for k, i := range idx {
+				rec := recs[i]
+				e.Timestamps[k] = rec.Timestamp
+				e.CPUPct[k] = rec.CPUPct
+				e.MemUsageMB[k] = rec.MemUsageMB
+				e.MemLimitMB[k] = rec.MemLimitMB
+				e.MemPct[k] = rec.MemPct
+				for name, v := range rec.Extra {
+					if e.Extra == nil {
+						e.Extra = map[string][]float64{}
+					}
+					if e.Extra[name] == nil {
+						e.Extra[name] = make([]float64, len(idx))
+					}
+					e.Extra[name][k] = v
+				}
+			}
+			out = append(out, e)
+		}
+		writeJSON(w, out)
+	}
+}
+
+// recordFilter is the ?window= and ?containers= selection shared by the
+// live API endpoints.
+type recordFilter struct {
+	// Window keeps only samples within this duration of the newest sample
+	// (0 = everything).
+	Window     time.Duration
+	Containers []string
+}
+
+// parseRecordFilter reads ?window=30m and ?containers=app,db.
+func parseRecordFilter(r *http.Request) (recordFilter, error) {
+	var f recordFilter
+	if v := r.URL.Query().Get("window"); v != "" && v != "all" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return f, fmt.Errorf("invalid window parameter %q, want a duration like 15m or 1h", v)
+		}
+		f.Window = d
+	}
+	if v := r.URL.Query().Get("containers"); v != "" {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				f.Containers = append(f.Containers, c)
+			}
+		}
+	}
+	return f, nil
+}
+
+// key identifies the filter in cache keys.
+func (f recordFilter) key() string {
+	return f.Window.String() + "/" + strings.Join(f.Containers, ",")
+}
+
+// apply returns the records matching the filter. The window is anchored at
+// the newest sample rather than the wall clock so finished captures work.
+func (f recordFilter) apply(records []record) []record {
+	if f.Window == 0 && len(f.Containers) == 0 {
+		return records
+	}
+	var cutoff time.Time
+	if f.Window > 0 {
+		cutoff = lastSample(records).Add(-f.Window)
+	}
+	out := make([]record, 0, len(records))
+	for _, r := range records {
+		if r.Timestamp.Before(cutoff) {
+			continue
+		}
+		if len(f.Containers) > 0 && !slices.Contains(f.Containers, r.Container) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// withFilter parses the record filter and passes it to h, answering 400 for
+// malformed parameters.
+func withFilter(h func(http.ResponseWriter, *http.Request, recordFilter)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseRecordFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h(w, r, f)
+	}
+}
@@ -0,0 +1,99 @@
+package cstats
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// tokenCookie carries the --token credential for the page's own fetch and
+// EventSource requests, which cannot set an Authorization header.
+const tokenCookie = "cstats_token"
+
+// authConfig protects the live server with HTTP basic auth and/or a bearer
+// token. Either credential is accepted when both are set.
+type authConfig struct {
+	basic string
+	token string
+}
+
+// authFlags registers --auth and --token on fs.
+func authFlags(fs *flag.FlagSet) *authConfig {
+	a := &authConfig{}
+	fs.StringVar(&a.basic, "auth", "", "Require HTTP basic auth on the live server (user:pass)")
+	fs.StringVar(&a.token, "token", "", "Require a bearer token on the live server (Authorization header or ?token=)")
+	return a
+}
+
+// isLoopbackHost reports whether a --host only accepts connections from
+// this machine.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (a *authConfig) enabled() bool { return a.basic != "" || a.token != "" }
+
+func (a *authConfig) validate() error {
+	if a.basic != "" && !strings.Contains(a.basic, ":") {
+		return fmt.Errorf("--auth must be user:pass")
+	}
+	return nil
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authorized checks the request's credentials. A valid ?token= query also
+// sets the token cookie so the rest of the page's requests pass.
+func (a *authConfig) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if a.basic != "" {
+		if user, pass, ok := r.BasicAuth(); ok && secureEqual(user+":"+pass, a.basic) {
+			return true
+		}
+	}
+	if a.token == "" {
+		return false
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(bearer, a.token) {
+		return true
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil && secureEqual(c.Value, a.token) {
+		return true
+	}
+	if q := r.URL.Query().Get("token"); q != "" && secureEqual(q, a.token) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    q,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		return true
+	}
+	return false
+}
+
+// wrap rejects unauthenticated requests to h with 401.
+func (a *authConfig) wrap(h http.Handler) http.Handler {
+	if !a.enabled() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(w, r) {
+			if a.basic != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="cstats", charset="UTF-8"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,422 @@
+package cstats
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var awsErrorMessage = regexp.MustCompile(`<Message>(.*?)</Message>`)
+
+// awsCreds are AWS access keys; Expires is zero for long-lived ones.
+type awsCreds struct {
+	AccessKeyID, SecretAccessKey, SessionToken string
+	Expires                                    time.Time
+}
+
+// awsCredentials resolves credentials in the order of the AWS CLI and SDKs:
+// AWS_ACCESS_KEY_ID and friends, a web identity token (EKS IRSA), the
+// access keys of the AWS_PROFILE profile in the shared credentials and
+// config files, the ECS task role, and the EC2 instance role. Temporary
+// credentials are refreshed before they expire.
+type awsCredentials struct {
+	client *http.Client
+	cur    awsCreds
+}
+
+var (
+	// imdsURL is the EC2 instance metadata service.
+	imdsURL = "http://169.254.169.254/latest/"
+	// ecsCredentialsHost serves the ECS task role at
+	// $AWS_CONTAINER_CREDENTIALS_RELATIVE_URI.
+	ecsCredentialsHost = "http://169.254.170.2"
+)
+
+func (c *awsCredentials) get() (awsCreds, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCreds{AccessKeyID: id, SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	if c.cur.AccessKeyID != "" && (c.cur.Expires.IsZero() || time.Until(c.cur.Expires) > 5*time.Minute) {
+		return c.cur, nil
+	}
+	creds, err := c.resolve()
+	if err != nil {
+		return awsCreds{}, err
+	}
+	c.cur = creds
+	return creds, nil
+}
+
+// resolve finds credentials past the environment variables.
+func (c *awsCredentials) resolve() (awsCreds, error) {
+	if file, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); file != "" && role != "" {
+		creds, err := c.webIdentity(file, role)
+		if err != nil {
+			return awsCreds{}, fmt.Errorf("web identity credentials: %w", err)
+		}
+		return creds, nil
+	}
+	if creds, ok, err := profileCredentials(); ok || err != nil {
+		return creds, err
+	}
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		creds, err := c.container()
+		if err != nil {
+			return awsCreds{}, fmt.Errorf("ECS task credentials: %w", err)
+		}
+		return creds, nil
+	}
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return awsCreds{}, errors.New("no AWS credentials: set AWS_ACCESS_KEY_ID or AWS_PROFILE, or run with a web identity, ECS task or EC2 instance role")
+	}
+	role, err := c.metadata("meta-data/iam/security-credentials/")
+	if err != nil {
+		return awsCreds{}, fmt.Errorf("no AWS credentials: set AWS_ACCESS_KEY_ID or AWS_PROFILE, or run with a web identity, ECS task or EC2 instance role (%v)", err)
+	}
+	doc, err := c.metadata("meta-data/iam/security-credentials/" + strings.TrimSpace(strings.SplitN(role, "\n", 2)[0]))
+	if err != nil {
+		return awsCreds{}, fmt.Errorf("instance role credentials: %w", err)
+	}
+	creds, err := parseRoleCredentials([]byte(doc))
+	if err != nil {
+		return awsCreds{}, fmt.Errorf("instance role credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// parseRoleCredentials reads the credentials document of the EC2 instance
+// metadata service and the ECS credentials endpoint.
+func parseRoleCredentials(doc []byte) (awsCreds, error) {
+	var v struct {
+		AccessKeyId, SecretAccessKey, Token string
+		Expiration                          time.Time
+	}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return awsCreds{}, err
+	}
+	if v.AccessKeyId == "" {
+		return awsCreds{}, errors.New("no access key in the credentials document")
+	}
+	return awsCreds{AccessKeyID: v.AccessKeyId, SecretAccessKey: v.SecretAccessKey, SessionToken: v.Token, Expires: v.Expiration}, nil
+}
+
+// webIdentity exchanges the token in file for credentials of role with
+// STS AssumeRoleWithWebIdentity, which takes no signature.
+func (c *awsCredentials) webIdentity(file, role string) (awsCreds, error) {
+	token, err := os.ReadFile(file)
+	if err != nil {
+		return awsCreds{}, err
+	}
+	endpoint := "https://sts.amazonaws.com/"
+	if region := cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")); region != "" {
+		endpoint = "https://sts." + region + ".amazonaws.com/"
+	}
+	endpoint = cmp.Or(os.Getenv("AWS_ENDPOINT_URL_STS"), endpoint)
+	form := neturl.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {cmp.Or(os.Getenv("AWS_ROLE_SESSION_NAME"), "cstats-"+strconv.FormatInt(time.Now().Unix(), 10))},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	resp, err := c.client.PostForm(endpoint, form)
+	if err != nil {
+		return awsCreds{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		if m := awsErrorMessage.FindSubmatch(body); m != nil {
+			body = m[1]
+		}
+		return awsCreds{}, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	var v struct {
+		Credentials struct {
+			AccessKeyId, SecretAccessKey, SessionToken string
+			Expiration                                 time.Time
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &v); err != nil {
+		return awsCreds{}, err
+	}
+	cr := v.Credentials
+	if cr.AccessKeyId == "" {
+		return awsCreds{}, errors.New("no credentials in the STS response")
+	}
+	return awsCreds{AccessKeyID: cr.AccessKeyId, SecretAccessKey: cr.SecretAccessKey, SessionToken: cr.SessionToken, Expires: cr.Expiration}, nil
+}
+
+// container reads the credentials of the ECS task role (or of another
+// container credentials provider, at a full URI with an authorization
+// token).
+func (c *awsCredentials) container() (awsCreds, error) {
+	url := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		url = ecsCredentialsHost + rel
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return awsCreds{}, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return awsCreds{}, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return awsCreds{}, err
+	}
+	defer resp.Body.Close()
+	doc, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return awsCreds{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCreds{}, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(doc)))
+	}
+	return parseRoleCredentials(doc)
+}
+
+// profileCredentials returns the access keys of the $AWS_PROFILE profile
+// ("default" if unset) in the shared credentials file or the config file.
+// ok is false when there is no such profile; a profile named in
+// $AWS_PROFILE must have keys, since the rest of the chain would not
+// stand in for it.
+func profileCredentials() (creds awsCreds, ok bool, err error) {
+	name := os.Getenv("AWS_PROFILE")
+	home, _ := os.UserHomeDir()
+	files := []struct{ path, section string }{
+		{cmp.Or(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), filepath.Join(home, ".aws", "credentials")), cmp.Or(name, "default")},
+		{cmp.Or(os.Getenv("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config")), "profile " + cmp.Or(name, "default")},
+	}
+	if name == "" || name == "default" {
+		files = append(files, struct{ path, section string }{files[1].path, "default"})
+	}
+	found := false
+	for _, f := range files {
+		keys, err := readINISection(f.path, f.section)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return awsCreds{}, false, err
+		}
+		found = found || keys != nil
+		if id := keys["aws_access_key_id"]; id != "" {
+			return awsCreds{AccessKeyID: id, SecretAccessKey: keys["aws_secret_access_key"], SessionToken: keys["aws_session_token"]}, true, nil
+		}
+	}
+	if name != "" {
+		if !found {
+			return awsCreds{}, false, fmt.Errorf("AWS profile %q not found", name)
+		}
+		return awsCreds{}, false, fmt.Errorf("AWS profile %q has no aws_access_key_id (only access keys are supported)", name)
+	}
+	return awsCreds{}, false, nil
+}
+
+// readINISection returns the key = value pairs under [section] of an AWS
+// shared config file, nil if it has no such section.
+func readINISection(path, section string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var keys map[string]string
+	in := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			in = strings.Join(strings.Fields(line[1:len(line)-1]), " ") == section
+			if in && keys == nil {
+				keys = map[string]string{}
+			}
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok && in {
+			keys[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	return keys, sc.Err()
+}
+
+// metadata reads a path under meta-data/ of the instance metadata service,
+// with an IMDSv2 session token.
+func (c *awsCredentials) metadata(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, imdsURL+"api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// In a container, a hop limit of 1 drops the response.
+		return "", fmt.Errorf("instance metadata token: %w", err)
+	}
+	token, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("instance metadata token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata token: %s", resp.Status)
+	}
+	if !strings.HasPrefix(path, "meta-data/") {
+		path = "meta-data/" + path
+	}
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, imdsURL+path, nil)
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata %s: %s", path, resp.Status)
+	}
+	return string(b), err
+}
+
+// signAWSv4 signs req, whose body is body, with AWS Signature Version 4.
+// Every header set on req is signed, with the host; a payload hash already
+// in X-Amz-Content-Sha256 (S3) is used as is.
+func signAWSv4(req *http.Request, body string, creds awsCreds, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	signed := []string{"host"}
+	for h := range req.Header {
+		if h := strings.ToLower(h); h != "authorization" && h != "user-agent" {
+			signed = append(signed, h)
+		}
+	}
+	slices.Sort(signed)
+	payload := cmp.Or(req.Header.Get("X-Amz-Content-Sha256"), sha256Hex(body))
+	scope, sig := awsSignature(req, signed, payload, creds, region, service, amzDate)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, strings.Join(signed, ";"), sig))
+}
+
+// presignAWSv4 returns the URL of req, a GET, with an AWS Signature
+// Version 4 in its query string: a link anyone can follow for expires (at
+// most a week, and no longer than temporary credentials last).
+func presignAWSv4(req *http.Request, creds awsCreds, region, service string, now time.Time, expires time.Duration) string {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	q := req.URL.Query()
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	req.URL.RawQuery = canonicalQuery(q)
+	req.URL.RawPath = uriEncode(req.URL.Path, false) // sent as signed
+	_, sig := awsSignature(req, []string{"host"}, "UNSIGNED-PAYLOAD", creds, region, service, amzDate)
+	return req.URL.String() + "&X-Amz-Signature=" + sig
+}
+
+// awsSignature returns the credential scope of a request and its
+// signature over the signed headers, sorted, and the payload hash.
+func awsSignature(req *http.Request, signed []string, payload string, creds awsCreds, region, service, amzDate string) (scope, sig string) {
+	var headers strings.Builder
+	for _, h := range signed {
+		v := strings.Join(req.Header.Values(h), ",")
+		if h == "host" {
+			v = req.URL.Host
+		}
+		headers.WriteString(h + ":" + strings.Join(strings.Fields(v), " ") + "\n")
+	}
+	path := uriEncode(req.URL.Path, false)
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{req.Method, path, canonicalQuery(req.URL.Query()), headers.String(), strings.Join(signed, ";"), payload}, "\n")
+	day := amzDate[:8]
+	scope = day + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonical)
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return scope, hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+// canonicalQuery encodes query parameters sorted by name, then value.
+func canonicalQuery(q neturl.Values) string {
+	var params [][2]string
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, [2]string{uriEncode(k, true), uriEncode(v, true)})
+		}
+	}
+	slices.SortFunc(params, func(a, b [2]string) int { return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1])) })
+	var out []string
+	for _, p := range params {
+		out = append(out, p[0]+"="+p[1])
+	}
+	return strings.Join(out, "&")
+}
+
+// uriEncode escapes everything but unreserved characters the way AWS
+// signs it, and slashes too if slash is set.
+func uriEncode(s string, slash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.IndexByte("-_.~", c) >= 0, c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,173 @@
+package cstats
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// defaultWarnPct is the percent of a budget from which a container is WARN,
+// when the budgets file does not say.
+const defaultWarnPct = 90
+
+// budgetsYAML is a budgets file:
+//
+//	warn: 90            # percent of a budget from which a container warns
+//	budgets:
+//	- container: api-*  # glob of container names (default *)
+//	  cpu_p95_pct: 80   # metrics as in summary --format json, memory in MB
+//	  mem_max_mb: 512
+type budgetsYAML struct {
+	Warn    *float64         `json:"warn"`
+	Budgets []map[string]any `json:"budgets"`
+}
+
+// loadBudgets reads the rules of a budgets file.
+func loadBudgets(file string) ([]budgetRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc budgetsYAML
+	if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	warn := float64(defaultWarnPct)
+	if doc.Warn != nil {
+		warn = *doc.Warn
+	}
+	if warn <= 0 || warn > 100 {
+		return nil, fmt.Errorf("%s: warn must be a percent in (0, 100], got %g", file, warn)
+	}
+	var rules []budgetRule
+	for i, entry := range doc.Budgets {
+		pattern := "*"
+		if v, ok := entry["container"]; ok {
+			s, ok := v.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("%s: budget %d: container must be a name or glob", file, i+1)
+			}
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("%s: budget %d: bad pattern %q: %w", file, i+1, s, err)
+			}
+			pattern = s
+		}
+		n := 0
+		for _, metric := range slices.Sorted(maps.Keys(entry)) {
+			if metric == "container" {
+				continue
+			}
+			if _, ok := budgetMetrics[metric]; !ok {
+				return nil, fmt.Errorf("%s: budget %d: unknown metric %q (use %s)", file, i+1, metric,
+					strings.Join(slices.Sorted(maps.Keys(budgetMetrics)), ", "))
+			}
+			limit, ok := entry[metric].(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s: budget %d: %s must be a number", file, i+1, metric)
+			}
+			rules = append(rules, budgetRule{Pattern: pattern, Metric: metric, Limit: limit, Warn: warn / 100})
+			n++
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("%s: budget %d caps no metric", file, i+1)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s: no budgets", file)
+	}
+	return rules, nil
+}
+
+// budgetsFlag registers --budgets on fs.
+func budgetsFlag(fs *flag.FlagSet) *string {
+	return fs.String("budgets", "", "Budgets `file` (YAML) of per-container limits: adds an OK/WARN/FAIL column to the summary")
+}
+
+// mustLoadBudgets loads the --budgets file, if any, exiting on errors.
+func mustLoadBudgets(file string) []budgetRule {
+	if file == "" {
+		return nil
+	}
+	rules, err := loadBudgets(file)
+	if err != nil {
+		log.Fatalf("--budgets: %v", err)
+	}
+	return rules
+}
+
+// Budget statuses of the summary's Budget column.
+const (
+	budgetOK   = "OK"
+	budgetWarn = "WARN"
+	budgetFail = "FAIL"
+	budgetNone = "-" // no budget covers the container
+)
+
+// Colors of the WARN and OK statuses in the HTML summary; FAIL takes
+// exceededColor.
+const (
+	warnColor = "#FFA15A"
+	okColor   = "#00CC96"
+)
+
+// applyBudgets sets the budget status of every container: FAIL when over
+// any of its budgets, WARN when close to one, else OK.
+func applyBudgets(stats map[string]*containerStats, rules []budgetRule) {
+	if len(rules) == 0 {
+		return
+	}
+	for _, s := range stats {
+		s.Budget = budgetNone
+	}
+	for _, r := range checkBudgets(rules, slices.Sorted(maps.Keys(stats)), stats) {
+		s := stats[r.Container]
+		if s == nil {
+			continue // a rule matching nothing
+		}
+		switch {
+		case r.Failed:
+			s.Budget = budgetFail
+		case r.Warned && s.Budget != budgetFail:
+			s.Budget = budgetWarn
+		case s.Budget == budgetNone:
+			s.Budget = budgetOK
+		}
+	}
+}
+
+// budgetFontColors returns the font colors of the summary table's cells,
+// column-major like Plotly wants them: text in the Budget column takes the
+// color of its status, everything else the default.
+func budgetFontColors(header []string, columns []any, text string) any {
+	col := slices.Index(header, "Budget")
+	if col < 0 {
+		return text
+	}
+	colors := make([]any, len(columns))
+	for j := range columns {
+		colors[j] = text
+	}
+	statuses := columns[col].([]string)
+	cells := make([]string, len(statuses))
+	for i, status := range statuses {
+		switch status {
+		case budgetFail:
+			cells[i] = exceededColor
+		case budgetWarn:
+			cells[i] = warnColor
+		case budgetOK:
+			cells[i] = okColor
+		default:
+			cells[i] = text
+		}
+	}
+	colors[col] = cells
+	return colors
+}
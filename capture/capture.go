@@ -0,0 +1,195 @@
+// Package capture records container stats around a piece of code, typically
+// an integration test, and returns per-container summaries to assert on.
+//
+// It runs the cstats binary ("cstats daemon" while capturing, then "cstats
+// summary --format json"), so the cstats command must be installed
+// (go install github.com/saveugene/cstats/cmd/cstats@latest):
+//
+//	c, err := capture.StartCapture(ctx, capture.Options{Args: []string{"--compose-project", "it"}})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	runLoadTest(t)
+//	sums, err := c.Stop()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	if s := sums["it-api-1"]; s.MemMaxMB > 512 {
+//		t.Errorf("api peaked at %.0f MB", s.MemMaxMB)
+//	}
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a capture. The zero value samples all Docker
+// containers every second into a temporary file.
+type Options struct {
+	Binary   string        // cstats executable (default "cstats" from PATH)
+	Backend  string        // daemon backend: docker (default) or kubernetes
+	Interval time.Duration // sampling interval, rounded to whole seconds (default 1s)
+	Outfile  string        // capture CSV to keep (default: a temporary file removed by Stop)
+	Args     []string      // extra daemon flags, e.g. --compose-project or --namespace
+}
+
+// Summary is the summary of one container, as printed by
+// "cstats summary --format json". Memory is in MB.
+type Summary struct {
+	Container      string  `json:"container"`
+	Samples        int     `json:"samples"`
+	CPUAvgPct      float64 `json:"cpu_avg_pct"`
+	CPUP50Pct      float64 `json:"cpu_p50_pct"`
+	CPUP95Pct      float64 `json:"cpu_p95_pct"`
+	CPUP99Pct      float64 `json:"cpu_p99_pct"`
+	CPUMaxPct      float64 `json:"cpu_max_pct"`
+	MemAvgMB       float64 `json:"mem_avg_mb"`
+	MemP50MB       float64 `json:"mem_p50_mb"`
+	MemP95MB       float64 `json:"mem_p95_mb"`
+	MemP99MB       float64 `json:"mem_p99_mb"`
+	MemMaxMB       float64 `json:"mem_max_mb"`
+	MemLimitMB     float64 `json:"mem_limit_mb"`
+	MemPctMax      float64 `json:"mem_pct_max"`
+	CPUCoreSeconds float64 `json:"cpu_core_seconds"`
+	MemMBHours     float64 `json:"mem_mb_hours"`
+}
+
+// Capture is a running capture.
+type Capture struct {
+	opts   Options
+	temp   string // directory to remove, when Outfile was not given
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	done   chan error
+
+	stopOnce sync.Once
+	sums     map[string]Summary
+	err      error
+}
+
+// StartCapture starts the daemon and returns once it is collecting. ctx
+// bounds the start only; stop the capture with Stop.
+func StartCapture(ctx context.Context, opts Options) (*Capture, error) {
+	if opts.Binary == "" {
+		opts.Binary = "cstats"
+	}
+	if opts.Backend == "" {
+		opts.Backend = "docker"
+	}
+	c := &Capture{opts: opts, done: make(chan error, 1)}
+	if c.opts.Outfile == "" {
+		dir, err := os.MkdirTemp("", "cstats-capture-")
+		if err != nil {
+			return nil, err
+		}
+		c.temp = dir
+		c.opts.Outfile = filepath.Join(dir, "capture.csv")
+	}
+	secs := max(int(opts.Interval.Round(time.Second)/time.Second), 1)
+	args := append([]string{"daemon", opts.Backend, "--interval", strconv.Itoa(secs), "--outfile", c.opts.Outfile}, opts.Args...)
+	c.cmd = exec.Command(opts.Binary, args...)
+	c.cmd.Stderr = &c.stderr
+	stdout, err := c.cmd.StdoutPipe()
+	if err != nil {
+		c.cleanup()
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		c.cleanup()
+		return nil, fmt.Errorf("start %s: %w", opts.Binary, err)
+	}
+
+	// The daemon announces "Collecting ..." right before its first sample.
+	ready := make(chan bool, 1)
+	go func() {
+		sc := bufio.NewScanner(stdout)
+		announced := false
+		for sc.Scan() {
+			if !announced && strings.HasPrefix(sc.Text(), "Collecting ") {
+				announced = true
+				ready <- true
+			}
+		}
+		if !announced {
+			ready <- false
+		}
+		io.Copy(io.Discard, stdout)
+		c.done <- c.cmd.Wait()
+	}()
+	select {
+	case ok := <-ready:
+		if ok {
+			return c, nil
+		}
+		err := <-c.done
+		c.cleanup()
+		return nil, fmt.Errorf("cstats daemon exited: %v: %s", err, strings.TrimSpace(c.stderr.String()))
+	case <-ctx.Done():
+		c.cmd.Process.Kill()
+		<-c.done
+		c.cleanup()
+		return nil, ctx.Err()
+	}
+}
+
+// Path is the capture CSV. A temporary one is removed by Stop; set Outfile
+// to keep it as a test artifact.
+func (c *Capture) Path() string { return c.opts.Outfile }
+
+// Stop stops the daemon, which flushes its last samples, and returns the
+// summaries by container. Later calls return the same result.
+func (c *Capture) Stop() (map[string]Summary, error) {
+	c.stopOnce.Do(func() {
+		c.sums, c.err = c.stop()
+		c.cleanup()
+	})
+	return c.sums, c.err
+}
+
+func (c *Capture) stop() (map[string]Summary, error) {
+	if err := c.cmd.Process.Signal(os.Interrupt); err != nil {
+		c.cmd.Process.Kill()
+	}
+	select {
+	case <-c.done:
+	case <-time.After(10 * time.Second):
+		c.cmd.Process.Kill()
+		<-c.done
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.opts.Binary, "summary", "--format", "json", c.opts.Outfile)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cstats summary: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var list []Summary
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("cstats summary: %w", err)
+	}
+	sums := make(map[string]Summary, len(list))
+	for _, s := range list {
+		sums[s.Container] = s
+	}
+	return sums, nil
+}
+
+// cleanup removes the temporary capture, if any.
+func (c *Capture) cleanup() {
+	if c.temp != "" {
+		os.RemoveAll(c.temp)
+	}
+}
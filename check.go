@@ -0,0 +1,341 @@
+package cstats
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// budgetMetrics are the metrics a budget can cap, named as in the summary
+// JSON. Memory is in MB whatever --units says.
+var budgetMetrics = map[string]func(s *containerStats) float64{
+	"cpu_avg_pct":      (*containerStats).CPUAvg,
+	"cpu_p50_pct":      func(s *containerStats) float64 { return s.CPUP50 },
+	"cpu_p95_pct":      func(s *containerStats) float64 { return s.CPUP95 },
+	"cpu_p99_pct":      func(s *containerStats) float64 { return s.CPUP99 },
+	"cpu_max_pct":      func(s *containerStats) float64 { return s.CPUMax },
+	"mem_avg_mb":       (*containerStats).MemAvg,
+	"mem_p50_mb":       func(s *containerStats) float64 { return s.MemP50 },
+	"mem_p95_mb":       func(s *containerStats) float64 { return s.MemP95 },
+	"mem_p99_mb":       func(s *containerStats) float64 { return s.MemP99 },
+	"mem_max_mb":       func(s *containerStats) float64 { return s.MemMax },
+	"mem_pct_max":      func(s *containerStats) float64 { return s.MemPctMax },
+	"cpu_core_seconds": func(s *containerStats) float64 { return s.CPUCoreSeconds },
+	"mem_mb_hours":     func(s *containerStats) float64 { return s.MemMBHours },
+}
+
+// budgetRule caps a metric of the containers matching a glob.
+type budgetRule struct {
+	Pattern string // path.Match glob of container names
+	Metric  string
+	Limit   float64
+	Warn    float64 // fraction of Limit from which a value warns; 0 = never
+}
+
+func (b budgetRule) String() string {
+	return fmt.Sprintf("%s <= %s", b.Metric, strconv.FormatFloat(b.Limit, 'f', -1, 64))
+}
+
+// parseBudget parses a --budget rule, "[container:]metric=limit"; without a
+// container it applies to all of them.
+func parseBudget(spec string) (budgetRule, error) {
+	b := budgetRule{Pattern: "*"}
+	rule := spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		b.Pattern, rule = spec[:i], spec[i+1:]
+		if _, err := path.Match(b.Pattern, ""); err != nil {
+			return b, fmt.Errorf("invalid --budget %q: bad pattern: %w", spec, err)
+		}
+	}
+	metric, limit, ok := strings.Cut(rule, "=")
+	b.Metric = strings.TrimSpace(metric)
+	if !ok {
+		return b, fmt.Errorf("invalid --budget %q, want [container:]metric=limit", spec)
+	}
+	if _, ok := budgetMetrics[b.Metric]; !ok {
+		return b, fmt.Errorf("invalid --budget %q: unknown metric %q (use %s)", spec, b.Metric,
+			strings.Join(slices.Sorted(maps.Keys(budgetMetrics)), ", "))
+	}
+	var err error
+	if b.Limit, err = strconv.ParseFloat(strings.TrimSpace(limit), 64); err != nil {
+		return b, fmt.Errorf("invalid --budget %q: %w", spec, err)
+	}
+	return b, nil
+}
+
+// budgetResult is one rule checked against one container. A rule matching
+// no container is a failed result with an empty Container.
+type budgetResult struct {
+	Rule      budgetRule
+	Container string
+	Value     float64
+	Failed    bool
+	Warned    bool // close to the limit, not over it
+	Message   string
+}
+
+// checkBudgets checks every rule against every container it matches.
+func checkBudgets(rules []budgetRule, containers []string, stats map[string]*containerStats) []budgetResult {
+	var results []budgetResult
+	for _, b := range rules {
+		matched := false
+		for _, c := range containers {
+			if ok, _ := path.Match(b.Pattern, c); !ok {
+				continue
+			}
+			matched = true
+			v := budgetMetrics[b.Metric](stats[c])
+			r := budgetResult{Rule: b, Container: c, Value: v, Failed: v > b.Limit}
+			r.Warned = !r.Failed && b.Warn > 0 && v >= b.Limit*b.Warn
+			switch {
+			case r.Failed:
+				r.Message = fmt.Sprintf("%s of %s is %.2f, over the budget of %s", b.Metric, c, v, strconv.FormatFloat(b.Limit, 'f', -1, 64))
+			case r.Warned:
+				r.Message = fmt.Sprintf("%s of %s is %.2f, %.0f%% of the budget of %s", b.Metric, c, v, v/b.Limit*100, strconv.FormatFloat(b.Limit, 'f', -1, 64))
+			}
+			results = append(results, r)
+		}
+		if !matched {
+			results = append(results, budgetResult{Rule: b, Failed: true,
+				Message: fmt.Sprintf("no container matches %q", b.Pattern)})
+		}
+	}
+	return results
+}
+
+// writeCheckText prints one PASS/WARN/FAIL line per result and a total.
+func writeCheckText(w io.Writer, results []budgetResult) error {
+	failed, warned := 0, 0
+	for _, r := range results {
+		status := "PASS"
+		switch {
+		case r.Failed:
+			status = "FAIL"
+			failed++
+		case r.Warned:
+			status = "WARN"
+			warned++
+		}
+		if r.Container == "" {
+			fmt.Fprintf(w, "%s  %s  %s: %s\n", status, r.Rule.Pattern, r.Rule, r.Message)
+			continue
+		}
+		fmt.Fprintf(w, "%s  %s  %s (%.2f)\n", status, r.Container, r.Rule, r.Value)
+	}
+	if warned > 0 {
+		_, err := fmt.Fprintf(w, "%d of %d budget checks failed, %d close to the budget\n", failed, len(results), warned)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d of %d budget checks failed\n", failed, len(results))
+	return err
+}
+
+// writeCheckMarkdown renders results as a Markdown table, failures first and
+// warnings next, followed by the resource usage they were checked against.
+func writeCheckMarkdown(w io.Writer, name string, results []budgetResult, containers []string, stats map[string]*containerStats) error {
+	failed := 0
+	for _, r := range results {
+		if r.Failed {
+			failed++
+		}
+	}
+	fmt.Fprintf(w, "### Resource budgets: %s\n\n%d of %d checks failed.\n\n", name, failed, len(results))
+	fmt.Fprintln(w, "| | Container | Budget | Value |")
+	fmt.Fprintln(w, "| :---: | :--- | :--- | ---: |")
+	sorted := slices.Clone(results)
+	rank := func(r budgetResult) int {
+		switch {
+		case r.Failed:
+			return 0
+		case r.Warned:
+			return 1
+		}
+		return 2
+	}
+	slices.SortStableFunc(sorted, func(a, b budgetResult) int { return rank(a) - rank(b) })
+	for _, r := range sorted {
+		mark, container, value := "✅", r.Container, fmt.Sprintf("%.2f", r.Value)
+		switch {
+		case r.Failed:
+			mark = "❌"
+		case r.Warned:
+			mark = "⚠️"
+		}
+		if container == "" {
+			container, value = r.Rule.Pattern, "no match"
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", mark, strings.ReplaceAll(container, "|", `\|`), r.Rule, value)
+	}
+	fmt.Fprintln(w)
+	if err := writeSummary(w, "md", containers, stats); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// JUnit XML in the shape CI systems (Jenkins, GitLab, GitHub test reporters)
+// accept: one suite per capture, one test case per container and rule.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeCheckJUnit renders results as a JUnit XML report named after the
+// capture.
+func writeCheckJUnit(w io.Writer, name string, results []budgetResult) error {
+	suite := junitSuite{Name: "cstats check " + name, Tests: len(results), Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05")}
+	for _, r := range results {
+		c := junitCase{Classname: "cstats." + r.Container, Name: r.Rule.String()}
+		if r.Container == "" {
+			c.Classname = "cstats." + r.Rule.Pattern
+		}
+		if r.Failed {
+			suite.Failures++
+			c.Failure = &junitFailure{Message: r.Message, Type: "budget", Text: r.Message}
+		} else {
+			c.SystemOut = fmt.Sprintf("%s = %.2f", r.Rule.Metric, r.Value)
+			if r.Warned {
+				c.SystemOut = "WARN: " + r.Message
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// captureStats loads a finished capture through the view flags and
+// returns its sorted containers and stats, exiting on errors.
+func captureStats(csvPath string, view *viewFlags) ([]string, map[string]*containerStats) {
+	records, err := loadFinishedCSV(csvPath)
+	if err != nil {
+		log.Fatalf("Error reading CSV: %v", err)
+	}
+	stats := computeStats(view.apply(records))
+	if len(stats) == 0 {
+		log.Fatalf("No samples in %s", csvPath)
+	}
+	applyInterval(stats, captureInterval(csvPath))
+	return slices.Sorted(maps.Keys(stats)), stats
+}
+
+func runCheck(args []string) {
+	fs := newFlagSet("check")
+	csvPath := fs.String("csv", "docker-stats.csv", "Path or http(s) URL of the CSV file")
+	var specs stringList
+	fs.Var(&specs, "budget", "Budget rule `[container:]metric=limit`, e.g. cpu_p95_pct=80 or 'api-*:mem_max_mb=512' (repeatable; metrics as in summary --format json, memory in MB)")
+	budgetsFile := budgetsFlag(fs)
+	format := fs.String("format", "text", "Report format: text or junit")
+	out := fs.String("out", "", "Write the report to this file instead of stdout")
+	remoteFlags(fs)
+	view := registerViewFlags(fs)
+	strictFlag(fs)
+	dedupeFlag(fs)
+	githubFlag(fs)
+	parseFlags(fs, args)
+	if fs.NArg() > 0 {
+		*csvPath = fs.Arg(0)
+	}
+	if err := view.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *format != "text" && *format != "junit" {
+		log.Fatalf("--format must be text or junit, got %q", *format)
+	}
+	if githubMode && *format == "junit" && *out == "" {
+		log.Fatal("--github annotates on stdout; write the JUnit report with --out")
+	}
+	if len(specs) == 0 && *budgetsFile == "" {
+		log.Fatal("No budgets given; use --budget metric=limit or --budgets file")
+	}
+	rules := mustLoadBudgets(*budgetsFile)
+	for _, spec := range specs {
+		rule, err := parseBudget(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+
+	containers, stats := captureStats(*csvPath, view)
+	results := checkBudgets(rules, containers, stats)
+	applyBudgets(stats, rules)
+
+	var err error
+	write := func(w io.Writer) error {
+		if *format == "junit" {
+			return writeCheckJUnit(w, *csvPath, results)
+		}
+		return writeCheckText(w, results)
+	}
+	if *out == "" {
+		err = write(os.Stdout)
+	} else {
+		var f *os.File
+		if f, err = os.Create(*out); err == nil {
+			err = write(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if githubMode {
+		for _, r := range results {
+			switch {
+			case r.Failed:
+				githubAnnotate("error", "Resource budget", r.Message)
+			case r.Warned:
+				githubAnnotate("warning", "Resource budget", r.Message)
+			}
+		}
+		githubSamplingWarnings(samplingReport(containers, stats))
+		err := githubStepSummary(func(w io.Writer) error {
+			return writeCheckMarkdown(w, *csvPath, results, containers, stats)
+		})
+		if err != nil {
+			warnf("%v", err)
+		}
+	}
+	if slices.ContainsFunc(results, func(r budgetResult) bool { return r.Failed }) {
+		os.Exit(1)
+	}
+}
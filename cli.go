@@ -0,0 +1,207 @@
+// Package cstats is the cstats command line: collecting container stats
+// (daemon, monitor, agent), and plotting, summarizing and serving captures.
+// The command itself is cmd/cstats; a build of it with extra collectors or
+// sinks imports their packages and calls Main (see the collector package).
+package cstats
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// command is a cstats subcommand.
+type command struct {
+	name string
+	help string
+	run  func(args []string)
+}
+
+var commands = []command{
+	{"plot", "HTML/Plotly dashboard (one-shot or live server)", runPlot},
+	{"term", "Terminal UI dashboard", runTerm},
+	{"summary", "Print per-container summary statistics", runSummary},
+	{"check", "Check summary statistics against resource budgets", runCheck},
+	{"diff", "Compare a capture with a baseline summary, or update it", runDiff},
+	{"mark", "Append a timestamped event marker for the dashboards", runMark},
+	{"daemon", "Collect container stats (docker or kubernetes)", runDaemon},
+	{"monitor", "Collect and serve the live dashboard in one process", runMonitor},
+	{"agent", "Collect and push the samples to an aggregator", runAgent},
+	{"aggregator", "Receive samples from agents and serve the fleet dashboard", runAggregator},
+}
+
+// Log levels of --log-level. Warnings are the problems cstats works around
+// (skipped rows, lost backends); debug is the per-sample chatter of --debug.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]logLevel{"debug": levelDebug, "info": levelInfo, "warn": levelWarn, "error": levelError}
+
+// Global flags, accepted before the command and by every command.
+var (
+	configPath   = os.Getenv("CSTATS_CONFIG")
+	logLevelName = "info"
+	minLevel     = levelInfo
+	noColor      = os.Getenv("NO_COLOR") != ""
+)
+
+// globalFlags registers the global flags on fs, keeping the values given
+// before the command as defaults.
+func globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configPath, "config", configPath, "Config `file` of default flag values: key = value lines, optionally under [command] sections (default $CSTATS_CONFIG)")
+	fs.StringVar(&logLevelName, "log-level", logLevelName, "Log messages at or above this level: debug, info, warn or error")
+	fs.BoolVar(&noColor, "no-color", noColor, "Draw the terminal UI without colors ($NO_COLOR)")
+}
+
+func infof(format string, args ...any) {
+	if minLevel <= levelInfo {
+		log.Printf(format, args...)
+	}
+}
+
+func warnf(format string, args ...any) {
+	if minLevel <= levelWarn {
+		log.Printf(format, args...)
+	}
+}
+
+// newFlagSet returns the flag set of a command, with the global flags and a
+// usage message naming the command. Parse it with parseFlags.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cstats %s [flags]\n\nFlags:\n", name)
+		fs.PrintDefaults()
+	}
+	globalFlags(fs)
+	return fs
+}
+
+// parseFlags parses a command's arguments, fills the flags not given from
+// --config and applies the global flags.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if err := applyConfig(fs); err != nil {
+		log.Fatal(err)
+	}
+	applyGlobals()
+}
+
+// applyGlobals checks and applies the global flags.
+func applyGlobals() {
+	level, ok := logLevels[logLevelName]
+	if !ok {
+		log.Fatalf("--log-level must be debug, info, warn or error, got %q", logLevelName)
+	}
+	minLevel = level
+}
+
+// applyConfig sets the flags of fs not given on the command line from the
+// config file: keys before any section apply to every command having that
+// flag, keys in a [name] section only to that command (and [daemon] to all
+// daemons). An unknown key is an error only in the command's own section.
+func applyConfig(fs *flag.FlagSet) error {
+	given := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { given[fl.Name] = true })
+	return applyConfigExcept(fs, given)
+}
+
+// applyConfigExcept is applyConfig for flags given by other means than
+// parsing fs (daemon --sources).
+func applyConfigExcept(fs *flag.FlagSet, given map[string]bool) error {
+	if configPath == "" {
+		return nil
+	}
+	f, err := os.Open(configPath)
+	if err != nil {
+		return fmt.Errorf("--config: %w", err)
+	}
+	defer f.Close()
+
+	section, lineNo := "", 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" {
+			return fmt.Errorf("%s:%d: want key = value, got %q", configPath, lineNo, line)
+		}
+		mine := section == fs.Name() || strings.HasPrefix(fs.Name(), section+" ")
+		if section != "" && !mine {
+			continue
+		}
+		if fs.Lookup(k) == nil {
+			if section == fs.Name() {
+				return fmt.Errorf("%s:%d: cstats %s has no flag --%s", configPath, lineNo, fs.Name(), k)
+			}
+			continue
+		}
+		if given[k] || k == "config" {
+			continue
+		}
+		if err := fs.Set(k, v); err != nil {
+			return fmt.Errorf("%s:%d: --%s: %w", configPath, lineNo, k, err)
+		}
+	}
+	return sc.Err()
+}
+
+func usage() {
+	var cmds strings.Builder
+	for _, c := range commands {
+		fmt.Fprintf(&cmds, "  %-8s%s\n", c.name, c.help)
+	}
+	global := flag.NewFlagSet("cstats", flag.ContinueOnError)
+	globalFlags(global)
+	global.SetOutput(os.Stderr)
+	fmt.Fprintf(os.Stderr, `Usage: cstats [global flags] <command> [flags]
+
+Commands:
+%s
+Global flags (also accepted after the command):
+`, cmds.String())
+	global.PrintDefaults()
+	fmt.Fprintf(os.Stderr, `
+Run "cstats <command> -h" for command-specific flags.
+`)
+	os.Exit(1)
+}
+
+// Main runs the cstats command line, with the collectors and sinks
+// registered by the packages the program imports besides the built-in ones.
+func Main() {
+	global := flag.NewFlagSet("cstats", flag.ExitOnError)
+	global.Usage = usage
+	globalFlags(global)
+	global.Parse(os.Args[1:])
+	args := global.Args()
+	if len(args) == 0 || args[0] == "help" {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			c.run(args[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+	usage()
+}
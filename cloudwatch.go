@@ -0,0 +1,212 @@
+package cstats
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saveugene/cstats/sink"
+)
+
+// cwMaxDatums is the most metric datums PutMetricData takes per call.
+const cwMaxDatums = 1000
+
+// cwDatum is a metric datum of PutMetricData.
+type cwDatum struct {
+	Name  string
+	Unit  string
+	Value float64
+	Time  time.Time
+	Dims  [][2]string
+}
+
+// cloudwatchSink puts samples to CloudWatch as custom metrics in a
+// namespace, one dimension set per container. Datums are batched until batch
+// of them are buffered or every has passed since the last submission.
+type cloudwatchSink struct {
+	endpoint  string
+	region    string
+	namespace string
+	dims      []string // container, host, or a capture column; Name=Value is fixed
+	host      string
+	batch     int
+	every     time.Duration
+	creds     *awsCredentials
+	client    *http.Client
+
+	buf  []cwDatum
+	last time.Time
+}
+
+func openCloudWatchSink(arg string) (*cloudwatchSink, error) {
+	opts, err := parseSinkArgs(arg, "namespace", "region", "endpoint", "dim", "batch", "every")
+	if err != nil {
+		return nil, err
+	}
+	s := &cloudwatchSink{
+		namespace: "cstats",
+		dims:      []string{"container", "host"},
+		batch:     cwMaxDatums,
+		every:     time.Minute,
+		client:    &http.Client{Timeout: apiTimeout},
+		last:      time.Now(),
+	}
+	if v := opts.Get("namespace"); v != "" {
+		s.namespace = v
+	}
+	if d := opts["dim"]; len(d) > 0 {
+		s.dims = d
+	}
+	if len(s.dims) > 30 {
+		return nil, fmt.Errorf("at most 30 dimensions, got %d", len(s.dims))
+	}
+	if v := opts.Get("batch"); v != "" {
+		if s.batch, err = strconv.Atoi(v); err != nil || s.batch < 1 {
+			return nil, fmt.Errorf("batch must be a positive number of datums, got %q", v)
+		}
+	}
+	if v := opts.Get("every"); v != "" {
+		if s.every, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("every: %w", err)
+		}
+	}
+	s.creds = &awsCredentials{client: s.client}
+	s.region = cmp.Or(opts.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+	if s.region == "" {
+		// On EC2 the instance knows its region.
+		if s.region, err = s.creds.metadata("placement/region"); err != nil {
+			return nil, errors.New("no AWS region; set AWS_REGION or region=")
+		}
+	}
+	s.endpoint = cmp.Or(opts.Get("endpoint"), "https://monitoring."+s.region+".amazonaws.com/")
+	if _, err := s.creds.get(); err != nil {
+		return nil, err
+	}
+	s.host, _ = os.Hostname()
+	return s, nil
+}
+
+// dimensions returns the dimensions of a sample. Missing values are left
+// out, since CloudWatch rejects empty ones.
+func (s *cloudwatchSink) dimensions(r record) [][2]string {
+	var out [][2]string
+	for _, d := range s.dims {
+		name, value, fixed := strings.Cut(d, "=")
+		switch {
+		case fixed:
+		case d == "container":
+			name, value = "ContainerName", r.Container
+		case d == "host":
+			name, value = "Host", cmp.Or(r.Attrs["host"], s.host)
+		default:
+			value = r.Attrs[d]
+		}
+		if value != "" {
+			out = append(out, [2]string{name, value})
+		}
+	}
+	return out
+}
+
+func (s *cloudwatchSink) Write(r record) error {
+	dims := s.dimensions(r)
+	for _, m := range []struct {
+		name, unit string
+		v          float64
+	}{
+		{"CPUPercent", "Percent", r.CPUPct},
+		{"MemoryUsage", "Megabytes", r.MemUsageMB},
+		{"MemoryLimit", "Megabytes", r.MemLimitMB},
+		{"MemoryPercent", "Percent", r.MemPct},
+	} {
+		s.buf = append(s.buf, cwDatum{Name: m.name, Unit: m.unit, Value: m.v, Time: r.Timestamp, Dims: dims})
+	}
+	return nil
+}
+
+// Flush puts the buffered datums once the batch is full or due.
+func (s *cloudwatchSink) Flush() error {
+	if len(s.buf) < s.batch && time.Since(s.last) < s.every {
+		return nil
+	}
+	return s.submit()
+}
+
+func (s *cloudwatchSink) Close() error { return s.submit() }
+
+// submit puts the buffered datums, cwMaxDatums per call. They are dropped
+// on failure, so an unreachable API does not grow the buffer without bound.
+func (s *cloudwatchSink) submit() error {
+	s.last = time.Now()
+	buf := s.buf
+	s.buf = nil
+	for len(buf) > 0 {
+		n := min(len(buf), cwMaxDatums)
+		if err := s.put(buf[:n]); err != nil {
+			return fmt.Errorf("cloudwatch: %w (%d datums dropped)", err, len(buf))
+		}
+		logf("cloudwatch: put %d datums", n)
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// put calls PutMetricData through the query API.
+func (s *cloudwatchSink) put(data []cwDatum) error {
+	form := neturl.Values{
+		"Action":    {"PutMetricData"},
+		"Version":   {"2010-08-01"},
+		"Namespace": {s.namespace},
+	}
+	for i, d := range data {
+		p := fmt.Sprintf("MetricData.member.%d.", i+1)
+		form.Set(p+"MetricName", d.Name)
+		form.Set(p+"Unit", d.Unit)
+		form.Set(p+"Value", strconv.FormatFloat(d.Value, 'f', -1, 64))
+		form.Set(p+"Timestamp", d.Time.UTC().Format(time.RFC3339))
+		for j, dim := range d.Dims {
+			form.Set(fmt.Sprintf("%sDimensions.member.%d.Name", p, j+1), dim[0])
+			form.Set(fmt.Sprintf("%sDimensions.member.%d.Value", p, j+1), dim[1])
+		}
+	}
+	body := form.Encode()
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds, err := s.creds.get()
+	if err != nil {
+		return err
+	}
+	signAWSv4(req, body, creds, s.region, "monitoring", time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		if m := awsErrorMessage.FindSubmatch(msg); m != nil {
+			msg = m[1]
+		}
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func init() {
+	sink.Register(sink.Kind{
+		Name:   "cloudwatch",
+		Help:   "custom metrics via CloudWatch PutMetricData (credentials as for the AWS CLI: environment, web identity, profile, ECS task or EC2 instance role); arg: namespace=, region=, endpoint=, dim=container|host|<column>|Name=Value (repeatable), batch=<datums>, every=<duration>",
+		Remote: true,
+		Open:   func(arg string, cols []string) (sink.Sink, error) { return openCloudWatchSink(arg) },
+	})
+}
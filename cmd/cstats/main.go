@@ -0,0 +1,7 @@
+// Command cstats collects, plots and summarizes container resource usage.
+// Run "cstats help" for the commands.
+package main
+
+import "github.com/saveugene/cstats"
+
+func main() { cstats.Main() }
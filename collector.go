@@ -0,0 +1,209 @@
+package cstats
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/saveugene/cstats/collector"
+	"github.com/saveugene/cstats/sink"
+)
+
+// collectorUsage lists the backends for usage messages.
+func collectorUsage() string {
+	var b strings.Builder
+	for _, k := range collector.Kinds() {
+		fmt.Fprintf(&b, "  %-12s %s\n", k.Name, k.Help)
+	}
+	return b.String()
+}
+
+// collectorNames is "docker|kubernetes|..." for usage lines.
+func collectorNames() string {
+	kinds := collector.Kinds()
+	names := make([]string, len(kinds))
+	for i, k := range kinds {
+		names[i] = k.Name
+	}
+	return strings.Join(names, "|")
+}
+
+// collectorCommand resolves the backend subcommand of daemon and monitor
+// from args. Without a known one it prints the usage, listing every
+// backend with the flags register adds for it, and exits.
+func collectorCommand(cmd, intro string, args []string, register func(fs *flag.FlagSet, kind collector.Kind)) collector.Kind {
+	if len(args) > 0 {
+		if kind, ok := collector.Lookup(args[0]); ok {
+			return kind
+		}
+	}
+	help := len(args) > 0 && slices.Contains([]string{"-h", "-help", "--help", "help"}, args[0])
+	if len(args) > 0 && !help {
+		fmt.Fprintf(os.Stderr, "Unknown %s subcommand: %s\n\n", cmd, args[0])
+	}
+	fmt.Fprintf(os.Stderr, "Usage: cstats %s <%s> [flags]\n\n%sSubcommands:\n%s", cmd, collectorNames(), intro, collectorUsage())
+	for _, k := range collector.Kinds() {
+		fs := flag.NewFlagSet(cmd+" "+k.Name, flag.ContinueOnError)
+		fs.SetOutput(os.Stderr)
+		register(fs, k)
+		fmt.Fprintf(os.Stderr, "\nFlags of cstats %s %s:\n", cmd, k.Name)
+		fs.PrintDefaults()
+	}
+	fmt.Fprintf(os.Stderr, "\nGlobal flags are listed by \"cstats -h\".\n")
+	if help {
+		os.Exit(0)
+	}
+	os.Exit(1)
+	return collector.Kind{}
+}
+
+// maxBackoff caps the wait between attempts to reach a backend that is
+// down.
+const maxBackoff = time.Minute
+
+// runCollector samples c every interval into outfile, the --sink sinks and
+// sinks until ctx is done. The sinks passed in are closed too.
+func runCollector(ctx context.Context, kind collector.Kind, c collector.Collector, interval int, outfile string, sinks ...sink.Sink) (err error) {
+	if recordSelf {
+		c = withSelf(c)
+	}
+	if closer, ok := c.(io.Closer); ok {
+		defer closer.Close()
+	}
+	defer func() {
+		if cerr := closeSinks(sinks); err == nil {
+			err = cerr
+		}
+	}()
+	cols := c.Columns()
+	capture, err := openCSVSink(outfile, cols)
+	if err != nil {
+		return err
+	}
+	extra, err := openSinks(cols)
+	if err != nil {
+		capture.Close()
+		return err
+	}
+	sinks = append(append([]sink.Sink{capture}, extra...), sinks...)
+	if err := writeCaptureMeta(outfile, kind.Name, time.Duration(interval)*time.Second); err != nil {
+		warnf("capture metadata: %v", err)
+	}
+
+	if r, ok := c.(collector.EventReporter); ok {
+		r.ReportEvents(func(ev event) {
+			if err := queueEvent(eventsPath(outfile), ev, strings.ToLower(kind.Title)); err != nil {
+				warnf("events: %v", err)
+			}
+		})
+	}
+
+	fmt.Printf("Collecting %s stats every %ds -> %s (Ctrl+C to stop)\n", kind.Title, interval, outfile)
+	logf("%s daemon started: interval=%ds, outfile=%s", kind.Title, interval, outfile)
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	// While the backend is down, ticks only try to reach it again, backing
+	// off up to maxBackoff. The outage is marked in the events file so the
+	// dashboard explains the gap.
+	var lostAt, retryAt time.Time
+	var backoff time.Duration
+	mark := func(what string) {
+		label := strings.ToLower(kind.Backend) + " " + what
+		if err := queueEvent(eventsPath(outfile), event{Timestamp: time.Now(), Label: label}, "alert"); err != nil {
+			warnf("events: %v", err)
+		}
+	}
+	retry := func() {
+		backoff = min(2*backoff, maxBackoff)
+		retryAt = time.Now().Add(backoff)
+	}
+
+	skipped := 0 // implausible samples not written
+	collect := func() {
+		if ctx.Err() != nil {
+			return
+		}
+		if !lostAt.IsZero() {
+			if time.Now().Before(retryAt) {
+				return
+			}
+			if r, ok := c.(collector.Reconnector); ok {
+				if err := r.Reconnect(ctx); err != nil {
+					logf("reconnect: %v", err)
+					retry()
+					return
+				}
+			}
+		}
+		names, err := c.Discover(ctx)
+		if err != nil && ctx.Err() == nil && errors.Is(err, collector.ErrUnreachable) {
+			if lostAt.IsZero() {
+				lostAt = time.Now()
+				backoff = time.Duration(interval) * time.Second
+				retryAt = lostAt.Add(backoff)
+				warnf("Lost the %s (%v); reconnecting in the background", kind.Backend, err)
+				mark("unreachable")
+			} else {
+				retry()
+			}
+			return
+		}
+		if err != nil {
+			logf("discover: %v", err)
+			return
+		}
+		if !lostAt.IsZero() {
+			infof("Reconnected to the %s after %s", kind.Backend, time.Since(lostAt).Round(time.Second))
+			mark("reconnected")
+			lostAt = time.Time{}
+		}
+		logf("discovered %d containers", len(names))
+
+		samples, err := c.Sample(ctx)
+		if err != nil {
+			logf("sample: %v", err)
+			return
+		}
+		ts := time.Now().UTC().Truncate(time.Second)
+		for _, r := range samples {
+			if why := implausible(r.CPUPct, r.MemUsageMB, r.MemLimitMB, r.MemPct); why != "" {
+				skipped++
+				warnf("skipped implausible sample of %s (%s), %d so far", r.Container, why, skipped)
+				continue
+			}
+			r.Timestamp = ts
+			for _, s := range sinks {
+				if err := s.Write(r); err != nil {
+					warnf("sink: %v", err)
+				}
+			}
+			logf("  %s  cpu=%.2f%%  mem=%.1f/%.1f MB (%.2f%%)",
+				r.Container, r.CPUPct, r.MemUsageMB, r.MemLimitMB, r.MemPct)
+		}
+		for _, s := range sinks {
+			if err := s.Flush(); err != nil {
+				warnf("sink: %v", err)
+			}
+		}
+	}
+
+	// Collect immediately, then on ticker.
+	collect()
+	for {
+		select {
+		case <-ctx.Done():
+			logf("%s daemon stopped", kind.Title)
+			return nil
+		case <-ticker.C:
+			collect()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package collector is the plug-in point for the stats backends of
+// "cstats daemon" and "cstats monitor". Docker, Kubernetes and the kubelet
+// are built in; another backend (Nomad, an appliance, ...) lives in a
+// package of its own that calls Register from an init function. A main
+// package importing it and calling cstats.Main builds a cstats with the
+// backend added:
+//
+//	package main
+//
+//	import (
+//		"github.com/saveugene/cstats"
+//		_ "example.com/cstats-nomad"
+//	)
+//
+//	func main() { cstats.Main() }
+//
+// Registered backends share the collection loop, the capture CSV and sinks,
+// and the handling of outages.
+package collector
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"slices"
+	"time"
+)
+
+// Record is one sample of a container.
+type Record struct {
+	Timestamp  time.Time
+	Container  string
+	CPUPct     float64
+	MemUsageMB float64
+	MemLimitMB float64
+	MemPct     float64
+	// Extra holds optional numeric columns beyond the standard header
+	// (net_rx_mb, blkio_read_mb, pids, ...), keyed by column name.
+	Extra map[string]float64
+	// Attrs holds optional non-numeric columns (label_<key>, ...).
+	Attrs map[string]string
+}
+
+// Event is a timestamped marker (deploy, test phase, OOM kill, ...) drawn
+// over the time-series panels.
+type Event struct {
+	Timestamp time.Time
+	Label     string
+}
+
+// Collector is a stats backend.
+type Collector interface {
+	// Columns names the optional columns the samples fill, in CSV order:
+	// text ones in Attrs, numeric ones (cpu_limit_m, ...) in Extra.
+	Columns() []string
+	// Discover finds the containers to sample and returns their names. An
+	// error wrapping ErrUnreachable marks the backend down: it is retried
+	// with backoff (after Reconnect, if the collector is a Reconnector) and
+	// the outage is marked in the events file.
+	Discover(ctx context.Context) ([]string, error)
+	// Sample reads the containers found by the last Discover. The caller
+	// sets the timestamps.
+	Sample(ctx context.Context) ([]Record, error)
+}
+
+// Reconnector is implemented by collectors whose client must be re-created
+// once the backend is back (a restarted dockerd).
+type Reconnector interface {
+	Reconnect(ctx context.Context) error
+}
+
+// EventReporter is implemented by collectors that report what happens to
+// the containers in the backend (an OOM kill, an eviction); the collection
+// loop records it in the events file of the capture.
+type EventReporter interface {
+	ReportEvents(report func(Event))
+}
+
+// A Collector that is an io.Closer is closed when collection stops.
+
+// ErrUnreachable is wrapped by Discover errors meaning the backend is down.
+var ErrUnreachable = errors.New("backend unreachable")
+
+// Kind describes a registered backend.
+type Kind struct {
+	Name    string   // subcommand, e.g. "docker"
+	Aliases []string // other accepted subcommands
+	Title   string   // for messages, e.g. "Docker"
+	Backend string   // for outage messages and events, e.g. "Docker daemon"
+	Help    string   // one-line description for usage
+	Outfile string   // default capture file
+	// Flags registers the backend's flags on fs and returns the function
+	// that builds the collector once fs is parsed.
+	Flags func(fs *flag.FlagSet) func(ctx context.Context) (Collector, error)
+}
+
+// kinds are the registered backends, in registration order.
+var kinds []Kind
+
+// Register makes a backend available to daemon and monitor.
+func Register(k Kind) {
+	kinds = append(kinds, k)
+}
+
+// Lookup returns the backend registered under name or an alias.
+func Lookup(name string) (Kind, bool) {
+	for _, k := range kinds {
+		if k.Name == name || slices.Contains(k.Aliases, name) {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+// Kinds returns the registered backends, in registration order.
+func Kinds() []Kind {
+	return slices.Clone(kinds)
+}
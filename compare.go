@@ -0,0 +1,235 @@
+package cstats
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// runStart returns the earliest timestamp in records, used to align runs on
+// relative elapsed time.
+func runStart(records []record) time.Time {
+	var start time.Time
+	for _, r := range records {
+		if start.IsZero() || r.Timestamp.Before(start) {
+			start = r.Timestamp
+		}
+	}
+	return start
+}
+
+// formatDelta renders "base → cand (+x.x%)" for the compare table.
+func formatDelta(base, cand float64) string {
+	if base == 0 {
+		return fmt.Sprintf("%.1f → %.1f", base, cand)
+	}
+	return fmt.Sprintf("%.1f → %.1f (%+.1f%%)", base, cand, (cand-base)/base*100)
+}
+
+// buildCompareFigure overlays a baseline and a candidate capture on relative
+// elapsed time: baseline traces are dashed, candidate traces solid. A delta
+// table summarizes the per-container change.
+func buildCompareFigure(base, cand []record, opts FigureOptions) map[string]any {
+	th := themeFor(opts.Theme)
+	if len(base) == 0 && len(cand) == 0 {
+		return emptyFigure(th, opts)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range containerNames(base) {
+		seen[c] = true
+	}
+	for _, c := range containerNames(cand) {
+		seen[c] = true
+	}
+	containers := make([]string, 0, len(seen))
+	for c := range seen {
+		containers = append(containers, c)
+	}
+	sort.Strings(containers)
+	u := recordsMemUnit(slices.Concat(base, cand))
+
+	runs := []struct {
+		label   string
+		dash    string
+		start   time.Time
+		grouped map[string][]record
+	}{
+		{"baseline", "dash", runStart(base), groupByContainer(base)},
+		{"candidate", "solid", runStart(cand), groupByContainer(cand)},
+	}
+
+	var traces []map[string]any
+	for i, name := range containers {
+		color := colors[i%len(colors)]
+		for _, run := range runs {
+			recs := run.grouped[name]
+			if len(recs) == 0 {
+				continue
+			}
+			series := func(val func(record) float64) ([]float64, []float64) {
+				idx, ys := downsampleSeries(recs, val, opts.MaxPoints)
+				elapsed := make([]float64, len(idx))
+				for k, j := range idx {
+					elapsed[k] = round1(recs[j].Timestamp.Sub(run.start).Seconds())
+				}
+				return elapsed, ys
+			}
+			label := name + " (" + run.label + ")"
+			panels := []struct {
+				val          func(record) float64
+				hover        string
+				xaxis, yaxis string
+			}{
+				{func(r record) float64 { return r.CPUPct }, "CPU: %{y:.1f}%", "x", "y"},
+				{func(r record) float64 { return u.of(r.MemUsageMB) }, "RAM: " + u.hover(), "x3", "y3"},
+				{func(r record) float64 { return r.MemPct }, "Mem: %{y:.2f}%", "x5", "y5"},
+			}
+			for k, p := range panels {
+				x, y := series(p.val)
+				traces = append(traces, map[string]any{
+					"type":          "scatter",
+					"x":             x,
+					"y":             y,
+					"name":          label,
+					"legendgroup":   label,
+					"showlegend":    k == 0,
+					"mode":          "lines",
+					"line":          map[string]any{"color": color, "width": 1.5, "dash": run.dash},
+					"hovertemplate": "+%{x}s<br>" + p.hover + "<extra>" + label + "</extra>",
+					"xaxis":         p.xaxis,
+					"yaxis":         p.yaxis,
+				})
+			}
+		}
+	}
+
+	// Delta summary table.
+	baseStats := computeStats(base)
+	candStats := computeStats(cand)
+	metrics := []struct {
+		header string
+		val    func(*containerStats) float64
+	}{
+		{"CPU avg%", (*containerStats).CPUAvg},
+		{"CPU p95%", func(s *containerStats) float64 { return s.CPUP95 }},
+		{"CPU max%", func(s *containerStats) float64 { return s.CPUMax }},
+		{"RAM avg MB", func(s *containerStats) float64 { return u.of(s.MemAvg()) }},
+		{"RAM p95 MB", func(s *containerStats) float64 { return u.of(s.MemP95) }},
+		{"RAM max MB", func(s *containerStats) float64 { return u.of(s.MemMax) }},
+	}
+	header := []string{"Container"}
+	columns := []any{containers}
+	for _, m := range metrics {
+		header = append(header, u.label(m.header))
+		col := make([]string, len(containers))
+		for i, c := range containers {
+			b, bok := baseStats[c]
+			k, kok := candStats[c]
+			if !bok || !kok {
+				col[i] = "-"
+				continue
+			}
+			col[i] = formatDelta(m.val(b), m.val(k))
+		}
+		columns = append(columns, col)
+	}
+	if anyImages(baseStats) || anyImages(candStats) {
+		header = append(header, "Image")
+		col := make([]string, len(containers))
+		for i, c := range containers {
+			b, k := "-", "-"
+			if s, ok := baseStats[c]; ok && len(s.Images) > 0 {
+				b = s.image()
+			}
+			if s, ok := candStats[c]; ok && len(s.Images) > 0 {
+				k = s.image()
+			}
+			col[i] = b
+			if k != b {
+				col[i] = b + " → " + k
+			}
+		}
+		columns = append(columns, col)
+	}
+	traces = append(traces, map[string]any{
+		"type": "table",
+		"header": map[string]any{
+			"values": header,
+			"fill":   map[string]any{"color": th.TableHeaderBG},
+			"font":   map[string]any{"color": th.TableHeaderText, "size": 11},
+			"align":  "left",
+		},
+		"cells": map[string]any{
+			"values": columns,
+			"fill":   map[string]any{"color": th.TableCellBG},
+			"font":   map[string]any{"color": th.TableCellText, "size": 10},
+			"align":  "left",
+		},
+		"domain": map[string]any{
+			"x": []float64{0.66, 1.0},
+			"y": []float64{0.0, 1.0},
+		},
+	})
+
+	elapsedAxis := func(anchor string, title bool) map[string]any {
+		ax := map[string]any{
+			"domain":     []float64{0.0, 0.62},
+			"anchor":     anchor,
+			"matches":    "x",
+			"ticksuffix": "s",
+		}
+		if title {
+			ax["title"] = map[string]any{"text": "Elapsed since run start"}
+		}
+		return ax
+	}
+	xaxis := elapsedAxis("y", false)
+	delete(xaxis, "matches")
+
+	layout := map[string]any{
+		"template": th.Template,
+		"title":    figureTitle(opts, " - baseline vs candidate"),
+		"height":   950,
+		"width":    1400,
+		"legend": map[string]any{
+			"orientation": "h",
+			"yanchor":     "bottom",
+			"y":           1.02,
+			"xanchor":     "center",
+			"x":           0.35,
+			"font":        map[string]any{"size": 10},
+		},
+		"hovermode": "x unified",
+		"xaxis":     xaxis,
+		"yaxis": map[string]any{
+			"domain": []float64{0.72, 1.0},
+			"anchor": "x",
+			"title":  map[string]any{"text": "CPU %"},
+		},
+		"xaxis3": elapsedAxis("y3", false),
+		"yaxis3": map[string]any{
+			"domain": []float64{0.36, 0.64},
+			"anchor": "x3",
+			"title":  map[string]any{"text": u.Label},
+		},
+		"xaxis5": elapsedAxis("y5", true),
+		"yaxis5": map[string]any{
+			"domain": []float64{0.0, 0.28},
+			"anchor": "x5",
+			"title":  map[string]any{"text": "Mem %"},
+		},
+		"annotations": []map[string]any{
+			subplotTitle("CPU %", 0.31, 1.0),
+			subplotTitle(u.label("RAM (MB)"), 0.31, 0.64),
+			subplotTitle("Memory % of limit", 0.31, 0.28),
+			subplotTitle("Delta (baseline → candidate)", 0.83, 1.0),
+		},
+	}
+
+	return map[string]any{
+		"data":   traces,
+		"layout": layout,
+	}
+}
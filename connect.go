@@ -0,0 +1,113 @@
+package cstats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// liveClient follows a running `cstats plot --live` server through its
+// /api/records endpoint, asking each time for the samples from the newest
+// timestamp received on. That tick is asked for again since a read of the
+// capture can end in the middle of it; the samples of it already held are
+// skipped.
+type liveClient struct {
+	label   string // server address without credentials
+	url     *neturl.URL
+	last    time.Time       // newest timestamp received
+	atLast  map[string]bool // sampleKey of the samples received at last
+	records []record
+	store   *seriesStore // instead of records, with --window
+}
+
+// newLiveClient parses a --connect address: the server's base URL, with an
+// optional ?source= to pick one of several captures.
+func newLiveClient(addr string) (*liveClient, error) {
+	u, err := neturl.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --connect %q, want http(s)://host:port", addr)
+	}
+	label := u.Redacted()
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/records"
+	c := &liveClient{label: label, url: u, atLast: map[string]bool{}}
+	if retention > 0 {
+		c.store = newSeriesStore(retention)
+	}
+	return c, nil
+}
+
+// fetch appends the new samples and returns everything received so far.
+// On error the records already held are returned along with it.
+func (c *liveClient) fetch() ([]record, error) {
+	u := *c.url
+	q := u.Query()
+	if !c.last.IsZero() {
+		// since is exclusive.
+		q.Set("since", c.last.Add(-time.Nanosecond).Format(time.RFC3339Nano))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return c.held(), err
+	}
+	if err := addCSVHeaders(req); err != nil {
+		return c.held(), err
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return c.held(), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return c.held(), fmt.Errorf("GET %s: %s", c.url.Redacted(), resp.Status)
+	}
+
+	var body struct {
+		Records []apiRecord `json:"records"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return c.held(), fmt.Errorf("decode %s: %w", c.url.Redacted(), err)
+	}
+	for _, r := range body.Records {
+		rec := record{
+			Timestamp:  r.Timestamp.In(displayLoc),
+			Container:  r.Container,
+			CPUPct:     r.CPUPct,
+			MemUsageMB: r.MemUsageMB,
+			MemLimitMB: r.MemLimitMB,
+			MemPct:     r.MemPct,
+			Extra:      r.Extra,
+			Attrs:      r.Attrs,
+		}
+		key := sampleKey(rec)
+		switch {
+		case rec.Timestamp.After(c.last):
+			c.last = rec.Timestamp
+			clear(c.atLast)
+		case rec.Timestamp.Equal(c.last) && c.atLast[key]:
+			continue
+		}
+		if rec.Timestamp.Equal(c.last) {
+			c.atLast[key] = true
+		}
+		if c.store != nil {
+			c.store.add(rec)
+		} else {
+			c.records = append(c.records, rec)
+		}
+	}
+	return c.held(), nil
+}
+
+// held returns the records received so far (within the window, if any).
+func (c *liveClient) held() []record {
+	if c.store != nil {
+		return c.store.records()
+	}
+	return slices.Clip(c.records)
+}
@@ -0,0 +1,75 @@
+package cstats
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+)
+
+// corsConfig allows other origins (e.g. an internal SPA) to call the live
+// server's /api/ endpoints.
+type corsConfig struct {
+	origins stringList
+}
+
+// corsFlags registers --cors-origin on fs.
+func corsFlags(fs *flag.FlagSet) *corsConfig {
+	c := &corsConfig{}
+	fs.Var(&c.origins, "cors-origin", `Origin allowed to call the /api/ endpoints from a browser, or "*" (repeatable)`)
+	return c
+}
+
+// allowed returns the Access-Control-Allow-Origin value for origin, or ""
+// when the origin is not permitted.
+func (c *corsConfig) allowed(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, o := range c.origins {
+		for _, o := range strings.Split(o, ",") {
+			o = strings.TrimSuffix(strings.TrimSpace(o), "/")
+			if o == "*" {
+				return "*"
+			}
+			if strings.EqualFold(o, origin) {
+				return origin
+			}
+		}
+	}
+	return ""
+}
+
+// wrap adds CORS headers to /api/ responses and answers preflight requests
+// itself, ahead of authentication (browsers send preflights without
+// credentials).
+func (c *corsConfig) wrap(h http.Handler) http.Handler {
+	if len(c.origins) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allow := c.allowed(r.Header.Get("Origin"))
+		if allow == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allow)
+		if allow != "*" {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, X-Last-Sample")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-None-Match")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
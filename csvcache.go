@@ -0,0 +1,372 @@
+package cstats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// csvTail is the parsed part of a growing capture: its header and how far
+// into the data rows have been read. Local files and remote mirrors both
+// feed it only the bytes appended since the last read.
+type csvTail struct {
+	header  []byte // raw header line, to notice rewritten captures
+	offset  int64  // bytes consumed, always at a line boundary
+	mark    []byte // the bytes just before offset, to notice truncation
+	partial []byte // the trailing line not yet ended by a newline
+	lines   int    // lines consumed, for error messages
+	fields  int
+	parser  *csvParser
+	records []record
+	store   *seriesStore   // instead of records, with --window
+	stream  *streamSummary // instead of records, with --stream
+}
+
+// feed parses the complete lines of data, which continues the capture at
+// t.offset. A trailing partial line is left for the next call.
+func (t *csvTail) feed(data []byte) error {
+	defer timed(csvParses, parseSeconds, time.Now())
+	end := bytes.LastIndexByte(data, '\n') + 1
+	t.partial = append(t.partial[:0], data[end:]...)
+	data = data[:end]
+
+	rows := data
+	if t.parser == nil {
+		header, err := csv.NewReader(bytes.NewReader(data)).Read()
+		if err != nil {
+			return fmt.Errorf("reading header: %w", err)
+		}
+		p, err := newCSVParser(header)
+		if err != nil {
+			return err
+		}
+		t.parser = p
+		t.fields = len(header)
+		t.header = slices.Clone(data[:bytes.IndexByte(data, '\n')+1])
+		rows = data[len(t.header):]
+		t.lines = 1
+	}
+	t.parser.line = t.lines
+	if streamFollow.points > 0 {
+		if t.stream == nil {
+			t.stream = newStreamSummary(streamFollow.points)
+		}
+		r := csv.NewReader(bytes.NewReader(rows))
+		r.FieldsPerRecord = t.fields
+		t.parser.eachRow(r, func(rec record) {
+			rec.Container = keyedName(rec.Container, rec, streamFollow.seriesKey)
+			t.stream.add(rec)
+		})
+	} else if retention > 0 {
+		if t.store == nil {
+			t.store = newSeriesStore(retention)
+		}
+		r := csv.NewReader(bytes.NewReader(rows))
+		r.FieldsPerRecord = t.fields
+		t.parser.eachRow(r, func(rec record) {
+			switch unordered, dup := t.store.add(rec); {
+			case unordered:
+				t.parser.issues.Unordered++
+			case dup:
+				t.parser.issues.Duplicates++
+			}
+		})
+	} else {
+		from := len(t.records)
+		t.records = append(t.records, t.parser.parseParallel(rows, t.fields)...)
+		var unordered, dups int
+		t.records, unordered, dups = settleRecords(t.records, from)
+		t.parser.issues.settled(unordered, dups)
+	}
+	if err := t.parser.err; err != nil {
+		t.reset()
+		return err
+	}
+	t.lines += bytes.Count(rows, []byte{'\n'})
+	t.offset += int64(end)
+	if n := min(end, tailMarkSize); n > 0 {
+		t.mark = append(t.mark[:0], data[end-n:end]...)
+	}
+	return nil
+}
+
+// feedChunk is how much of a capture feedFrom reads at a time.
+const feedChunk = 8 << 20
+
+// feedFrom feeds the rest of f from t.offset a chunk at a time, so only
+// what t keeps of a large capture (the window, the reduced --stream series)
+// is held in memory, never the file itself.
+func (t *csvTail) feedFrom(f *os.File) error {
+	buf := make([]byte, feedChunk)
+	for {
+		n, err := f.ReadAt(buf, t.offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == nil && bytes.IndexByte(buf[:n], '\n') < 0 {
+			// A line longer than the chunk.
+			buf = make([]byte, 2*len(buf))
+			continue
+		}
+		if ferr := t.feed(buf[:n]); ferr != nil {
+			return ferr
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// tailMarkSize is how many of the last bytes read are compared before
+// reading on: a file truncated and refilled past the old size between two
+// reads (copytruncate) fails the comparison instead of being read from the
+// middle of a row.
+const tailMarkSize = 64
+
+// rows returns the records parsed so far (within the window, if any, or
+// the reduced series with --stream).
+func (t *csvTail) rows() []record {
+	if t.store != nil {
+		return t.store.records()
+	}
+	if t.stream != nil {
+		_, records := t.stream.snapshot()
+		return records
+	}
+	return slices.Clip(t.records)
+}
+
+// pending returns the trailing line held back by the last feed and, if it
+// is a whole row, the row.
+func (t *csvTail) pending() ([]byte, record, bool) {
+	if t.parser == nil || len(t.partial) == 0 {
+		return nil, record{}, false
+	}
+	r := csv.NewReader(bytes.NewReader(t.partial))
+	r.FieldsPerRecord = t.fields
+	row, err := r.Read()
+	if err != nil {
+		return t.partial, record{}, false
+	}
+	rec, issue := t.parser.parseRow(row)
+	return t.partial, rec, issue == rowOK
+}
+
+// reset drops everything parsed so far.
+func (t *csvTail) reset() {
+	*t = csvTail{}
+}
+
+// loadFinishedCSV is loadCSV for captures read once. Readers following a
+// capture hold back a last line without a newline until the collector
+// finishes it; here it is parsed when it is a whole row (files written by
+// other tools often end that way) and reported when it is not.
+func loadFinishedCSV(path string) ([]record, error) {
+	records, err := loadCSV(path)
+	if err != nil {
+		return nil, err
+	}
+	var line []byte
+	var rec record
+	var ok bool
+	var issues parseIssues
+	withTail(path, func(t *csvTail) {
+		line, rec, ok = t.pending()
+		if t.parser != nil {
+			issues = t.parser.issues
+		}
+	})
+	switch {
+	case ok:
+		var unordered, dups int
+		records, unordered, dups = settleRecords(append(records, rec), len(records))
+		issues.settled(unordered, dups)
+	case len(line) > 0 && strictParse:
+		return nil, fmt.Errorf("incomplete last line %q", line)
+	case len(line) > 0:
+		warnf("%s: skipped incomplete last line %q (still being written?)", path, line)
+	}
+	if s := issues.String(); s != "" {
+		warnf("%s: %s", path, s)
+	}
+	return records, nil
+}
+
+// csvIssues returns the problem rows counted while loading path.
+func csvIssues(path string) parseIssues {
+	var issues parseIssues
+	withTail(path, func(t *csvTail) {
+		if t.parser != nil {
+			issues = t.parser.issues
+		}
+	})
+	return issues
+}
+
+// withTail calls fn with the parse state of a loaded capture, locked.
+func withTail(path string, fn func(*csvTail)) {
+	if isURL(path) {
+		rc := remoteFor(path)
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		fn(&rc.tail)
+		return
+	}
+	csvCacheMu.Lock()
+	e, ok := csvCache[path]
+	csvCacheMu.Unlock()
+	if !ok {
+		fn(&csvTail{})
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fn(&e.tail)
+}
+
+// csvCacheEntry is a parsed local capture.
+type csvCacheEntry struct {
+	mu    sync.Mutex
+	state fileState
+	file  os.FileInfo // to notice a rotated (replaced) file
+	tail  csvTail
+}
+
+var (
+	csvCacheMu sync.Mutex
+	csvCache   = map[string]*csvCacheEntry{}
+)
+
+// loadLocalCSV returns the records of a local capture. An unchanged file is
+// served from memory; a file that only grew has just its appended lines
+// parsed. Anything else (truncation, rewrite, rotation) triggers a full
+// re-read.
+func loadLocalCSV(path string) ([]record, error) {
+	csvCacheMu.Lock()
+	e, ok := csvCache[path]
+	if !ok {
+		e = &csvCacheEntry{}
+		csvCache[path] = e
+	}
+	csvCacheMu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := statFile(path)
+	if st.exists && st == e.state {
+		return e.tail.rows(), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		e.reset()
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if e.tail.parser != nil && (!os.SameFile(info, e.file) || st.size < e.tail.offset || !e.sameHeader(f) || !e.sameMark(f)) {
+		e.reset()
+	}
+	e.file = info
+	if e.tail.parser == nil && retention > 0 && !strictParse {
+		if err := e.tail.seekWindow(f, path, retention); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.tail.feedFrom(f); err != nil {
+		return nil, err
+	}
+	e.state = st
+	return e.tail.rows(), nil
+}
+
+// reset drops everything read so far; the caller holds e.mu.
+func (e *csvCacheEntry) reset() {
+	e.state = fileState{}
+	e.file = nil
+	e.tail.reset()
+}
+
+// seekWindow starts the first read of a large capture at the indexed row
+// just before window of its end, so older rows are never parsed.
+func (t *csvTail) seekWindow(f *os.File, path string, window time.Duration) error {
+	ix, err := openTimeIndex(path)
+	if err != nil || ix == nil {
+		// Without an index the whole capture is read as usual.
+		return nil
+	}
+	first, start := ix.entries[0].Offset, ix.seek(ix.last().Add(-window))
+	if start <= first {
+		return nil
+	}
+	head := make([]byte, first)
+	if _, err := f.ReadAt(head, 0); err != nil {
+		return err
+	}
+	if err := t.feed(head); err != nil {
+		return err
+	}
+	t.offset = start
+	t.mark = make([]byte, min(start, tailMarkSize))
+	_, err = f.ReadAt(t.mark, start-int64(len(t.mark)))
+	return err
+}
+
+// loadCSVWindow reads just the rows of a large local capture within about
+// window of its end, seeking with the time index, for a ?window= query of
+// a capture not read in full. ok is false for a capture already in memory,
+// or without an index to seek with.
+func loadCSVWindow(path string, window time.Duration) (records []record, ok bool) {
+	if isURL(path) || retention > 0 || streamFollow.points > 0 {
+		return nil, false
+	}
+	csvCacheMu.Lock()
+	_, cached := csvCache[path]
+	csvCacheMu.Unlock()
+	if cached {
+		return nil, false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	var t csvTail
+	if err := t.seekWindow(f, path, window); err != nil || t.parser == nil {
+		return nil, false
+	}
+	if err := t.feedFrom(f); err != nil {
+		return nil, false
+	}
+	return t.rows(), true
+}
+
+// sameMark reports whether the bytes before the read offset are still the
+// ones read last time.
+func (e *csvCacheEntry) sameMark(f *os.File) bool {
+	buf := make([]byte, len(e.tail.mark))
+	if _, err := f.ReadAt(buf, e.tail.offset-int64(len(buf))); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, e.tail.mark)
+}
+
+// sameHeader reports whether the file still starts with the header that
+// was parsed.
+func (e *csvCacheEntry) sameHeader(f *os.File) bool {
+	buf := make([]byte, len(e.tail.header))
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, e.tail.header)
+}
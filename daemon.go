@@ -1,34 +1,48 @@
-package main
+package cstats
 
 import (
+	"bufio"
+	"cmp"
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"math"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	dockerclient "github.com/docker/docker/client"
 
+	"github.com/saveugene/cstats/collector"
+	"github.com/saveugene/cstats/sink"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
-var debug bool
-
+// logf logs at debug level (--debug or --log-level debug).
 func logf(format string, args ...any) {
-	if debug {
+	if minLevel <= levelDebug {
 		log.Printf(format, args...)
 	}
 }
@@ -37,19 +51,38 @@ func logf(format string, args ...any) {
 var csvHeader = []string{"timestamp", "container", "cpu_pct", "mem_usage_mb", "mem_limit_mb", "mem_pct"}
 
 // openCSV opens (or creates) the CSV file and writes the header if the file is new/empty.
+// extraHeader names optional columns appended after csvHeader; appending to an
+// existing file with a different header is refused, since readers would drop
+// the mismatched rows.
 // It returns the file handle and a csv.Writer ready for appending rows.
-func openCSV(path string) (*os.File, *csv.Writer, error) {
+func openCSV(path string, extraHeader ...string) (*os.File, *csv.Writer, error) {
+	header := append(append([]string{}, csvHeader...), extraHeader...)
 	info, err := os.Stat(path)
 	needHeader := os.IsNotExist(err) || (err == nil && info.Size() == 0)
+	if !needHeader {
+		existing, err := readCSVHeader(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read csv header: %w", err)
+		}
+		if strings.Join(existing, ",") != strings.Join(header, ",") {
+			return nil, nil, fmt.Errorf("%s has columns %v, want %v; use a new --outfile", path, existing, header)
+		}
+	}
 
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return nil, nil, fmt.Errorf("open csv: %w", err)
 	}
+	if err := lockCSV(f); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
 
-	w := csv.NewWriter(f)
+	// The buffer holds a whole row, so each flush is a single append and
+	// readers see at most a trailing partial line, never a torn one.
+	w := csv.NewWriter(bufio.NewWriterSize(f, 64<<10))
 	if needHeader {
-		if err := w.Write(csvHeader); err != nil {
+		if err := w.Write(header); err != nil {
 			f.Close()
 			return nil, nil, fmt.Errorf("write csv header: %w", err)
 		}
@@ -58,16 +91,27 @@ func openCSV(path string) (*os.File, *csv.Writer, error) {
 	return f, w, nil
 }
 
-// writeRow writes a single stats row and flushes.
-func writeRow(w *csv.Writer, ts time.Time, name string, cpuPct, memUsageMB, memLimitMB, memPct float64) {
-	w.Write([]string{
+// readCSVHeader returns the first row of an existing CSV file.
+func readCSVHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return csv.NewReader(f).Read()
+}
+
+// writeRow writes a single stats row and flushes. extra holds the values of
+// the optional columns passed to openCSV, in the same order.
+func writeRow(w *csv.Writer, ts time.Time, name string, cpuPct, memUsageMB, memLimitMB, memPct float64, extra ...string) {
+	w.Write(append([]string{
 		ts.Format(time.RFC3339),
 		name,
 		fmt.Sprintf("%.2f", cpuPct),
 		fmt.Sprintf("%.2f", memUsageMB),
 		fmt.Sprintf("%.2f", memLimitMB),
 		fmt.Sprintf("%.2f", memPct),
-	})
+	}, extra...))
 	w.Flush()
 }
 
@@ -94,7 +138,13 @@ type dockerStatsJSON struct {
 	} `json:"memory_stats"`
 }
 
+// calcDockerCPU returns the CPU percentage since the previous reading, NaN
+// without one (the first read of a container can come without it, and the
+// delta against zero is the container's lifetime usage).
 func calcDockerCPU(s *dockerStatsJSON) float64 {
+	if s.PreCPUStats.SystemCPUUsage == 0 {
+		return math.NaN()
+	}
 	cpuDelta := s.CPUStats.CPUUsage.TotalUsage - s.PreCPUStats.CPUUsage.TotalUsage
 	sysDelta := s.CPUStats.SystemCPUUsage - s.PreCPUStats.SystemCPUUsage
 	if sysDelta <= 0 || cpuDelta < 0 {
@@ -104,7 +154,8 @@ func calcDockerCPU(s *dockerStatsJSON) float64 {
 	if numCPUs == 0 {
 		numCPUs = 1
 	}
-	return (cpuDelta / sysDelta) * numCPUs * 100.0
+	// Counters sampled at slightly different moments can overshoot.
+	return min((cpuDelta/sysDelta)*numCPUs*100.0, numCPUs*100.0)
 }
 
 func calcDockerMem(s *dockerStatsJSON) (usageMB, limitMB, pct float64) {
@@ -118,11 +169,10 @@ func calcDockerMem(s *dockerStatsJSON) (usageMB, limitMB, pct float64) {
 	if usage < 0 {
 		usage = 0
 	}
-	limit := s.MemoryStats.Limit
 	usageMB = usage / (1024 * 1024)
-	limitMB = limit / (1024 * 1024)
-	if limit > 0 {
-		pct = (usage / limit) * 100.0
+	limitMB = noLimit(s.MemoryStats.Limit / (1024 * 1024))
+	if limitMB > 0 {
+		pct = (usage / s.MemoryStats.Limit) * 100.0
 	}
 	return
 }
@@ -134,116 +184,414 @@ func containerName(names []string) string {
 	return "unknown"
 }
 
-func runDockerDaemon(stopCh <-chan struct{}, interval int, outfile string) error {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
-	if err != nil {
-		return fmt.Errorf("docker client: %w", err)
+// withAttr sets an optional text column of a sample; empty values are left
+// out, as the CSV reader does.
+func withAttr(r *record, col, v string) {
+	if v == "" {
+		return
 	}
-	defer cli.Close()
+	if r.Attrs == nil {
+		r.Attrs = map[string]string{}
+	}
+	r.Attrs[col] = v
+}
 
-	// Verify connectivity.
-	if _, err := cli.Ping(context.Background()); err != nil {
-		return fmt.Errorf("cannot reach Docker daemon: %w", err)
+// idColumns are the extra columns written with --ids, to tell apart
+// containers that share a name.
+var idColumns = []string{"container_id", "host"}
+
+// shortID shortens a container ID like docker ps does, dropping a runtime
+// prefix such as containerd://.
+func shortID(id string) string {
+	if _, after, ok := strings.Cut(id, "://"); ok {
+		id = after
 	}
+	return id[:min(len(id), 12)]
+}
 
-	f, w, err := openCSV(outfile)
+// apiTimeout bounds every collector API call, so a slow API server costs a
+// tick instead of blocking the collector.
+const apiTimeout = 10 * time.Second
+
+// stopContext returns a context cancelled once stopCh is closed (never for
+// a nil stopCh), so a stop interrupts API calls in flight.
+func stopContext(stopCh <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if stopCh != nil {
+		go func() {
+			select {
+			case <-stopCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// --- Docker collector: Compose, health and image columns ---
+
+// dialDocker connects to the Docker daemon at ep and checks that it
+// answers.
+func dialDocker(ctx context.Context, ep dockerEndpoint) (*dockerclient.Client, error) {
+	opts, err := ep.clientOpts()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
+	cli, err := dockerclient.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("docker client: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+	if _, err := cli.Ping(ctx); err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("cannot reach Docker daemon: %w", err)
+	}
+	return cli, nil
+}
 
-	fmt.Printf("Collecting Docker stats every %ds -> %s (Ctrl+C to stop)\n", interval, outfile)
-	logf("Docker daemon started: interval=%ds, outfile=%s", interval, outfile)
+// imageColumns are the extra columns written with --images: the reference a
+// container was created from and the ID of the image it runs, which tells a
+// re-pushed tag from the one pulled before.
+var imageColumns = []string{"image", "image_id"}
 
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	defer ticker.Stop()
+// composeColumns are the extra columns written with --compose, from the
+// labels Docker Compose puts on the containers it creates.
+var composeColumns = []string{"compose_project", "compose_service"}
 
-	stopped := func() bool {
-		select {
-		case <-stopCh:
-			return true
-		default:
-			return false
+// dockerCollector samples the containers of a Docker daemon. With ids it
+// adds the container ID and Docker host columns, with compose the Compose
+// project and service ones, and labelKeys become label_<key> columns. A
+// project limits it to that Compose project, filterLabels (key or
+// key=value, all required) to the containers labelled so. With health it
+// records the health check status and reports its transitions as events,
+// with images the image reference each container was created from and the
+// image ID.
+type dockerCollector struct {
+	cli          *dockerclient.Client
+	endpoint     dockerEndpoint
+	ids          bool
+	compose      bool
+	project      string
+	filterLabels []string
+	labelKeys    []string
+	health       bool
+	images       bool
+	host         string
+	containers   []types.Container
+
+	healthOf map[string]string // by container, as of the last Discover
+	report   func(event)
+}
+
+func newDockerCollector(ctx context.Context, ep dockerEndpoint, ids, compose bool, project string, filterLabels, labelKeys []string, health, images bool) (*dockerCollector, error) {
+	cli, err := dialDocker(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+	c := &dockerCollector{cli: cli, endpoint: ep, ids: ids, compose: compose || project != "", project: project, filterLabels: filterLabels, labelKeys: labelKeys,
+		health: health, images: images, healthOf: map[string]string{}}
+	if ids {
+		infoCtx, done := context.WithTimeout(ctx, apiTimeout)
+		info, err := cli.Info(infoCtx)
+		done()
+		if err == nil {
+			c.host = info.Name
+		} else {
+			c.host, _ = os.Hostname()
 		}
 	}
+	return c, nil
+}
 
-	collect := func() {
-		if stopped() {
-			return
-		}
-		containers, err := cli.ContainerList(context.Background(), container.ListOptions{})
-		if err != nil {
-			logf("ContainerList error: %v", err)
-			return
-		}
-		ts := time.Now().UTC()
+func (c *dockerCollector) Columns() []string {
+	var cols []string
+	for _, k := range c.labelKeys {
+		cols = append(cols, "label_"+k)
+	}
+	if c.ids {
+		cols = append(cols, idColumns...)
+	}
+	if c.compose {
+		cols = append(cols, composeColumns...)
+	}
+	if c.health {
+		cols = append(cols, "health")
+	}
+	if c.images {
+		cols = append(cols, imageColumns...)
+	}
+	return cols
+}
 
-		type result struct {
-			name                          string
-			cpuPct, memUsage, memLimit, memPct float64
+// healthStatus matches the health check status docker ps shows after the
+// uptime: "Up 2 minutes (healthy)".
+var healthStatus = regexp.MustCompile(`\((healthy|unhealthy|health: starting)\)$`)
+
+// containerHealth returns healthy, unhealthy or starting, or "" for a
+// container without a health check.
+func containerHealth(ct types.Container) string {
+	m := healthStatus.FindStringSubmatch(ct.Status)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m[1], "health: ")
+}
+
+// ReportEvents makes the collector report health transitions, with health.
+func (c *dockerCollector) ReportEvents(report func(event)) { c.report = report }
+
+// checkHealth reports the containers whose health changed since the last
+// Discover.
+func (c *dockerCollector) checkHealth() {
+	now := time.Now()
+	seen := make(map[string]string, len(c.containers))
+	for _, ct := range c.containers {
+		name, health := containerName(ct.Names), containerHealth(ct)
+		seen[name] = health
+		was, ok := c.healthOf[name]
+		if !ok || was == health || health == "" || c.report == nil {
+			continue
+		}
+		label := name + " " + health
+		if was != "" {
+			label += " (was " + was + ")"
 		}
+		logf("health: %s", label)
+		c.report(event{Timestamp: now, Label: label})
+	}
+	c.healthOf = seen
+}
 
-		results := make([]result, len(containers))
-		var wg sync.WaitGroup
+func (c *dockerCollector) Discover(ctx context.Context) ([]string, error) {
+	listCtx, done := context.WithTimeout(ctx, apiTimeout)
+	defer done()
+	opts := container.ListOptions{Filters: filters.NewArgs()}
+	if c.project != "" {
+		opts.Filters.Add("label", "com.docker.compose.project="+c.project)
+	}
+	for _, l := range c.filterLabels {
+		opts.Filters.Add("label", l)
+	}
+	containers, err := c.cli.ContainerList(listCtx, opts)
+	if dockerclient.IsErrConnectionFailed(err) {
+		return nil, fmt.Errorf("%w: %v", collector.ErrUnreachable, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ContainerList: %w", err)
+	}
+	c.containers = containers
+	if c.health {
+		c.checkHealth()
+	}
+	names := make([]string, len(containers))
+	for i, ct := range containers {
+		names[i] = containerName(ct.Names)
+	}
+	return names, nil
+}
 
-		for i := range containers {
-			wg.Add(1)
-			go func(i int) {
-				defer wg.Done()
-				c := containers[i]
-				name := containerName(c.Names)
+// Sample reads the stats of all containers concurrently; containers whose
+// stats fail are left out.
+func (c *dockerCollector) Sample(ctx context.Context) ([]record, error) {
+	results := make([]*record, len(c.containers))
+	var wg sync.WaitGroup
+	for i := range c.containers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ct := c.containers[i]
+			name := containerName(ct.Names)
 
-				resp, err := cli.ContainerStats(context.Background(), c.ID, false)
-				if err != nil {
-					logf("ContainerStats(%s) error: %v", name, err)
-					return
-				}
-				var stats dockerStatsJSON
-				if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
-					resp.Body.Close()
-					logf("decode stats(%s) error: %v", name, err)
-					return
-				}
+			statsCtx, done := context.WithTimeout(ctx, apiTimeout)
+			defer done()
+			resp, err := c.cli.ContainerStats(statsCtx, ct.ID, false)
+			if err != nil {
+				logf("ContainerStats(%s) error: %v", name, err)
+				return
+			}
+			var stats dockerStatsJSON
+			if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
 				resp.Body.Close()
+				logf("decode stats(%s) error: %v", name, err)
+				return
+			}
+			resp.Body.Close()
 
-				memUsage, memLimit, memPct := calcDockerMem(&stats)
-				results[i] = result{
-					name:     name,
-					cpuPct:   calcDockerCPU(&stats),
-					memUsage: memUsage,
-					memLimit: memLimit,
-					memPct:   memPct,
-				}
-			}(i)
-		}
-		wg.Wait()
-
-		for _, r := range results {
-			if r.name == "" {
-				continue
+			memUsage, memLimit, memPct := calcDockerMem(&stats)
+			r := &record{
+				Container:  name,
+				CPUPct:     calcDockerCPU(&stats),
+				MemUsageMB: memUsage,
+				MemLimitMB: memLimit,
+				MemPct:     memPct,
 			}
-			writeRow(w, ts, r.name, r.cpuPct, r.memUsage, r.memLimit, r.memPct)
-			logf("  %s  cpu=%.2f%%  mem=%.1f/%.1f MB (%.2f%%)",
-				r.name, r.cpuPct, r.memUsage, r.memLimit, r.memPct)
-		}
+			for _, k := range c.labelKeys {
+				withAttr(r, "label_"+k, ct.Labels[k])
+			}
+			if c.ids {
+				withAttr(r, "container_id", shortID(ct.ID))
+				withAttr(r, "host", c.host)
+			}
+			if c.compose {
+				withAttr(r, "compose_project", ct.Labels["com.docker.compose.project"])
+				withAttr(r, "compose_service", ct.Labels["com.docker.compose.service"])
+			}
+			if c.health {
+				withAttr(r, "health", containerHealth(ct))
+			}
+			if c.images {
+				withAttr(r, "image", ct.Image)
+				withAttr(r, "image_id", shortID(strings.TrimPrefix(ct.ImageID, "sha256:")))
+			}
+			results[i] = r
+		}(i)
 	}
+	wg.Wait()
 
-	// Collect immediately, then on ticker.
-	collect()
-	for {
-		select {
-		case <-stopCh:
-			logf("Docker daemon stopped")
-			return nil
-		case <-ticker.C:
-			collect()
+	var out []record
+	for _, r := range results {
+		if r != nil {
+			out = append(out, *r)
 		}
 	}
+	return out, nil
+}
+
+// Reconnect replaces the client, whose connections died with the daemon.
+func (c *dockerCollector) Reconnect(ctx context.Context) error {
+	cli, err := dialDocker(ctx, c.endpoint)
+	if err != nil {
+		return err
+	}
+	c.cli.Close()
+	c.cli = cli
+	return nil
 }
 
+func (c *dockerCollector) Close() error { return c.cli.Close() }
+
 // --- Kubernetes daemon ---
 
-func runK8sDaemon(stopCh <-chan struct{}, interval int, outfile, namespace, selector, kubeContext string) error {
+// k8sCollector samples pods through the metrics API. The pods, for their
+// limits, labels, container IDs and nodes, come from a watch kept up to date
+// by an informer, so a tick costs one metrics call however big the cluster.
+// labelKeys become label_<key> columns; with ids it adds the container ID
+// and node columns. Samples are named after the pod, or <pod>:<container>
+// in pods running several containers. Init and ephemeral containers are
+// left out unless included, then named <pod>:<container> too and told apart
+// by a container_type column.
+type k8sCollector struct {
+	metricsClient    *metricsv.Clientset
+	clientset        kubernetes.Interface
+	cluster          string // recorded in the cluster column, if set
+	namespace        string
+	selector         string
+	podRegex         *regexp.Regexp // nil = all pods
+	labelKeys        []string
+	ids              bool
+	includeInit      bool
+	includeEphemeral bool
+	images           bool
+	storage          bool // ephemeral_storage_mb, from the kubelets
+	pvc              bool // pvc_used_mb and pvc_used_pct, from the kubelets
+	started          time.Time
+
+	informer cache.SharedIndexInformer
+	stop     chan struct{}
+
+	mu     sync.Mutex
+	pods   map[string]k8sPod // by namespace/pod
+	report func(event)       // with events, once runCollector asks
+}
+
+// cpuLimitColumn is the CPU limit in millicores the Kubernetes collectors
+// record with each sample, 0 without one: their cpu_pct is a percentage of
+// it rather than of one core.
+const cpuLimitColumn = "cpu_limit_m"
+
+type k8sLimits struct {
+	cpuMillis int64
+	memBytes  int64
+}
+
+// k8sPod is what the collectors keep of a pod.
+type k8sPod struct {
+	labels       map[string]string
+	node         string
+	limits       map[string]k8sLimits // by container
+	containerIDs map[string]string    // by container
+	types        map[string]string    // by container, for init and ephemeral ones
+	images       map[string]string    // by container, as in the pod spec
+	running      int                  // regular containers and native sidecars
+}
+
+// containerName names the series of a container of pod: the pod, or
+// pod:container for an init or ephemeral container and in a pod running
+// several, so their samples are not merged.
+func (p *k8sPod) containerName(pod, container string) string {
+	if p.types[container] != "" || p.running > 1 {
+		return pod + ":" + container
+	}
+	return pod
+}
+
+// Container types of the container_type column.
+const (
+	regularContainer   = "regular"
+	initContainer      = "init"
+	ephemeralContainer = "ephemeral"
+)
+
+// podInfo extracts the k8sPod of pod.
+func podInfo(pod *corev1.Pod) k8sPod {
+	p := k8sPod{
+		labels:       pod.Labels,
+		node:         pod.Spec.NodeName,
+		limits:       make(map[string]k8sLimits, len(pod.Spec.Containers)),
+		containerIDs: make(map[string]string, len(pod.Status.ContainerStatuses)),
+		types:        map[string]string{},
+		images:       map[string]string{},
+	}
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for _, cs := range statuses {
+			p.containerIDs[cs.Name] = shortID(cs.ContainerID)
+		}
+	}
+	limits := func(ct corev1.Container) {
+		var lim k8sLimits
+		if cpuLim, ok := ct.Resources.Limits["cpu"]; ok {
+			lim.cpuMillis = cpuLim.MilliValue()
+		}
+		if memLim, ok := ct.Resources.Limits["memory"]; ok {
+			lim.memBytes = memLim.Value()
+		}
+		p.limits[ct.Name] = lim
+		p.images[ct.Name] = ct.Image
+	}
+	for _, ct := range pod.Spec.Containers {
+		limits(ct)
+	}
+	p.running = len(pod.Spec.Containers)
+	for _, ct := range pod.Spec.InitContainers {
+		limits(ct)
+		// Native sidecars (restartPolicy: Always) run alongside the
+		// regular containers.
+		if ct.RestartPolicy == nil || *ct.RestartPolicy != corev1.ContainerRestartPolicyAlways {
+			p.types[ct.Name] = initContainer
+		} else {
+			p.running++
+		}
+	}
+	for _, ct := range pod.Spec.EphemeralContainers {
+		p.types[ct.Name] = ephemeralContainer // no resources allowed
+		p.images[ct.Name] = ct.Image
+	}
+	return p
+}
+
+func newK8sCollector(ctx context.Context, namespace, selector, fieldSelector, podRegex, kubeContext, cluster string, labelKeys []string, ids, includeInit, includeEphemeral, images, events, storage, pvc bool) (*k8sCollector, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	configOverrides := &clientcmd.ConfigOverrides{}
 	if kubeContext != "" {
@@ -253,168 +601,479 @@ func runK8sDaemon(stopCh <-chan struct{}, interval int, outfile, namespace, sele
 
 	restConfig, err := kubeConfig.ClientConfig()
 	if err != nil {
-		return fmt.Errorf("kubeconfig: %w", err)
+		return nil, fmt.Errorf("kubeconfig: %w", err)
 	}
 
 	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
-		return fmt.Errorf("kubernetes client: %w", err)
+		return nil, fmt.Errorf("kubernetes client: %w", err)
 	}
 
 	metricsClient, err := metricsv.NewForConfig(restConfig)
 	if err != nil {
-		return fmt.Errorf("metrics client: %w", err)
+		return nil, fmt.Errorf("metrics client: %w", err)
+	}
+	if _, err := fields.ParseSelector(fieldSelector); err != nil {
+		return nil, fmt.Errorf("--field-selector: %w", err)
+	}
+	var podRE *regexp.Regexp
+	if podRegex != "" {
+		if podRE, err = regexp.Compile(podRegex); err != nil {
+			return nil, fmt.Errorf("--pod-regex: %w", err)
+		}
+	}
+	logf("Kubernetes collector: context=%q, namespace=%s, selector=%q, field-selector=%q, pod-regex=%q", kubeContext, namespace, selector, fieldSelector, podRegex)
+	c := &k8sCollector{
+		metricsClient:    metricsClient,
+		clientset:        clientset,
+		cluster:          cluster,
+		namespace:        namespace,
+		selector:         selector,
+		podRegex:         podRE,
+		labelKeys:        labelKeys,
+		ids:              ids,
+		includeInit:      includeInit,
+		includeEphemeral: includeEphemeral,
+		images:           images,
+		storage:          storage,
+		pvc:              pvc,
+		started:          time.Now().Truncate(time.Second), // event times are in seconds
+		stop:             make(chan struct{}),
+		pods:             map[string]k8sPod{},
 	}
 
-	f, w, err := openCSV(outfile)
-	if err != nil {
-		return err
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = selector
+			o.FieldSelector = fieldSelector
+		}))
+	c.informer = factory.Core().V1().Pods().Informer()
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.podChanged,
+		UpdateFunc: func(old, obj any) {
+			c.podChanged(obj)
+			if events {
+				c.podTerminated(old, obj)
+			}
+		},
+		DeleteFunc: c.podDeleted,
+	})
+	if events {
+		c.watchEvents(clientset, namespace)
 	}
-	defer f.Close()
+	c.informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		logf("pod watch: %v", err)
+	})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-c.stop:
+		}
+	}()
+	go c.informer.Run(c.stop)
+	return c, nil
+}
 
-	fmt.Printf("Collecting Kubernetes stats every %ds -> %s (Ctrl+C to stop)\n", interval, outfile)
-	logf("Kubernetes daemon started: interval=%ds, namespace=%s, selector=%q, outfile=%s",
-		interval, namespace, selector, outfile)
+func (c *k8sCollector) podChanged(obj any) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	if c.podRegex != nil && !c.podRegex.MatchString(pod.Name) {
+		return
+	}
+	info := podInfo(pod)
+	c.mu.Lock()
+	c.pods[pod.Namespace+"/"+pod.Name] = info
+	c.mu.Unlock()
+}
 
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	defer ticker.Stop()
+func (c *k8sCollector) podDeleted(obj any) {
+	if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tomb.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	delete(c.pods, pod.Namespace+"/"+pod.Name)
+	c.mu.Unlock()
+}
 
-	collect := func() {
-		listOpts := metav1.ListOptions{}
-		if selector != "" {
-			listOpts.LabelSelector = selector
-		}
+// Close stops the pod watch.
+func (c *k8sCollector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	return nil
+}
 
-		pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), listOpts)
-		if err != nil {
-			logf("Pods.List error: %v", err)
-			return
+func (c *k8sCollector) Columns() []string {
+	var cols []string
+	if c.cluster != "" {
+		cols = append(cols, "cluster")
+	}
+	cols = append(cols, "namespace")
+	for _, k := range c.labelKeys {
+		cols = append(cols, "label_"+k)
+	}
+	if c.ids {
+		cols = append(cols, idColumns...)
+	}
+	if c.includeInit || c.includeEphemeral {
+		cols = append(cols, "container_type")
+	}
+	if c.images {
+		cols = append(cols, "image")
+	}
+	cols = append(cols, cpuLimitColumn)
+	return append(cols, storageColumns(c.storage, c.pvc)...)
+}
+
+func (c *k8sCollector) listOptions() metav1.ListOptions {
+	listOpts := metav1.ListOptions{}
+	if c.selector != "" {
+		listOpts.LabelSelector = c.selector
+	}
+	return listOpts
+}
+
+// podStorage reads the storage stats of the watched pods from the kubelet
+// summaries of their nodes, through the API server's node proxy (which
+// needs get on nodes/proxy). Nodes that fail are left out.
+func (c *k8sCollector) podStorage(ctx context.Context) map[string]*kubeletPodStats {
+	c.mu.Lock()
+	nodes := map[string]bool{}
+	for _, p := range c.pods {
+		if p.node != "" {
+			nodes[p.node] = true
 		}
+	}
+	c.mu.Unlock()
 
-		// Build limits map: namespace/pod/container -> (cpuMillis, memBytes).
-		type limits struct {
-			cpuMillis int64
-			memBytes  int64
+	out := map[string]*kubeletPodStats{}
+	for node := range nodes {
+		nodeCtx, done := context.WithTimeout(ctx, apiTimeout)
+		raw, err := c.clientset.CoreV1().RESTClient().Get().
+			AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").DoRaw(nodeCtx)
+		done()
+		var sum kubeletSummary
+		if err == nil {
+			err = json.Unmarshal(raw, &sum)
 		}
-		limitsMap := make(map[string]limits)
-		for _, pod := range pods.Items {
-			for _, c := range pod.Spec.Containers {
-				key := pod.Namespace + "/" + pod.Name + "/" + c.Name
-				var lim limits
-				if cpuLim, ok := c.Resources.Limits["cpu"]; ok {
-					lim.cpuMillis = cpuLim.MilliValue()
-				}
-				if memLim, ok := c.Resources.Limits["memory"]; ok {
-					lim.memBytes = memLim.Value()
-				}
-				limitsMap[key] = lim
-			}
+		if err != nil {
+			logf("storage stats of node %s: %v", node, err)
+			continue
 		}
+		for i := range sum.Pods {
+			p := &sum.Pods[i]
+			out[p.PodRef.Namespace+"/"+p.PodRef.Name] = p
+		}
+	}
+	return out
+}
 
-		podMetrics, err := metricsClient.MetricsV1beta1().PodMetricses(namespace).List(context.Background(), listOpts)
-		if err != nil {
-			logf("PodMetrics.List error: %v", err)
-			return
+// Discover returns the watched pods, waiting for the initial list on the
+// first ticks.
+func (c *k8sCollector) Discover(ctx context.Context) ([]string, error) {
+	if !c.informer.HasSynced() {
+		syncCtx, done := context.WithTimeout(ctx, apiTimeout)
+		defer done()
+		if !cache.WaitForCacheSync(syncCtx.Done(), c.informer.HasSynced) {
+			return nil, fmt.Errorf("%w: pod watch not synced", collector.ErrUnreachable)
 		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Sorted(maps.Keys(c.pods)), nil
+}
 
-		ts := time.Now().UTC()
-		for _, pm := range podMetrics.Items {
-			for _, cm := range pm.Containers {
-				key := pm.Namespace + "/" + pm.Name + "/" + cm.Name
-				displayName := pm.Namespace + "/" + pm.Name
+func (c *k8sCollector) Sample(ctx context.Context) ([]record, error) {
+	metricsCtx, done := context.WithTimeout(ctx, apiTimeout)
+	defer done()
+	podMetrics, err := c.metricsClient.MetricsV1beta1().PodMetricses(c.namespace).List(metricsCtx, c.listOptions())
+	if err != nil {
+		return nil, fmt.Errorf("PodMetrics.List: %w", err)
+	}
+	var storage map[string]*kubeletPodStats
+	if c.storage || c.pvc {
+		storage = c.podStorage(ctx)
+	}
 
-				cpuUsedMillis := cm.Usage.Cpu().MilliValue()
-				memUsedBytes := cm.Usage.Memory().Value()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []record
+	for _, pm := range podMetrics.Items {
+		for _, cm := range pm.Containers {
+			pod, ok := c.pods[pm.Namespace+"/"+pm.Name]
+			if !ok {
+				continue // filtered out by --field-selector or --pod-regex, or not seen yet
+			}
+			ctype := cmp.Or(pod.types[cm.Name], regularContainer)
+			if (ctype == initContainer && !c.includeInit) || (ctype == ephemeralContainer && !c.includeEphemeral) {
+				continue
+			}
+			name := pod.containerName(pm.Name, cm.Name)
 
-				memUsageMB := float64(memUsedBytes) / (1024 * 1024)
-				var memLimitMB, memPct, cpuPct float64
+			cpuUsedMillis := cm.Usage.Cpu().MilliValue()
+			memUsedBytes := cm.Usage.Memory().Value()
 
-				if lim, ok := limitsMap[key]; ok {
-					if lim.cpuMillis > 0 {
-						cpuPct = float64(cpuUsedMillis) / float64(lim.cpuMillis) * 100.0
-					}
-					if lim.memBytes > 0 {
-						memLimitMB = float64(lim.memBytes) / (1024 * 1024)
-						memPct = float64(memUsedBytes) / float64(lim.memBytes) * 100.0
-					}
+			r := record{
+				Container:  name,
+				MemUsageMB: float64(memUsedBytes) / (1024 * 1024),
+				Extra:      map[string]float64{cpuLimitColumn: float64(pod.limits[cm.Name].cpuMillis)},
+			}
+			withAttr(&r, "cluster", c.cluster)
+			withAttr(&r, "namespace", pm.Namespace)
+			if lim, ok := pod.limits[cm.Name]; ok {
+				if lim.cpuMillis > 0 {
+					r.CPUPct = float64(cpuUsedMillis) / float64(lim.cpuMillis) * 100.0
 				}
-
-				writeRow(w, ts, displayName, cpuPct, memUsageMB, memLimitMB, memPct)
-				logf("  %s  cpu=%.2f%%  mem=%.1f/%.1f MB (%.2f%%)",
-					displayName, cpuPct, memUsageMB, memLimitMB, memPct)
+				if lim.memBytes > 0 {
+					r.MemLimitMB = float64(lim.memBytes) / (1024 * 1024)
+					r.MemPct = float64(memUsedBytes) / float64(lim.memBytes) * 100.0
+				}
+			}
+			for _, k := range c.labelKeys {
+				withAttr(&r, "label_"+k, pod.labels[k])
+			}
+			if c.ids {
+				withAttr(&r, "container_id", pod.containerIDs[cm.Name])
+				withAttr(&r, "host", pod.node)
+			}
+			if c.includeInit || c.includeEphemeral {
+				withAttr(&r, "container_type", ctype)
+			}
+			if c.images {
+				withAttr(&r, "image", pod.images[cm.Name])
+			}
+			if ps := storage[pm.Namespace+"/"+pm.Name]; ps != nil {
+				ps.addStorage(&r, c.storage, c.pvc)
 			}
+			out = append(out, r)
 		}
 	}
+	return out, nil
+}
 
-	// Collect immediately, then on ticker.
-	collect()
-	for {
-		select {
-		case <-stopCh:
-			logf("Kubernetes daemon stopped")
-			return nil
-		case <-ticker.C:
-			collect()
-		}
-	}
+func init() {
+	collector.Register(collector.Kind{
+		Name:    "docker",
+		Title:   "Docker",
+		Backend: "Docker daemon",
+		Help:    "Collect Docker container stats via Docker Engine API",
+		Outfile: "docker-stats.csv",
+		Flags: func(fs *flag.FlagSet) func(ctx context.Context) (collector.Collector, error) {
+			var ep dockerEndpoint
+			fs.StringVar(&ep.Host, "docker-host", "", "Docker `endpoint`: unix:///path/docker.sock, tcp://host:2376, ssh://[user@]host[:port] or rootless ($XDG_RUNTIME_DIR/docker.sock) (default $DOCKER_HOST, else rootful, else rootless)")
+			fs.StringVar(&ep.CACert, "tlscacert", "", "CA certificate `file` of a tcp:// --docker-host")
+			fs.StringVar(&ep.Cert, "tlscert", "", "Client certificate `file` for a tcp:// --docker-host")
+			fs.StringVar(&ep.Key, "tlskey", "", "Client key `file` for a tcp:// --docker-host")
+			ids := fs.Bool("ids", false, "Also record container_id and host columns, to tell apart containers with the same name")
+			compose := fs.Bool("compose", false, "Also record compose_project and compose_service columns from the Docker Compose labels (see --group-by service)")
+			project := fs.String("compose-project", "", "Only collect the containers of this Docker Compose project (implies --compose)")
+			var filterLabels stringList
+			fs.Var(&filterLabels, "filter-label", "Only collect the containers with this label, `key` or key=value (repeatable, all must match)")
+			labels := fs.String("labels", "", "Comma-separated container label keys to record as label_<key> columns")
+			health := fs.Bool("health", false, "Also record the health check status (healthy, unhealthy, starting) and mark its changes in the events file")
+			images := fs.Bool("images", false, "Also record the image and image_id columns: the image reference (name:tag or @digest) each container runs and the ID of that image")
+			return func(ctx context.Context) (collector.Collector, error) {
+				var labelKeys []string
+				for _, k := range strings.Split(*labels, ",") {
+					if k = strings.TrimSpace(k); k != "" {
+						labelKeys = append(labelKeys, k)
+					}
+				}
+				return newDockerCollector(ctx, ep, *ids, *compose, *project, filterLabels, labelKeys, *health, *images)
+			}
+		},
+	})
+	collector.Register(collector.Kind{
+		Name:    "kubernetes",
+		Aliases: []string{"k8s"},
+		Title:   "Kubernetes",
+		Backend: "Kubernetes API",
+		Help:    "Collect Kubernetes pod stats via metrics API",
+		Outfile: "k8s-stats.csv",
+		Flags: func(fs *flag.FlagSet) func(ctx context.Context) (collector.Collector, error) {
+			namespace := fs.String("namespace", "", "Kubernetes namespace (empty = all namespaces)")
+			selector := fs.String("selector", "", "Label selector (e.g. app=web)")
+			fieldSelector := fs.String("field-selector", "", "Pod field selector (e.g. spec.nodeName=node-1,status.phase=Running)")
+			podRegex := fs.String("pod-regex", "", "Only collect the pods whose name matches this `regex` (e.g. ^db-[0-9]+$ for a StatefulSet)")
+			kubeContext := fs.String("context", "", "Kubeconfig context to use; several comma-separated contexts collect from each cluster, named by context in the cluster column")
+			cluster := fs.String("cluster", "", "Cluster `name` to record in the cluster column, for captures merged across clusters")
+			labels := fs.String("labels", "", "Comma-separated pod label keys to record as label_<key> columns")
+			ids := fs.Bool("ids", false, "Also record container_id and host (node) columns, to tell apart containers with the same name")
+			includeInit := fs.Bool("include-init", false, "Also collect running init containers, as <pod>:<container> with a container_type column")
+			includeEphemeral := fs.Bool("include-ephemeral", false, "Also collect ephemeral (debug) containers, as <pod>:<container> with a container_type column")
+			images := fs.Bool("images", false, "Also record the image column: the image reference (name:tag or @digest) of each container's spec")
+			storage := fs.Bool("storage", false, "Also record each pod's ephemeral storage use (ephemeral_storage_mb; needs get on nodes/proxy)")
+			pvc := fs.Bool("pvc", false, "Also record the use of each pod's persistent volume claims (pvc_used_mb, pvc_used_pct; needs get on nodes/proxy)")
+			events := fs.Bool("events", false, "Record OOM kills, evictions, back-offs and scheduling failures of the collected pods in the events file (needs list/watch on events)")
+			return func(ctx context.Context) (collector.Collector, error) {
+				var labelKeys []string
+				for _, k := range strings.Split(*labels, ",") {
+					if k = strings.TrimSpace(k); k != "" {
+						labelKeys = append(labelKeys, k)
+					}
+				}
+				contexts := strings.Split(*kubeContext, ",")
+				if len(contexts) == 1 {
+					return newK8sCollector(ctx, *namespace, *selector, *fieldSelector, *podRegex, *kubeContext, *cluster, labelKeys, *ids, *includeInit, *includeEphemeral, *images, *events, *storage, *pvc)
+				}
+				if *cluster != "" {
+					return nil, errors.New("--cluster names one cluster; with several --context the context names are used")
+				}
+				clusters := &multiCollector{what: "cluster"}
+				for _, kc := range contexts {
+					c, err := newK8sCollector(ctx, *namespace, *selector, *fieldSelector, *podRegex, kc, kc, labelKeys, *ids, *includeInit, *includeEphemeral, *images, *events, *storage, *pvc)
+					if err != nil {
+						clusters.Close()
+						return nil, fmt.Errorf("context %s: %w", kc, err)
+					}
+					clusters.add(kc, c)
+				}
+				return clusters, nil
+			}
+		},
+	})
 }
 
 // --- Entrypoint ---
 
 func runDaemon(args []string) {
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, `Usage: cstats daemon <docker|kubernetes> [flags]
+	var interval *int
+	var outfile *string
+	var newCollector func(ctx context.Context) (collector.Collector, error)
+	var debugFlag *bool
+	var markAddr *string
+	var splitNS *bool
+	var reportEvery *time.Duration
+	var reportDir *string
+	var chdir *string
+	common := func(fs *flag.FlagSet, defaultOutfile string) {
+		interval = fs.Int("interval", 5, "Collection interval in seconds")
+		outfile = fs.String("outfile", defaultOutfile, "Output CSV file path")
+		splitNS = fs.Bool("split-by-namespace", false, "Also write the samples of each namespace to <outfile>-<namespace>.csv (kubernetes, kubelet)")
+		sinksFlag(fs)
+		debugFlag = fs.Bool("debug", false, "Enable debug logging")
+		pprofFlag(fs)
+		selfFlag(fs)
+		grafanaFlag(fs)
+		markAddr = fs.String("mark-addr", "", "Listen on `host:port` for POST /mark?label=... to add markers to the events file")
+		reportEvery = fs.Duration("report-every", 0, "Render an HTML report and summary JSON of every `period` (e.g. 24h, aligned to midnight UTC) into --report-dir")
+		reportDir = fs.String("report-dir", "reports", "Directory of the --report-every reports")
+		chdir = fs.String("chdir", "", "Change to this `directory` first, which relative paths are then relative to (set by daemon install for Windows services)")
+	}
+	register := func(fs *flag.FlagSet, kind collector.Kind) {
+		common(fs, kind.Outfile)
+		newCollector = kind.Flags(fs)
+	}
+	const intro = `With --sources instead of a subcommand, collects from several backends into
+one capture with a source column: cstats daemon --sources docker,kubernetes.
+The flags of each source take its name as a prefix (--kubernetes.namespace),
+or come from the [daemon <source>] section of --config.
+
+cstats daemon install <subcommand> [flags] registers the daemon as a service
+started on boot (systemd, launchd or Windows); cstats daemon uninstall
+removes it.
 
-Subcommands:
-  docker       Collect Docker container stats via Docker Engine API
-  kubernetes   Collect Kubernetes pod stats via metrics API
+`
 
-Run "cstats daemon <subcommand> -h" for subcommand-specific flags.
-`)
-		os.Exit(1)
+	var install *service
+	if len(args) > 0 && (args[0] == "install" || args[0] == "uninstall") {
+		install = parseService(args[0], args[1:])
+		if install.action == "uninstall" {
+			install.run()
+			return
+		}
+		// Parsed below like the daemon's own, to catch mistakes now.
+		args = install.args
+	}
+
+	var kind collector.Kind
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && !slices.Contains([]string{"-h", "-help", "--help"}, args[0]) {
+		fs := newFlagSet("daemon --sources")
+		common(fs, "")
+		sources := fs.String("sources", "", "Comma-separated collectors to run together, e.g. docker,kubernetes")
+		set := newSourceSet(fs)
+		parseFlags(fs, args)
+		if *sources == "" {
+			collectorCommand("daemon", intro, nil, register)
+		}
+		var err error
+		if kind, err = set.resolve(*sources); err != nil {
+			log.Fatal(err)
+		}
+		if *outfile == "" {
+			*outfile = kind.Outfile
+		}
+		newCollector = set.collector
+	} else {
+		kind = collectorCommand("daemon", intro, args, register)
+		fs := newFlagSet("daemon " + kind.Name)
+		register(fs, kind)
+		parseFlags(fs, args[1:])
 	}
+	if *debugFlag {
+		minLevel = levelDebug
+	}
+	if *reportEvery != 0 && *reportEvery < time.Duration(*interval)*time.Second {
+		log.Fatal("--report-every must be at least --interval")
+	}
+	if install != nil {
+		install.kind = kind.Name
+		install.run()
+		return
+	}
+	if *chdir != "" {
+		if err := os.Chdir(*chdir); err != nil {
+			log.Fatalf("--chdir: %v", err)
+		}
+	}
+	startDiagnostics()
+	startMarkServer(*markAddr, eventsPath(*outfile))
 
 	stopCh := make(chan struct{})
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer notifyService(sigCh)()
 	go func() {
 		<-sigCh
 		logf("Received shutdown signal")
 		close(stopCh)
 	}()
+	ctx, cancel := stopContext(stopCh)
+	defer cancel()
 
-	sub := args[0]
-	switch sub {
-	case "docker":
-		fs := flag.NewFlagSet("daemon docker", flag.ExitOnError)
-		interval := fs.Int("interval", 5, "Collection interval in seconds")
-		outfile := fs.String("outfile", "docker-stats.csv", "Output CSV file path")
-		debugFlag := fs.Bool("debug", false, "Enable debug logging")
-		fs.Parse(args[1:])
-		debug = *debugFlag
-
-		if err := runDockerDaemon(stopCh, *interval, *outfile); err != nil {
-			log.Fatalf("docker daemon: %v", err)
+	c, err := newCollector(ctx)
+	if err != nil {
+		log.Fatalf("%s daemon: %v", kind.Name, err)
+	}
+	var sinks []sink.Sink
+	if *splitNS {
+		cols := c.Columns()
+		if !slices.Contains(cols, "namespace") {
+			log.Fatalf("--split-by-namespace: the %s collector has no namespace column", kind.Name)
 		}
-
-	case "kubernetes", "k8s":
-		fs := flag.NewFlagSet("daemon kubernetes", flag.ExitOnError)
-		interval := fs.Int("interval", 5, "Collection interval in seconds")
-		outfile := fs.String("outfile", "k8s-stats.csv", "Output CSV file path")
-		namespace := fs.String("namespace", "", "Kubernetes namespace (empty = all namespaces)")
-		selector := fs.String("selector", "", "Label selector (e.g. app=web)")
-		kubeContext := fs.String("context", "", "Kubeconfig context to use")
-		debugFlag := fs.Bool("debug", false, "Enable debug logging")
-		fs.Parse(args[1:])
-		debug = *debugFlag
-
-		if err := runK8sDaemon(stopCh, *interval, *outfile, *namespace, *selector, *kubeContext); err != nil {
-			log.Fatalf("kubernetes daemon: %v", err)
+		sinks = append(sinks, newSplitSink(*outfile, "namespace", cols, kind.Name, time.Duration(*interval)*time.Second))
+	}
+	if *reportEvery > 0 {
+		reports, err := newReportSink(*outfile, *reportDir, *reportEvery, time.Duration(*interval)*time.Second)
+		if err != nil {
+			log.Fatalf("%s daemon: %v", kind.Name, err)
 		}
-
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown daemon subcommand: %s\nUse 'docker' or 'kubernetes'.\n", sub)
-		os.Exit(1)
+		sinks = append(sinks, reports)
+	}
+	if err := runCollector(ctx, kind, c, *interval, *outfile, sinks...); err != nil {
+		log.Fatalf("%s daemon: %v", kind.Name, err)
 	}
 }
 
@@ -0,0 +1,157 @@
+package cstats
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/saveugene/cstats/sink"
+)
+
+// ddSeries is a series of the Datadog v2 metrics API.
+type ddSeries struct {
+	Metric string    `json:"metric"`
+	Type   int       `json:"type"` // 3 = gauge
+	Points []ddPoint `json:"points"`
+	Tags   []string  `json:"tags"`
+}
+
+type ddPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// datadogSink submits samples as gauges to the Datadog metrics API, tagged
+// with container_name and host. Points are batched until batch of them are
+// buffered or every has passed since the last submission.
+type datadogSink struct {
+	url    string
+	apiKey string
+	prefix string
+	tags   []string
+	host   string
+	batch  int
+	every  time.Duration
+	client *http.Client
+
+	buf  []ddSeries
+	last time.Time
+}
+
+func openDatadogSink(arg string) (*datadogSink, error) {
+	opts, err := parseSinkArgs(arg, "site", "url", "prefix", "tag", "batch", "every")
+	if err != nil {
+		return nil, err
+	}
+	s := &datadogSink{
+		apiKey: os.Getenv("DD_API_KEY"),
+		prefix: "cstats",
+		tags:   opts["tag"],
+		batch:  1000,
+		every:  10 * time.Second,
+		client: &http.Client{Timeout: 10 * time.Second},
+		last:   time.Now(),
+	}
+	if s.apiKey == "" {
+		return nil, errors.New("set DD_API_KEY to the Datadog API key")
+	}
+	site := opts.Get("site")
+	if site == "" {
+		site = os.Getenv("DD_SITE")
+	}
+	if site == "" {
+		site = "datadoghq.com"
+	}
+	s.url = "https://api." + site + "/api/v2/series"
+	if v := opts.Get("url"); v != "" {
+		s.url = v
+	}
+	if v := opts.Get("prefix"); v != "" {
+		s.prefix = v
+	}
+	if v := opts.Get("batch"); v != "" {
+		if s.batch, err = strconv.Atoi(v); err != nil || s.batch < 1 {
+			return nil, fmt.Errorf("batch must be a positive number of points, got %q", v)
+		}
+	}
+	if v := opts.Get("every"); v != "" {
+		if s.every, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("every: %w", err)
+		}
+	}
+	s.host, _ = os.Hostname()
+	return s, nil
+}
+
+func (s *datadogSink) Write(r record) error {
+	host := r.Attrs["host"]
+	if host == "" {
+		host = s.host
+	}
+	tags := append([]string{"container_name:" + r.Container, "host:" + host}, s.tags...)
+	ts := r.Timestamp.Unix()
+	for _, m := range []struct {
+		name string
+		v    float64
+	}{{"cpu_pct", r.CPUPct}, {"mem_usage_mb", r.MemUsageMB}, {"mem_limit_mb", r.MemLimitMB}, {"mem_pct", r.MemPct}} {
+		s.buf = append(s.buf, ddSeries{Metric: s.prefix + "." + m.name, Type: 3, Points: []ddPoint{{ts, m.v}}, Tags: tags})
+	}
+	return nil
+}
+
+// Flush submits the buffered points once the batch is full or due.
+func (s *datadogSink) Flush() error {
+	if len(s.buf) < s.batch && time.Since(s.last) < s.every {
+		return nil
+	}
+	return s.submit()
+}
+
+func (s *datadogSink) Close() error { return s.submit() }
+
+// submit posts the buffered points. They are dropped on failure, so an
+// unreachable API does not grow the buffer without bound.
+func (s *datadogSink) submit() error {
+	s.last = time.Now()
+	if len(s.buf) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(map[string]any{"series": s.buf})
+	n := len(s.buf)
+	s.buf = s.buf[:0]
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", s.apiKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("datadog: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("datadog: %s: %s (%d points dropped)", resp.Status, bytes.TrimSpace(msg), n)
+	}
+	logf("datadog: submitted %d points", n)
+	return nil
+}
+
+func init() {
+	sink.Register(sink.Kind{
+		Name:   "datadog",
+		Help:   "gauges to the Datadog metrics API ($DD_API_KEY); arg: site=, url=, prefix=, tag=k:v, batch=<points>, every=<duration>",
+		Remote: true,
+		Open:   func(arg string, cols []string) (sink.Sink, error) { return openDatadogSink(arg) },
+	})
+}
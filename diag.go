@@ -0,0 +1,55 @@
+package cstats
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"time"
+)
+
+// Self-diagnostics, served with expvar at /debug/vars of --pprof-addr.
+var (
+	rowsWritten   = expvar.NewInt("rows_written")
+	csvParses     = expvar.NewInt("csv_parses")
+	parseSeconds  = expvar.NewFloat("csv_parse_seconds")
+	figuresBuilt  = expvar.NewInt("figures_built")
+	figureSeconds = expvar.NewFloat("figure_build_seconds")
+	figuresServed = expvar.NewInt("figures_served")
+	serveSeconds  = expvar.NewFloat("figure_serve_seconds")
+)
+
+// timed counts one more operation in n and adds the time since start to
+// total; call it deferred.
+func timed(n *expvar.Int, total *expvar.Float, start time.Time) {
+	n.Add(1)
+	total.Add(time.Since(start).Seconds())
+}
+
+// pprofAddr is where --pprof-addr serves the diagnostics ("" = off).
+var pprofAddr string
+
+// pprofFlag registers --pprof-addr on fs.
+func pprofFlag(fs *flag.FlagSet) {
+	fs.StringVar(&pprofAddr, "pprof-addr", "", "Serve net/http/pprof and expvar counters on this address, e.g. 127.0.0.1:6060 (unauthenticated: keep it local)")
+}
+
+// startDiagnostics serves /debug/pprof/ and /debug/vars on --pprof-addr,
+// if set. They are registered on http.DefaultServeMux, which the live
+// server does not use.
+func startDiagnostics() {
+	if pprofAddr == "" {
+		return
+	}
+	ln, err := net.Listen("tcp", pprofAddr)
+	if err != nil {
+		log.Fatalf("--pprof-addr: %v", err)
+	}
+	fmt.Printf("Diagnostics: http://%s/debug/pprof/ and /debug/vars\n", ln.Addr())
+	go func() {
+		warnf("diagnostics server: %v", http.Serve(ln, nil))
+	}()
+}
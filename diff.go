@@ -0,0 +1,300 @@
+package cstats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// baseline is the compact summary of a capture that later runs are diffed
+// against: the budget metrics of each container.
+type baseline struct {
+	Version    int                           `json:"version"`
+	Source     string                        `json:"source"`
+	Created    time.Time                     `json:"created"`
+	Containers map[string]map[string]float64 `json:"containers"`
+}
+
+// newBaseline summarizes stats into a baseline.
+func newBaseline(source string, stats map[string]*containerStats) baseline {
+	b := baseline{Version: 1, Source: source, Created: time.Now().UTC().Truncate(time.Second), Containers: map[string]map[string]float64{}}
+	for c, s := range stats {
+		m := map[string]float64{}
+		for name, metric := range budgetMetrics {
+			m[name] = round2(metric(s))
+		}
+		b.Containers[c] = m
+	}
+	return b
+}
+
+func loadBaseline(path string) (baseline, error) {
+	var b baseline
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return b, err
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return b, fmt.Errorf("%s: %w", path, err)
+	}
+	if b.Version != 1 {
+		return b, fmt.Errorf("%s: unsupported baseline version %d", path, b.Version)
+	}
+	return b, nil
+}
+
+func writeBaseline(path string, b baseline) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// tolerance is how much a metric may grow over the baseline: by Abs in the
+// metric's unit and/or by Pct percent (0 = not set).
+type tolerance struct {
+	Abs, Pct float64
+}
+
+// exceeded reports whether growing from base to cand breaks the tolerance:
+// it must exceed every bound that is set.
+func (t tolerance) exceeded(base, cand float64) bool {
+	delta := cand - base
+	if delta <= 0 {
+		return false
+	}
+	if t.Abs > 0 && delta <= t.Abs {
+		return false
+	}
+	if t.Pct > 0 && base > 0 && delta/base*100 <= t.Pct {
+		return false
+	}
+	return true
+}
+
+func (t tolerance) String() string {
+	var parts []string
+	if t.Abs > 0 {
+		parts = append(parts, "+"+strconv.FormatFloat(t.Abs, 'f', -1, 64))
+	}
+	if t.Pct > 0 {
+		parts = append(parts, "+"+strconv.FormatFloat(t.Pct, 'f', -1, 64)+"%")
+	}
+	if len(parts) == 0 {
+		return "no increase"
+	}
+	return strings.Join(parts, " and ")
+}
+
+// defaultTolerances apply when no --tolerance is given.
+var defaultTolerances = []string{"cpu_p95_pct=10%", "mem_max_mb=10%"}
+
+// parseTolerances parses --tolerance rules, "metric=abs" or "metric=pct%";
+// a metric may be given both. Only the metrics named are compared.
+func parseTolerances(specs []string) (map[string]tolerance, error) {
+	tols := map[string]tolerance{}
+	for _, spec := range specs {
+		metric, v, ok := strings.Cut(spec, "=")
+		metric = strings.TrimSpace(metric)
+		if !ok {
+			return nil, fmt.Errorf("invalid --tolerance %q, want metric=value or metric=value%%", spec)
+		}
+		if _, ok := budgetMetrics[metric]; !ok {
+			return nil, fmt.Errorf("invalid --tolerance %q: unknown metric %q (use %s)", spec, metric,
+				strings.Join(slices.Sorted(maps.Keys(budgetMetrics)), ", "))
+		}
+		v = strings.TrimSpace(v)
+		pct := strings.HasSuffix(v, "%")
+		n, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid --tolerance %q: want a non-negative number", spec)
+		}
+		t := tols[metric]
+		if pct {
+			t.Pct = n
+		} else {
+			t.Abs = n
+		}
+		tols[metric] = t
+	}
+	return tols, nil
+}
+
+// diffResult is one metric of one container against the baseline. Note
+// explains containers found on only one side, which never fail.
+type diffResult struct {
+	Container string
+	Metric    string
+	Base      float64
+	Cand      float64
+	Tolerance tolerance
+	Failed    bool
+	Note      string
+}
+
+// diffBaseline compares stats with the baseline on the tolerated metrics.
+func diffBaseline(base baseline, stats map[string]*containerStats, tols map[string]tolerance) []diffResult {
+	var results []diffResult
+	metrics := slices.Sorted(maps.Keys(tols))
+	names := slices.Sorted(maps.Keys(base.Containers))
+	for _, c := range slices.Sorted(maps.Keys(stats)) {
+		if !slices.Contains(names, c) {
+			results = append(results, diffResult{Container: c, Note: "new, not in the baseline"})
+			continue
+		}
+		for _, m := range metrics {
+			b, ok := base.Containers[c][m]
+			if !ok {
+				continue
+			}
+			cand := round2(budgetMetrics[m](stats[c]))
+			results = append(results, diffResult{Container: c, Metric: m, Base: b, Cand: cand,
+				Tolerance: tols[m], Failed: tols[m].exceeded(b, cand)})
+		}
+	}
+	for _, c := range names {
+		if stats[c] == nil {
+			results = append(results, diffResult{Container: c, Note: "missing from this run"})
+		}
+	}
+	return results
+}
+
+func (r diffResult) message() string {
+	return fmt.Sprintf("%s of %s went %s, over the tolerance of %s", r.Metric, r.Container, formatDelta(r.Base, r.Cand), r.Tolerance)
+}
+
+// writeDiffText prints one line per compared metric and a total.
+func writeDiffText(w io.Writer, results []diffResult) error {
+	failed, compared := 0, 0
+	for _, r := range results {
+		if r.Note != "" {
+			fmt.Fprintf(w, "NOTE  %s  %s\n", r.Container, r.Note)
+			continue
+		}
+		compared++
+		status := "PASS"
+		if r.Failed {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%s  %s  %s  %s (tolerance %s)\n", status, r.Container, r.Metric, formatDelta(r.Base, r.Cand), r.Tolerance)
+	}
+	_, err := fmt.Fprintf(w, "%d of %d metrics regressed\n", failed, compared)
+	return err
+}
+
+// writeDiffMarkdown renders results as a Markdown table of deltas,
+// regressions first.
+func writeDiffMarkdown(w io.Writer, name string, base baseline, results []diffResult) error {
+	failed, compared := 0, 0
+	for _, r := range results {
+		if r.Note == "" {
+			compared++
+		}
+		if r.Failed {
+			failed++
+		}
+	}
+	fmt.Fprintf(w, "### Resource diff: %s against %s\n\n%d of %d metrics regressed.\n\n", name, base.Source, failed, compared)
+	fmt.Fprintln(w, "| | Container | Metric | Baseline → now | Tolerance |")
+	fmt.Fprintln(w, "| :---: | :--- | :--- | ---: | :--- |")
+	sorted := slices.Clone(results)
+	slices.SortStableFunc(sorted, func(a, b diffResult) int {
+		if a.Failed == b.Failed {
+			return 0
+		}
+		if a.Failed {
+			return -1
+		}
+		return 1
+	})
+	for _, r := range sorted {
+		c := strings.ReplaceAll(r.Container, "|", `\|`)
+		switch {
+		case r.Note != "":
+			fmt.Fprintf(w, "| ℹ️ | %s | | %s | |\n", c, r.Note)
+		case r.Failed:
+			fmt.Fprintf(w, "| ❌ | %s | %s | %s | %s |\n", c, r.Metric, formatDelta(r.Base, r.Cand), r.Tolerance)
+		default:
+			fmt.Fprintf(w, "| ✅ | %s | %s | %s | %s |\n", c, r.Metric, formatDelta(r.Base, r.Cand), r.Tolerance)
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func runDiff(args []string) {
+	fs := newFlagSet("diff")
+	csvPath := fs.String("csv", "docker-stats.csv", "Path or http(s) URL of the CSV file")
+	baselinePath := fs.String("baseline", "", "Baseline JSON to compare against (required)")
+	update := fs.Bool("update-baseline", false, "Write the capture's summary to --baseline instead of comparing")
+	var specs stringList
+	fs.Var(&specs, "tolerance", "Allowed growth `metric=value` or metric=value% (repeatable; both bounds must be exceeded to fail; default "+strings.Join(defaultTolerances, ", ")+")")
+	remoteFlags(fs)
+	view := registerViewFlags(fs)
+	strictFlag(fs)
+	dedupeFlag(fs)
+	githubFlag(fs)
+	parseFlags(fs, args)
+	if fs.NArg() > 0 {
+		*csvPath = fs.Arg(0)
+	}
+	if *baselinePath == "" {
+		log.Fatal("--baseline is required")
+	}
+	if err := view.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if len(specs) == 0 {
+		specs = defaultTolerances
+	}
+	tols, err := parseTolerances(specs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	containers, stats := captureStats(*csvPath, view)
+
+	if *update {
+		if err := writeBaseline(*baselinePath, newBaseline(*csvPath, stats)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Wrote baseline of %d containers -> %s\n", len(containers), *baselinePath)
+		return
+	}
+	base, err := loadBaseline(*baselinePath)
+	if err != nil {
+		log.Fatalf("Error reading baseline: %v (create it with --update-baseline)", err)
+	}
+	results := diffBaseline(base, stats, tols)
+	if err := writeDiffText(os.Stdout, results); err != nil {
+		log.Fatal(err)
+	}
+	if githubMode {
+		for _, r := range results {
+			if r.Failed {
+				githubAnnotate("error", "Resource regression", r.message())
+			}
+			if r.Note != "" {
+				githubAnnotate("notice", "Resource diff", r.Container+": "+r.Note)
+			}
+		}
+		err := githubStepSummary(func(w io.Writer) error {
+			return writeDiffMarkdown(w, *csvPath, base, results)
+		})
+		if err != nil {
+			warnf("%v", err)
+		}
+	}
+	if slices.ContainsFunc(results, func(r diffResult) bool { return r.Failed }) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,163 @@
+package cstats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	dockerclient "github.com/docker/docker/client"
+)
+
+// dockerEndpoint is the Docker Engine the docker collector connects to, from
+// --docker-host and the TLS flags. Unset fields keep what the environment
+// ($DOCKER_HOST, $DOCKER_TLS_VERIFY, $DOCKER_CERT_PATH) says.
+type dockerEndpoint struct {
+	Host   string // unix://, tcp://, ssh:// or "rootless"
+	CACert string
+	Cert   string
+	Key    string
+}
+
+// defaultDockerSocket is where rootful Docker listens.
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// rootlessSocket returns the socket of the rootless Docker of this user.
+func rootlessSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return filepath.Join(dir, "docker.sock")
+}
+
+// clientOpts turns the endpoint into Docker client options. With neither
+// --docker-host nor $DOCKER_HOST, a rootless Docker is used when the
+// rootful socket is missing.
+func (e dockerEndpoint) clientOpts() ([]dockerclient.Opt, error) {
+	opts := []dockerclient.Opt{dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation()}
+	host := e.Host
+	if host == "" && os.Getenv("DOCKER_HOST") == "" {
+		if _, err := os.Stat(defaultDockerSocket); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Stat(rootlessSocket()); err == nil {
+				host = "rootless"
+			}
+		}
+	}
+	switch {
+	case host == "":
+	case host == "rootless":
+		opts = append(opts, dockerclient.WithHost("unix://"+rootlessSocket()))
+	case strings.HasPrefix(host, "ssh://"):
+		u, err := url.Parse(host)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("--docker-host: want ssh://[user@]host[:port], got %q", host)
+		}
+		// The host is a placeholder: every connection is a new ssh session.
+		opts = append(opts, dockerclient.WithHost("http://docker.example.com"), dockerclient.WithDialContext(sshDialer(u)))
+	case strings.HasPrefix(host, "unix://"), strings.HasPrefix(host, "tcp://"), strings.HasPrefix(host, "npipe://"):
+		opts = append(opts, dockerclient.WithHost(host))
+	default:
+		return nil, fmt.Errorf("--docker-host: want unix://, tcp://, ssh:// or rootless, got %q", host)
+	}
+	if e.CACert != "" || e.Cert != "" || e.Key != "" {
+		if strings.HasPrefix(host, "ssh://") || strings.HasPrefix(host, "unix://") || host == "rootless" {
+			return nil, errors.New("--tlscacert, --tlscert and --tlskey are for tcp:// hosts")
+		}
+		opts = append(opts, dockerclient.WithTLSClientConfig(e.CACert, e.Cert, e.Key))
+	}
+	return opts, nil
+}
+
+// sshDialer connects through `docker system dial-stdio` run on the remote
+// host over ssh, as the docker CLI does for ssh:// hosts. ssh reads its
+// keys, agent and known hosts as usual; it must not prompt.
+func sshDialer(u *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	args := []string{"-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// Not CommandContext: the session outlives the dial.
+		cmd := exec.Command("ssh", args...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		c := &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, host: u.Host}
+		cmd.Stderr = &c.stderr
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("ssh: %w", err)
+		}
+		return c, nil
+	}
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a command.
+// Deadlines are not supported; the client's timeouts cancel requests
+// instead.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	host   string
+	stderr bytes.Buffer
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+// wait reaps the command once, however many callers.
+func (c *commandConn) wait() error {
+	c.waitOnce.Do(func() { c.waitErr = c.cmd.Wait() })
+	return c.waitErr
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if errors.Is(err, io.EOF) && c.wait() != nil {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			err = fmt.Errorf("ssh %s: %s", c.host, msg)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	c.wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return dummyAddr("local") }
+func (c *commandConn) RemoteAddr() net.Addr { return dummyAddr(c.host) }
+
+func (c *commandConn) SetDeadline(time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+// dummyAddr is the net.Addr of a command connection.
+type dummyAddr string
+
+func (a dummyAddr) Network() string { return "ssh" }
+func (a dummyAddr) String() string  { return string(a) }
@@ -0,0 +1,93 @@
+package cstats
+
+import "math"
+
+// lttb selects up to threshold indices from the series (xs, ys) using the
+// largest-triangle-three-buckets algorithm. The first, last and global
+// maximum points are always kept so peaks survive downsampling. A threshold
+// <= 0 or >= len(ys) returns every index.
+func lttb(xs, ys []float64, threshold int) []int {
+	n := len(ys)
+	if threshold <= 0 || threshold >= n || n < 3 {
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx
+	}
+	if threshold < 3 {
+		threshold = 3
+	}
+
+	idx := make([]int, 0, threshold+1)
+	idx = append(idx, 0)
+
+	bucket := float64(n-2) / float64(threshold-2)
+	a := 0
+	for i := 0; i < threshold-2; i++ {
+		// Average of the next bucket is the third triangle vertex.
+		nextStart := int(math.Floor(float64(i+1)*bucket)) + 1
+		nextEnd := int(math.Floor(float64(i+2)*bucket)) + 1
+		if nextEnd > n {
+			nextEnd = n
+		}
+		var avgX, avgY float64
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += xs[j]
+			avgY += ys[j]
+		}
+		if cnt := float64(nextEnd - nextStart); cnt > 0 {
+			avgX /= cnt
+			avgY /= cnt
+		}
+
+		start := int(math.Floor(float64(i)*bucket)) + 1
+		end := nextStart
+		best, bestArea := start, -1.0
+		for j := start; j < end; j++ {
+			area := math.Abs((xs[a]-avgX)*(ys[j]-ys[a]) - (xs[a]-xs[j])*(avgY-ys[a]))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		idx = append(idx, best)
+		a = best
+	}
+	idx = append(idx, n-1)
+
+	// Peak preservation: splice the global maximum in if LTTB skipped it.
+	peak := 0
+	for i, y := range ys {
+		if y > ys[peak] {
+			peak = i
+		}
+	}
+	for i, v := range idx {
+		if v == peak {
+			return idx
+		}
+		if v > peak {
+			idx = append(idx[:i], append([]int{peak}, idx[i:]...)...)
+			return idx
+		}
+	}
+	return idx
+}
+
+// downsampleSeries extracts the metric val from time-ordered recs and
+// downsamples it to maxPoints. It returns the kept indices into recs and
+// their values.
+func downsampleSeries(recs []record, val func(record) float64, maxPoints int) ([]int, []float64) {
+	xs := make([]float64, len(recs))
+	ys := make([]float64, len(recs))
+	for i, r := range recs {
+		xs[i] = float64(r.Timestamp.UnixMilli())
+		ys[i] = val(r)
+	}
+	idx := lttb(xs, ys, maxPoints)
+	vals := make([]float64, len(idx))
+	for i, j := range idx {
+		vals[i] = ys[j]
+	}
+	return idx, vals
+}
@@ -0,0 +1,66 @@
+package cstats
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestLTTB(t *testing.T) {
+	series := func(ys ...float64) ([]float64, []float64) {
+		xs := make([]float64, len(ys))
+		for i := range xs {
+			xs[i] = float64(i)
+		}
+		return xs, ys
+	}
+	tests := []struct {
+		name      string
+		ys        []float64
+		threshold int
+		want      []int
+	}{
+		{name: "no threshold keeps everything", ys: []float64{1, 2, 3, 4}, threshold: 0, want: []int{0, 1, 2, 3}},
+		{name: "threshold above the length", ys: []float64{1, 2, 3}, threshold: 10, want: []int{0, 1, 2}},
+		{name: "too short to reduce", ys: []float64{1, 2}, threshold: 1, want: []int{0, 1}},
+		{name: "threshold raised to three", ys: []float64{0, 0, 5, 0, 0}, threshold: 1, want: []int{0, 2, 4}},
+		{name: "spike picked by its bucket", ys: []float64{0, 0, 0, 9, 0, 0, 0, 0}, threshold: 4, want: []int{0, 3, 4, 7}},
+		// The buckets' triangles favour the dip, so the lone peak is
+		// spliced back in, in index order.
+		{name: "peak spliced in", ys: []float64{5, 5, 6, 5, 5, 5, 0, 5, 5, 5}, threshold: 3, want: []int{0, 2, 6, 9}},
+		{name: "peak at the end is kept", ys: []float64{0, 1, 0, 1, 0, 1, 0, 9}, threshold: 3, want: []int{0, 6, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xs, ys := series(tt.ys...)
+			got := lttb(xs, ys, tt.threshold)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lttb(%v, %d) = %v, want %v", tt.ys, tt.threshold, got, tt.want)
+			}
+			if !slices.IsSorted(got) {
+				t.Errorf("indices %v are out of order", got)
+			}
+		})
+	}
+}
+
+// However far a series is reduced, its first, last and highest samples stay.
+func TestLTTBKeepsPeaks(t *testing.T) {
+	ys := make([]float64, 1000)
+	for i := range ys {
+		ys[i] = float64(i % 7)
+	}
+	ys[613] = 50
+	xs := make([]float64, len(ys))
+	for i := range xs {
+		xs[i] = float64(i)
+	}
+	for _, threshold := range []int{3, 10, 100, 999} {
+		t.Run(fmt.Sprint(threshold), func(t *testing.T) {
+			idx := lttb(xs, ys, threshold)
+			if len(idx) > threshold+1 || idx[0] != 0 || idx[len(idx)-1] != len(ys)-1 || !slices.Contains(idx, 613) {
+				t.Errorf("kept %d indices from %v to %v, with the peak: %v", len(idx), idx[0], idx[len(idx)-1], slices.Contains(idx, 613))
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package cstats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var unsafeSlugChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// pageSlug makes a container name safe for use as a file name
+// ("ns/pod-1" -> "ns_pod-1").
+func pageSlug(name string) string {
+	return unsafeSlugChars.ReplaceAllString(name, "_")
+}
+
+// pageSlugs returns distinct slugs of names: one that another name already
+// has ("ns/pod" and "ns_pod", or "Web" and "web" on a case-insensitive file
+// system) gets a short hash of its name appended.
+func pageSlugs(names []string) map[string]string {
+	slugs := make(map[string]string, len(names))
+	taken := map[string]bool{}
+	for _, name := range names {
+		slug := pageSlug(name)
+		if taken[strings.ToLower(slug)] {
+			sum := sha256.Sum256([]byte(name))
+			slug += "-" + hex.EncodeToString(sum[:4])
+		}
+		taken[strings.ToLower(slug)] = true
+		slugs[name] = slug
+	}
+	return slugs
+}
+
+// writeDrilldownPages writes one detail page per container into the
+// "<index>-containers" directory next to indexPath and returns the links
+// (relative to the index page) keyed by container.
+func writeDrilldownPages(indexPath string, records []record, themeName string, optsFor func(theme string) FigureOptions) (map[string]string, error) {
+	base := strings.TrimSuffix(indexPath, ".html")
+	dir := base + "-containers"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	back := "../" + filepath.Base(indexPath)
+
+	stats := computeStats(records)
+	grouped := groupByContainer(records)
+	links := make(map[string]string, len(grouped))
+	names := containerNames(records)
+	slugs := pageSlugs(names)
+	for _, name := range names {
+		file := slugs[name] + ".html"
+		title := name + " - " + dashboardTitle(optsFor(""))
+		err := writeFigureHTML(filepath.Join(dir, file), themeName, title, func(theme string) map[string]any {
+			return buildContainerFigure(name, grouped[name], stats[name], optsFor(theme), back)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		links[name] = filepath.Base(dir) + "/" + file
+	}
+	return links, nil
+}
+
+// buildContainerFigure renders the full-resolution detail view of a single
+// container: CPU with percentile guides, memory usage against its limit,
+// memory % and a percentile table.
+func buildContainerFigure(name string, recs []record, s *containerStats, opts FigureOptions, backHref string) map[string]any {
+	th := themeFor(opts.Theme)
+	color := colors[0]
+
+	// Full resolution: every sample, with line breaks at gaps.
+	gaps := gapStarts(recs)
+	series := func(val func(record) float64) ([]string, []any) {
+		idx, ys := downsampleSeries(recs, val, 0)
+		return breakAtGaps(recs, idx, ys, gaps)
+	}
+	cpuTS, cpu := series(func(r record) float64 { return r.CPUPct })
+	u := memUnitFor(s.MemMax)
+	memTS, mem := series(func(r record) float64 { return u.of(r.MemUsageMB) })
+	limitTS, limit := series(func(r record) float64 { return u.of(r.MemLimitMB) })
+	memPctTS, memPct := series(func(r record) float64 { return r.MemPct })
+
+	traces := []map[string]any{
+		{
+			"type":          "scatter",
+			"x":             cpuTS,
+			"y":             cpu,
+			"name":          "CPU %",
+			"mode":          "lines",
+			"line":          map[string]any{"color": color, "width": 1.2},
+			"hovertemplate": "%{x|%H:%M:%S}<br>CPU: %{y:.1f}%<extra></extra>",
+			"xaxis":         "x",
+			"yaxis":         "y",
+		},
+		{
+			"type":          "scatter",
+			"x":             memTS,
+			"y":             mem,
+			"name":          "RAM used",
+			"mode":          "lines",
+			"fill":          "tozeroy",
+			"line":          map[string]any{"color": colors[2], "width": 1.2},
+			"hovertemplate": "%{x|%H:%M:%S}<br>Used: " + u.hover() + "<extra></extra>",
+			"xaxis":         "x3",
+			"yaxis":         "y3",
+		},
+		{
+			"type":          "scatter",
+			"x":             memPctTS,
+			"y":             memPct,
+			"name":          "Mem %",
+			"mode":          "lines",
+			"line":          map[string]any{"color": colors[3], "width": 1.2},
+			"hovertemplate": "%{x|%H:%M:%S}<br>Mem: %{y:.2f}%<extra></extra>",
+			"xaxis":         "x5",
+			"yaxis":         "y5",
+		},
+	}
+	// Only draw the limit when it is in the same ballpark as usage; an
+	// unlimited container reports host memory and would flatten the chart.
+	if s.MemLimit > 0 && s.MemMax >= s.MemLimit*0.1 {
+		traces = append(traces, map[string]any{
+			"type":          "scatter",
+			"x":             limitTS,
+			"y":             limit,
+			"name":          "RAM limit",
+			"mode":          "lines",
+			"line":          map[string]any{"color": exceededColor, "width": 1.2, "dash": "dash"},
+			"hovertemplate": "%{x|%H:%M:%S}<br>Limit: " + u.hover() + "<extra></extra>",
+			"xaxis":         "x3",
+			"yaxis":         "y3",
+		})
+	}
+
+	table := func(header []string, cells []any, y []float64) map[string]any {
+		return map[string]any{
+			"type": "table",
+			"header": map[string]any{
+				"values": header,
+				"fill":   map[string]any{"color": th.TableHeaderBG},
+				"font":   map[string]any{"color": th.TableHeaderText, "size": 11},
+				"align":  "left",
+			},
+			"cells": map[string]any{
+				"values": cells,
+				"fill":   map[string]any{"color": th.TableCellBG},
+				"font":   map[string]any{"color": th.TableCellText, "size": 11},
+				"align":  "left",
+			},
+			"domain": map[string]any{"x": []float64{0.72, 1.0}, "y": y},
+		}
+	}
+	f1 := func(v float64) string { return fmt.Sprintf("%.1f", v) }
+	capture := []string{"samples", "first", "last", u.label("mem limit MB"), "mem max %"}
+	captureVals := []string{
+		fmt.Sprint(s.Count),
+		recs[0].Timestamp.Format(time.RFC3339),
+		recs[len(recs)-1].Timestamp.Format(time.RFC3339),
+		u.format(s.MemLimit),
+		fmt.Sprintf("%.2f", s.MemPctMax),
+	}
+	for i, img := range s.Images {
+		// Several when the image changed mid-capture, oldest first.
+		capture = append(capture, fmt.Sprintf("image %d", i+1))
+		captureVals = append(captureVals, img)
+	}
+	if len(s.Images) == 1 {
+		capture[len(capture)-1] = "image"
+	}
+	traces = append(traces,
+		table([]string{"Stat", "CPU %", u.label("RAM MB")}, []any{
+			[]string{"avg", "p50", "p95", "p99", "max"},
+			[]string{f1(s.CPUAvg()), f1(s.CPUP50), f1(s.CPUP95), f1(s.CPUP99), f1(s.CPUMax)},
+			[]string{u.format(s.MemAvg()), u.format(s.MemP50), u.format(s.MemP95), u.format(s.MemP99), u.format(s.MemMax)},
+		}, []float64{0.6, 1.0}),
+		table([]string{"Capture", ""}, []any{capture, captureVals}, []float64{0.2, 0.55}),
+	)
+
+	var shapes []map[string]any
+	for _, p := range []struct {
+		label string
+		v     float64
+	}{{"p50", s.CPUP50}, {"p95", s.CPUP95}, {"p99", s.CPUP99}} {
+		shapes = append(shapes, hline("x", "y", p.v, th.Muted, fmt.Sprintf("%s %.1f%%", p.label, p.v)))
+	}
+	annotations := []map[string]any{
+		subplotTitle("CPU %", 0.35, 1.0),
+		subplotTitle(u.label("RAM used vs limit (MB)"), 0.35, 0.64),
+		subplotTitle("Memory % of limit", 0.35, 0.28),
+		subplotTitle("Percentiles", 0.86, 1.0),
+		{
+			"text":      fmt.Sprintf(`<a href="%s">← all containers</a>`, html.EscapeString(backHref)),
+			"x":         0,
+			"y":         1.06,
+			"xref":      "paper",
+			"yref":      "paper",
+			"xanchor":   "left",
+			"showarrow": false,
+		},
+	}
+	if len(opts.Events) > 0 {
+		axes := [][2]string{{"x", "y"}, {"x3", "y3"}, {"x5", "y5"}}
+		phShapes, phNotes := phaseShapes(phasesFrom(opts.Events, recs[len(recs)-1].Timestamp), axes, th)
+		evShapes, notes := eventAnnotations(opts.Events, axes, th)
+		shapes = append(append(shapes, phShapes...), evShapes...)
+		annotations = append(append(annotations, phNotes...), notes...)
+	}
+
+	opts.Title = name
+	layout := map[string]any{
+		"template":    th.Template,
+		"title":       figureTitle(opts, ""),
+		"height":      950,
+		"width":       1400,
+		"hovermode":   "x unified",
+		"showlegend":  true,
+		"legend":      map[string]any{"orientation": "h", "y": 1.02, "x": 0.35, "xanchor": "center", "yanchor": "bottom"},
+		"shapes":      shapes,
+		"annotations": annotations,
+		"xaxis":       map[string]any{"domain": []float64{0.0, 0.7}, "anchor": "y"},
+		"yaxis":       map[string]any{"domain": []float64{0.72, 1.0}, "anchor": "x", "title": map[string]any{"text": "CPU %"}},
+		"xaxis3":      map[string]any{"domain": []float64{0.0, 0.7}, "anchor": "y3", "matches": "x"},
+		"yaxis3":      map[string]any{"domain": []float64{0.36, 0.64}, "anchor": "x3", "title": map[string]any{"text": u.Label}},
+		"xaxis5":      map[string]any{"domain": []float64{0.0, 0.7}, "anchor": "y5", "matches": "x", "title": map[string]any{"text": "Time (" + tzName() + ")"}},
+		"yaxis5":      map[string]any{"domain": []float64{0.0, 0.28}, "anchor": "x5", "title": map[string]any{"text": "Mem %"}},
+	}
+	return map[string]any{
+		"data":   traces,
+		"layout": layout,
+	}
+}
@@ -0,0 +1,141 @@
+package cstats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// event is a timestamped marker (deploy, test phase, ...) drawn over the
+// time-series panels.
+type event = collector.Event
+
+// eventsHeader is the header of the events CSV file.
+var eventsHeader = []string{"timestamp", "label"}
+
+// eventsPath derives the default events file for a stats CSV:
+// docker-stats.csv -> docker-stats.events.csv.
+func eventsPath(csvPath string) string {
+	return strings.TrimSuffix(csvPath, ".csv") + ".events.csv"
+}
+
+// loadEvents reads an events file. A missing file is not an error.
+func loadEvents(path string) ([]event, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var events []event
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(row) < 2 {
+			continue
+		}
+		ts, err := parseTimestamp(row[0])
+		if err != nil {
+			// Header or malformed row.
+			continue
+		}
+		events = append(events, event{Timestamp: ts, Label: strings.TrimSpace(row[1])})
+	}
+	return events, nil
+}
+
+// appendEvent appends ev to the events file, creating it with a header if needed.
+func appendEvent(path string, ev event) error {
+	info, err := os.Stat(path)
+	needHeader := os.IsNotExist(err) || (err == nil && info.Size() == 0)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open events: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if needHeader {
+		w.Write(eventsHeader)
+	}
+	w.Write([]string{ev.Timestamp.UTC().Format(time.RFC3339), ev.Label})
+	w.Flush()
+	return w.Error()
+}
+
+// eventAnnotations renders events as vertical lines (shapes) plus hoverable
+// labels across the given time-series axes (e.g. "x"/"y", "x3"/"y3").
+func eventAnnotations(events []event, axes [][2]string, th theme) (shapes, annotations []map[string]any) {
+	for _, ev := range events {
+		x := ev.Timestamp.Format(time.RFC3339)
+		for i, ax := range axes {
+			shapes = append(shapes, map[string]any{
+				"type": "line",
+				"xref": ax[0],
+				"yref": ax[1] + " domain",
+				"x0":   x,
+				"x1":   x,
+				"y0":   0,
+				"y1":   1,
+				"line": map[string]any{"color": th.Marker, "width": 1, "dash": "dot"},
+			})
+			text := "▼"
+			if i == 0 {
+				text = ev.Label
+			}
+			annotations = append(annotations, map[string]any{
+				"x":         x,
+				"y":         1,
+				"xref":      ax[0],
+				"yref":      ax[1] + " domain",
+				"yanchor":   "bottom",
+				"showarrow": false,
+				"text":      text,
+				"hovertext": ev.Timestamp.Format("15:04:05") + " " + ev.Label,
+				"font":      map[string]any{"size": 10, "color": th.Muted},
+			})
+		}
+	}
+	return shapes, annotations
+}
+
+func runMark(args []string) {
+	fs := newFlagSet("mark")
+	csvPath := fs.String("csv", "docker-stats.csv", "Stats CSV the marker belongs to")
+	eventsFile := fs.String("events", "", "Events file (default: <csv>.events.csv)")
+	grafanaFlag(fs)
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, `Usage: cstats mark [--csv file | --events file] "label"
+
+Labels ending in " start" and " end" ("load start", "load end") delimit a
+phase, shaded in the dashboards and summarized per phase by cstats summary.`)
+		os.Exit(1)
+	}
+	label := strings.Join(fs.Args(), " ")
+	path := *eventsFile
+	if path == "" {
+		path = eventsPath(*csvPath)
+	}
+
+	ev := event{Timestamp: time.Now().UTC(), Label: label}
+	if err := recordEvent(path, ev, "marker"); err != nil {
+		log.Fatalf("Error writing marker: %v", err)
+	}
+	fmt.Printf("Marked %q at %s -> %s\n", label, ev.Timestamp.Format(time.RFC3339), path)
+}
@@ -0,0 +1,33 @@
+package cstats_test
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/saveugene/cstats"
+	"github.com/saveugene/cstats/collector"
+)
+
+// A service serves the live dashboard of a capture under /stats/, behind
+// its own authentication.
+func ExampleNewLiveServer() {
+	srv := cstats.NewLiveServer(cstats.LiveOptions{
+		Sources:  []string{"docker-stats.csv"},
+		Interval: 5 * time.Second,
+	})
+	http.Handle("/stats/", http.StripPrefix("/stats", srv.Handler()))
+}
+
+// A service serves the samples it collects itself, held in memory, and
+// stops watching when it shuts down.
+func ExampleNewLiveServer_store() {
+	store := cstats.NewMemStore(time.Hour)
+	srv := cstats.NewLiveServer(cstats.LiveOptions{
+		Sources: []string{"service"},
+		Stores:  map[string]*cstats.MemStore{"service": store},
+	})
+	defer srv.Close()
+	http.Handle("/stats/", http.StripPrefix("/stats", srv.Handler()))
+
+	store.Write(collector.Record{Timestamp: time.Now(), Container: "worker", CPUPct: 12.5, MemUsageMB: 256})
+}
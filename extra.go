@@ -0,0 +1,95 @@
+package cstats
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// extraOrder lists well-known optional columns in display order; any other
+// numeric column follows alphabetically.
+var extraOrder = []string{
+	"net_rx_mb", "net_tx_mb",
+	"blkio_read_mb", "blkio_write_mb",
+	"ephemeral_storage_mb", "pvc_used_mb", "pvc_used_pct",
+	"pids",
+	"gpu_util_pct", "gpu_mem_mb",
+}
+
+// extraMetrics returns the optional metric columns present in records.
+func extraMetrics(records []record) []string {
+	seen := map[string]bool{}
+	for _, r := range records {
+		for k := range r.Extra {
+			seen[k] = true
+		}
+	}
+	var metrics []string
+	for _, k := range extraOrder {
+		if seen[k] {
+			metrics = append(metrics, k)
+			delete(seen, k)
+		}
+	}
+	rest := make([]string, 0, len(seen))
+	for k := range seen {
+		rest = append(rest, k)
+	}
+	sort.Strings(rest)
+	return append(metrics, rest...)
+}
+
+// extraLabel derives a panel title and hover unit from a column name:
+// net_rx_mb -> ("net rx (MB)", " MB").
+func extraLabel(col string) (title, unit string) {
+	parts := strings.Split(col, "_")
+	switch parts[len(parts)-1] {
+	case "mb":
+		unit = " MB"
+	case "pct":
+		unit = "%"
+	case "m":
+		unit = "m" // millicores
+	}
+	if unit != "" {
+		parts = parts[:len(parts)-1]
+	}
+	title = strings.Join(parts, " ")
+	if unit != "" {
+		title += " (" + strings.TrimSpace(unit) + ")"
+	}
+	return title, unit
+}
+
+// addExtraPanels adds one time-series row per optional metric column found
+// in the capture, so the layout follows the data actually collected.
+func addExtraPanels(fig map[string]any, records []record, containers []string, grouped map[string][]record, colorMap map[string]string, maxPoints int) {
+	for _, col := range extraMetrics(records) {
+		title, unit := extraLabel(col)
+		xa, ya := addRow(fig, title, 220)
+		for _, name := range containers {
+			recs := slices.DeleteFunc(slices.Clone(grouped[name]), func(r record) bool {
+				_, ok := r.Extra[col]
+				return !ok
+			})
+			if len(recs) == 0 {
+				continue
+			}
+			idx, ys := downsampleSeries(recs, func(r record) float64 { return r.Extra[col] }, maxPoints)
+			timestamps, vals := breakAtGaps(recs, idx, ys, gapStarts(recs))
+			fig["data"] = append(fig["data"].([]map[string]any), map[string]any{
+				"type":          "scatter",
+				"x":             timestamps,
+				"y":             vals,
+				"name":          name,
+				"legendgroup":   name,
+				"showlegend":    false,
+				"mode":          "lines",
+				"line":          map[string]any{"color": colorMap[name], "width": 1.5},
+				"hovertemplate": "%{x|%H:%M:%S}<br>" + title + ": %{y:.2f}" + unit + "<extra>" + name + "</extra>",
+				"xaxis":         xa,
+				"yaxis":         ya,
+			})
+		}
+	}
+}
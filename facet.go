@@ -0,0 +1,95 @@
+package cstats
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// facetRowPx is the height of each row of facet panels.
+const facetRowPx = 240
+
+// addFacets appends one column of CPU and RAM panels per value of the col
+// column (e.g. cluster), each showing the containers with that value only,
+// on shared scales so the columns compare at a glance. Samples without the
+// column are left out; with fewer than two values there is nothing to
+// compare and nothing is added.
+func addFacets(fig map[string]any, records []record, col string, colorMap map[string]string, maxPoints int, u memUnit) {
+	byValue := map[string][]record{}
+	for _, r := range records {
+		if v := r.Attrs[col]; v != "" {
+			byValue[v] = append(byValue[v], r)
+		}
+	}
+	if len(byValue) < 2 {
+		return
+	}
+	values := make([]string, 0, len(byValue))
+	for v := range byValue {
+		values = append(values, v)
+	}
+	slices.Sort(values)
+
+	layout := fig["layout"].(map[string]any)
+	n := 2
+	for key := range layout {
+		if i, err := strconv.Atoi(strings.TrimPrefix(key, "xaxis")); err == nil && i >= n {
+			n = i + 1
+		}
+	}
+	h, _ := layout["height"].(int)
+	frac := float64(2*facetRowPx) / float64(h+2*facetRowPx)
+	reserveBottom(fig, frac)
+
+	cpuRow := []float64{frac * 0.5, frac * 0.88}
+	memRow := []float64{0, frac * 0.38}
+	cpuAxis, memAxis := fmt.Sprintf("y%d", n), fmt.Sprintf("y%d", n+1)
+	width := 1 / float64(len(values))
+	const gap = 0.04
+	for i, v := range values {
+		x := []float64{float64(i)*width + gap/2, float64(i+1)*width - gap/2}
+		for j, row := range [][]float64{cpuRow, memRow} {
+			k := n + 2*i + j
+			xa := map[string]any{"domain": x, "anchor": fmt.Sprintf("y%d", k), "matches": "x"}
+			ya := map[string]any{"domain": row, "anchor": fmt.Sprintf("x%d", k)}
+			if k != n && k != n+1 {
+				ya["matches"] = []string{cpuAxis, memAxis}[j]
+			} else {
+				ya["title"] = map[string]any{"text": []string{"CPU %", u.Label}[j]}
+			}
+			layout[fmt.Sprintf("xaxis%d", k)] = xa
+			layout[fmt.Sprintf("yaxis%d", k)] = ya
+		}
+		layout["annotations"] = append(layout["annotations"].([]map[string]any),
+			subplotTitle(col+" "+v, (x[0]+x[1])/2, cpuRow[1]))
+
+		grouped := groupByContainer(byValue[v])
+		for _, name := range containerNames(byValue[v]) {
+			recs := grouped[name]
+			gaps := gapStarts(recs)
+			for j, val := range []func(record) float64{
+				func(r record) float64 { return r.CPUPct },
+				func(r record) float64 { return u.of(r.MemUsageMB) },
+			} {
+				idx, ys := downsampleSeries(recs, val, maxPoints)
+				timestamps, vals := breakAtGaps(recs, idx, ys, gaps)
+				hover := []string{"CPU: %{y:.1f}%", "RAM: " + u.hover()}[j]
+				k := n + 2*i + j
+				fig["data"] = append(fig["data"].([]map[string]any), map[string]any{
+					"type":          "scatter",
+					"x":             timestamps,
+					"y":             vals,
+					"name":          name,
+					"legendgroup":   name,
+					"showlegend":    false,
+					"mode":          "lines",
+					"line":          map[string]any{"color": colorMap[name], "width": 1.5},
+					"hovertemplate": "%{x|%H:%M:%S}<br>" + hover + "<extra>" + name + " (" + v + ")</extra>",
+					"xaxis":         fmt.Sprintf("x%d", k),
+					"yaxis":         fmt.Sprintf("y%d", k),
+				})
+			}
+		}
+	}
+}
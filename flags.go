@@ -0,0 +1,194 @@
+package cstats
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stringList is a repeatable string flag (--meta a=1 --meta b=2).
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// expandCSVPaths resolves CSV arguments: directories contribute their *.csv
+// files (skipping events and summary files), globs are expanded, and URLs
+// and plain paths are kept even if they do not exist yet. Duplicates are
+// dropped.
+func expandCSVPaths(args []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, arg := range args {
+		if isURL(arg) {
+			add(arg)
+			continue
+		}
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			matches, _ := filepath.Glob(filepath.Join(arg, "*.csv"))
+			n := 0
+			for _, m := range matches {
+				if strings.HasSuffix(m, ".events.csv") || strings.HasSuffix(m, ".summary.csv") {
+					continue
+				}
+				add(m)
+				n++
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("no CSV files in %s", arg)
+			}
+			continue
+		}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			for _, m := range matches {
+				add(m)
+			}
+			continue
+		}
+		add(arg)
+	}
+	return out, nil
+}
+
+// parseMeta validates key=value pairs, preserving their order.
+func parseMeta(pairs []string) ([][2]string, error) {
+	meta := make([][2]string, 0, len(pairs))
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid --meta %q, want key=value", p)
+		}
+		meta = append(meta, [2]string{strings.TrimSpace(k), strings.TrimSpace(v)})
+	}
+	return meta, nil
+}
+
+// viewFlags are the record transforms shared by plot, term and summary:
+// renaming containers, grouping replicas into workloads and keeping the top
+// N containers.
+type viewFlags struct {
+	rename     stringList
+	renameFile string
+	rules      []renameRule
+
+	seriesKey string
+	groupBy   string
+	agg       string
+	top       int
+	by        string
+	others    bool
+
+	redact    bool
+	redactMap string
+	redactor  *redactor // with --redact
+}
+
+// registerViewFlags adds the shared view flags to fs.
+func registerViewFlags(fs *flag.FlagSet) *viewFlags {
+	v := &viewFlags{}
+	fs.Var(&v.rename, "rename", "Rename containers with a sed-style rule, e.g. 's/^myapp_(.*)_[0-9]+$/$1/' (repeatable)")
+	fs.StringVar(&v.renameFile, "rename-file", "", "File of --rename rules, one per line")
+	fs.StringVar(&v.seriesKey, "series-key", "auto", "Key series by container name alone, or by name plus its id or host (for captures collected with --ids) or its Kubernetes cluster or namespace; auto is namespace, which Docker captures do not have")
+	fs.StringVar(&v.groupBy, "group-by", "", "Merge pod series by deployment, namespace, cluster or label:<key>, or Docker Compose replicas by service")
+	fs.StringVar(&v.agg, "agg", "sum", "How --rename/--group-by combine merged series: sum or avg")
+	fs.IntVar(&v.top, "top", 0, "Keep only the N heaviest containers (0 = all)")
+	fs.StringVar(&v.by, "by", "mem_max", "Ranking metric for --top: cpu_avg, cpu_p95, cpu_max, mem_avg, mem_p95, mem_max")
+	fs.BoolVar(&v.others, "others", false, "With --top, aggregate the remaining containers into an \"others\" series")
+	fs.BoolVar(&v.redact, "redact", false, "Pseudonymize container, pod, namespace, cluster and label names with stable aliases and drop hosts and images, for sharing")
+	fs.StringVar(&v.redactMap, "redact-map", "", "File of `name = alias` lines choosing the aliases of --redact (implies --redact; other names are hashed)")
+	return v
+}
+
+// validate checks the flag values after parsing and compiles the rename
+// rules.
+func (v *viewFlags) validate() error {
+	rules := []string(v.rename)
+	if v.renameFile != "" {
+		fileRules, err := loadRenameFile(v.renameFile)
+		if err != nil {
+			return fmt.Errorf("read --rename-file: %w", err)
+		}
+		rules = append(fileRules, rules...)
+	}
+	v.rules = v.rules[:0]
+	for _, rule := range rules {
+		r, err := parseRenameRule(rule)
+		if err != nil {
+			return err
+		}
+		v.rules = append(v.rules, r)
+	}
+	if _, ok := seriesKeys[v.seriesKey]; !ok {
+		return fmt.Errorf("--series-key must be auto, name, id, host, cluster or namespace, got %q", v.seriesKey)
+	}
+	if err := checkGroupBy(v.groupBy); err != nil {
+		return err
+	}
+	if v.agg != "sum" && v.agg != "avg" {
+		return fmt.Errorf("--agg must be sum or avg, got %q", v.agg)
+	}
+	if v.redact || v.redactMap != "" {
+		r, err := newRedactor(v.redactMap)
+		if err != nil {
+			return fmt.Errorf("--redact-map: %w", err)
+		}
+		v.redactor = r
+	}
+	return checkRankMetric(v.by)
+}
+
+// apply runs the transforms in order: renaming and grouping first so --top
+// ranks whole workloads.
+func (v *viewFlags) apply(records []record) []record {
+	return topN(v.normalize(records), v.top, v.by, v.others)
+}
+
+// reshapes reports whether the view renames, re-keys, groups, drops or
+// redacts containers, which needs all records at hand. The auto key only
+// renames, so --stream applies it as it reads.
+func (v *viewFlags) reshapes() bool {
+	return len(v.rules) > 0 || (v.seriesKey != "name" && v.seriesKey != "auto") || v.groupBy != "" || v.top > 0 || v.redactor != nil
+}
+
+// normalize applies only --rename and --group-by, for views like --compare
+// where the two runs must keep matching container sets.
+func (v *viewFlags) normalize(records []record) []record {
+	key := v.seriesKey
+	if key == "auto" && v.groupBy != "" {
+		key = "name" // groups of pods carry their namespace themselves
+	}
+	records = renameRecords(records, v.rules, key, v.agg)
+	records = groupRecords(records, v.groupBy, v.agg)
+	if v.redactor != nil {
+		records = v.redactor.records(records)
+	}
+	return records
+}
+
+// events redacts the names in event labels with --redact, once the records
+// went through the view.
+func (v *viewFlags) events(events []event) []event {
+	if v.redactor == nil {
+		return events
+	}
+	return v.redactor.events(events)
+}
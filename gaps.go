@@ -0,0 +1,106 @@
+package cstats
+
+import (
+	"sort"
+	"time"
+)
+
+// gapFactor is how many median sampling intervals without a sample count as
+// a gap.
+const gapFactor = 2
+
+// medianInterval returns the median spacing of ascending timestamps.
+func medianInterval(ts []time.Time) time.Duration {
+	if len(ts) < 2 {
+		return 0
+	}
+	d := make([]time.Duration, len(ts)-1)
+	for i := 1; i < len(ts); i++ {
+		d[i-1] = ts[i].Sub(ts[i-1])
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	return d[len(d)/2]
+}
+
+// gapStarts returns the indices i of time-ordered recs where the spacing to
+// recs[i-1] exceeds gapFactor times the median interval.
+func gapStarts(recs []record) []int {
+	ts := make([]time.Time, len(recs))
+	for i, r := range recs {
+		ts[i] = r.Timestamp
+	}
+	limit := gapFactor * medianInterval(ts)
+	if limit <= 0 {
+		return nil
+	}
+	var gaps []int
+	for i := 1; i < len(ts); i++ {
+		if ts[i].Sub(ts[i-1]) > limit {
+			gaps = append(gaps, i)
+		}
+	}
+	return gaps
+}
+
+// breakAtGaps turns the downsampled points (indices idx into recs, values
+// ys) into Plotly x/y arrays, inserting a null between kept points that
+// straddle a gap so the line breaks instead of bridging it.
+func breakAtGaps(recs []record, idx []int, ys []float64, gaps []int) ([]string, []any) {
+	x := make([]string, 0, len(idx)+len(gaps))
+	y := make([]any, 0, len(idx)+len(gaps))
+	g := 0
+	for k, i := range idx {
+		if k > 0 {
+			for g < len(gaps) && gaps[g] <= idx[k-1] {
+				g++
+			}
+			if g < len(gaps) && gaps[g] <= i {
+				x = append(x, recs[idx[k-1]].Timestamp.Add(recs[i].Timestamp.Sub(recs[idx[k-1]].Timestamp)/2).Format(time.RFC3339))
+				y = append(y, nil)
+			}
+		}
+		x = append(x, recs[i].Timestamp.Format(time.RFC3339))
+		y = append(y, ys[k])
+	}
+	return x, y
+}
+
+// captureGapShapes shades periods where no container was sampled at all
+// (collector down) on each of the given time-series axes.
+func captureGapShapes(records []record, axes [][2]string) []map[string]any {
+	seen := map[time.Time]bool{}
+	var ts []time.Time
+	for _, r := range records {
+		if !seen[r.Timestamp] {
+			seen[r.Timestamp] = true
+			ts = append(ts, r.Timestamp)
+		}
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Before(ts[j]) })
+	limit := gapFactor * medianInterval(ts)
+	if limit <= 0 {
+		return nil
+	}
+
+	var shapes []map[string]any
+	for i := 1; i < len(ts); i++ {
+		if ts[i].Sub(ts[i-1]) <= limit {
+			continue
+		}
+		for _, ax := range axes {
+			shapes = append(shapes, map[string]any{
+				"type":      "rect",
+				"xref":      ax[0],
+				"yref":      ax[1] + " domain",
+				"x0":        ts[i-1].Format(time.RFC3339),
+				"x1":        ts[i].Format(time.RFC3339),
+				"y0":        0,
+				"y1":        1,
+				"fillcolor": "rgba(128,128,128,0.15)",
+				"line":      map[string]any{"width": 0},
+				"layer":     "below",
+			})
+		}
+	}
+	return shapes
+}
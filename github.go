@@ -0,0 +1,59 @@
+package cstats
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// githubMode makes reports speak GitHub Actions (--github): problems become
+// workflow annotations on stdout and a Markdown table is appended to the
+// job summary.
+var githubMode bool
+
+// githubFlag registers --github on fs.
+func githubFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&githubMode, "github", false, "Emit GitHub Actions ::error/::warning annotations and append a Markdown table to $GITHUB_STEP_SUMMARY")
+}
+
+// githubEscape escapes workflow command data, and properties too when prop
+// is set (they also end at ':' and ',').
+func githubEscape(s string, prop bool) string {
+	r := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	if prop {
+		r = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	}
+	return r.Replace(s)
+}
+
+// githubAnnotate prints an annotation; level is error, warning or notice.
+func githubAnnotate(level, title, msg string) {
+	fmt.Printf("::%s title=%s::%s\n", level, githubEscape(title, true), githubEscape(msg, false))
+}
+
+// githubStepSummary appends what write renders to $GITHUB_STEP_SUMMARY.
+func githubStepSummary(write func(w io.Writer) error) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return errors.New("GITHUB_STEP_SUMMARY is not set, skipping the job summary")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("job summary: %w", err)
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// githubSamplingWarnings annotates the containers of samplingReport.
+func githubSamplingWarnings(lines []string) {
+	for _, line := range lines {
+		githubAnnotate("warning", "Sampling", line)
+	}
+}
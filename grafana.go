@@ -0,0 +1,127 @@
+package cstats
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// grafanaConfig pushes events to Grafana as annotations (--grafana), so
+// markers and collector outages also show up on standing dashboards.
+type grafanaConfig struct {
+	URL       string
+	Dashboard string
+	Panel     int
+	Tags      stringList
+}
+
+var grafana grafanaConfig
+
+// grafanaFlag registers the --grafana flags on fs.
+func grafanaFlag(fs *flag.FlagSet) {
+	fs.StringVar(&grafana.URL, "grafana", "", "Also post markers and outage events as annotations to the Grafana at this `URL` (token in $GRAFANA_TOKEN)")
+	fs.StringVar(&grafana.Dashboard, "grafana-dashboard", "", "With --grafana, annotate only the dashboard with this `UID` (default: an organization-wide annotation)")
+	fs.IntVar(&grafana.Panel, "grafana-panel", 0, "With --grafana-dashboard, annotate only this panel `id`")
+	fs.Var(&grafana.Tags, "grafana-tag", "With --grafana, add this tag to the annotations (repeatable; cstats and marker or alert are always set)")
+}
+
+// recordEvent appends ev to the events file at path and, with --grafana,
+// posts it as an annotation with the given kind tag (marker or alert). A
+// failed post is only a warning: the events file is the record.
+func recordEvent(path string, ev event, kind string) error {
+	if err := appendEvent(path, ev); err != nil {
+		return err
+	}
+	if grafana.URL != "" {
+		if err := grafana.annotate(ev, kind); err != nil {
+			warnf("grafana: %v", err)
+		}
+	}
+	return nil
+}
+
+// grafanaQueue is the most annotations of the collection loop waiting to be
+// posted.
+const grafanaQueue = 64
+
+type annotation struct {
+	ev   event
+	kind string
+}
+
+// annotations is the queue of the goroutine posting the annotations of the
+// collection loop, started on first use.
+var annotations = sync.OnceValue(func() chan annotation {
+	ch := make(chan annotation, grafanaQueue)
+	go func() {
+		for a := range ch {
+			if err := grafana.annotate(a.ev, a.kind); err != nil {
+				warnf("grafana: %v", err)
+			}
+		}
+	}()
+	return ch
+})
+
+// queueEvent is recordEvent for the collection loop: the annotation is
+// posted from a goroutine of its own, so a slow Grafana does not hold up
+// sampling. With grafanaQueue of them waiting, more are dropped.
+func queueEvent(path string, ev event, kind string) error {
+	if err := appendEvent(path, ev); err != nil {
+		return err
+	}
+	if grafana.URL != "" {
+		select {
+		case annotations() <- annotation{ev, kind}:
+		default:
+			warnf("grafana: behind, dropped the annotation %q", ev.Label)
+		}
+	}
+	return nil
+}
+
+// annotate posts ev to the Grafana annotations API.
+func (g grafanaConfig) annotate(ev event, kind string) error {
+	ann := map[string]any{
+		"time": ev.Timestamp.UnixMilli(),
+		"text": ev.Label,
+		"tags": append([]string{"cstats", kind}, g.Tags...),
+	}
+	if g.Dashboard != "" {
+		ann["dashboardUID"] = g.Dashboard
+		if g.Panel != 0 {
+			ann["panelId"] = g.Panel
+		}
+	}
+	body, err := json.Marshal(ann)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(g.URL, "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("GRAFANA_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	logf("grafana: annotated %q", ev.Label)
+	return nil
+}
@@ -0,0 +1,166 @@
+package cstats
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// <deployment>-<pod-template-hash>-<suffix>
+	replicaSetPod = regexp.MustCompile(`^(.+)-[a-z0-9]{6,10}-[a-z0-9]{5}$`)
+	// <statefulset>-<ordinal>
+	statefulSetPod = regexp.MustCompile(`^(.+)-[0-9]+$`)
+	// <daemonset|job>-<suffix>
+	generatedPod = regexp.MustCompile(`^(.+)-[a-z0-9]{5}$`)
+	// <project>-<service>-<n> (Compose v2) or <project>_<service>_<n> (v1)
+	composeReplica = regexp.MustCompile(`^(.+)[-_][0-9]+$`)
+)
+
+// workloadName strips the generated suffixes Kubernetes controllers add to
+// pod names, recovering the owning workload: web-7d9f8c6b5-x2k4p -> web.
+func workloadName(pod string) string {
+	for _, re := range []*regexp.Regexp{replicaSetPod, statefulSetPod, generatedPod} {
+		if m := re.FindStringSubmatch(pod); m != nil {
+			return m[1]
+		}
+	}
+	return pod
+}
+
+// serviceName recovers the Compose service of a container, keyed by project
+// so same-named services of two projects stay apart: project/service from
+// its compose_project and compose_service columns when captured with
+// --compose, else its name without the replica number (shop_web_1,
+// shop-web-2 -> shop_web, shop-web).
+func serviceName(r record) string {
+	if v := r.Attrs["compose_service"]; v != "" {
+		if p := r.Attrs["compose_project"]; p != "" {
+			return p + "/" + v
+		}
+		return v
+	}
+	if m := composeReplica.FindStringSubmatch(r.Container); m != nil {
+		return m[1]
+	}
+	return r.Container
+}
+
+// checkGroupBy validates a --group-by value.
+func checkGroupBy(by string) error {
+	switch {
+	case by == "", by == "deployment", by == "namespace", by == "cluster", by == "service":
+		return nil
+	case strings.HasPrefix(by, "label:") && len(by) > len("label:"):
+		return nil
+	}
+	return fmt.Errorf("--group-by must be deployment, namespace, cluster, service or label:<key>, got %q", by)
+}
+
+// groupKey returns the group a record belongs to. Kubernetes captures have a
+// namespace column (older ones name containers "namespace/pod"); records
+// without the needed label keep their own name.
+func groupKey(r record, by string) string {
+	ns, pod, ok := strings.Cut(r.Container, "/")
+	if !ok {
+		ns, pod = "", r.Container
+	}
+	if v := r.Attrs["namespace"]; v != "" {
+		ns, pod, ok = v, r.Container, true
+	}
+	switch {
+	case by == "service":
+		return serviceName(r)
+	case by == "namespace" && ok:
+		return ns
+	case by == "cluster" && r.Attrs["cluster"] != "":
+		return r.Attrs["cluster"]
+	case by == "deployment":
+		if ok {
+			return ns + "/" + workloadName(pod)
+		}
+		return workloadName(pod)
+	case strings.HasPrefix(by, "label:"):
+		if v := r.Attrs["label_"+strings.TrimPrefix(by, "label:")]; v != "" {
+			return v
+		}
+	}
+	return r.Container
+}
+
+// groupRecords merges the series of all containers in the same group into
+// one series per group.
+func groupRecords(records []record, by, agg string) []record {
+	if by == "" {
+		return records
+	}
+	return mergeRecords(records, func(r record) string { return groupKey(r, by) }, agg)
+}
+
+// mergeRecords renames every record to key(r) and combines records that end
+// up with the same name and timestamp, summing (agg "sum") or averaging
+// (agg "avg") them. Records that do not collide are kept as they are.
+func mergeRecords(records []record, key func(record) string, agg string) []record {
+	type slot struct {
+		name string
+		ts   time.Time
+	}
+	type acc struct {
+		rec    record
+		pctSum float64
+		n      int
+	}
+	accs := map[slot]*acc{}
+	var order []slot
+	for _, r := range records {
+		k := slot{key(r), r.Timestamp}
+		a, ok := accs[k]
+		if !ok {
+			r.Container = k.name
+			accs[k] = &acc{rec: r, pctSum: r.MemPct, n: 1}
+			order = append(order, k)
+			continue
+		}
+		if a.n == 1 {
+			// Copy before accumulating so the input record is untouched.
+			extra := make(map[string]float64, len(a.rec.Extra))
+			for name, v := range a.rec.Extra {
+				extra[name] = v
+			}
+			a.rec.Extra = extra
+		}
+		a.rec.CPUPct += r.CPUPct
+		a.rec.MemUsageMB += r.MemUsageMB
+		a.rec.MemLimitMB += r.MemLimitMB
+		a.pctSum += r.MemPct
+		for name, v := range r.Extra {
+			a.rec.Extra[name] += v
+		}
+		a.n++
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].ts.Before(order[j].ts) })
+	out := make([]record, 0, len(order))
+	for _, k := range order {
+		a := accs[k]
+		r := a.rec
+		switch {
+		case a.n == 1:
+		case agg == "avg":
+			n := float64(a.n)
+			r.CPUPct /= n
+			r.MemUsageMB /= n
+			r.MemLimitMB /= n
+			r.MemPct = a.pctSum / n
+			for name := range r.Extra {
+				r.Extra[name] /= n
+			}
+		case r.MemLimitMB > 0:
+			r.MemPct = r.MemUsageMB / r.MemLimitMB * 100
+		}
+		out = append(out, r)
+	}
+	return out
+}
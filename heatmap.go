@@ -0,0 +1,84 @@
+package cstats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// heatmapMetrics maps --heatmap values to the plotted record field.
+var heatmapMetrics = map[string]struct {
+	title string
+	val   func(record) float64
+}{
+	"cpu": {"CPU %", func(r record) float64 { return r.CPUPct }},
+	"mem": {"Memory % of limit", func(r record) float64 { return r.MemPct }},
+}
+
+// addHeatmap appends a utilization heatmap (time on X, container on Y) below
+// the existing panels. Columns are bucketed to at most maxPoints, keeping
+// the max per bucket so spikes stay visible.
+func addHeatmap(fig map[string]any, containers []string, grouped map[string][]record, metric string, maxPoints int) error {
+	m, ok := heatmapMetrics[metric]
+	if !ok {
+		return fmt.Errorf("unknown heatmap metric %q (use cpu or mem)", metric)
+	}
+
+	tsSet := map[time.Time]bool{}
+	for _, recs := range grouped {
+		for _, r := range recs {
+			tsSet[r.Timestamp] = true
+		}
+	}
+	grid := make([]time.Time, 0, len(tsSet))
+	for ts := range tsSet {
+		grid = append(grid, ts)
+	}
+	sort.Slice(grid, func(i, j int) bool { return grid[i].Before(grid[j]) })
+
+	cols := len(grid)
+	if maxPoints > 0 && cols > maxPoints {
+		cols = maxPoints
+	}
+	bucketOf := make(map[time.Time]int, len(grid))
+	for i, ts := range grid {
+		bucketOf[ts] = i * cols / len(grid)
+	}
+	x := make([]string, cols)
+	for i := len(grid) - 1; i >= 0; i-- {
+		x[bucketOf[grid[i]]] = grid[i].Format(time.RFC3339)
+	}
+
+	z := make([][]*float64, len(containers))
+	for i, c := range containers {
+		row := make([]*float64, cols)
+		for _, r := range grouped[c] {
+			b := bucketOf[r.Timestamp]
+			v := m.val(r)
+			if row[b] == nil || v > *row[b] {
+				row[b] = &v
+			}
+		}
+		z[i] = row
+	}
+
+	xa, ya := addRow(fig, "Heatmap - "+m.title, 260)
+	layout := fig["layout"].(map[string]any)
+	yaxis := layout["yaxis"+ya[1:]].(map[string]any)
+	yaxis["autorange"] = "reversed"
+	d := yaxis["domain"].([]float64)
+
+	fig["data"] = append(fig["data"].([]map[string]any), map[string]any{
+		"type":          "heatmap",
+		"x":             x,
+		"y":             containers,
+		"z":             z,
+		"colorscale":    "Inferno",
+		"hoverongaps":   false,
+		"hovertemplate": "%{x|%H:%M:%S}<br>%{y}: %{z:.1f}%<extra></extra>",
+		"colorbar":      map[string]any{"x": 0.64, "y": (d[0] + d[1]) / 2, "len": d[1] - d[0], "thickness": 12},
+		"xaxis":         xa,
+		"yaxis":         ya,
+	})
+	return nil
+}
@@ -0,0 +1,248 @@
+package cstats
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// indexEvery is how many rows apart time index entries are.
+	indexEvery = 4096
+	// indexMinBytes is the capture size from which readers keep an index;
+	// smaller files are quicker to scan than to seek.
+	indexMinBytes = 16 << 20
+)
+
+// indexEntry maps the timestamp of a row to the byte offset it starts at.
+type indexEntry struct {
+	Timestamp time.Time
+	Offset    int64
+}
+
+// timeIndex is the sidecar <csv>.idx of a large capture: the timestamp and
+// offset of every indexEvery-th row, so readers interested in a time range
+// can seek to it instead of parsing from the start. Readers keep it up to
+// date, indexing only the rows appended since it was written, and rebuild
+// it when the capture was rotated or rewritten.
+type timeIndex struct {
+	entries []indexEntry
+	// unordered is set once a row is older than one before it (a clock
+	// stepped back): seeking could then skip rows of the range.
+	unordered bool
+}
+
+func indexPath(csvPath string) string { return csvPath + ".idx" }
+
+// openTimeIndex returns the up-to-date index of a local capture, or nil for
+// captures below indexMinBytes or with rows out of time order, which are
+// scanned in full.
+func openTimeIndex(csvPath string) (*timeIndex, error) {
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < indexMinBytes {
+		return nil, nil
+	}
+
+	col, err := timestampColumn(f)
+	if err != nil {
+		return nil, err
+	}
+	ix := readTimeIndex(indexPath(csvPath))
+	if !ix.valid(f, col) {
+		*ix = timeIndex{}
+	}
+	n, unordered := len(ix.entries), ix.unordered
+	if err := ix.extend(f, col); err != nil {
+		return nil, err
+	}
+	if len(ix.entries) != n || ix.unordered != unordered {
+		// The index is only an optimization: a read-only directory just
+		// means indexing again next time.
+		ix.write(indexPath(csvPath))
+	}
+	if ix.unordered {
+		return nil, nil
+	}
+	return ix, nil
+}
+
+// timestampColumn returns the position of the timestamp column in the
+// capture's header.
+func timestampColumn(f *os.File) (int, error) {
+	header, err := csv.NewReader(io.NewSectionReader(f, 0, 1<<20)).Read()
+	if err != nil {
+		return 0, fmt.Errorf("reading header: %w", err)
+	}
+	for i, h := range header {
+		if strings.TrimSpace(h) == "timestamp" {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("missing column %q", "timestamp")
+}
+
+// rowTimestamp parses the timestamp of a CSV line.
+func rowTimestamp(line []byte, col int) (time.Time, bool) {
+	if col == 0 && !bytes.HasPrefix(line, []byte{'"'}) {
+		// The usual layout, without the cost of a CSV reader per row.
+		if i := bytes.IndexByte(line, ','); i > 0 {
+			t, err := parseTimestamp(string(line[:i]))
+			return t, err == nil
+		}
+	}
+	row, err := csv.NewReader(bytes.NewReader(line)).Read()
+	if err != nil || col >= len(row) {
+		return time.Time{}, false
+	}
+	t, err := parseTimestamp(row[col])
+	return t, err == nil
+}
+
+// valid reports whether the first and last entries still point at rows
+// with their timestamps, i.e. the capture was only appended to.
+func (ix *timeIndex) valid(f *os.File, col int) bool {
+	if len(ix.entries) == 0 {
+		return false
+	}
+	for _, e := range []indexEntry{ix.entries[0], ix.entries[len(ix.entries)-1]} {
+		line, err := bufio.NewReader(io.NewSectionReader(f, e.Offset, 1<<20)).ReadBytes('\n')
+		if err != nil {
+			return false
+		}
+		if t, ok := rowTimestamp(line, col); !ok || !t.Equal(e.Timestamp) {
+			return false
+		}
+	}
+	return true
+}
+
+// extend indexes the rows past the last entry (the whole capture for an
+// empty index), checking that their timestamps do not go backwards. A
+// trailing partial line is left for next time.
+func (ix *timeIndex) extend(f *os.File, col int) error {
+	var off int64
+	next := 0
+	if n := len(ix.entries); n > 0 {
+		off, next = ix.entries[n-1].Offset, indexEvery
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(f, 1<<20)
+	if off == 0 {
+		// Skip the header.
+		header, err := br.ReadBytes('\n')
+		if err != nil {
+			return nil
+		}
+		off = int64(len(header))
+	}
+	var newest time.Time
+	for row := 0; ; row++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if t, ok := rowTimestamp(line, col); ok {
+			if t.Before(newest) {
+				ix.unordered = true
+			} else {
+				newest = t
+			}
+			if row >= next {
+				ix.entries = append(ix.entries, indexEntry{Timestamp: t, Offset: off})
+				next = row + indexEvery
+			}
+		}
+		off += int64(len(line))
+	}
+}
+
+// seek returns the offset of the indexed row before t: reading from there
+// covers every row at or after t.
+func (ix *timeIndex) seek(t time.Time) int64 {
+	i := sort.Search(len(ix.entries), func(i int) bool { return !ix.entries[i].Timestamp.Before(t) })
+	return ix.entries[max(i-1, 0)].Offset
+}
+
+// last returns the timestamp of the newest indexed row.
+func (ix *timeIndex) last() time.Time {
+	return ix.entries[len(ix.entries)-1].Timestamp
+}
+
+// readTimeIndex reads a sidecar; a missing or malformed one reads as
+// empty. A third header column, "unordered", marks a capture with rows out
+// of time order.
+func readTimeIndex(path string) *timeIndex {
+	f, err := os.Open(path)
+	if err != nil {
+		return &timeIndex{}
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil || len(rows) == 0 {
+		return &timeIndex{}
+	}
+	ix := &timeIndex{unordered: len(rows[0]) > 2 && rows[0][2] == "unordered"}
+	for _, row := range rows[1:] {
+		if len(row) != 2 {
+			return &timeIndex{}
+		}
+		t, err := time.Parse(time.RFC3339Nano, row[0])
+		if err != nil {
+			return &timeIndex{}
+		}
+		off, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return &timeIndex{}
+		}
+		ix.entries = append(ix.entries, indexEntry{Timestamp: t, Offset: off})
+	}
+	if !slices.IsSortedFunc(ix.entries, func(a, b indexEntry) int { return cmp.Compare(a.Offset, b.Offset) }) {
+		return &timeIndex{}
+	}
+	return ix
+}
+
+// write replaces the sidecar, through a temporary file so concurrent
+// readers never see half of it.
+func (ix *timeIndex) write(path string) error {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	header := []string{"timestamp", "offset"}
+	if ix.unordered {
+		header = append(header, "unordered")
+	}
+	cw.Write(header)
+	for _, e := range ix.entries {
+		cw.Write([]string{e.Timestamp.Format(time.RFC3339Nano), strconv.FormatInt(e.Offset, 10)})
+	}
+	cw.Flush()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,145 @@
+package cstats
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeIndexSeek(t *testing.T) {
+	at := func(s int) time.Time { return time.Unix(int64(s), 0) }
+	ix := &timeIndex{entries: []indexEntry{{at(0), 100}, {at(10), 200}, {at(10), 300}, {at(20), 400}, {at(30), 500}}}
+	tests := []struct {
+		name string
+		t    time.Time
+		want int64
+	}{
+		{name: "before the capture", t: at(-5), want: 100},
+		{name: "first entry", t: at(0), want: 100},
+		{name: "between entries", t: at(15), want: 300},
+		// Rows at 10 may start before the first entry stamped 10.
+		{name: "entries sharing the time", t: at(10), want: 100},
+		{name: "last entry", t: at(30), want: 400},
+		{name: "after the capture", t: at(99), want: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ix.seek(tt.t); got != tt.want {
+				t.Errorf("seek(%v) = %d, want %d", tt.t.Unix(), got, tt.want)
+			}
+		})
+	}
+}
+
+// writeCapture writes a capture whose row i is stamped second(i), with the
+// timestamp in column col, and returns its path.
+func writeCapture(t *testing.T, rows, col int, second func(int) int, tail string) string {
+	t.Helper()
+	cols := []string{"container", "cpu_pct", "mem_usage_mb"}
+	cols = append(cols[:col], append([]string{"timestamp"}, cols[col:]...)...)
+	var b strings.Builder
+	b.WriteString(strings.Join(cols, ",") + "\n")
+	for i := range rows {
+		fields := []string{"web", "1.00", "2.00"}
+		ts := time.Unix(int64(second(i)), 0).UTC().Format(time.RFC3339)
+		fields = append(fields[:col], append([]string{ts}, fields[col:]...)...)
+		b.WriteString(strings.Join(fields, ",") + "\n")
+	}
+	b.WriteString(tail)
+	path := filepath.Join(t.TempDir(), "capture.csv")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTimeIndexExtend(t *testing.T) {
+	inOrder := func(i int) int { return i }
+	tests := []struct {
+		name      string
+		rows, col int
+		second    func(int) int
+		tail      string
+		want      string // seconds of the entries
+		unordered bool
+	}{
+		{name: "empty capture", rows: 0, second: inOrder, want: ""},
+		{name: "one entry", rows: 10, second: inOrder, want: "0"},
+		{name: "every indexEvery rows", rows: 2*indexEvery + 1, second: inOrder, want: fmt.Sprint(0, " ", indexEvery, " ", 2*indexEvery)},
+		{name: "timestamp not first", rows: indexEvery + 1, col: 2, second: inOrder, want: fmt.Sprint(0, " ", indexEvery)},
+		{name: "partial line left", rows: indexEvery, second: inOrder, tail: "2099-01-01T00:00:00Z,web", want: "0"},
+		{name: "clock stepped back", rows: 10, second: func(i int) int { return i % 5 }, want: "0", unordered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeCapture(t, tt.rows, tt.col, tt.second, tt.tail)
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var ix timeIndex
+			if err := ix.extend(f, tt.col); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range ix.entries {
+				got = append(got, fmt.Sprint(e.Timestamp.Unix()))
+			}
+			if strings.Join(got, " ") != tt.want || ix.unordered != tt.unordered {
+				t.Errorf("entries %v unordered %v, want %q %v", got, ix.unordered, tt.want, tt.unordered)
+			}
+			if len(ix.entries) > 0 && !ix.valid(f, tt.col) {
+				t.Error("the index does not point at its rows")
+			}
+		})
+	}
+}
+
+// The sidecar survives a round trip, is extended by appended rows and is
+// refused once the capture is rewritten.
+func TestTimeIndexSidecar(t *testing.T) {
+	path := writeCapture(t, indexEvery+1, 0, func(i int) int { return i }, "")
+	f, _ := os.Open(path)
+	var ix timeIndex
+	ix.extend(f, 0)
+	f.Close()
+	ix.unordered = true
+	if err := ix.write(indexPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	dump := func(ix *timeIndex) string {
+		s := fmt.Sprint(ix.unordered)
+		for _, e := range ix.entries {
+			s += fmt.Sprint(" ", e.Timestamp.Unix(), "@", e.Offset)
+		}
+		return s
+	}
+	if got, want := dump(readTimeIndex(indexPath(path))), dump(&ix); got != want {
+		t.Errorf("read back %s, want %s", got, want)
+	}
+
+	more := writeCapture(t, 2*indexEvery+1, 0, func(i int) int { return i }, "")
+	b, _ := os.ReadFile(more)
+	os.WriteFile(path, b, 0o644)
+	f, _ = os.Open(path)
+	defer f.Close()
+	ix.unordered = false
+	if !ix.valid(f, 0) {
+		t.Fatal("the index of an appended capture is not valid")
+	}
+	ix.extend(f, 0)
+	if len(ix.entries) != 3 || ix.last().Unix() != 2*indexEvery {
+		t.Errorf("extended to %d entries up to %v, want 3 up to %d", len(ix.entries), ix.last().Unix(), 2*indexEvery)
+	}
+
+	rewritten := writeCapture(t, indexEvery+1, 0, func(i int) int { return 1000 + i }, "")
+	b, _ = os.ReadFile(rewritten)
+	os.WriteFile(path, b, 0o644)
+	if ix.valid(f, 0) {
+		t.Error("the index of a rewritten capture is valid")
+	}
+}
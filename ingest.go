@@ -0,0 +1,353 @@
+package cstats
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saveugene/cstats/sink"
+)
+
+// maxIngestBody bounds a POSTed batch, after decompression.
+const maxIngestBody = 16 << 20
+
+// ingestDoneHeader carries, on a failed ingest, the number of samples at
+// the start of the batch that were written or rejected.
+const ingestDoneHeader = "X-Ingest-Done"
+
+// ingestFlag registers --ingest-token on fs; it defaults to
+// $CSTATS_INGEST_TOKEN.
+func ingestFlag(fs *flag.FlagSet) *string {
+	return fs.String("ingest-token", os.Getenv("CSTATS_INGEST_TOKEN"), "Accept samples POSTed to /api/ingest?source=... with this bearer `token` and append them to the source CSV (default $CSTATS_INGEST_TOKEN)")
+}
+
+// ingester appends pushed samples to the capture CSVs of the live sources,
+// keeping each open (and locked) once written to.
+type ingester struct {
+	token string
+	mu    sync.Mutex
+	sinks map[string]*csvSink
+}
+
+// sink returns the capture sink of csvPath, opening it on first use. The
+// columns of an existing capture are kept; a new one gets the columns of
+// its first batch.
+func (in *ingester) sink(csvPath string, batch []apiRecord) (*csvSink, error) {
+	if s := in.sinks[csvPath]; s != nil {
+		return s, nil
+	}
+	cols := batchColumns(batch)
+	if header, err := readCSVHeader(csvPath); err == nil && len(header) >= len(csvHeader) {
+		cols = header[len(csvHeader):]
+	}
+	s, err := openCSVSink(csvPath, cols)
+	if err != nil {
+		return nil, err
+	}
+	in.sinks[csvPath] = s
+	return s, nil
+}
+
+// batchColumns returns the optional columns the samples of batch set, sorted.
+func batchColumns(batch []apiRecord) []string {
+	seen := map[string]bool{}
+	for _, r := range batch {
+		for k := range r.Attrs {
+			seen[k] = true
+		}
+		for k := range r.Extra {
+			seen[k] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+// handler serves POST /api/ingest: a batch in the /api/records form,
+// {"records": [...]}, optionally gzip-encoded. Samples without a container
+// or timestamp, or with implausible values, are rejected one by one; a batch
+// with columns the capture does not have is refused whole, since a CSV
+// header cannot grow. A write failing mid-batch is answered with
+// X-Ingest-Done.
+func (in *ingester) handler(src *liveSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !ok || !secureEqual(bearer, in.token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if isURL(src.CSVPath) {
+			http.Error(w, "cannot ingest into a remote source", http.StatusBadRequest)
+			return
+		}
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			body = zr
+		}
+		var batch struct {
+			Records []apiRecord `json:"records"`
+		}
+		if err := json.NewDecoder(io.LimitReader(body, maxIngestBody)).Decode(&batch); err != nil {
+			http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		in.mu.Lock()
+		defer in.mu.Unlock()
+		s, err := in.sink(src.CSVPath, batch.Records)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		var unknown []string
+		for _, col := range batchColumns(batch.Records) {
+			if !slices.Contains(s.cols, col) {
+				unknown = append(unknown, col)
+			}
+		}
+		if len(unknown) > 0 {
+			http.Error(w, fmt.Sprintf("%s has no columns %s; push them to a new source", src.Name, strings.Join(unknown, ", ")), http.StatusBadRequest)
+			return
+		}
+
+		// Check the whole batch before writing any of it.
+		var recs []record
+		var at []int // index of recs[i] in the batch
+		for i, a := range batch.Records {
+			if a.Container == "" || a.Timestamp.IsZero() || implausible(a.CPUPct, a.MemUsageMB, a.MemLimitMB, a.MemPct) != "" {
+				continue
+			}
+			rec := record{Timestamp: a.Timestamp, Container: a.Container, CPUPct: a.CPUPct, MemUsageMB: a.MemUsageMB,
+				MemLimitMB: a.MemLimitMB, MemPct: a.MemPct, Extra: a.Extra, Attrs: map[string]string{}}
+			for _, col := range s.cols {
+				if v, ok := a.Attrs[col]; ok {
+					rec.Attrs[col] = v
+				} else if v, ok := a.Extra[col]; ok {
+					rec.Attrs[col] = strconv.FormatFloat(v, 'f', -1, 64)
+				}
+			}
+			recs = append(recs, rec)
+			at = append(at, i)
+		}
+
+		// A failed write leaves the rows before it in the capture:
+		// X-Ingest-Done tells the pusher how many samples of the batch are
+		// handled, so it resends only the rest. The sink, whose errors
+		// stick, is reopened by the next batch.
+		fail := func(done int, err error) {
+			s.Close()
+			delete(in.sinks, src.CSVPath)
+			w.Header().Set(ingestDoneHeader, strconv.Itoa(done))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		for i, rec := range recs {
+			if err := s.Write(rec); err != nil {
+				fail(at[i], err)
+				return
+			}
+			if src.store != nil {
+				src.store.add(rec)
+			}
+		}
+		if err := s.Flush(); err != nil {
+			fail(len(batch.Records), err)
+			return
+		}
+		accepted, rejected := len(recs), len(batch.Records)-len(recs)
+		logf("ingest: %s: %d samples accepted, %d rejected", src.Name, accepted, rejected)
+		writeJSON(w, map[string]int{"accepted": accepted, "rejected": rejected})
+	}
+}
+
+// withIngest routes /api/ingest of the live server to srv directly: it
+// checks the ingest token itself, so agents do not need the dashboard's
+// --auth/--token credentials.
+func withIngest(h http.Handler, srv *LiveServer) http.Handler {
+	if srv.opts.IngestToken == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/ingest" {
+			srv.Handler().ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// pushBatch is the most samples posted in one request.
+const pushBatch = 5000
+
+// pushSink pushes samples to the /api/ingest endpoint of another cstats (an
+// aggregator, or plot --live --ingest-token), stamped with this host. While
+// the server is unreachable up to limit samples are kept, dropping the
+// oldest, and the push is retried with backoff.
+type pushSink struct {
+	url    string
+	token  string
+	host   string
+	limit  int
+	client *http.Client
+
+	buf     []apiRecord
+	dropped int
+	failing bool
+	backoff time.Duration
+	retryAt time.Time
+}
+
+func openPushSink(arg string) (*pushSink, error) {
+	opts, err := parseSinkArgs(arg, "url", "source", "token", "host", "buffer")
+	if err != nil {
+		return nil, err
+	}
+	limit := 100000
+	if v := opts.Get("buffer"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("buffer must be a number of samples, got %q", v)
+		}
+	}
+	return newPushSink(opts.Get("url"), opts.Get("source"), cmp.Or(opts.Get("token"), os.Getenv("CSTATS_INGEST_TOKEN")), opts.Get("host"), limit)
+}
+
+// newPushSink pushes to the server at rawURL (its /api/ingest is implied),
+// into source ("" for its first), stamping samples without a host with host
+// (default: this machine's name).
+func newPushSink(rawURL, source, token, host string, limit int) (*pushSink, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("want the http(s) URL of a cstats server, got %q", rawURL)
+	}
+	if !strings.HasSuffix(u.Path, "/api/ingest") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/ingest"
+	}
+	if source != "" {
+		q := u.Query()
+		q.Set("source", source)
+		u.RawQuery = q.Encode()
+	}
+	if token == "" {
+		return nil, errors.New("missing ingest token")
+	}
+	if limit < 1 {
+		return nil, fmt.Errorf("the buffer must hold at least one sample, got %d", limit)
+	}
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return &pushSink{url: u.String(), token: token, host: host, limit: limit, client: &http.Client{Timeout: apiTimeout}}, nil
+}
+
+func (s *pushSink) Write(r record) error {
+	attrs := maps.Clone(r.Attrs)
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	if attrs["host"] == "" {
+		attrs["host"] = s.host
+	}
+	s.buf = append(s.buf, apiRecord{Timestamp: r.Timestamp, Container: r.Container, CPUPct: r.CPUPct,
+		MemUsageMB: r.MemUsageMB, MemLimitMB: r.MemLimitMB, MemPct: r.MemPct, Extra: r.Extra, Attrs: attrs})
+	if over := len(s.buf) - s.limit; over > 0 {
+		s.buf = slices.Delete(s.buf, 0, over)
+		s.dropped += over
+	}
+	return nil
+}
+
+// Flush pushes the buffered samples, unless a retry is not due yet.
+func (s *pushSink) Flush() error {
+	if len(s.buf) == 0 || time.Now().Before(s.retryAt) {
+		return nil
+	}
+	for len(s.buf) > 0 {
+		n := min(len(s.buf), pushBatch)
+		done, err := s.post(s.buf[:n])
+		s.buf = s.buf[done:]
+		if err != nil {
+			s.backoff = min(max(2*s.backoff, time.Second), maxBackoff)
+			s.retryAt = time.Now().Add(s.backoff)
+			s.failing = true
+			return fmt.Errorf("push: %w (%d samples buffered, retrying in %s)", err, len(s.buf), s.backoff)
+		}
+	}
+	if s.failing {
+		infof("push: caught up with %s", s.url)
+		if s.dropped > 0 {
+			warnf("push: %d samples dropped while the server was unreachable", s.dropped)
+		}
+		s.failing, s.dropped, s.backoff = false, 0, 0
+	}
+	return nil
+}
+
+// Close makes a last attempt to push what is buffered.
+func (s *pushSink) Close() error {
+	s.retryAt = time.Time{}
+	return s.Flush()
+}
+
+// post sends one gzip-encoded batch and returns how many of its samples the
+// server is done with: all of them, or on failure those before the first
+// sample it did not write (X-Ingest-Done), which are not to be resent.
+func (s *pushSink) post(batch []apiRecord) (int, error) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if err := json.NewEncoder(zw).Encode(map[string]any{"records": batch}); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		done, _ := strconv.Atoi(resp.Header.Get(ingestDoneHeader))
+		return min(max(done, 0), len(batch)), fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	logf("push: %d samples -> %s", len(batch), s.url)
+	return len(batch), nil
+}
+
+func init() {
+	sink.Register(sink.Kind{
+		Name:   "ingest",
+		Help:   "push to the /api/ingest of a cstats aggregator or live server; arg: url=, source=, token= (default $CSTATS_INGEST_TOKEN), host=<name stamped on samples>, buffer=<samples kept while unreachable>",
+		Remote: true,
+		Open:   func(arg string, cols []string) (sink.Sink, error) { return openPushSink(arg) },
+	})
+}
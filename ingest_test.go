@@ -0,0 +1,135 @@
+package cstats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ingest posts records to in for the capture at path and returns the
+// response.
+func ingest(t *testing.T, in *ingester, path string, records ...apiRecord) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"records": records})
+	req := httptest.NewRequest(http.MethodPost, "/api/ingest", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer tok")
+	w := httptest.NewRecorder()
+	in.handler(&liveSource{Name: "fleet", CSVPath: path})(w, req)
+	return w
+}
+
+func TestIngest(t *testing.T) {
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	web := apiRecord{Timestamp: ts, Container: "web", CPUPct: 10, MemUsageMB: 100, Attrs: map[string]string{"host": "a"}}
+	noName := apiRecord{Timestamp: ts, CPUPct: 10}
+	negative := apiRecord{Timestamp: ts, Container: "db", CPUPct: -5}
+	db := apiRecord{Timestamp: ts, Container: "db", CPUPct: 20, MemUsageMB: 200, Attrs: map[string]string{"host": "a"}}
+	labelled := apiRecord{Timestamp: ts, Container: "db", Attrs: map[string]string{"host": "a", "label_team": "x"}}
+
+	tests := []struct {
+		name     string
+		batch    []apiRecord
+		status   int
+		response string
+		rows     []string // containers appended, in order
+	}{
+		{name: "all accepted", batch: []apiRecord{web, db}, status: 200, response: `{"accepted":2,"rejected":0}`, rows: []string{"web", "db"}},
+		{name: "bad samples rejected one by one", batch: []apiRecord{noName, web, negative, db}, status: 200,
+			response: `{"accepted":2,"rejected":2}`, rows: []string{"web", "db"}},
+		{name: "unknown column refuses the whole batch", batch: []apiRecord{web, labelled}, status: 400,
+			response: "fleet has no columns label_team; push them to a new source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fleet.csv")
+			os.WriteFile(path, []byte("timestamp,container,cpu_pct,mem_usage_mb,mem_limit_mb,mem_pct,host\n"), 0o644)
+			in := &ingester{token: "tok", sinks: map[string]*csvSink{}}
+			w := ingest(t, in, path, tt.batch...)
+			if w.Code != tt.status || strings.TrimSpace(w.Body.String()) != tt.response {
+				t.Errorf("got %d %q, want %d %q", w.Code, strings.TrimSpace(w.Body.String()), tt.status, tt.response)
+			}
+			in.sinks[path].Close()
+			records, err := loadCSV(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rows []string
+			for _, r := range records {
+				rows = append(rows, r.Container)
+			}
+			if strings.Join(rows, ",") != strings.Join(tt.rows, ",") {
+				t.Errorf("appended %v, want %v", rows, tt.rows)
+			}
+		})
+	}
+}
+
+// A write failing mid-batch reports the samples handled before it, and the
+// next batch reopens the capture.
+func TestIngestWriteFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fleet.csv")
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	web := apiRecord{Timestamp: ts, Container: "web", CPUPct: 10}
+	in := &ingester{token: "tok", sinks: map[string]*csvSink{}}
+	if w := ingest(t, in, path, web); w.Code != 200 {
+		t.Fatalf("first batch: %d %s", w.Code, w.Body)
+	}
+	in.sinks[path].f.Close() // the next write fails
+
+	w := ingest(t, in, path, apiRecord{Timestamp: ts}, web, web)
+	if w.Code != 500 || w.Header().Get(ingestDoneHeader) != "1" {
+		t.Errorf("got %d with %s %q, want 500 and 1 (the rejected sample)", w.Code, ingestDoneHeader, w.Header().Get(ingestDoneHeader))
+	}
+	if w := ingest(t, in, path, web); w.Code != 200 {
+		t.Errorf("batch after the failure: %d %s", w.Code, w.Body)
+	}
+}
+
+// The push sink resends only the samples the server did not write.
+func TestPushResendsTheRest(t *testing.T) {
+	var got [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var batch struct{ Records []apiRecord }
+		json.NewDecoder(zr).Decode(&batch)
+		var names []string
+		for _, rec := range batch.Records {
+			names = append(names, rec.Container)
+		}
+		got = append(got, names)
+		if len(got) == 1 {
+			w.Header().Set(ingestDoneHeader, "2")
+			http.Error(w, "disk full", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := newPushSink(srv.URL, "", "tok", "edge", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		s.Write(record{Timestamp: time.Unix(60, 0), Container: name})
+	}
+	if err := s.Flush(); err == nil {
+		t.Fatal("the failed push was not reported")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g := fmt.Sprint(got); g != "[[a b c d] [c d]]" {
+		t.Errorf("pushed %s, want [[a b c d] [c d]]", g)
+	}
+}
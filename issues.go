@@ -0,0 +1,110 @@
+package cstats
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// strictParse makes loading fail on the first row that would otherwise be
+// dropped or read with zeros (--strict).
+var strictParse bool
+
+// strictFlag registers --strict on fs.
+func strictFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&strictParse, "strict", false, "Fail on the first malformed CSV row instead of skipping it")
+}
+
+// rowIssue is what is wrong with a CSV row, if anything.
+type rowIssue int
+
+const (
+	rowOK          rowIssue = iota
+	rowMalformed            // broken quoting or too few fields: dropped
+	rowBadTime              // unparsable timestamp: dropped
+	rowImplausible          // NaN, negative or absurdly large value: dropped
+	rowBadNumber            // unparsable CPU or memory value: kept as 0
+)
+
+func (i rowIssue) String() string {
+	switch i {
+	case rowMalformed:
+		return "malformed row"
+	case rowBadTime:
+		return "unparsable timestamp"
+	case rowImplausible:
+		return "implausible value"
+	case rowBadNumber:
+		return "unparsable number"
+	}
+	return "ok"
+}
+
+// parseIssues counts the problem rows of a capture, so corrupted captures
+// do not pass for valid but sparse ones, and the rows put back in order or
+// combined as duplicates.
+type parseIssues struct {
+	Malformed   int
+	BadTime     int
+	Implausible int
+	BadNumbers  int
+	Unordered   int
+	Duplicates  int
+}
+
+func (p *parseIssues) note(i rowIssue) {
+	switch i {
+	case rowMalformed:
+		p.Malformed++
+	case rowBadTime:
+		p.BadTime++
+	case rowImplausible:
+		p.Implausible++
+	case rowBadNumber:
+		p.BadNumbers++
+	}
+}
+
+func (p *parseIssues) add(o parseIssues) {
+	p.Malformed += o.Malformed
+	p.BadTime += o.BadTime
+	p.Implausible += o.Implausible
+	p.BadNumbers += o.BadNumbers
+	p.Unordered += o.Unordered
+	p.Duplicates += o.Duplicates
+}
+
+// settled counts what settleRecords or seriesStore.add did.
+func (p *parseIssues) settled(unordered, dups int) {
+	p.Unordered += unordered
+	p.Duplicates += dups
+}
+
+// String summarizes the issues, e.g. "3 rows dropped (2 malformed, 1 bad
+// timestamp)", or returns "" when there are none.
+func (p parseIssues) String() string {
+	var parts []string
+	if dropped := p.Malformed + p.BadTime + p.Implausible; dropped > 0 {
+		var why []string
+		if p.Malformed > 0 {
+			why = append(why, fmt.Sprintf("%d malformed", p.Malformed))
+		}
+		if p.BadTime > 0 {
+			why = append(why, fmt.Sprintf("%d bad timestamp", p.BadTime))
+		}
+		if p.Implausible > 0 {
+			why = append(why, fmt.Sprintf("%d implausible", p.Implausible))
+		}
+		parts = append(parts, fmt.Sprintf("%d rows dropped (%s)", dropped, strings.Join(why, ", ")))
+	}
+	if p.BadNumbers > 0 {
+		parts = append(parts, fmt.Sprintf("%d rows with unreadable values read as 0", p.BadNumbers))
+	}
+	if p.Duplicates > 0 {
+		parts = append(parts, fmt.Sprintf("%d duplicate samples combined (--dedupe %s)", p.Duplicates, dedupe))
+	}
+	if p.Unordered > 0 {
+		parts = append(parts, fmt.Sprintf("%d out-of-order rows sorted", p.Unordered))
+	}
+	return strings.Join(parts, ", ")
+}
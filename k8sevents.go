@@ -0,0 +1,127 @@
+package cstats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// k8sEventReasons are the Kubernetes event reasons worth an annotation:
+// those that explain a series stopping or never starting.
+var k8sEventReasons = map[string]bool{
+	"Evicted":          true,
+	"Preempted":        true,
+	"BackOff":          true,
+	"FailedScheduling": true,
+}
+
+// maxEventMessage bounds the event message kept in a label.
+const maxEventMessage = 120
+
+// ReportEvents makes the collector report the events of its pods, when
+// created with events.
+func (c *k8sCollector) ReportEvents(report func(event)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report = report
+}
+
+// emit reports an event of the pod ns/name if it is one of the collected
+// pods. Events from before the collector started are history, not news.
+func (c *k8sCollector) emit(t time.Time, ns, name, label string) {
+	c.mu.Lock()
+	_, ok := c.pods[ns+"/"+name]
+	report := c.report
+	c.mu.Unlock()
+	if !ok || report == nil || t.Before(c.started) {
+		return
+	}
+	if c.cluster != "" {
+		label = c.cluster + ": " + label
+	}
+	logf("kubernetes event: %s", label)
+	report(event{Timestamp: t, Label: label})
+}
+
+// watchEvents watches the pod events of namespace; the API server leaves
+// out the events of other objects. Events have no labels, so they are
+// matched to the selected pods by name instead.
+func (c *k8sCollector) watchEvents(clientset kubernetes.Interface, namespace string) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = "involvedObject.kind=Pod"
+		}))
+	inf := factory.Core().V1().Events().Informer()
+	inf.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { c.eventChanged(nil, obj) },
+		UpdateFunc: c.eventChanged,
+	})
+	inf.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		logf("event watch: %v", err)
+	})
+	go inf.Run(c.stop)
+}
+
+// eventChanged reports a new event, or a repeated one (BackOff) whose count
+// went up.
+func (c *k8sCollector) eventChanged(old, obj any) {
+	ev, ok := obj.(*corev1.Event)
+	if !ok || ev.InvolvedObject.Kind != "Pod" || !k8sEventReasons[ev.Reason] {
+		return
+	}
+	if prev, ok := old.(*corev1.Event); ok && prev.Count >= ev.Count {
+		return
+	}
+	t := ev.LastTimestamp.Time
+	if t.IsZero() {
+		t = ev.EventTime.Time
+	}
+	if t.IsZero() {
+		t = ev.FirstTimestamp.Time
+	}
+	msg, _, _ := strings.Cut(strings.TrimSpace(ev.Message), "\n")
+	if r := []rune(msg); len(r) > maxEventMessage {
+		msg = string(r[:maxEventMessage]) + "…"
+	}
+	c.emit(t, ev.InvolvedObject.Namespace, ev.InvolvedObject.Name,
+		fmt.Sprintf("%s %s/%s: %s", ev.Reason, ev.InvolvedObject.Namespace, ev.InvolvedObject.Name, msg))
+}
+
+// podTerminated reports the containers of a pod update that were just OOM
+// killed. The kernel's kill is no Kubernetes event, only a termination
+// reason in the container status.
+func (c *k8sCollector) podTerminated(old, obj any) {
+	prev, ok1 := old.(*corev1.Pod)
+	pod, ok2 := obj.(*corev1.Pod)
+	if !ok1 || !ok2 {
+		return
+	}
+	before := map[string]corev1.ContainerStatus{}
+	for _, cs := range prev.Status.ContainerStatuses {
+		before[cs.Name] = cs
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		was := before[cs.Name]
+		term := cs.State.Terminated
+		if cs.RestartCount > was.RestartCount {
+			term = cs.LastTerminationState.Terminated
+		} else if was.State.Terminated != nil {
+			continue // seen already
+		}
+		if term == nil || term.Reason != "OOMKilled" {
+			continue
+		}
+		t := term.FinishedAt.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		c.emit(t, pod.Namespace, pod.Name, fmt.Sprintf("OOMKilled %s/%s (container %s)", pod.Namespace, pod.Name, cs.Name))
+	}
+}
@@ -0,0 +1,329 @@
+package cstats
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/saveugene/cstats/collector"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// In-cluster service account files, used to authenticate to the kubelet.
+const (
+	saTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	saCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// kubeletCollector samples the pods of one node from its kubelet (/pods and
+// /stats/summary), without the API server or metrics-server. It is meant to
+// run as a DaemonSet, given the node through the downward API:
+//
+//	env:
+//	- name: NODE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//	- name: HOST_IP
+//	  valueFrom: {fieldRef: {fieldPath: status.hostIP}}
+//
+// Its service account needs get on nodes/proxy and nodes/stats. Samples
+// carry the node in the host column, so "cstats agent kubelet" pushes them
+// node-keyed to an aggregator; "cstats daemon kubelet --outfile
+// /data/$(NODE_NAME).csv" writes node-scoped captures instead.
+type kubeletCollector struct {
+	url       string
+	node      string
+	cluster   string
+	tokenFile string
+	client    *http.Client
+	namespace string
+	selector  labels.Selector
+	labelKeys []string
+	ids       bool
+	images    bool
+	storage   bool
+	pvc       bool
+
+	pods map[string]k8sPod // from the last Discover, by namespace/pod
+}
+
+func newKubeletCollector(url, node, cluster, tokenFile, caFile string, insecure bool, namespace, selector string, labelKeys []string, ids, images, storage, pvc bool) (*kubeletCollector, error) {
+	if node == "" {
+		return nil, errors.New("no node; set --node or $NODE_NAME (downward API spec.nodeName)")
+	}
+	if url == "" {
+		host := os.Getenv("HOST_IP")
+		if host == "" {
+			host = node
+		}
+		url = "https://" + host + ":10250"
+	}
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("--selector: %w", err)
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if !insecure && caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("--ca-file: %w", err)
+		}
+		if err == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			tlsConfig.RootCAs.AppendCertsFromPEM(pem)
+		}
+	}
+	logf("Kubelet collector: node=%s, url=%s, namespace=%s, selector=%q", node, url, namespace, selector)
+	return &kubeletCollector{
+		url:       strings.TrimSuffix(url, "/"),
+		node:      node,
+		cluster:   cluster,
+		tokenFile: tokenFile,
+		client:    &http.Client{Timeout: apiTimeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		namespace: namespace,
+		selector:  sel,
+		labelKeys: labelKeys,
+		ids:       ids,
+		images:    images,
+		storage:   storage,
+		pvc:       pvc,
+	}, nil
+}
+
+func (c *kubeletCollector) Columns() []string {
+	var cols []string
+	if c.cluster != "" {
+		cols = append(cols, "cluster")
+	}
+	cols = append(cols, "namespace")
+	for _, k := range c.labelKeys {
+		cols = append(cols, "label_"+k)
+	}
+	if c.ids {
+		cols = append(cols, idColumns...)
+	} else {
+		cols = append(cols, "host")
+	}
+	if c.images {
+		cols = append(cols, "image")
+	}
+	cols = append(cols, cpuLimitColumn)
+	return append(cols, storageColumns(c.storage, c.pvc)...)
+}
+
+// get decodes a kubelet endpoint into v. The token is read on every call,
+// as projected service account tokens are rotated.
+func (c *kubeletCollector) get(ctx context.Context, path string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.tokenFile != "" {
+		if token, err := os.ReadFile(c.tokenFile); err == nil {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", collector.ErrUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kubelet %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// included reports whether a pod passes --namespace and --selector.
+func (c *kubeletCollector) included(namespace string, podLabels map[string]string) bool {
+	return (c.namespace == "" || namespace == c.namespace) && c.selector.Matches(labels.Set(podLabels))
+}
+
+// Discover lists the node's pods for their limits, labels and container IDs.
+func (c *kubeletCollector) Discover(ctx context.Context) ([]string, error) {
+	var pods corev1.PodList
+	if err := c.get(ctx, "/pods", &pods); err != nil {
+		return nil, err
+	}
+	c.pods = map[string]k8sPod{}
+	var names []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !c.included(pod.Namespace, pod.Labels) {
+			continue
+		}
+		podKey := pod.Namespace + "/" + pod.Name
+		names = append(names, podKey)
+		c.pods[podKey] = podInfo(pod)
+	}
+	return names, nil
+}
+
+// kubeletSummary is the part of the kubelet's /stats/summary read here.
+type kubeletSummary struct {
+	Pods []kubeletPodStats `json:"pods"`
+}
+
+type kubeletPodStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	Containers []struct {
+		Name string `json:"name"`
+		CPU  struct {
+			UsageNanoCores *uint64 `json:"usageNanoCores"`
+		} `json:"cpu"`
+		Memory struct {
+			WorkingSetBytes *uint64 `json:"workingSetBytes"`
+		} `json:"memory"`
+	} `json:"containers"`
+	EphemeralStorage *struct {
+		UsedBytes *uint64 `json:"usedBytes"`
+	} `json:"ephemeral-storage"`
+	Volumes []struct {
+		UsedBytes     *uint64 `json:"usedBytes"`
+		CapacityBytes *uint64 `json:"capacityBytes"`
+		PVCRef        *struct {
+			Name string `json:"name"`
+		} `json:"pvcRef"`
+	} `json:"volume"`
+}
+
+// storageColumns are the columns of --storage and --pvc.
+func storageColumns(storage, pvc bool) []string {
+	var cols []string
+	if storage {
+		cols = append(cols, "ephemeral_storage_mb")
+	}
+	if pvc {
+		cols = append(cols, "pvc_used_mb", "pvc_used_pct")
+	}
+	return cols
+}
+
+// addStorage sets the storage columns of a pod's sample: its ephemeral
+// storage (container writable layers, logs and emptyDirs) and the use of
+// its persistent volume claims taken together.
+func (p *kubeletPodStats) addStorage(r *record, storage, pvc bool) {
+	set := func(col string, v float64) {
+		if r.Extra == nil {
+			r.Extra = map[string]float64{}
+		}
+		r.Extra[col] = v
+	}
+	if storage && p.EphemeralStorage != nil && p.EphemeralStorage.UsedBytes != nil {
+		set("ephemeral_storage_mb", float64(*p.EphemeralStorage.UsedBytes)/(1024*1024))
+	}
+	if !pvc {
+		return
+	}
+	var used, capacity uint64
+	claims := 0
+	for _, v := range p.Volumes {
+		if v.PVCRef == nil || v.UsedBytes == nil || v.CapacityBytes == nil {
+			continue
+		}
+		used += *v.UsedBytes
+		capacity += *v.CapacityBytes
+		claims++
+	}
+	if claims > 0 {
+		set("pvc_used_mb", float64(used)/(1024*1024))
+		if capacity > 0 {
+			set("pvc_used_pct", float64(used)/float64(capacity)*100.0)
+		}
+	}
+}
+
+// Sample reads the usage of the pods found by the last Discover. Like the
+// kubernetes collector, CPU is a percentage of the container's CPU limit.
+func (c *kubeletCollector) Sample(ctx context.Context) ([]record, error) {
+	var sum kubeletSummary
+	if err := c.get(ctx, "/stats/summary", &sum); err != nil {
+		return nil, err
+	}
+	var out []record
+	for i := range sum.Pods {
+		p := &sum.Pods[i]
+		pod, ok := c.pods[p.PodRef.Namespace+"/"+p.PodRef.Name]
+		if !ok {
+			continue
+		}
+		for _, cm := range p.Containers {
+			if cm.CPU.UsageNanoCores == nil || cm.Memory.WorkingSetBytes == nil {
+				continue // not running yet
+			}
+			memUsedBytes := float64(*cm.Memory.WorkingSetBytes)
+			r := record{Container: pod.containerName(p.PodRef.Name, cm.Name), MemUsageMB: memUsedBytes / (1024 * 1024),
+				Extra: map[string]float64{cpuLimitColumn: float64(pod.limits[cm.Name].cpuMillis)}}
+			withAttr(&r, "cluster", c.cluster)
+			withAttr(&r, "namespace", p.PodRef.Namespace)
+			if lim, ok := pod.limits[cm.Name]; ok {
+				if lim.cpuMillis > 0 {
+					r.CPUPct = float64(*cm.CPU.UsageNanoCores) / 1e6 / float64(lim.cpuMillis) * 100.0
+				}
+				if lim.memBytes > 0 {
+					r.MemLimitMB = float64(lim.memBytes) / (1024 * 1024)
+					r.MemPct = memUsedBytes / float64(lim.memBytes) * 100.0
+				}
+			}
+			for _, k := range c.labelKeys {
+				withAttr(&r, "label_"+k, pod.labels[k])
+			}
+			if c.ids {
+				withAttr(&r, "container_id", pod.containerIDs[cm.Name])
+			}
+			withAttr(&r, "host", c.node)
+			if c.images {
+				withAttr(&r, "image", pod.images[cm.Name])
+			}
+			p.addStorage(&r, c.storage, c.pvc)
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func init() {
+	collector.Register(collector.Kind{
+		Name:    "kubelet",
+		Title:   "Kubelet",
+		Backend: "kubelet",
+		Help:    "Collect the pods of one node from its kubelet (DaemonSet mode, no metrics-server)",
+		Outfile: "kubelet-stats.csv",
+		Flags: func(fs *flag.FlagSet) func(ctx context.Context) (collector.Collector, error) {
+			node := fs.String("node", os.Getenv("NODE_NAME"), "Node to collect, recorded in the host column (default $NODE_NAME)")
+			cluster := fs.String("cluster", "", "Cluster `name` to record in the cluster column, for nodes of several clusters pushing to one aggregator")
+			url := fs.String("kubelet-url", "", "Kubelet `URL` (default https://$HOST_IP:10250, else the node name)")
+			tokenFile := fs.String("token-file", saTokenFile, "Bearer token file for the kubelet (default: the pod's service account)")
+			caFile := fs.String("ca-file", saCAFile, "CA bundle of the kubelet's serving certificate")
+			insecure := fs.Bool("kubelet-insecure-tls", false, "Do not verify the kubelet's certificate (self-signed serving certificates)")
+			namespace := fs.String("namespace", "", "Kubernetes namespace (empty = all namespaces)")
+			selector := fs.String("selector", "", "Label selector (e.g. app=web)")
+			labels := fs.String("labels", "", "Comma-separated pod label keys to record as label_<key> columns")
+			ids := fs.Bool("ids", false, "Also record the container_id column")
+			images := fs.Bool("images", false, "Also record the image column: the image reference (name:tag or @digest) of each container's spec")
+			storage := fs.Bool("storage", false, "Also record the pod's ephemeral storage use (ephemeral_storage_mb)")
+			pvc := fs.Bool("pvc", false, "Also record the use of the pod's persistent volume claims (pvc_used_mb, pvc_used_pct)")
+			return func(ctx context.Context) (collector.Collector, error) {
+				var labelKeys []string
+				for _, k := range strings.Split(*labels, ",") {
+					if k = strings.TrimSpace(k); k != "" {
+						labelKeys = append(labelKeys, k)
+					}
+				}
+				return newKubeletCollector(*url, *node, *cluster, *tokenFile, *caFile, *insecure, *namespace, *selector, labelKeys, *ids, *images, *storage, *pvc)
+			}
+		},
+	})
+}
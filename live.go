@@ -0,0 +1,466 @@
+package cstats
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileState is the part of a file's metadata that changes when rows are
+// appended or the file is rewritten.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	exists  bool
+}
+
+func statFile(path string) fileState {
+	if isURL(path) {
+		return remoteFor(path).state()
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{size: info.Size(), modTime: info.ModTime(), exists: true}
+}
+
+// fileWatcher watches a set of files and notifies subscribers when any of
+// them changes. Local files are watched with fsnotify (inotify, kqueue, ...);
+// remote sources, and all files where fsnotify is unavailable, are polled.
+// Notifications are coalesced: a slow subscriber sees at most one pending
+// change.
+type fileWatcher struct {
+	paths []string
+	stop  chan struct{}
+	once  sync.Once
+
+	mu   sync.Mutex
+	subs map[chan struct{}]bool
+}
+
+// newFileWatcher starts watching paths, polling every interval when needed,
+// until close.
+func newFileWatcher(interval time.Duration, paths ...string) *fileWatcher {
+	w := &fileWatcher{paths: paths, stop: make(chan struct{}), subs: map[chan struct{}]bool{}}
+	go w.run(interval)
+	return w
+}
+
+// close stops watching and releases the fsnotify watcher.
+func (w *fileWatcher) close() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+func (w *fileWatcher) run(interval time.Duration) {
+	last := make([]fileState, len(w.paths))
+	for i, p := range w.paths {
+		last[i] = statFile(p)
+	}
+	check := func() {
+		changed := false
+		for i, p := range w.paths {
+			if st := statFile(p); st != last[i] {
+				last[i] = st
+				changed = true
+			}
+		}
+		if changed {
+			w.notify()
+		}
+	}
+
+	fsw, poll := w.watchLocal()
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if fsw != nil {
+		defer fsw.Close()
+		events, errs = fsw.Events, fsw.Errors
+	}
+	var tick <-chan time.Time
+	if poll {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-events:
+			check()
+		case <-errs:
+		case <-tick:
+			check()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// watchLocal registers the directories of the local paths with fsnotify
+// (watching the directory also catches files created or replaced later).
+// poll is true when some path still needs polling.
+func (w *fileWatcher) watchLocal() (fsw *fsnotify.Watcher, poll bool) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, true
+	}
+	watched := 0
+	for _, p := range w.paths {
+		switch {
+		case p == "":
+		case isURL(p):
+			poll = true
+		case fsw.Add(filepath.Dir(p)) != nil:
+			poll = true
+		default:
+			watched++
+		}
+	}
+	if watched == 0 {
+		fsw.Close()
+		return nil, true
+	}
+	return fsw, poll
+}
+
+func (w *fileWatcher) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel that receives a value after each change, and
+// a function to unsubscribe.
+func (w *fileWatcher) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	w.subs[ch] = true
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.subs, ch)
+		w.mu.Unlock()
+	}
+}
+
+// sseKeepAlive is how often an idle stream sends a comment line so proxies
+// do not close it.
+const sseKeepAlive = 15 * time.Second
+
+// streamHandler serves /api/stream, a Server-Sent Events channel that emits
+// an "update" event whenever the watched files change, plus one right after
+// connecting so a reconnecting page catches up. A "pause" event carries the
+// paused state on connecting and on each switch; while paused reports true
+// changes are held back, and resuming sends the update held back.
+func streamHandler(watcher *fileWatcher, paused func() bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		changes, unsubscribe := watcher.subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		wasPaused := !paused() // so the first send reports the state
+		send := func() {
+			if p := paused(); p != wasPaused {
+				wasPaused = p
+				fmt.Fprintf(w, "event: pause\ndata: %t\n\n", p)
+				flusher.Flush()
+			}
+			if wasPaused {
+				return
+			}
+			fmt.Fprintf(w, "event: update\ndata: %d\n\n", time.Now().UnixMilli())
+			flusher.Flush()
+		}
+		send()
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-changes:
+				send()
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// apiRecord is the JSON form of a sample served by /api/records.
+type apiRecord struct {
+	Timestamp  time.Time          `json:"timestamp"`
+	Container  string             `json:"container"`
+	CPUPct     float64            `json:"cpu_pct"`
+	MemUsageMB float64            `json:"mem_usage_mb"`
+	MemLimitMB float64            `json:"mem_limit_mb"`
+	MemPct     float64            `json:"mem_pct"`
+	Extra      map[string]float64 `json:"extra,omitempty"`
+	Attrs      map[string]string  `json:"attrs,omitempty"`
+}
+
+// lastSample returns the newest timestamp in records, or the zero time.
+func lastSample(records []record) time.Time {
+	var last time.Time
+	for _, r := range records {
+		if r.Timestamp.After(last) {
+			last = r.Timestamp
+		}
+	}
+	return last
+}
+
+// recordsHandler serves /api/records?since=<RFC3339 timestamp>, returning
+// only the samples newer than since (all samples without it) and the newest
+// timestamp. The samples of that tick may not all be written yet, so a
+// client polling for more asks again from just before it and skips the ones
+// it holds, as liveClient does.
+func recordsHandler(load func() []record) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				http.Error(w, "invalid since parameter, want an RFC3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			since = t
+		}
+
+		records := load()
+		out := []apiRecord{}
+		for _, rec := range records {
+			if !rec.Timestamp.After(since) {
+				continue
+			}
+			out = append(out, apiRecord{
+				Timestamp:  rec.Timestamp,
+				Container:  rec.Container,
+				CPUPct:     rec.CPUPct,
+				MemUsageMB: rec.MemUsageMB,
+				MemLimitMB: rec.MemLimitMB,
+				MemPct:     rec.MemPct,
+				Extra:      rec.Extra,
+				Attrs:      rec.Attrs,
+			})
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+
+		last := lastSample(records)
+		if last.Before(since) {
+			last = since
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{
+			"records": out,
+			"last":    last.Format(time.RFC3339Nano),
+		})
+	}
+}
+
+// cachedFigure is a marshaled /api/figure response.
+type cachedFigure struct {
+	body       []byte
+	etag       string
+	lastSample string
+}
+
+// figureCacheSize bounds the figures cached per source state; viewers
+// asking for many different windows or point counts just start over.
+const figureCacheSize = 64
+
+// figureCache keeps marshaled figures until one of the source files (CSV,
+// events) changes, or a sample is added to the source's store, so idle
+// dashboards are answered without re-parsing the capture, and many viewers
+// of the same dashboard share one build.
+type figureCache struct {
+	paths []string
+	store *MemStore // nil for sources read from their file
+
+	mu      sync.Mutex
+	state   []fileState
+	version uint64 // of store
+	entries map[string]cachedFigure
+}
+
+func newFigureCache(store *MemStore, paths ...string) *figureCache {
+	return &figureCache{paths: paths, store: store}
+}
+
+// get returns the figure cached under key, building it if the source files
+// changed since it was cached. It also returns the newest source mtime for
+// Last-Modified.
+func (c *figureCache) get(key string, build func() (any, time.Time)) (cachedFigure, time.Time, error) {
+	state := make([]fileState, len(c.paths))
+	var modTime time.Time
+	for i, p := range c.paths {
+		state[i] = statFile(p)
+		if state[i].modTime.After(modTime) {
+			modTime = state[i].modTime
+		}
+	}
+	var version uint64
+	if c.store != nil {
+		version = c.store.changes()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !slices.Equal(state, c.state) || version != c.version {
+		c.state, c.version = state, version
+		c.entries = map[string]cachedFigure{}
+	}
+	if f, ok := c.entries[key]; ok {
+		return f, modTime, nil
+	}
+	if len(c.entries) >= figureCacheSize {
+		clear(c.entries)
+	}
+
+	fig, last := build()
+	body, err := json.Marshal(fig)
+	if err != nil {
+		return cachedFigure{}, modTime, err
+	}
+	sum := sha256.Sum256(body)
+	f := cachedFigure{body: body, etag: fmt.Sprintf(`"%x"`, sum[:12])}
+	if !last.IsZero() {
+		f.lastSample = last.Format(time.RFC3339Nano)
+	}
+	c.entries[key] = f
+	return f, modTime, nil
+}
+
+// serve writes f with ETag and Last-Modified headers; conditional requests
+// that still match get 304 Not Modified.
+func (f cachedFigure) serve(w http.ResponseWriter, r *http.Request, modTime time.Time) {
+	if f.lastSample != "" {
+		w.Header().Set("X-Last-Sample", f.lastSample)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", f.etag)
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(f.body))
+}
+
+// liveSource is one CSV capture hosted by the live server, selected with
+// ?source=<name>.
+type liveSource struct {
+	Name       string
+	CSVPath    string
+	EventsPath string
+
+	store   *MemStore // the samples, when held in memory
+	watcher *fileWatcher
+	figures *figureCache
+	unwatch func() // stops the store notifying watcher
+	// paused holds back the updates of /api/stream for every page showing
+	// the source (POST /api/pause).
+	paused atomic.Bool
+}
+
+// close stops watching the source.
+func (src *liveSource) close() {
+	src.watcher.close()
+	if src.unwatch != nil {
+		src.unwatch()
+	}
+}
+
+// setPaused pauses or resumes the pushed updates of the source and tells
+// the connected pages.
+func (src *liveSource) setPaused(paused bool) {
+	if src.paused.Swap(paused) != paused {
+		src.watcher.notify()
+	}
+}
+
+// newLiveSources sets up the watched sources. Sources are named after their
+// file (docker-stats.csv -> docker-stats), falling back to the full path
+// when two files share a name. eventsFile overrides the events path of a
+// single source. A source found in stores, or collected into by this
+// process, is read from its store.
+func newLiveSources(csvPaths []string, stores map[string]*MemStore, eventsFile string, interval time.Duration) []*liveSource {
+	count := map[string]int{}
+	for _, p := range csvPaths {
+		count[sourceName(p)]++
+	}
+	sources := make([]*liveSource, 0, len(csvPaths))
+	for _, p := range csvPaths {
+		name := sourceName(p)
+		if count[name] > 1 {
+			name = p
+		}
+		events := eventsPath(p)
+		if isURL(p) {
+			// Markers for remote captures are only read from --events.
+			events = ""
+		}
+		if eventsFile != "" {
+			events = eventsFile
+		}
+		store := stores[p]
+		if store == nil {
+			store = memStoreFor(p)
+		}
+		src := &liveSource{
+			Name:       name,
+			CSVPath:    p,
+			EventsPath: events,
+			store:      store,
+			watcher:    newFileWatcher(interval, p, events),
+			figures:    newFigureCache(store, p, events),
+		}
+		if store != nil {
+			src.unwatch = store.watch(src.watcher)
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+func sourceName(csvPath string) string {
+	return filepath.Base(localBase(csvPath))
+}
+
+// withSource resolves ?source= (default: the first source) and passes it to
+// h, answering 404 for unknown names.
+func withSource(sources []*liveSource, h func(http.ResponseWriter, *http.Request, *liveSource)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("source")
+		for _, src := range sources {
+			if name == "" || src.Name == name {
+				h(w, r, src)
+				return
+			}
+		}
+		http.Error(w, fmt.Sprintf("unknown source %q", name), http.StatusNotFound)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cstats
+
+import "os"
+
+// lockCSV is a no-op where flock is unavailable.
+func lockCSV(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package cstats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockCSV takes an advisory lock on a capture for its collector, so a second
+// collector started on the same file fails instead of interleaving rows.
+// Filesystems without locking support are written to unlocked.
+func lockCSV(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return fmt.Errorf("%s is locked by another collector", f.Name())
+	}
+	return nil
+}
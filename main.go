@@ -1,25 +1,29 @@
-package main
+package cstats
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"html"
 	"io"
 	"log"
+	"maps"
 	"math"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
 	"runtime"
-	"sort"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
+	"github.com/saveugene/cstats/collector"
 )
 
 // Same colorblind-friendly palette as plot.py.
@@ -28,136 +32,395 @@ var colors = []string{
 	"#19D3F3", "#FF6692", "#B6E880", "#FF97FF", "#FECB52",
 }
 
-type record struct {
-	Timestamp  time.Time
-	Container  string
-	CPUPct     float64
-	MemUsageMB float64
-	MemLimitMB float64
-	MemPct     float64
-}
+// record is one sample of a container.
+type record = collector.Record
 
-type containerStats struct {
-	CPUMax    float64
-	CPUSum    float64
-	MemMax    float64
-	MemSum    float64
-	MemPctMax float64
-	Count     int
+// isAttrColumn reports whether an optional column always holds text, even
+// when a value happens to look numeric (label values like "2").
+func isAttrColumn(name string) bool {
+	switch name {
+	case "container_id", "host", "cluster", "namespace", "compose_project", "compose_service", "container_type", "health", "image", "image_id", "source":
+		return true
+	}
+	return strings.HasPrefix(name, "label_")
 }
 
-// loadCSV reads and parses the CSV file.
+// loadCSV reads and parses the CSV file or http(s) URL.
 func loadCSV(path string) ([]record, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+	if isURL(path) {
+		return remoteFor(path).records()
 	}
-	defer f.Close()
+	return loadLocalCSV(path)
+}
 
-	r := csv.NewReader(f)
+// parseCSV parses a capture. Malformed rows are skipped.
+func parseCSV(in io.Reader) ([]record, error) {
+	r := csv.NewReader(in)
 	header, err := r.Read()
 	if err != nil {
 		return nil, fmt.Errorf("reading header: %w", err)
 	}
+	p, err := newCSVParser(header)
+	if err != nil {
+		return nil, err
+	}
+	records := p.parseRows(r)
+	return records, p.err
+}
 
+// csvParser maps a capture's header to record fields. It counts the rows it
+// had to drop or read with zeros; in strict mode it stops at the first one
+// and reports it in err instead.
+type csvParser struct {
+	idx       map[string]int
+	extraCols []string
+
+	line   int // lines before the reader's first, for error messages
+	issues parseIssues
+	err    error
+}
+
+func newCSVParser(header []string) (*csvParser, error) {
 	idx := make(map[string]int, len(header))
 	for i, h := range header {
 		idx[strings.TrimSpace(h)] = i
 	}
-	need := []string{"timestamp", "container", "cpu_pct", "mem_usage_mb", "mem_limit_mb", "mem_pct"}
+	need := coreColumns
 	for _, n := range need {
 		if _, ok := idx[n]; !ok {
 			return nil, fmt.Errorf("missing column %q", n)
 		}
 	}
+	var extraCols []string
+	for h := range idx {
+		if !slices.Contains(need, h) {
+			extraCols = append(extraCols, h)
+		}
+	}
+	return &csvParser{idx: idx, extraCols: extraCols}, nil
+}
 
+// parseRows reads the remaining rows of r.
+func (p *csvParser) parseRows(r *csv.Reader) []record {
 	var records []record
-	for {
+	p.eachRow(r, func(rec record) {
+		records = append(records, rec)
+	})
+	return records
+}
+
+// parallelMinBytes is the input size from which parseParallel splits the
+// work; smaller inputs are not worth the goroutines.
+const parallelMinBytes = 4 << 20
+
+// parseParallel parses the rows in data (no header) on all cores: data is
+// cut into one chunk per worker at line boundaries and the chunks' records
+// are concatenated in file order. Captures never have newlines inside
+// quoted fields, so a line boundary is always a row boundary.
+func (p *csvParser) parseParallel(data []byte, fields int) []record {
+	workers := runtime.GOMAXPROCS(0)
+	if len(data) < parallelMinBytes || workers < 2 {
+		workers = 1
+	}
+	var chunks [][]byte
+	for len(data) > 0 {
+		end := len(data)
+		if n := workers - len(chunks); n > 1 {
+			end = len(data) / n
+			if i := bytes.IndexByte(data[end:], '\n'); i >= 0 {
+				end += i + 1
+			} else {
+				end = len(data)
+			}
+		}
+		chunks = append(chunks, data[:end])
+		data = data[end:]
+	}
+
+	parts := make([][]record, len(chunks))
+	parsers := make([]csvParser, len(chunks))
+	line := p.line
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		parsers[i] = csvParser{idx: p.idx, extraCols: p.extraCols, line: line}
+		line += bytes.Count(chunk, []byte{'\n'})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := csv.NewReader(bytes.NewReader(chunk))
+			r.FieldsPerRecord = fields
+			parts[i] = parsers[i].parseRows(r)
+		}()
+	}
+	wg.Wait()
+	for _, q := range parsers {
+		p.issues.add(q.issues)
+		if p.err == nil {
+			p.err = q.err
+		}
+	}
+	return slices.Concat(parts...)
+}
+
+// eachRow calls fn for every usable remaining row of r, counting the
+// others. In strict mode it stops at the first problem row.
+func (p *csvParser) eachRow(r *csv.Reader, fn func(record)) {
+	for p.err == nil {
 		row, err := r.Read()
 		if err == io.EOF {
-			break
+			return
 		}
 		if err != nil {
+			line := 0
+			if pe, ok := err.(*csv.ParseError); ok {
+				line, err = pe.StartLine, pe.Err
+			}
+			p.problem(rowMalformed, line, err.Error())
 			continue
 		}
-		ts, err := time.Parse(time.RFC3339, strings.TrimSpace(row[idx["timestamp"]]))
+		rec, issue := p.parseRow(row)
+		if issue != rowOK {
+			line, _ := r.FieldPos(0)
+			p.problem(issue, line, strings.Join(row, ","))
+		}
+		if issue == rowOK || issue == rowBadNumber {
+			fn(rec)
+		}
+	}
+}
+
+// problem counts a problem row, or in strict mode turns it into p.err.
+// line is relative to the reader.
+func (p *csvParser) problem(issue rowIssue, line int, detail string) {
+	p.issues.note(issue)
+	if strictParse && p.err == nil {
+		p.err = fmt.Errorf("line %d: %s: %s", p.line+line, issue, detail)
+	}
+}
+
+// parseRow converts a row; rows with a rowBadNumber issue are still usable.
+func (p *csvParser) parseRow(row []string) (record, rowIssue) {
+	idx, extraCols := p.idx, p.extraCols
+	for _, n := range coreColumns {
+		if idx[n] >= len(row) {
+			return record{}, rowMalformed
+		}
+	}
+	ts, err := parseTimestamp(row[idx["timestamp"]])
+	if err != nil {
+		return record{}, rowBadTime
+	}
+	issue := rowOK
+	number := func(col string) float64 {
+		v, err := strconv.ParseFloat(strings.TrimSpace(row[idx[col]]), 64)
 		if err != nil {
-			ts, err = time.Parse("2006-01-02T15:04:05Z", strings.TrimSpace(row[idx["timestamp"]]))
-			if err != nil {
+			issue = rowBadNumber
+		}
+		return v
+	}
+	cpu := number("cpu_pct")
+	memU := number("mem_usage_mb")
+	memL := noLimit(number("mem_limit_mb"))
+	memP := number("mem_pct")
+	if implausible(cpu, memU, memL, memP) != "" {
+		return record{}, rowImplausible
+	}
+
+	var extra map[string]float64
+	var attrs map[string]string
+	for _, h := range extraCols {
+		i := idx[h]
+		if i >= len(row) {
+			continue
+		}
+		val := strings.TrimSpace(row[i])
+		if v, err := strconv.ParseFloat(val, 64); err == nil && !isAttrColumn(h) {
+			if !finite(v) {
+				issue = rowBadNumber
 				continue
 			}
+			if extra == nil {
+				extra = make(map[string]float64, len(extraCols))
+			}
+			extra[h] = v
+		} else if val != "" {
+			if attrs == nil {
+				attrs = make(map[string]string, len(extraCols))
+			}
+			attrs[h] = val
 		}
-		cpu, _ := strconv.ParseFloat(strings.TrimSpace(row[idx["cpu_pct"]]), 64)
-		memU, _ := strconv.ParseFloat(strings.TrimSpace(row[idx["mem_usage_mb"]]), 64)
-		memL, _ := strconv.ParseFloat(strings.TrimSpace(row[idx["mem_limit_mb"]]), 64)
-		memP, _ := strconv.ParseFloat(strings.TrimSpace(row[idx["mem_pct"]]), 64)
-
-		records = append(records, record{
-			Timestamp:  ts,
-			Container:  strings.TrimSpace(row[idx["container"]]),
-			CPUPct:     cpu,
-			MemUsageMB: memU,
-			MemLimitMB: memL,
-			MemPct:     memP,
-		})
 	}
-	return records, nil
+
+	return record{
+		Timestamp:  ts,
+		Container:  strings.TrimSpace(row[idx["container"]]),
+		CPUPct:     cpu,
+		MemUsageMB: memU,
+		MemLimitMB: memL,
+		MemPct:     memP,
+		Extra:      extra,
+		Attrs:      attrs,
+	}, issue
 }
 
-// buildFigure constructs a Plotly figure JSON matching plot.py's layout.
-func buildFigure(records []record) map[string]any {
-	if len(records) == 0 {
-		return emptyFigure()
+// coreColumns is the standard CSV header written by the daemon.
+var coreColumns = []string{"timestamp", "container", "cpu_pct", "mem_usage_mb", "mem_limit_mb", "mem_pct"}
+
+// writeCSV writes records in the capture format loadCSV reads, with any
+// extra and attribute columns after the standard ones.
+func writeCSV(w io.Writer, records []record) error {
+	extraSet := map[string]bool{}
+	attrSet := map[string]bool{}
+	for _, r := range records {
+		for k := range r.Extra {
+			extraSet[k] = true
+		}
+		for k := range r.Attrs {
+			attrSet[k] = true
+		}
 	}
+	extraCols := slices.Sorted(maps.Keys(extraSet))
+	attrCols := slices.Sorted(maps.Keys(attrSet))
 
-	// Collect sorted unique container names.
-	seen := map[string]bool{}
+	cw := csv.NewWriter(w)
+	cw.Write(slices.Concat(coreColumns, extraCols, attrCols))
 	for _, r := range records {
-		seen[r.Container] = true
+		row := []string{
+			r.Timestamp.Format(time.RFC3339),
+			r.Container,
+			strconv.FormatFloat(r.CPUPct, 'f', -1, 64),
+			strconv.FormatFloat(r.MemUsageMB, 'f', -1, 64),
+			strconv.FormatFloat(r.MemLimitMB, 'f', -1, 64),
+			strconv.FormatFloat(r.MemPct, 'f', -1, 64),
+		}
+		for _, k := range extraCols {
+			v, ok := r.Extra[k]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		for _, k := range attrCols {
+			row = append(row, r.Attrs[k])
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// FigureOptions tunes how a capture is rendered, by the dashboards and
+// the LiveServer. Pricing, Budgets and Stats are set by the plot flags.
+type FigureOptions struct {
+	// MaxPoints caps the points per time-series trace via LTTB downsampling
+	// (0 = no limit).
+	MaxPoints int
+	// Events are drawn as vertical marker lines on the time-series panels.
+	Events []collector.Event
+	// CPUThreshold and MemThresholdMB draw horizontal reference lines on the
+	// CPU and RAM panels (0 = none).
+	CPUThreshold   float64
+	MemThresholdMB float64
+	// Stacked renders CPU and RAM as stacked areas with a total line.
+	Stacked bool
+	// Heatmap adds a container x time utilization panel ("cpu" or "mem").
+	Heatmap string
+	// Facet adds a column of CPU and RAM panels per value of this text
+	// column (e.g. "cluster").
+	Facet string
+	// Theme selects the color scheme ("dark" or "light").
+	Theme string
+	// Title replaces the default dashboard title; Meta key/value pairs
+	// (run id, commit, environment) are shown beneath it.
+	Title string
+	Meta  [][2]string
+	// Links turns container names in the summary table into links
+	// (container -> href), used by the multi-page drilldown output.
+	Links map[string]string
+	// Pricing adds an estimated cost column to the summary table.
+	Pricing pricing
+	// Budgets adds a budget status column to the summary table.
+	Budgets []budgetRule
+	// Recommend adds right-sizing columns computed with Headroom.
+	Recommend bool
+	Headroom  float64
+	// Stats replaces the stats computed from the records, for streamed
+	// captures whose records are only a reduced sample.
+	Stats map[string]*containerStats
+	// Interval is the capture's intended sampling interval, which the
+	// coverage column is measured against (0 = each container's median
+	// spacing).
+	Interval time.Duration
+}
+
+const defaultTitle = "Container Resource Monitor"
+
+// dashboardTitle returns the page title for opts.
+func dashboardTitle(opts FigureOptions) string {
+	if opts.Title != "" {
+		return opts.Title
+	}
+	return defaultTitle
+}
+
+// metaLine renders Meta as "k=v · k=v".
+func metaLine(meta [][2]string) string {
+	parts := make([]string, len(meta))
+	for i, kv := range meta {
+		parts[i] = kv[0] + "=" + kv[1]
 	}
-	containers := make([]string, 0, len(seen))
-	for c := range seen {
-		containers = append(containers, c)
+	return strings.Join(parts, " · ")
+}
+
+// figureTitle builds the layout title with the metadata line as a subtitle.
+func figureTitle(opts FigureOptions, suffix string) map[string]any {
+	text := html.EscapeString(dashboardTitle(opts) + suffix)
+	if len(opts.Meta) > 0 {
+		text += "<br><sup>" + html.EscapeString(metaLine(opts.Meta)) + "</sup>"
 	}
-	sort.Strings(containers)
+	return map[string]any{"text": text, "font": map[string]any{"size": 20}}
+}
+
+// summarize computes per-container stats with the optional cost and
+// recommendation columns requested in opts.
+func summarize(records []record, opts FigureOptions) map[string]*containerStats {
+	stats := opts.Stats
+	if stats == nil {
+		stats = computeStats(records)
+	}
+	applyInterval(stats, opts.Interval)
+	applyPricing(stats, opts.Pricing)
+	applyBudgets(stats, opts.Budgets)
+	if opts.Recommend {
+		applyRecommendations(stats, opts.Headroom)
+	}
+	return stats
+}
+
+// buildFigure constructs a Plotly figure JSON matching plot.py's layout.
+func buildFigure(records []record, opts FigureOptions) map[string]any {
+	defer timed(figuresBuilt, figureSeconds, time.Now())
+	th := themeFor(opts.Theme)
+	if len(records) == 0 {
+		return emptyFigure(th, opts)
+	}
+
+	containers := containerNames(records)
 
 	colorMap := make(map[string]string, len(containers))
 	for i, c := range containers {
 		colorMap[c] = colors[i%len(colors)]
 	}
 
-	// Group records by container, sorted by timestamp.
-	grouped := map[string][]record{}
-	for _, r := range records {
-		grouped[r.Container] = append(grouped[r.Container], r)
-	}
-	for _, recs := range grouped {
-		sort.Slice(recs, func(i, j int) bool {
-			return recs[i].Timestamp.Before(recs[j].Timestamp)
-		})
-	}
+	grouped := groupByContainer(records)
 
 	// Summary stats per container.
-	stats := map[string]*containerStats{}
-	for _, r := range records {
-		s, ok := stats[r.Container]
-		if !ok {
-			s = &containerStats{}
-			stats[r.Container] = s
-		}
-		s.CPUSum += r.CPUPct
-		if r.CPUPct > s.CPUMax {
-			s.CPUMax = r.CPUPct
-		}
-		s.MemSum += r.MemUsageMB
-		if r.MemUsageMB > s.MemMax {
-			s.MemMax = r.MemUsageMB
-		}
-		if r.MemPct > s.MemPctMax {
-			s.MemPctMax = r.MemPct
-		}
-		s.Count++
+	stats := summarize(records, opts)
+	if s := stats[selfContainer]; s != nil && s.Count > 0 {
+		opts.Meta = append(slices.Clip(opts.Meta), [2]string{"cstats", selfOverhead(s)})
 	}
+	u := statsMemUnit(stats)
 
 	var traces []map[string]any
 
@@ -170,53 +433,57 @@ func buildFigure(records []record) map[string]any {
 	for _, name := range containers {
 		recs := grouped[name]
 		color := colorMap[name]
-		timestamps := make([]string, len(recs))
-		cpuVals := make([]float64, len(recs))
-		memVals := make([]float64, len(recs))
-		memPctVals := make([]float64, len(recs))
-		for i, r := range recs {
-			timestamps[i] = r.Timestamp.Format(time.RFC3339)
-			cpuVals[i] = r.CPUPct
-			memVals[i] = r.MemUsageMB
-			memPctVals[i] = r.MemPct
-		}
-
-		// CPU % time series (row1, col1)
-		traces = append(traces, map[string]any{
-			"type":        "scatter",
-			"x":           timestamps,
-			"y":           cpuVals,
-			"name":        name,
-			"legendgroup": name,
-			"showlegend":  true,
-			"mode":        "lines+markers",
-			"marker":      map[string]any{"size": 3},
-			"line":        map[string]any{"color": color, "width": 1.5},
-			"hovertemplate": "%{x|%H:%M:%S}<br>CPU: %{y:.1f}%<extra>" + name + "</extra>",
-			"xaxis":        "x",
-			"yaxis":        "y",
-		})
+		gaps := gapStarts(recs)
+		series := func(val func(record) float64) ([]string, []any) {
+			idx, ys := downsampleSeries(recs, val, opts.MaxPoints)
+			return breakAtGaps(recs, idx, ys, gaps)
+		}
+		memPctTS, memPctVals := series(func(r record) float64 { return r.MemPct })
+
+		// CPU and RAM are drawn as stacked areas below in stacked mode.
+		if !opts.Stacked {
+			cpuTS, cpuVals := series(func(r record) float64 { return r.CPUPct })
+			memTS, memVals := series(func(r record) float64 { return u.of(r.MemUsageMB) })
+
+			// CPU % time series (row1, col1)
+			traces = append(traces, map[string]any{
+				"type":        "scatter",
+				"x":           cpuTS,
+				"y":           cpuVals,
+				"name":        name,
+				"legendgroup": name,
+				"showlegend":  true,
+				"mode":        "lines+markers",
+				"marker":      map[string]any{"size": 3},
+				"line":        map[string]any{"color": color, "width": 1.5},
+				"hovertemplate": "%{x|%H:%M:%S}<br>CPU: %{y:.1f}%<extra>" + name + "</extra>",
+				"meta":         map[string]any{"container": name, "metric": "cpu"},
+				"xaxis":        "x",
+				"yaxis":        "y",
+			})
 
-		// RAM time series (row2, col1)
-		traces = append(traces, map[string]any{
-			"type":        "scatter",
-			"x":           timestamps,
-			"y":           memVals,
-			"name":        name,
-			"legendgroup": name,
-			"showlegend":  false,
-			"mode":        "lines+markers",
-			"marker":      map[string]any{"size": 3},
-			"line":        map[string]any{"color": color, "width": 1.5},
-			"hovertemplate": "%{x|%H:%M:%S}<br>RAM: %{y:.1f} MB<extra>" + name + "</extra>",
-			"xaxis":        "x3",
-			"yaxis":        "y3",
-		})
+			// RAM time series (row2, col1)
+			traces = append(traces, map[string]any{
+				"type":        "scatter",
+				"x":           memTS,
+				"y":           memVals,
+				"name":        name,
+				"legendgroup": name,
+				"showlegend":  false,
+				"mode":        "lines+markers",
+				"marker":      map[string]any{"size": 3},
+				"line":        map[string]any{"color": color, "width": 1.5},
+				"hovertemplate": "%{x|%H:%M:%S}<br>RAM: " + u.hover() + "<extra>" + name + "</extra>",
+				"meta":         map[string]any{"container": name, "metric": "mem", "per": u.Per},
+				"xaxis":        "x3",
+				"yaxis":        "y3",
+			})
+		}
 
 		// Mem % time series (row3, col1)
 		traces = append(traces, map[string]any{
 			"type":        "scatter",
-			"x":           timestamps,
+			"x":           memPctTS,
 			"y":           memPctVals,
 			"name":        name,
 			"legendgroup": name,
@@ -225,101 +492,90 @@ func buildFigure(records []record) map[string]any {
 			"marker":      map[string]any{"size": 3},
 			"line":        map[string]any{"color": color, "width": 1.5},
 			"hovertemplate": "%{x|%H:%M:%S}<br>Mem: %{y:.2f}%<extra>" + name + "</extra>",
+			"meta":         map[string]any{"container": name, "metric": "mem_pct"},
 			"xaxis":        "x5",
 			"yaxis":        "y5",
 		})
 	}
+	if opts.Stacked {
+		traces = append(traces, stackedTraces(containers, grouped, colorMap, opts.MaxPoints, th, u)...)
+	}
 
-	// Bar chart data.
-	cpuMaxVals := make([]float64, len(containers))
-	cpuAvgVals := make([]float64, len(containers))
-	memMaxVals := make([]float64, len(containers))
-	memAvgVals := make([]float64, len(containers))
-	for i, c := range containers {
-		s := stats[c]
-		cpuMaxVals[i] = round1(s.CPUMax)
-		cpuAvgVals[i] = round1(s.CPUSum / float64(s.Count))
-		memMaxVals[i] = round1(s.MemMax)
-		memAvgVals[i] = round1(s.MemSum / float64(s.Count))
+	// Bar chart data: one grouped trace per statistic, in each bar subplot.
+	type barStat struct {
+		name  string
+		color string
+		cpu   func(*containerStats) float64
+		mem   func(*containerStats) float64
 	}
+	barStats := []barStat{
+		{"peak", "rgba(239,85,59,0.7)", func(s *containerStats) float64 { return s.CPUMax }, func(s *containerStats) float64 { return s.MemMax }},
+		{"p99", "rgba(255,161,90,0.7)", func(s *containerStats) float64 { return s.CPUP99 }, func(s *containerStats) float64 { return s.MemP99 }},
+		{"p95", "rgba(254,203,82,0.7)", func(s *containerStats) float64 { return s.CPUP95 }, func(s *containerStats) float64 { return s.MemP95 }},
+		{"p50", "rgba(0,204,150,0.7)", func(s *containerStats) float64 { return s.CPUP50 }, func(s *containerStats) float64 { return s.MemP50 }},
+		{"avg", "rgba(99,110,250,0.7)", (*containerStats).CPUAvg, (*containerStats).MemAvg},
+	}
+	for _, b := range barStats {
+		cpuVals := make([]float64, len(containers))
+		memVals := make([]float64, len(containers))
+		for i, c := range containers {
+			cpuVals[i] = round1(b.cpu(stats[c]))
+			memVals[i] = u.round(b.mem(stats[c]))
+		}
+		label := strings.ToUpper(b.name[:1]) + b.name[1:]
 
-	// CPU bar - peak (row1, col2)
-	traces = append(traces, map[string]any{
-		"type":          "bar",
-		"x":             containers,
-		"y":             cpuMaxVals,
-		"name":          "peak",
-		"marker":        map[string]any{"color": "rgba(239,85,59,0.7)"},
-		"showlegend":    false,
-		"hovertemplate": "%{x}<br>Peak CPU: %{y:.1f}%<extra></extra>",
-		"xaxis":         "x2",
-		"yaxis":         "y2",
-	})
-	// CPU bar - avg (row1, col2)
-	traces = append(traces, map[string]any{
-		"type":          "bar",
-		"x":             containers,
-		"y":             cpuAvgVals,
-		"name":          "avg",
-		"marker":        map[string]any{"color": "rgba(99,110,250,0.7)"},
-		"showlegend":    false,
-		"hovertemplate": "%{x}<br>Avg CPU: %{y:.1f}%<extra></extra>",
-		"xaxis":         "x2",
-		"yaxis":         "y2",
-	})
-	// RAM bar - peak (row2, col2)
-	traces = append(traces, map[string]any{
-		"type":          "bar",
-		"x":             containers,
-		"y":             memMaxVals,
-		"name":          "peak",
-		"marker":        map[string]any{"color": "rgba(239,85,59,0.7)"},
-		"showlegend":    false,
-		"hovertemplate": "%{x}<br>Peak RAM: %{y:.1f} MB<extra></extra>",
-		"xaxis":         "x4",
-		"yaxis":         "y4",
-	})
-	// RAM bar - avg (row2, col2)
-	traces = append(traces, map[string]any{
-		"type":          "bar",
-		"x":             containers,
-		"y":             memAvgVals,
-		"name":          "avg",
-		"marker":        map[string]any{"color": "rgba(99,110,250,0.7)"},
-		"showlegend":    false,
-		"hovertemplate": "%{x}<br>Avg RAM: %{y:.1f} MB<extra></extra>",
-		"xaxis":         "x4",
-		"yaxis":         "y4",
-	})
+		// CPU bars (row1, col2)
+		traces = append(traces, map[string]any{
+			"type":          "bar",
+			"x":             containers,
+			"y":             cpuVals,
+			"name":          b.name,
+			"marker":        map[string]any{"color": b.color},
+			"showlegend":    false,
+			"hovertemplate": "%{x}<br>" + label + " CPU: %{y:.1f}%<extra></extra>",
+			"xaxis":         "x2",
+			"yaxis":         "y2",
+		})
+		// RAM bars (row2, col2)
+		traces = append(traces, map[string]any{
+			"type":          "bar",
+			"x":             containers,
+			"y":             memVals,
+			"name":          b.name,
+			"marker":        map[string]any{"color": b.color},
+			"showlegend":    false,
+			"hovertemplate": "%{x}<br>" + label + " RAM: " + u.hover() + "<extra></extra>",
+			"xaxis":         "x4",
+			"yaxis":         "y4",
+		})
+	}
 
-	// Summary table (row3, col2).
-	tContainers := make([]string, len(containers))
-	tCPUAvg := make([]float64, len(containers))
-	tCPUMax := make([]float64, len(containers))
-	tMemAvg := make([]float64, len(containers))
-	tMemMax := make([]float64, len(containers))
-	tMemPctMax := make([]float64, len(containers))
+	// Summary table (row3, col2), column-major as Plotly expects.
+	header := summaryHeaderFor(stats)
+	columns := make([]any, len(header))
+	for j := range header {
+		columns[j] = make([]string, len(containers))
+	}
 	for i, c := range containers {
-		s := stats[c]
-		tContainers[i] = c
-		tCPUAvg[i] = round1(s.CPUSum / float64(s.Count))
-		tCPUMax[i] = round1(s.CPUMax)
-		tMemAvg[i] = round1(s.MemSum / float64(s.Count))
-		tMemMax[i] = round1(s.MemMax)
-		tMemPctMax[i] = round2(s.MemPctMax)
+		for j, v := range summaryRow(c, stats[c], u) {
+			columns[j].([]string)[i] = v
+		}
+		if href, ok := opts.Links[c]; ok {
+			columns[0].([]string)[i] = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(c))
+		}
 	}
 	traces = append(traces, map[string]any{
 		"type": "table",
 		"header": map[string]any{
-			"values":     []string{"Container", "CPU avg%", "CPU max%", "RAM avg MB", "RAM max MB", "Mem max%"},
-			"fill":       map[string]any{"color": "#2a2a2a"},
-			"font":       map[string]any{"color": "white", "size": 11},
+			"values":     header,
+			"fill":       map[string]any{"color": th.TableHeaderBG},
+			"font":       map[string]any{"color": th.TableHeaderText, "size": 11},
 			"align":      "left",
 		},
 		"cells": map[string]any{
-			"values": []any{tContainers, tCPUAvg, tCPUMax, tMemAvg, tMemMax, tMemPctMax},
-			"fill":   map[string]any{"color": "#1e1e1e"},
-			"font":   map[string]any{"color": "#ddd", "size": 10},
+			"values": columns,
+			"fill":   map[string]any{"color": th.TableCellBG},
+			"font":   map[string]any{"color": budgetFontColors(header, columns, th.TableCellText), "size": 10},
 			"align":  "left",
 		},
 		"domain": map[string]any{
@@ -328,10 +584,10 @@ func buildFigure(records []record) map[string]any {
 		},
 	})
 
-	// Layout mimicking make_subplots(3 rows, 2 cols) with plotly_dark.
+	// Layout mimicking make_subplots(3 rows, 2 cols) with the theme template.
 	layout := map[string]any{
-		"template":   "plotly_dark",
-		"title":      map[string]any{"text": "Container Resource Monitor", "font": map[string]any{"size": 20}},
+		"template":   th.Template,
+		"title":      figureTitle(opts, ""),
 		"height":     950,
 		"width":      1400,
 		"uirevision": "live-monitor",
@@ -376,7 +632,7 @@ func buildFigure(records []record) map[string]any {
 		"yaxis3": map[string]any{
 			"domain": []float64{0.36, 0.64},
 			"anchor": "x3",
-			"title":  map[string]any{"text": "MB"},
+			"title":  map[string]any{"text": u.Label},
 		},
 
 		// Row 2 right - RAM bars
@@ -394,7 +650,7 @@ func buildFigure(records []record) map[string]any {
 		"xaxis5": map[string]any{
 			"domain": []float64{0.0, 0.62},
 			"anchor": "y5",
-			"title":  map[string]any{"text": "Time"},
+			"title":  map[string]any{"text": "Time (" + tzName() + ")"},
 			"rangeslider": map[string]any{
 				"visible":   true,
 				"thickness": 0.05,
@@ -409,17 +665,44 @@ func buildFigure(records []record) map[string]any {
 		// Subplot titles as annotations.
 		"annotations": []map[string]any{
 			subplotTitle("CPU %", 0.31, 1.0),
-			subplotTitle("CPU - peak & average", 0.89, 1.0),
-			subplotTitle("RAM (MB)", 0.31, 0.64),
-			subplotTitle("RAM - peak & average", 0.89, 0.64),
+			subplotTitle("CPU - peak, p99/p95/p50 & avg", 0.89, 1.0),
+			subplotTitle(u.label("RAM (MB)"), 0.31, 0.64),
+			subplotTitle("RAM - peak, p99/p95/p50 & avg", 0.89, 0.64),
 			subplotTitle("Memory % of limit", 0.31, 0.2),
 		},
 	}
 
-	return map[string]any{
+	// Limit/threshold reference lines, collector gaps and event markers.
+	shapes := referenceLines(containers, stats, colorMap, opts)
+	shapes = append(shapes, captureGapShapes(records, [][2]string{{"x", "y"}, {"x3", "y3"}, {"x5", "y5"}})...)
+	if len(opts.Events) > 0 {
+		axes := [][2]string{{"x", "y"}, {"x3", "y3"}, {"x5", "y5"}}
+		phShapes, phNotes := phaseShapes(phasesFrom(opts.Events, lastSample(records)), axes, th)
+		evShapes, notes := eventAnnotations(opts.Events, axes, th)
+		shapes = append(append(shapes, phShapes...), evShapes...)
+		layout["annotations"] = append(layout["annotations"].([]map[string]any), append(phNotes, notes...)...)
+	}
+	if len(shapes) > 0 {
+		layout["shapes"] = shapes
+	}
+
+	fig := map[string]any{
 		"data":   traces,
 		"layout": layout,
 	}
+	addExtraPanels(fig, records, containers, grouped, colorMap, opts.MaxPoints)
+	if opts.Facet != "" {
+		addFacets(fig, records, opts.Facet, colorMap, opts.MaxPoints, u)
+	}
+	if opts.Heatmap != "" {
+		if err := addHeatmap(fig, containers, grouped, opts.Heatmap, opts.MaxPoints); err != nil {
+			warnf("heatmap: %v", err)
+		}
+	}
+	if _, n := scrubFigure(fig); n > 0 {
+		warnf("figure: blanked %d NaN or infinite values", n)
+	}
+	return fig
 }
 
 func subplotTitle(text string, x, y float64) map[string]any {
@@ -436,12 +719,12 @@ func subplotTitle(text string, x, y float64) map[string]any {
 	}
 }
 
-func emptyFigure() map[string]any {
+func emptyFigure(th theme, opts FigureOptions) map[string]any {
 	return map[string]any{
 		"data": []any{},
 		"layout": map[string]any{
-			"template": "plotly_dark",
-			"title":    map[string]any{"text": "Container Resource Monitor", "font": map[string]any{"size": 20}},
+			"template": th.Template,
+			"title":    figureTitle(opts, ""),
 			"height":   600,
 			"width":    1200,
 			"annotations": []map[string]any{
@@ -452,7 +735,7 @@ func emptyFigure() map[string]any {
 					"yref":      "paper",
 					"showarrow": false,
 					"font":      map[string]any{"size": 18},
-					"text":      "No metrics yet. Start d-daemon.sh or k8s-daemon.sh and wait for samples.",
+					"text":      "No metrics yet. Start cstats daemon, or install it with cstats daemon install, and wait for samples.",
 				},
 			},
 		},
@@ -488,13 +771,74 @@ func truncName(s string, n int) string {
 }
 
 func runTerm(args []string) {
-	fs := flag.NewFlagSet("term", flag.ExitOnError)
-	csvPath := fs.String("csv", "docker-stats.csv", "Path to CSV file")
+	fs := newFlagSet("term")
+	csvPath := fs.String("csv", "docker-stats.csv", "Path or http(s) URL of the CSV file")
 	interval := fs.Float64("interval", 2.0, "Refresh interval in seconds")
-	fs.Parse(args)
+	view := registerViewFlags(fs)
+	prices := pricingFlags(fs)
+	budgetsFile := budgetsFlag(fs)
+	remoteFlags(fs)
+	logsRuntime := fs.String("logs", "", "Tail the highlighted container's logs in a panel: docker or kubernetes (toggle with t)")
+	logLines := fs.Int("log-lines", 200, "Log lines fetched for the --logs panel")
+	connect := fs.String("connect", "", "Follow a running `cstats plot --live` server (http://host:port, optionally ?source=name) instead of a CSV")
+	var warn termThresholds
+	fs.Float64Var(&warn.CPU, "warn-cpu", 0, "Color CPU cells and bars above this % (red: average, yellow: peak; 0 = off)")
+	fs.Float64Var(&warn.MemMB, "warn-mem", 0, "Color RAM cells and bars above this many MB (red: average, yellow: peak; 0 = off)")
+	layoutFlag := fs.String("layout", "auto", "TUI layout: auto, panels, stacked or sparklines (cycle with l)")
+	stream := fs.Bool("stream", false, "Follow the capture in bounded memory (approximate percentiles, peak-preserving charts; the summary covers the whole capture) for very large files")
+	retentionFlag(fs)
+	strictFlag(fs)
+	dedupeFlag(fs)
+	tz := tzFlag(fs)
+	unitsFlag(fs)
+	pprofFlag(fs)
+	parseFlags(fs, args)
 	if fs.NArg() > 0 {
 		*csvPath = fs.Arg(0)
 	}
+	if err := view.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *layoutFlag != "auto" && !slices.Contains(termLayouts, *layoutFlag) {
+		log.Fatalf("unknown --layout %q (use auto, panels, stacked or sparklines)", *layoutFlag)
+	}
+	if retention < 0 {
+		log.Fatal("--window must not be negative")
+	}
+	if err := parseTZ(*tz); err != nil {
+		log.Fatal(err)
+	}
+	if *stream {
+		switch {
+		case *connect != "":
+			log.Fatal("--stream is for a CSV, not --connect")
+		case retention > 0:
+			log.Fatal("--stream cannot be combined with --window")
+		case view.reshapes():
+			log.Fatal("--stream cannot be combined with --rename, --series-key id|host|cluster|namespace, --group-by, --top or --redact")
+		}
+		streamFollow.points, streamFollow.seriesKey = termStreamPoints, view.seriesKey
+	}
+	budgets := mustLoadBudgets(*budgetsFile)
+	startDiagnostics()
+	var logs *logTail
+	switch *logsRuntime {
+	case "":
+	case "docker", "kubernetes":
+		logs = &logTail{runtime: *logsRuntime, lines: *logLines}
+	default:
+		log.Fatalf("unknown --logs %q (use docker or kubernetes)", *logsRuntime)
+	}
+	// source is what the TUI reads: the CSV, or the live server's records.
+	source := *csvPath
+	load := func() ([]record, error) { return loadCSV(*csvPath) }
+	if *connect != "" {
+		client, err := newLiveClient(*connect)
+		if err != nil {
+			log.Fatal(err)
+		}
+		source, load = client.label, client.fetch
+	}
 
 	if err := ui.Init(); err != nil {
 		log.Fatalf("failed to init termui: %v", err)
@@ -521,90 +865,191 @@ func runTerm(args []string) {
 	ramBar.BarWidth = 5
 	ramBar.BarGap = 1
 
+	ioPlots := map[string]*widgets.Plot{}
+	for _, p := range termIOPanels {
+		plot := widgets.NewPlot()
+		plot.Title = p.Title
+		plot.AxesColor = ui.ColorWhite
+		plot.ShowAxes = true
+		ioPlots[p.Column] = plot
+	}
+
 	table := widgets.NewTable()
 	table.Title = " Summary "
 	table.TextStyle = ui.NewStyle(ui.ColorWhite)
 	table.RowSeparator = true
 	table.TextAlignment = ui.AlignCenter
 
+	// sparkTable is the compact one-row-per-container layout.
+	sparkTable := widgets.NewTable()
+	sparkTable.Title = " Containers "
+	sparkTable.TextStyle = ui.NewStyle(ui.ColorWhite)
+	sparkTable.RowSeparator = false
+	sparkTable.TextAlignment = ui.AlignLeft
+
+	logPanel := newLogPanel()
+	logPanel.Title = " Logs "
+	logPanel.WrapText = false
+	showLogs := logs != nil
+
 	statusBar := widgets.NewParagraph()
 	statusBar.Border = false
 	statusBar.TextStyle = ui.NewStyle(ui.ColorWhite)
 
+	// showIO swaps the RAM row for I/O rate panels, when the capture has
+	// network or disk counters (ioShown).
+	var showIO bool
+	var ioShown []string
+
 	grid := ui.NewGrid()
 	termWidth, termHeight := ui.TerminalDimensions()
-	grid.SetRect(0, 0, termWidth, termHeight-1)
-	grid.Set(
-		ui.NewRow(0.37,
-			ui.NewCol(0.7, cpuPlot),
-			ui.NewCol(0.3, cpuBar),
-		),
-		ui.NewRow(0.37,
+	// With --layout auto the layout follows the terminal size until one is
+	// picked with l.
+	autoSize := *layoutFlag == "auto"
+	layout := *layoutFlag
+	if autoSize {
+		layout = autoLayout(termWidth, termHeight)
+	}
+	setGrid := func() {
+		grid.SetRect(0, 0, termWidth, termHeight-1)
+		statusBar.SetRect(0, termHeight-1, termWidth, termHeight)
+		grid.Items = nil
+		switch {
+		case layout == "sparklines":
+			split := termHeight - 1
+			if showLogs {
+				split = split * 7 / 10
+			}
+			sparkTable.SetRect(0, 0, termWidth, split)
+			logPanel.SetRect(0, split, termWidth, termHeight-1)
+			return
+		case layout == "stacked" && showLogs:
+			grid.Set(
+				ui.NewRow(0.4, cpuPlot),
+				ui.NewRow(0.3, logPanel),
+				ui.NewRow(0.3, table),
+			)
+			return
+		case layout == "stacked":
+			grid.Set(
+				ui.NewRow(0.55, cpuPlot),
+				ui.NewRow(0.45, table),
+			)
+			return
+		}
+		// The chart rows give up some height to the log panel.
+		rowHeight := 0.37
+		if showLogs {
+			rowHeight = 0.3
+		}
+		middle := ui.NewRow(rowHeight,
 			ui.NewCol(0.7, ramPlot),
 			ui.NewCol(0.3, ramBar),
-		),
-		ui.NewRow(0.26, table),
-	)
-	statusBar.SetRect(0, termHeight-1, termWidth, termHeight)
-
-	updateData := func() {
-		records, err := loadCSV(*csvPath)
-		if err != nil || len(records) == 0 {
-			table.Rows = [][]string{{"Waiting for data..."}, {fmt.Sprintf("CSV: %s", *csvPath)}}
-			statusBar.Text = fmt.Sprintf(" [%s](fg:cyan) | q to quit | no data yet",
-				time.Now().Format("15:04:05"))
-			ui.Render(grid, statusBar)
+		)
+		if showIO && len(ioShown) > 0 {
+			cols := make([]any, len(ioShown))
+			for i, col := range ioShown {
+				cols[i] = ui.NewCol(1/float64(len(ioShown)), ioPlots[col])
+			}
+			middle = ui.NewRow(rowHeight, cols...)
+		}
+		top := ui.NewRow(rowHeight,
+			ui.NewCol(0.7, cpuPlot),
+			ui.NewCol(0.3, cpuBar),
+		)
+		if showLogs {
+			grid.Set(top, middle, ui.NewRow(0.2, logPanel), ui.NewRow(0.2, table))
 			return
 		}
-
-		seen := map[string]bool{}
-		for _, r := range records {
-			seen[r.Container] = true
+		grid.Set(top, middle, ui.NewRow(0.26, table))
+	}
+	setGrid()
+
+	render := func() {
+		if layout == "sparklines" && showLogs {
+			drawUI(sparkTable, logPanel, statusBar)
+		} else if layout == "sparklines" {
+			drawUI(sparkTable, statusBar)
+		} else {
+			drawUI(grid, statusBar)
 		}
-		containers := make([]string, 0, len(seen))
-		for c := range seen {
-			containers = append(containers, c)
+	}
+
+	var window termWindow
+	var scroll tableScroll
+	// While paused the TUI keeps rendering the records loaded last, so
+	// window and pan keys still work on the frozen data.
+	var paused bool
+	var lastLoaded []record
+	var tracker statsTracker
+	var series seriesTracker
+	// shown and shownStats are what the last refresh displayed, for s to
+	// save; notice reports the result in the status bar for a while.
+	var shown []record
+	var shownStats map[string]*containerStats
+	var notice string
+	var noticeAt time.Time
+	// Clicking a container in the table highlights it (grays out the other
+	// series); clicking a header sorts by that column.
+	var highlight string
+	var order tableSort
+	dimmed := ui.Color(240)
+	seriesColor := func(i int, c string) ui.Color {
+		if highlight != "" && c != highlight {
+			return dimmed
 		}
-		sort.Strings(containers)
+		return termColors[i%len(termColors)]
+	}
 
-		tsSet := map[time.Time]bool{}
-		for _, r := range records {
-			tsSet[r.Timestamp] = true
+	updateData := func() {
+		records, err := lastLoaded, error(nil)
+		if !paused {
+			records, err = load()
+			lastLoaded = records
 		}
-		timestamps := make([]time.Time, 0, len(tsSet))
-		for ts := range tsSet {
-			timestamps = append(timestamps, ts)
+		if err != nil && len(records) > 0 {
+			// Keep showing what a live server sent before it went away.
+			notice, noticeAt = fmt.Sprintf("[%v](fg:red)", err), time.Now()
+		} else if err != nil || len(records) == 0 {
+			table.Rows = [][]string{{"Waiting for data..."}, {fmt.Sprintf("Source: %s", source)}}
+			sparkTable.Rows, sparkTable.ColumnWidths = table.Rows, nil
+			statusBar.Text = fmt.Sprintf(" [%s](fg:cyan) | q to quit | no data yet",
+				time.Now().In(displayLoc).Format("15:04:05"))
+			render()
+			return
 		}
-		sort.Slice(timestamps, func(i, j int) bool {
-			return timestamps[i].Before(timestamps[j])
-		})
-
-		lookup := map[string]map[time.Time]record{}
-		for _, r := range records {
-			if _, ok := lookup[r.Container]; !ok {
-				lookup[r.Container] = map[time.Time]record{}
-			}
-			lookup[r.Container][r.Timestamp] = r
+		if !*stream {
+			records = view.apply(records) // streamed ones were keyed as read
+		}
+		records = window.apply(records)
+		if len(records) == 0 {
+			table.Rows = [][]string{{"No samples in window"}, {window.String()}}
+			sparkTable.Rows, sparkTable.ColumnWidths = table.Rows, nil
+			statusBar.Text = fmt.Sprintf(" [%s](fg:cyan) | window: %s | ←/→ pan, 0-3 window, p pause, q to quit",
+				time.Now().In(displayLoc).Format("15:04:05"), window)
+			render()
+			return
 		}
 
-		cpuData := make([][]float64, len(containers))
-		ramData := make([][]float64, len(containers))
-		plotLabels := make([]string, len(containers))
+		series.update(records)
+		containers, timestamps, u := series.containers, series.timestamps, series.unit
+		ramPlot.Title = u.label(" RAM (MB) ")
+		ramBar.Title = u.label(" RAM peak MB ")
+		// The outer slices are reordered for the highlight; the series
+		// themselves are the tracker's.
+		cpuData := slices.Clone(series.cpu)
+		ramData := slices.Clone(series.ram)
+		plotLabels := slices.Clone(containers)
 		plotColors := make([]ui.Color, len(containers))
-
 		for i, c := range containers {
-			cpuSeries := make([]float64, len(timestamps))
-			ramSeries := make([]float64, len(timestamps))
-			for j, ts := range timestamps {
-				if r, ok := lookup[c][ts]; ok {
-					cpuSeries[j] = r.CPUPct
-					ramSeries[j] = r.MemUsageMB
-				}
-			}
-			cpuData[i] = cpuSeries
-			ramData[i] = ramSeries
-			plotLabels[i] = c
-			plotColors[i] = termColors[i%len(termColors)]
+			plotColors[i] = seriesColor(i, c)
+		}
+		top := slices.Index(containers, highlight)
+		if top >= 0 {
+			moveToEnd(cpuData, top)
+			moveToEnd(ramData, top)
+			moveToEnd(plotLabels, top)
+			moveToEnd(plotColors, top)
 		}
 
 		cpuPlot.Data = cpuData
@@ -615,71 +1060,147 @@ func runTerm(args []string) {
 		ramPlot.DataLabels = plotLabels
 		ramPlot.LineColors = plotColors
 
-		stats := map[string]*containerStats{}
-		for _, r := range records {
-			s, ok := stats[r.Container]
-			if !ok {
-				s = &containerStats{}
-				stats[r.Container] = s
-			}
-			s.CPUSum += r.CPUPct
-			if r.CPUPct > s.CPUMax {
-				s.CPUMax = r.CPUPct
-			}
-			s.MemSum += r.MemUsageMB
-			if r.MemUsageMB > s.MemMax {
-				s.MemMax = r.MemUsageMB
-			}
-			if r.MemPct > s.MemPctMax {
-				s.MemPctMax = r.MemPct
+		grouped := series.grouped
+		if !slices.Equal(series.ioCols, ioShown) {
+			ioShown = series.ioCols
+			setGrid()
+			ui.Clear()
+		}
+		for _, col := range ioShown {
+			ioData := slices.Clone(series.io[col])
+			if top >= 0 {
+				moveToEnd(ioData, top)
 			}
-			s.Count++
+			ioPlots[col].Data = ioData
+			ioPlots[col].DataLabels = plotLabels
+			ioPlots[col].LineColors = plotColors
+		}
+
+		stats := tracker.update(records)
+		if *stream && window.Window == 0 {
+			stats = streamedStats(*csvPath) // of all samples, not just the kept ones
 		}
 
 		cpuPeakVals := make([]float64, len(containers))
 		ramPeakVals := make([]float64, len(containers))
 		barLabels := make([]string, len(containers))
-		barColors := make([]ui.Color, len(containers))
+		cpuBarColors := make([]ui.Color, len(containers))
+		ramBarColors := make([]ui.Color, len(containers))
 		for i, c := range containers {
 			s := stats[c]
 			cpuPeakVals[i] = round1(s.CPUMax)
-			ramPeakVals[i] = round1(s.MemMax)
+			ramPeakVals[i] = u.round(s.MemMax)
 			barLabels[i] = truncName(c, 6)
-			barColors[i] = termColors[i%len(termColors)]
+			cpuBarColors[i] = warn.barColor(s.CPUAvg(), s.CPUMax, warn.CPU, seriesColor(i, c))
+			ramBarColors[i] = warn.barColor(s.MemAvg(), s.MemMax, warn.MemMB, seriesColor(i, c))
 		}
 		cpuBar.Data = cpuPeakVals
 		cpuBar.Labels = barLabels
-		cpuBar.BarColors = barColors
+		cpuBar.BarColors = cpuBarColors
 		ramBar.Data = ramPeakVals
 		ramBar.Labels = barLabels
-		ramBar.BarColors = barColors
+		ramBar.BarColors = ramBarColors
 
-		rows := [][]string{
-			{"Container", "CPU avg%", "CPU max%", "RAM avg MB", "RAM max MB", "Mem max%"},
-		}
+		applyInterval(stats, captureInterval(*csvPath))
+		applyPricing(stats, *prices)
+		applyBudgets(stats, budgets)
+		shown, shownStats = records, stats
+		rows := [][]string{summaryHeaderFor(stats)}
 		for _, c := range containers {
-			s := stats[c]
-			rows = append(rows, []string{
-				c,
-				fmt.Sprintf("%.1f", s.CPUSum/float64(s.Count)),
-				fmt.Sprintf("%.1f", s.CPUMax),
-				fmt.Sprintf("%.1f", s.MemSum/float64(s.Count)),
-				fmt.Sprintf("%.1f", s.MemMax),
-				fmt.Sprintf("%.2f", s.MemPctMax),
-			})
+			rows = append(rows, summaryRow(c, stats[c], u))
+		}
+		if layout == "stacked" {
+			for i, row := range rows {
+				rows[i] = compactRow(row)
+			}
+		}
+		order.apply(rows)
+		var indicator string
+		table.Rows, indicator = scroll.visible(rows, tableFit(table.Inner.Dy(), true))
+		warn.mark(table.Rows, u)
+		markBudgets(table.Rows)
+		table.Title = " Summary "
+		if indicator != "" {
+			table.Title = " Summary (" + indicator + ") "
 		}
-		table.Rows = rows
 		table.RowStyles = map[int]ui.Style{
 			0: ui.NewStyle(ui.ColorYellow, ui.ColorClear, ui.ModifierBold),
 		}
+		for k := 1; k < len(table.Rows); k++ {
+			if table.Rows[k][0] == highlight {
+				table.RowStyles[k] = ui.NewStyle(ui.ColorWhite, ui.ColorClear, ui.ModifierReverse)
+			}
+		}
+
+		if layout == "sparklines" {
+			// Name and value columns are fixed; the two histories share the rest.
+			widths := []int{24, 8, 0, 10, 0, 8}
+			sparkWidth := max((sparkTable.Inner.Dx()-54)/2, 8)
+			widths[2], widths[4] = sparkWidth+2, sparkWidth+2
+			sparkTable.ColumnWidths = widths
+			rows := sparklineRows(containers, grouped, sparkWidth, u)
+			order.apply(rows)
+			sparkTable.Rows, indicator = scroll.visible(rows, tableFit(sparkTable.Inner.Dy(), false))
+			warn.mark(sparkTable.Rows, u)
+			sparkTable.Title = " Containers "
+			if indicator != "" {
+				sparkTable.Title = " Containers (" + indicator + ") "
+			}
+			sparkTable.RowStyles = map[int]ui.Style{
+				0: ui.NewStyle(ui.ColorYellow, ui.ColorClear, ui.ModifierBold),
+			}
+			for k := 1; k < len(sparkTable.Rows); k++ {
+				c := sparkTable.Rows[k][0]
+				style := ui.NewStyle(seriesColor(slices.Index(containers, c), c))
+				if c == highlight {
+					style.Modifier = ui.ModifierReverse
+				}
+				sparkTable.RowStyles[k] = style
+			}
+		}
 
 		last := timestamps[len(timestamps)-1].Format("15:04:05")
+		keys := "←/→ pan, 0-3 window, ↑/↓ scroll, l layout, s snapshot, p pause, q to quit"
+		if len(ioShown) > 0 {
+			keys = "i I/O, " + keys
+		}
+		if logs != nil {
+			keys = "t logs, " + keys
+		}
 		statusBar.Text = fmt.Sprintf(
-			" [%s](fg:cyan) | CSV: [%s](fg:green) | %d containers | %d samples | last: %s | q to quit",
-			time.Now().Format("15:04:05"), *csvPath, len(containers), len(timestamps), last,
+			" [%s](fg:cyan) | Source: [%s](fg:green) | %d containers | %d samples | last: %s | window: [%s](fg:yellow) | %s",
+			time.Now().In(displayLoc).Format("15:04:05"), source, len(containers), len(timestamps), last, window, keys,
 		)
+		if issues := csvIssues(*csvPath).String(); issues != "" && *connect == "" {
+			statusBar.Text = " [" + issues + "](fg:red) |" + statusBar.Text
+		}
+		if paused {
+			statusBar.Text = " [PAUSED](fg:black,bg:yellow) p to resume |" + statusBar.Text
+		}
+		if notice != "" && time.Since(noticeAt) < 10*time.Second {
+			statusBar.Text = " " + notice + " |" + statusBar.Text
+		}
+
+		if showLogs {
+			logPanel.Title = " Logs "
+			logPanel.Text = "Click a container in the table to tail its logs."
+			logPanel.Err = nil
+			if highlight != "" {
+				if !paused {
+					logs.refresh(highlight)
+				}
+				fit := logPanel.Inner.Dy()
+				if fit <= 0 {
+					fit = termHeight
+				}
+				name, lines, err := logs.last(fit)
+				logPanel.Title = " Logs: " + name + " "
+				logPanel.Text = strings.Join(lines, "\n")
+				logPanel.Err = err
+			}
+		}
 
-		ui.Render(grid, statusBar)
+		render()
 	}
 
 	updateData()
@@ -696,8 +1217,99 @@ func runTerm(args []string) {
 				return
 			case "<Resize>":
 				payload := e.Payload.(ui.Resize)
-				grid.SetRect(0, 0, payload.Width, payload.Height-1)
-				statusBar.SetRect(0, payload.Height-1, payload.Width, payload.Height)
+				termWidth, termHeight = payload.Width, payload.Height
+				if next := autoLayout(termWidth, termHeight); autoSize && next != layout {
+					layout, order = next, tableSort{}
+				}
+				setGrid()
+				ui.Clear()
+				updateData()
+			case "p":
+				paused = !paused
+				updateData()
+			case "<MouseLeft>":
+				m := e.Payload.(ui.Mouse)
+				t := table
+				if layout == "sparklines" {
+					t = sparkTable
+				}
+				row, col, ok := tableCell(t, m.X, m.Y)
+				if !ok || m.Drag {
+					break
+				}
+				if row == 0 {
+					order.toggle(col)
+				} else if c := t.Rows[row][0]; c == highlight {
+					highlight = ""
+				} else {
+					highlight = c
+				}
+				updateData()
+			case "<MouseWheelUp>", "<MouseWheelDown>":
+				if e.ID == "<MouseWheelUp>" {
+					scroll.scroll(-3, false)
+				} else {
+					scroll.scroll(3, false)
+				}
+				updateData()
+			case "s":
+				if len(shown) == 0 {
+					break
+				}
+				paths, err := writeTermSnapshot(source, shown, shownStats, *prices, budgets, view.events)
+				if err != nil {
+					notice = fmt.Sprintf("[snapshot failed: %v](fg:red)", err)
+				} else {
+					notice = fmt.Sprintf("[saved %s](fg:green)", strings.Join(paths, ", "))
+				}
+				noticeAt = time.Now()
+				updateData()
+			case "t":
+				if logs == nil {
+					break
+				}
+				showLogs = !showLogs
+				setGrid()
+				ui.Clear()
+				updateData()
+			case "i":
+				showIO = !showIO
+				setGrid()
+				ui.Clear()
+				updateData()
+			case "l":
+				layout, autoSize = nextLayout(layout), false
+				setGrid()
+				scroll.Offset = 0
+				order = tableSort{}
+				ui.Clear()
+				updateData()
+			case "<Up>", "<Down>", "<PageUp>", "<PageDown>", "<Home>", "<End>":
+				switch e.ID {
+				case "<Up>":
+					scroll.scroll(-1, false)
+				case "<Down>":
+					scroll.scroll(1, false)
+				case "<PageUp>":
+					scroll.scroll(-1, true)
+				case "<PageDown>":
+					scroll.scroll(1, true)
+				case "<Home>":
+					scroll.Offset = 0
+				case "<End>":
+					scroll.Offset = math.MaxInt
+				}
+				updateData()
+			case "1", "2", "3", "0":
+				window = termWindow{Window: termWindowKeys[e.ID]}
+				ui.Clear()
+				updateData()
+			case "<Left>", "<Right>":
+				if e.ID == "<Left>" {
+					window.pan(-1)
+				} else {
+					window.pan(1)
+				}
 				ui.Clear()
 				updateData()
 			}
@@ -707,25 +1319,44 @@ func runTerm(args []string) {
 	}
 }
 
-func liveHTML(interval float64, csvPath string) string {
+// liveHTML renders the live dashboard page. embed drops the header and
+// mode bar so the chart fills the frame (status portals, wall displays).
+func liveHTML(interval float64, sources []*liveSource, themeName string, opts FigureOptions, embed bool) string {
 	refreshMs := int(interval * 1000)
 	if refreshMs < 500 {
 		refreshMs = 500
 	}
-	escaped := html.EscapeString(csvPath)
+	sourceHTML := fmt.Sprintf("<code>%s</code>", html.EscapeString(sources[0].CSVPath))
+	if len(sources) > 1 {
+		sourceHTML = `<select id="source">`
+		for _, src := range sources {
+			sourceHTML += fmt.Sprintf(`<option value="%s">%s</option>`, html.EscapeString(src.Name), html.EscapeString(src.CSVPath))
+		}
+		sourceHTML += `</select>`
+	}
+	title := html.EscapeString(dashboardTitle(opts))
+	var metaHTML string
+	for _, kv := range opts.Meta {
+		metaHTML += fmt.Sprintf("\n    | %s: <code>%s</code>", html.EscapeString(kv[0]), html.EscapeString(kv[1]))
+	}
+	var bodyClass string
+	if embed {
+		bodyClass = ` class="embed"`
+	}
 	return fmt.Sprintf(`<!doctype html>
 <html lang="en">
 <head>
   <meta charset="utf-8" />
   <meta name="viewport" content="width=device-width, initial-scale=1" />
-  <title>Container Monitor Live</title>
+  <title>%s (live)</title>
   <script src="https://cdn.plot.ly/plotly-2.35.2.min.js"></script>
   <style>
+    %s
     body {
       margin: 0;
       padding: 12px;
-      background: #11161d;
-      color: #dce3f0;
+      background: var(--bg);
+      color: var(--fg);
       font: 13px/1.4 -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif;
     }
     .meta {
@@ -738,37 +1369,253 @@ func liveHTML(interval float64, csvPath string) string {
       min-height: 560px;
       border-radius: 8px;
       overflow: hidden;
-      background: #0f141b;
-      border: 1px solid rgba(120, 140, 170, 0.25);
+      background: var(--chart-bg);
+      border: 1px solid var(--border);
     }
     code {
-      color: #8ed7ff;
+      color: var(--code);
+    }
+    body.embed {
+      padding: 0;
+    }
+    body.embed .meta {
+      display: none;
+    }
+    body.embed #chart {
+      height: 100vh;
+      min-height: 0;
+      border: 0;
+      border-radius: 0;
+    }
+    select {
+      background: var(--chart-bg);
+      color: var(--code);
+      border: 1px solid var(--border);
+      font: inherit;
+    }
+    button {
+      background: var(--chart-bg);
+      color: var(--code);
+      border: 1px solid var(--border);
+      border-radius: 4px;
+      font: inherit;
+      cursor: pointer;
+    }
+    details {
+      display: inline-block;
+      position: relative;
+    }
+    summary {
+      cursor: pointer;
+      color: var(--code);
+    }
+    #containers {
+      position: absolute;
+      z-index: 10;
+      max-height: 50vh;
+      overflow: auto;
+      padding: 6px 10px;
+      white-space: nowrap;
+      background: var(--chart-bg);
+      border: 1px solid var(--border);
+      border-radius: 6px;
+    }
+    #containers label {
+      display: block;
     }
   </style>
 </head>
-<body>
+<body%s>
   <div class="meta">
-    Source: <code>%s</code>
-    | Refresh: <code>%.1fs</code>
+    <strong>%s</strong>
+    | Source: %s%s
+    | Window: <select id="window">
+        <option value="">all</option>
+        <option>5m</option>
+        <option>15m</option>
+        <option>30m</option>
+        <option>1h</option>
+        <option>6h</option>
+        <option>24h</option>
+      </select>
+    | <details><summary>Containers</summary><div id="containers"></div></details>
+    | <button id="pause" type="button">Pause</button>
+      <button id="snapshot" type="button">Snapshot</button>
+      <button id="download" type="button">Download CSV</button>
+    | Refresh: <code>%.1fs</code> <span id="mode"></span>
     | Last update: <span id="updated">-</span>
+      <span id="issues"></span>
   </div>
   <div id="chart"></div>
   <script>
     const REFRESH_MS = %d;
+    const EMBED = %t;
+    // Bars, tables and downsampling are only recomputed by a full refresh;
+    // in between, new samples are appended to the line traces.
+    const FULL_REFRESH_MS = 30000;
+    %s
     const chart = document.getElementById("chart");
     const updated = document.getElementById("updated");
+    const issues = document.getElementById("issues");
+    const mode = document.getElementById("mode");
+    const sourceSelect = document.getElementById("source");
+    let source = new URLSearchParams(location.search).get("source") || "";
+    if (sourceSelect) {
+      if (source) {
+        sourceSelect.value = source;
+      }
+      source = sourceSelect.value;
+    }
+
+    const windowSelect = document.getElementById("window");
+    const containerList = document.getElementById("containers");
+    let selected = null; // null: all containers
+
+    // api builds an endpoint URL for the selected source, window and
+    // containers.
+    function api(path, query) {
+      let url = path + "?source=" + encodeURIComponent(source);
+      if (windowSelect.value) {
+        url += "&window=" + encodeURIComponent(windowSelect.value);
+      }
+      if (selected !== null) {
+        url += "&containers=" + encodeURIComponent([...selected].join(","));
+      }
+      return url + (query ? "&" + query : "");
+    }
+
+    // refreshContainers rebuilds the container checklist when the set of
+    // containers in the capture changes.
+    async function refreshContainers() {
+      const response = await fetch("api/containers?source=" + encodeURIComponent(source), { cache: "no-store" });
+      if (!response.ok) {
+        return;
+      }
+      const names = await response.json();
+      if (names.join("\u0000") === containerList.dataset.names) {
+        return;
+      }
+      containerList.dataset.names = names.join("\u0000");
+      containerList.replaceChildren(...names.map((name) => {
+        const box = document.createElement("input");
+        box.type = "checkbox";
+        box.value = name;
+        box.checked = selected === null || selected.has(name);
+        const label = document.createElement("label");
+        label.append(box, " " + name);
+        return label;
+      }));
+    }
+
+    containerList.addEventListener("change", (event) => {
+      const boxes = [...containerList.querySelectorAll("input")];
+      const checked = boxes.filter((b) => b.checked).map((b) => b.value);
+      if (checked.length === 0) {
+        // Keep at least one container selected.
+        event.target.checked = true;
+        return;
+      }
+      selected = checked.length === boxes.length ? null : new Set(checked);
+      resetFigure();
+      updateFigure();
+    });
+    windowSelect.addEventListener("change", () => {
+      resetFigure();
+      updateFigure();
+    });
+
+    // Pausing freezes the chart for inspection. The server holds back the
+    // updates of the source for every page showing it until resumed, and
+    // tells them with a "pause" event.
+    let paused = false;
+    const pauseButton = document.getElementById("pause");
+    function showPaused(state) {
+      if (state === paused) {
+        return;
+      }
+      paused = state;
+      pauseButton.textContent = paused ? "Resume" : "Pause";
+      if (paused) {
+        updated.textContent = "paused";
+      } else {
+        updateFigure();
+      }
+    }
+    async function fetchPaused(init) {
+      try {
+        const response = await fetch(api("api/pause"), init);
+        if (!response.ok) {
+          throw new Error("HTTP " + response.status);
+        }
+        showPaused((await response.json()).paused);
+      } catch (error) {
+        updated.textContent = "pause failed: " + error.message;
+      }
+    }
+    pauseButton.addEventListener("click", () => {
+      fetchPaused({ method: "POST", body: new URLSearchParams({ paused: !paused }) });
+    });
+    document.getElementById("snapshot").addEventListener("click", async () => {
+      try {
+        const response = await fetch(api("api/snapshot"), { method: "POST" });
+        if (!response.ok) {
+          throw new Error("HTTP " + response.status);
+        }
+        const body = await response.json();
+        updated.textContent = "snapshot saved to " + body.path;
+      } catch (error) {
+        updated.textContent = "snapshot failed: " + error.message;
+      }
+    });
+    document.getElementById("download").addEventListener("click", () => {
+      window.location.href = api("api/csv");
+    });
+
+    // resetFigure forgets the drawn state so the next update redraws fully.
+    function resetFigure() {
+      figureETag = null;
+      lastSample = "";
+    }
 
     async function updateFigure() {
       try {
-        const response = await fetch("/api/figure?ts=" + Date.now(), { cache: "no-store" });
+        // "no-cache" revalidates with the ETag; an unchanged figure comes
+        // back as 304 and is not redrawn.
+        const response = await fetch(api("api/figure", "theme=" + pickTheme()), { cache: "no-cache" });
         if (!response.ok) {
           throw new Error("HTTP " + response.status);
         }
-        const figure = await response.json();
-        Plotly.react(chart, figure.data, figure.layout, {
-          responsive: true,
-          displaylogo: false,
-          scrollZoom: true
+        const etag = response.headers.get("ETag");
+        if (etag === null || etag !== figureETag) {
+          const figure = await response.json();
+          if (EMBED) {
+            // Fill the frame instead of the fixed dashboard size.
+            delete figure.layout.width;
+            delete figure.layout.height;
+            figure.layout.autosize = true;
+            figure.layout.title = { text: "" };
+            figure.layout.margin = { t: 40, r: 20, b: 40, l: 50 };
+          }
+          Plotly.react(chart, figure.data, figure.layout, {
+            responsive: true,
+            displaylogo: false,
+            displayModeBar: !EMBED,
+            scrollZoom: !EMBED
+          });
+          figureETag = etag;
+        }
+        lastSample = response.headers.get("X-Last-Sample") || "";
+        const problems = response.headers.get("X-Parse-Issues");
+        issues.textContent = problems ? "| \u26a0 " + problems : "";
+        lastFull = Date.now();
+        refreshContainers();
+        traceIndex = new Map();
+        tracePer = new Map();
+        chart.data.forEach((trace, i) => {
+          if (trace.meta && trace.meta.metric) {
+            traceIndex.set(trace.meta.container + "\u0000" + trace.meta.metric, i);
+            tracePer.set(i, trace.meta.per || 1);
+          }
         });
         updated.textContent = new Date().toLocaleTimeString();
       } catch (error) {
@@ -776,12 +1623,115 @@ func liveHTML(interval float64, csvPath string) string {
       }
     }
 
-    updateFigure();
-    setInterval(updateFigure, REFRESH_MS);
+    let figureETag = null;
+    let lastSample = "";
+    let lastFull = 0;
+    let traceIndex = new Map();
+    let tracePer = new Map(); // captured MB per unit drawn, for --units
+    const FIELDS = { cpu: "cpu_pct", mem: "mem_usage_mb", mem_pct: "mem_pct" };
+
+    // appendRecords fetches the samples newer than the last one drawn and
+    // extends the matching traces. New containers, stacked mode and stale
+    // figures fall back to a full refresh.
+    async function appendRecords() {
+      if (paused) {
+        return;
+      }
+      const stacked = ![...traceIndex.keys()].some((k) => k.endsWith("\u0000cpu"));
+      if (!lastSample || stacked || Date.now() - lastFull > FULL_REFRESH_MS) {
+        return updateFigure();
+      }
+      try {
+        const response = await fetch(api("api/records", "since=" + encodeURIComponent(lastSample)), { cache: "no-store" });
+        if (!response.ok) {
+          throw new Error("HTTP " + response.status);
+        }
+        const body = await response.json();
+        const byTrace = new Map();
+        for (const rec of body.records) {
+          for (const [metric, field] of Object.entries(FIELDS)) {
+            const i = traceIndex.get(rec.container + "\u0000" + metric);
+            if (i === undefined) {
+              return updateFigure();
+            }
+            if (!byTrace.has(i)) {
+              byTrace.set(i, { x: [], y: [] });
+            }
+            byTrace.get(i).x.push(rec.timestamp);
+            byTrace.get(i).y.push(rec[field] / tracePer.get(i));
+          }
+        }
+        if (byTrace.size > 0) {
+          const indices = [...byTrace.keys()];
+          Plotly.extendTraces(chart, {
+            x: indices.map((i) => byTrace.get(i).x),
+            y: indices.map((i) => byTrace.get(i).y)
+          }, indices);
+        }
+        lastSample = body.last;
+        updated.textContent = new Date().toLocaleTimeString();
+      } catch (error) {
+        updated.textContent = "update failed: " + error.message;
+      }
+    }
+
+    // Updates are pushed over Server-Sent Events when the CSV changes; the
+    // timer only runs while the stream is unavailable.
+    let pollTimer = null;
+    function startPolling() {
+      if (pollTimer === null) {
+        pollTimer = setInterval(appendRecords, REFRESH_MS);
+        mode.textContent = "(polling)";
+      }
+    }
+    function stopPolling() {
+      clearInterval(pollTimer);
+      pollTimer = null;
+      mode.textContent = "(push)";
+    }
+
+    let stream = null;
+    function connect() {
+      if (!window.EventSource) {
+        fetchPaused();
+        updateFigure();
+        startPolling();
+        return;
+      }
+      stream = new EventSource(api("api/stream"));
+      stream.addEventListener("update", () => {
+        stopPolling();
+        appendRecords();
+      });
+      stream.addEventListener("pause", (event) => {
+        stopPolling();
+        showPaused(event.data === "true");
+      });
+      stream.onerror = () => {
+        // EventSource reconnects on its own; poll in the meantime.
+        startPolling();
+      };
+    }
+    connect();
+
+    if (sourceSelect) {
+      sourceSelect.addEventListener("change", () => {
+        source = sourceSelect.value;
+        history.replaceState(null, "", "?source=" + encodeURIComponent(source));
+        if (stream) {
+          stream.close();
+        }
+        selected = null;
+        containerList.dataset.names = "";
+        resetFigure();
+        Plotly.purge(chart);
+        connect();
+      });
+    }
     window.addEventListener("resize", () => Plotly.Plots.resize(chart));
   </script>
 </body>
-</html>`, escaped, interval, refreshMs)
+</html>`, title, themeCSS(themeName), bodyClass, title, sourceHTML, metaHTML, interval, refreshMs, embed, themeJS(themeName))
 }
 
 func openBrowser(url string) {
@@ -799,50 +1749,294 @@ func openBrowser(url string) {
 	_ = cmd.Start()
 }
 
-func runPlot(args []string) {
-	fs := flag.NewFlagSet("plot", flag.ExitOnError)
-	csvPath := fs.String("csv", "docker-stats.csv", "Path to CSV file")
-	live := fs.Bool("live", false, "Serve live-updating dashboard")
-	interval := fs.Float64("interval", 2.0, "Refresh interval in seconds for live mode")
-	host := fs.String("host", "127.0.0.1", "Host for live server")
-	port := fs.Int("port", 8088, "Port for live server")
-	noOpen := fs.Bool("no-open-browser", false, "Do not auto-open browser")
-	fs.Parse(args)
-
-	if fs.NArg() > 0 {
-		*csvPath = fs.Arg(0)
+// writeFigureHTML writes a standalone Plotly HTML page. build renders the
+// figure for a concrete theme; with themeName "auto" both variants are
+// embedded and the browser's color-scheme preference picks one.
+func writeFigureHTML(path, themeName, title string, build func(theme string) map[string]any) error {
+	variants := []string{themeName}
+	if themeName == "auto" {
+		variants = []string{"dark", "light"}
 	}
-
-	if !*live {
-		records, err := loadCSV(*csvPath)
-		if err != nil {
-			log.Fatalf("Error reading CSV: %v", err)
-		}
-		fig := buildFigure(records)
-		figJSON, _ := json.Marshal(fig)
-
-		outPath := strings.TrimSuffix(*csvPath, ".csv") + ".html"
-		outHTML := fmt.Sprintf(`<!doctype html>
+	figs := make(map[string]map[string]any, len(variants))
+	for _, v := range variants {
+		figs[v] = build(v)
+	}
+	figJSON, err := json.Marshal(figs)
+	if err != nil {
+		return err
+	}
+	outHTML := fmt.Sprintf(`<!doctype html>
 <html lang="en">
 <head>
   <meta charset="utf-8" />
-  <title>Container Resource Monitor</title>
+  <title>%s</title>
   <script src="https://cdn.plot.ly/plotly-2.35.2.min.js"></script>
-  <style>body{margin:0;background:#11161d}</style>
+  <style>
+    %s
+    body{margin:0;background:var(--bg)}
+  </style>
 </head>
 <body>
   <div id="chart"></div>
   <script>
-    const figure = %s;
+    %s
+    const figures = %s;
+    const figure = figures[pickTheme()];
     Plotly.newPlot("chart", figure.data, figure.layout, {responsive:true,displaylogo:false,scrollZoom:true});
   </script>
 </body>
-</html>`, string(figJSON))
+</html>`, html.EscapeString(title), themeCSS(themeName), themeJS(themeName), string(figJSON))
+	return os.WriteFile(path, []byte(outHTML), 0644)
+}
 
-		if err := os.WriteFile(outPath, []byte(outHTML), 0644); err != nil {
+func runPlot(args []string) {
+	fs := newFlagSet("plot")
+	var csvPaths stringList
+	fs.Var(&csvPaths, "csv", "Path to CSV file, directory, glob or http(s) URL; repeat to serve several captures with --live (default docker-stats.csv)")
+	live := fs.Bool("live", false, "Serve live-updating dashboard")
+	interval := fs.Float64("interval", 2.0, "Refresh interval in seconds for live mode")
+	host := fs.String("host", "127.0.0.1", "Host for live server")
+	port := fs.Int("port", 8088, "Port for live server")
+	noOpen := fs.Bool("no-open-browser", false, "Do not auto-open browser")
+	auth := authFlags(fs)
+	cors := corsFlags(fs)
+	ingestToken := ingestFlag(fs)
+	prom := promFlags(fs)
+	kiosk := fs.Bool("kiosk", false, "Live page without header or mode bar, for embedding and wall displays (per page: ?embed=1)")
+	frameAncestors := fs.String("frame-ancestors", "", "Origins allowed to embed the live page, as a CSP frame-ancestors list (e.g. \"'self' https://status.example.com\")")
+	maxPoints := fs.Int("max-points", 2000, "Downsample each trace to at most N points (0 = all samples)")
+	compare := fs.Bool("compare", false, "Overlay two captures: plot --compare baseline.csv candidate.csv")
+	eventsFile := fs.String("events", "", "Events/markers file (default: <csv>.events.csv if present)")
+	cpuThreshold := fs.Float64("cpu-threshold", 0, "Draw a CPU % reference line (0 = none)")
+	memThreshold := fs.Float64("mem-threshold", 0, "Draw a RAM reference line in MB (0 = none)")
+	stacked := fs.Bool("stacked", false, "Show CPU and RAM as stacked areas with totals")
+	heatmap := fs.String("heatmap", "", "Add a utilization heatmap panel: cpu or mem")
+	facet := fs.String("facet", "", "Add one column of CPU and RAM panels per value of this `column`, e.g. cluster (or host, namespace)")
+	themeName := fs.String("theme", "dark", "Dashboard theme: dark, light or auto (follow the browser)")
+	title := fs.String("title", "", "Dashboard title (default \""+defaultTitle+"\")")
+	var metaFlags stringList
+	fs.Var(&metaFlags, "meta", "Run metadata key=value shown under the title (repeatable)")
+	view := registerViewFlags(fs)
+	pages := fs.Bool("pages", false, "Also write one drilldown page per container, linked from the summary table")
+	prices := pricingFlags(fs)
+	budgetsFile := budgetsFlag(fs)
+	remoteFlags(fs)
+	recommend := fs.Bool("recommend", false, "Add suggested CPU/memory requests and limits to the summary table")
+	headroom := fs.Float64("headroom", 0.2, "Headroom fraction added to --recommend suggestions")
+	summaryOut := fs.String("summary-out", "", "Also write the summary next to the HTML in these formats (comma-separated: csv, json, md)")
+	pub := publishFlags(fs)
+	stream := fs.Bool("stream", false, "Read the capture in one bounded-memory pass (approximate percentiles, peak-preserving charts) for very large files; with --live, follow it so")
+	retentionFlag(fs)
+	strictFlag(fs)
+	dedupeFlag(fs)
+	tz := tzFlag(fs)
+	unitsFlag(fs)
+	pprofFlag(fs)
+	grafanaFlag(fs)
+	parseFlags(fs, args)
+
+	if _, ok := heatmapMetrics[*heatmap]; *heatmap != "" && !ok {
+		log.Fatalf("--heatmap must be cpu or mem, got %q", *heatmap)
+	}
+	if !validTheme(*themeName) {
+		log.Fatalf("--theme must be dark, light or auto, got %q", *themeName)
+	}
+	meta, err := parseMeta(metaFlags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := view.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if pub.enabled() && *live {
+		log.Fatal("--publish is for one-shot plots, not --live")
+	}
+	if err := pub.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := parseTZ(*tz); err != nil {
+		log.Fatal(err)
+	}
+	if retention < 0 {
+		log.Fatal("--window must not be negative")
+	}
+	if retention > 0 && !*live {
+		log.Fatal("--window is for --live, one-shot plots show the whole capture")
+	}
+	budgets := mustLoadBudgets(*budgetsFile)
+	startDiagnostics()
+	if *stream {
+		switch {
+		case *compare, prom.URL != "":
+			log.Fatal("--stream is for plots of a CSV, not --compare or --prometheus")
+		case retention > 0:
+			log.Fatal("--stream cannot be combined with --window")
+		case *maxPoints <= 0:
+			log.Fatal("--stream needs --max-points > 0")
+		case view.reshapes():
+			log.Fatal("--stream cannot be combined with --rename, --series-key id|host|cluster|namespace, --group-by, --top or --redact")
+		}
+		streamFollow.points, streamFollow.seriesKey = *maxPoints, view.seriesKey
+	}
+	// streamed holds the stats of a --stream pass, which the reduced
+	// records can no longer provide.
+	var streamed map[string]*containerStats
+
+	// figOpts assembles the figure options shared by one-shot and live mode.
+	var sampling time.Duration // intended interval of a one-shot capture
+	figOpts := func(events []event, theme string) FigureOptions {
+		return FigureOptions{
+			MaxPoints:      *maxPoints,
+			Events:         view.events(events),
+			CPUThreshold:   *cpuThreshold,
+			MemThresholdMB: *memThreshold,
+			Stacked:        *stacked,
+			Heatmap:        *heatmap,
+			Facet:          *facet,
+			Theme:          theme,
+			Title:          *title,
+			Meta:           meta,
+			Pricing:        *prices,
+			Budgets:        budgets,
+			Recommend:      *recommend,
+			Headroom:       *headroom,
+			Stats:          streamed,
+			Interval:       sampling,
+		}
+	}
+
+	if *compare {
+		if fs.NArg() != 2 {
+			log.Fatal("--compare needs exactly two CSV files: baseline and candidate")
+		}
+		if *live {
+			log.Fatal("--compare cannot be combined with --live")
+		}
+		basePath, candPath := fs.Arg(0), fs.Arg(1)
+		base, err := loadFinishedCSV(basePath)
+		if err != nil {
+			log.Fatalf("Error reading baseline CSV: %v", err)
+		}
+		cand, err := loadFinishedCSV(candPath)
+		if err != nil {
+			log.Fatalf("Error reading candidate CSV: %v", err)
+		}
+		base, cand = view.normalize(base), view.normalize(cand)
+		outPath := strings.TrimSuffix(candPath, ".csv") + "-compare.html"
+		err = writeFigureHTML(outPath, *themeName, dashboardTitle(figOpts(nil, "")), func(theme string) map[string]any {
+			return buildCompareFigure(base, cand, figOpts(nil, theme))
+		})
+		if err != nil {
+			log.Fatalf("Error writing HTML: %v", err)
+		}
+		fmt.Printf("Saved comparison dashboard -> %s\n", outPath)
+		pub.publishDashboard(outPath, nil, "")
+		openBrowser(outPath)
+		return
+	}
+
+	sources, err := expandCSVPaths(append(csvPaths, fs.Args()...))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(sources) == 0 {
+		sources = []string{"docker-stats.csv"}
+	}
+	if len(sources) > 1 && !*live {
+		log.Fatal("several CSV sources are only supported with --live")
+	}
+	if len(sources) > 1 && *eventsFile != "" {
+		log.Fatal("--events needs a single CSV source")
+	}
+	csvPath := sources[0]
+	if prom.URL != "" {
+		if *live {
+			log.Fatal("--prometheus cannot be combined with --live")
+		}
+		// Outputs are named prometheus.html, prometheus.events.csv, ...
+		csvPath = "prometheus.csv"
+	}
+
+	if !*live {
+		if *eventsFile == "" {
+			*eventsFile = eventsPath(localBase(csvPath) + ".csv")
+		}
+		var records []record
+		if prom.URL != "" {
+			records, err = prom.load()
+			if err != nil {
+				log.Fatalf("Error querying Prometheus: %v", err)
+			}
+		} else if *stream {
+			streamed, records, err = loadStreamed(csvPath, *maxPoints, view.seriesKey)
+			if err != nil {
+				log.Fatalf("Error reading CSV: %v", err)
+			}
+		} else {
+			records, err = loadFinishedCSV(csvPath)
+			if err != nil {
+				log.Fatalf("Error reading CSV: %v", err)
+			}
+		}
+		if !*stream {
+			records = view.apply(records) // streamed ones were keyed as read
+		}
+		if prom.URL == "" {
+			if *recommend {
+				ofLimit := slices.ContainsFunc(records, func(r record) bool { _, ok := r.Extra[cpuLimitColumn]; return ok })
+				if err := checkRecommendable(csvPath, ofLimit); err != nil {
+					log.Fatal(err)
+				}
+			}
+			sampling = captureInterval(csvPath)
+		}
+		for _, line := range samplingReport(containerNames(records), summarize(records, figOpts(nil, ""))) {
+			warnf("%s", line)
+		}
+		events, err := loadEvents(*eventsFile)
+		if err != nil {
+			log.Fatalf("Error reading events: %v", err)
+		}
+		outPath := localBase(csvPath) + ".html"
+		var links map[string]string
+		if *pages {
+			links, err = writeDrilldownPages(outPath, records, *themeName, func(theme string) FigureOptions {
+				return figOpts(events, theme)
+			})
+			if err != nil {
+				log.Fatalf("Error writing drilldown pages: %v", err)
+			}
+			fmt.Printf("Saved %d drilldown pages -> %s-containers/\n", len(links), strings.TrimSuffix(outPath, ".html"))
+		}
+		err = writeFigureHTML(outPath, *themeName, dashboardTitle(figOpts(nil, "")), func(theme string) map[string]any {
+			opts := figOpts(events, theme)
+			opts.Links = links
+			return buildFigure(records, opts)
+		})
+		if err != nil {
 			log.Fatalf("Error writing HTML: %v", err)
 		}
 		fmt.Printf("Saved interactive dashboard -> %s\n", outPath)
+		if pub.enabled() && !slices.Contains(strings.Split(*summaryOut, ","), "json") {
+			// The summary JSON goes along with a published dashboard.
+			*summaryOut = strings.TrimPrefix(*summaryOut+",json", ",")
+		}
+		var summaries []string
+		if *summaryOut != "" {
+			paths, err := writeSummaryFiles(strings.TrimSuffix(outPath, ".html"), *summaryOut, containerNames(records), summarize(records, figOpts(nil, "")))
+			if err != nil {
+				log.Fatalf("Error writing summary: %v", err)
+			}
+			for _, p := range paths {
+				fmt.Printf("Saved summary -> %s\n", p)
+			}
+			summaries = paths
+		}
+		pagesDir := ""
+		if *pages {
+			pagesDir = strings.TrimSuffix(outPath, ".html") + "-containers"
+		}
+		pub.publishDashboard(outPath, summaries, pagesDir)
 		openBrowser(outPath)
 		return
 	}
@@ -850,73 +2044,49 @@ func runPlot(args []string) {
 	if *interval <= 0 {
 		log.Fatal("--interval must be > 0")
 	}
+	if err := auth.validate(); err != nil {
+		log.Fatal(err)
+	}
 
 	addr := fmt.Sprintf("%s:%d", *host, *port)
 	fmt.Printf("Live mode: http://%s\n", addr)
-	fmt.Printf("Source CSV: %s\n", *csvPath)
+	if auth.enabled() {
+		fmt.Println("Authentication: required")
+	}
+	liveView := view.apply
+	if *stream {
+		liveView = nil // streamed records are keyed as read
+	}
+	srv := NewLiveServer(LiveOptions{
+		Sources:        sources,
+		EventsFile:     *eventsFile,
+		Interval:       time.Duration(float64(time.Second) * *interval),
+		Theme:          *themeName,
+		Kiosk:          *kiosk,
+		FrameAncestors: *frameAncestors,
+		IngestToken:    *ingestToken,
+		Figure:         figOpts,
+		View:           liveView,
+	})
+	for _, src := range srv.sources {
+		fmt.Printf("Source CSV: %s (?source=%s)\n", src.CSVPath, src.Name)
+	}
 	fmt.Printf("Refresh interval: %.1fs\n", *interval)
+	if *ingestToken != "" {
+		fmt.Printf("Ingest: POST http://%s/api/ingest?source=... (bearer --ingest-token)\n", addr)
+	}
 	fmt.Println("Press Ctrl+C to stop")
 
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		p := r.URL.Path
-		if p != "/" && p != "/index.html" {
-			http.NotFound(w, r)
-			return
-		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-store")
-		fmt.Fprint(w, liveHTML(*interval, *csvPath))
-	})
-
-	mux.HandleFunc("/api/figure", func(w http.ResponseWriter, r *http.Request) {
-		records, err := loadCSV(*csvPath)
-		if err != nil {
-			records = nil
-		}
-		fig := buildFigure(records)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.Header().Set("Cache-Control", "no-store")
-		json.NewEncoder(w).Encode(fig)
-	})
-
 	if !*noOpen {
 		go func() {
 			time.Sleep(300 * time.Millisecond)
-			openBrowser(fmt.Sprintf("http://%s", addr))
+			url := fmt.Sprintf("http://%s", addr)
+			if auth.token != "" {
+				url += "/?token=" + neturl.QueryEscape(auth.token)
+			}
+			openBrowser(url)
 		}()
 	}
 
-	log.Fatal(http.ListenAndServe(addr, mux))
-}
-
-func usage() {
-	fmt.Fprintf(os.Stderr, `Usage: cstats <command> [flags]
-
-Commands:
-  plot    HTML/Plotly dashboard (one-shot or live server)
-  term    Terminal UI dashboard
-  daemon  Collect container stats (docker or kubernetes)
-
-Run "cstats <command> -h" for command-specific flags.
-`)
-	os.Exit(1)
-}
-
-func main() {
-	if len(os.Args) < 2 {
-		usage()
-	}
-	switch os.Args[1] {
-	case "plot":
-		runPlot(os.Args[2:])
-	case "term":
-		runTerm(os.Args[2:])
-	case "daemon":
-		runDaemon(os.Args[2:])
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
-		usage()
-	}
+	log.Fatal(http.ListenAndServe(addr, cors.wrap(withIngest(auth.wrap(srv.Handler()), srv))))
 }
@@ -0,0 +1,70 @@
+package cstats
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCSVParsing(t *testing.T) {
+	const (
+		header = "timestamp,container,cpu_pct,mem_usage_mb,mem_limit_mb,mem_pct\n"
+		web    = "2026-01-01T00:00:00Z,web,1,2,3,4\n"
+		db     = "2026-01-01T00:00:05Z,db,5,6,7,8\n"
+	)
+	tests := []struct {
+		name   string
+		rows   string
+		want   string // container=cpu of the records loaded
+		issues string
+		strict string // the --strict error, "" when it loads the same
+	}{
+		{name: "clean", rows: web + db, want: "web=1 db=5"},
+		{name: "too few fields", rows: web + "2026-01-01T00:00:01Z,web,1\n" + db, want: "web=1 db=5",
+			issues: "1 rows dropped (1 malformed)", strict: "line 3: malformed row"},
+		{name: "broken quoting", rows: web + "2026-01-01T00:00:01Z,\"we\"b,1,2,3,4\n" + db, want: "web=1 db=5",
+			issues: "1 rows dropped (1 malformed)", strict: "line 3: malformed row"},
+		{name: "bad timestamp", rows: "yesterday,web,1,2,3,4\n" + db, want: "db=5",
+			issues: "1 rows dropped (1 bad timestamp)", strict: "line 2: unparsable timestamp: yesterday,web,1,2,3,4"},
+		{name: "implausible value", rows: web + "2026-01-01T00:00:01Z,web,-1,2,3,4\n", want: "web=1",
+			issues: "1 rows dropped (1 implausible)", strict: "line 3: implausible value"},
+		{name: "bad number kept as zero", rows: web + "2026-01-01T00:00:01Z,web,n/a,2,3,4\n", want: "web=1 web=0",
+			issues: "1 rows with unreadable values read as 0", strict: "line 3: unparsable number"},
+		{name: "whole last row without newline", rows: web + strings.TrimSuffix(db, "\n"), want: "web=1 db=5"},
+		{name: "incomplete last line", rows: web + "2026-01-01T00:00:05Z,db,5", want: "web=1",
+			strict: "incomplete last line"},
+	}
+	for _, tt := range tests {
+		for _, strict := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/strict=%v", tt.name, strict), func(t *testing.T) {
+				defer func(s bool) { strictParse = s }(strictParse)
+				strictParse = strict
+				path := filepath.Join(t.TempDir(), "capture.csv")
+				os.WriteFile(path, []byte(header+tt.rows), 0o644)
+
+				records, err := loadFinishedCSV(path)
+				if strict && tt.strict != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.strict) {
+						t.Errorf("err = %v, want %q", err, tt.strict)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, r := range records {
+					got = append(got, fmt.Sprintf("%s=%g", r.Container, r.CPUPct))
+				}
+				if g := strings.Join(got, " "); g != tt.want {
+					t.Errorf("loaded %s, want %s", g, tt.want)
+				}
+				if issues := csvIssues(path).String(); issues != tt.issues {
+					t.Errorf("issues %q, want %q", issues, tt.issues)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cstats
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// MemStore holds the samples of a live source in memory, so the dashboard
+// does not parse its CSV back. Monitor mode feeds it from the collector as
+// it appends to the CSV; a service embedding the LiveServer writes its own
+// samples and passes it in LiveOptions.Stores, with or without a CSV.
+type MemStore struct {
+	mu       sync.Mutex
+	records  []record
+	window   *seriesStore // instead of records, with a window
+	version  uint64       // counts the samples added, for cached figures
+	watchers map[*fileWatcher]bool
+}
+
+// NewMemStore returns an empty store keeping the last window of samples of
+// each container, or all of them when window is 0.
+func NewMemStore(window time.Duration) *MemStore {
+	s := &MemStore{watchers: map[*fileWatcher]bool{}}
+	if window > 0 {
+		s.window = newSeriesStore(window)
+	}
+	return s
+}
+
+func (s *MemStore) add(rec record) {
+	rec.Timestamp = rec.Timestamp.In(displayLoc)
+	s.mu.Lock()
+	if s.window != nil {
+		s.window.add(rec)
+	} else {
+		s.records, _, _ = settleRecords(append(s.records, rec), len(s.records))
+	}
+	s.version++
+	watchers := slices.Collect(maps.Keys(s.watchers))
+	s.mu.Unlock()
+	for _, w := range watchers {
+		w.notify()
+	}
+}
+
+// Write adds a sample. Write, Flush and Close make the store a
+// sink.Sink, which is how the collector feeds it.
+func (s *MemStore) Write(rec collector.Record) error {
+	s.add(rec)
+	return nil
+}
+
+func (s *MemStore) Flush() error { return nil }
+func (s *MemStore) Close() error { return nil }
+
+// watch makes w notify its subscribers of each sample added, until the
+// returned function is called.
+func (s *MemStore) watch(w *fileWatcher) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers[w] = true
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, w)
+	}
+}
+
+// changes returns the number of samples added so far.
+func (s *MemStore) changes() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// snapshot returns the samples held so far; later adds do not change it.
+func (s *MemStore) snapshot() []record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.window != nil {
+		return s.window.records()
+	}
+	return slices.Clip(s.records)
+}
+
+var (
+	memStoresMu sync.Mutex
+	memStores   = map[string]*MemStore{}
+)
+
+// memStoreFor returns the store collecting into csvPath in this process, or
+// nil when the CSV is written by someone else.
+func memStoreFor(csvPath string) *MemStore {
+	memStoresMu.Lock()
+	defer memStoresMu.Unlock()
+	return memStores[csvPath]
+}
+
+// runMonitor collects stats and serves the live dashboard in one process.
+func runMonitor(args []string) {
+	var interval, port *int
+	var outfile, host, themeName, tz *string
+	var noOpen, debugFlag *bool
+	var newCollector func(ctx context.Context) (collector.Collector, error)
+	register := func(fs *flag.FlagSet, kind collector.Kind) {
+		interval = fs.Int("interval", 5, "Collection interval in seconds (also the dashboard refresh)")
+		outfile = fs.String("outfile", kind.Outfile, "Output CSV file path")
+		host = fs.String("host", "127.0.0.1", "Host for live server")
+		port = fs.Int("port", 8088, "Port for live server")
+		noOpen = fs.Bool("no-open-browser", false, "Do not auto-open browser")
+		themeName = fs.String("theme", "dark", "Dashboard theme: dark, light or auto (follow the browser)")
+		retentionFlag(fs)
+		tz = tzFlag(fs)
+		dedupeFlag(fs)
+		unitsFlag(fs)
+		sinksFlag(fs)
+		newCollector = kind.Flags(fs)
+		debugFlag = fs.Bool("debug", false, "Enable debug logging")
+		pprofFlag(fs)
+		selfFlag(fs)
+		grafanaFlag(fs)
+	}
+	kind := collectorCommand("monitor", `Collects like "cstats daemon" and serves the live dashboard of the capture
+from the same process, without re-reading the CSV.
+
+`, args, register)
+
+	fs := newFlagSet("monitor " + kind.Name)
+	register(fs, kind)
+	parseFlags(fs, args[1:])
+	if *debugFlag {
+		minLevel = levelDebug
+	}
+	if *interval <= 0 {
+		log.Fatal("--interval must be > 0")
+	}
+	if retention < 0 {
+		log.Fatal("--window must not be negative")
+	}
+	if err := parseTZ(*tz); err != nil {
+		log.Fatal(err)
+	}
+	startDiagnostics()
+
+	// Start from what an earlier run already captured.
+	store := NewMemStore(retention)
+	if err := streamCSV(*outfile, store.add); err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, io.EOF) {
+		log.Fatalf("Error reading %s: %v", *outfile, err)
+	}
+	memStoresMu.Lock()
+	memStores[*outfile] = store
+	memStoresMu.Unlock()
+
+	ctx := context.Background()
+	c, err := newCollector(ctx)
+	if err != nil {
+		log.Fatalf("%s collector: %v", kind.Name, err)
+	}
+	go func() {
+		if err := runCollector(ctx, kind, c, *interval, *outfile, store); err != nil {
+			log.Fatalf("%s collector: %v", kind.Name, err)
+		}
+	}()
+
+	plotArgs := []string{
+		"--live",
+		"--interval", strconv.Itoa(*interval),
+		"--host", *host,
+		"--port", strconv.Itoa(*port),
+		"--theme", *themeName,
+		"--window", retention.String(),
+		"--tz", *tz,
+		"--dedupe", dedupe.String(),
+		"--units", units.String(),
+	}
+	if *noOpen {
+		plotArgs = append(plotArgs, "--no-open-browser")
+	}
+	runPlot(append(plotArgs, *outfile))
+}
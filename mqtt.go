@@ -0,0 +1,378 @@
+package cstats
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saveugene/cstats/sink"
+)
+
+// mqttSink publishes each sample as a JSON message (the /api/records form)
+// to an MQTT 3.1.1 broker, on a topic rendered from a template. While the
+// broker is unreachable samples are dropped and a reconnect is tried every
+// mqttRetry. An idle connection is pinged on a goroutine of its own, since
+// the samples may come less often than the broker's keepalive allows.
+type mqttSink struct {
+	addr      string
+	tls       bool
+	user      *neturl.Userinfo
+	clientID  string
+	topic     string
+	qos       byte
+	retain    bool
+	host      string
+	keepAlive time.Duration
+	stop      chan struct{}
+
+	mu       sync.Mutex // the connection, shared with the pinger
+	conn     net.Conn
+	r        *bufio.Reader
+	id       uint16
+	lastSend time.Time
+	lastTry  time.Time
+	dropped  int
+}
+
+const (
+	mqttKeepAlive = 60 * time.Second
+	mqttRetry     = 5 * time.Second
+)
+
+// mqttPlaceholder is a {name} in a topic template.
+var mqttPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func openMQTTSink(arg string) (*mqttSink, error) {
+	opts, err := parseSinkArgs(arg, "url", "topic", "qos", "retain", "client", "keepalive")
+	if err != nil {
+		return nil, err
+	}
+	u, err := neturl.Parse(cmp.Or(opts.Get("url"), "mqtt://localhost:1883"))
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	s := &mqttSink{user: u.User, topic: cmp.Or(opts.Get("topic"), "cstats/{host}/{container}"), keepAlive: mqttKeepAlive, stop: make(chan struct{})}
+	port := u.Port()
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		port = cmp.Or(port, "1883")
+	case "mqtts", "ssl", "tls":
+		s.tls = true
+		port = cmp.Or(port, "8883")
+	default:
+		return nil, fmt.Errorf("url: unsupported scheme %q (use mqtt:// or mqtts://)", u.Scheme)
+	}
+	s.addr = net.JoinHostPort(u.Hostname(), port)
+	if v := opts.Get("qos"); v != "" {
+		q, err := strconv.Atoi(v)
+		if err != nil || q < 0 || q > 2 {
+			return nil, fmt.Errorf("qos must be 0, 1 or 2, got %q", v)
+		}
+		s.qos = byte(q)
+	}
+	if v := opts.Get("retain"); v != "" {
+		if s.retain, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("retain: %w", err)
+		}
+	}
+	if v := opts.Get("keepalive"); v != "" {
+		if s.keepAlive, err = time.ParseDuration(v); err != nil || s.keepAlive < time.Second || s.keepAlive > 18*time.Hour {
+			return nil, fmt.Errorf("keepalive must be a duration from 1s to 18h, got %q", v)
+		}
+	}
+	s.host, _ = os.Hostname()
+	s.clientID = cmp.Or(opts.Get("client"), fmt.Sprintf("cstats-%s-%d", s.host, os.Getpid()))
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	go s.pinger()
+	return s, nil
+}
+
+// topicFor renders the topic template for a sample: {container}, {host} or
+// a capture column. Values are stripped of the topic separators and
+// wildcards so that they stay one level.
+func (s *mqttSink) topicFor(r record) string {
+	return mqttPlaceholder.ReplaceAllStringFunc(s.topic, func(m string) string {
+		var v string
+		switch name := m[1 : len(m)-1]; name {
+		case "container":
+			v = r.Container
+		case "host":
+			v = cmp.Or(r.Attrs["host"], s.host)
+		default:
+			v = r.Attrs[name]
+		}
+		return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(cmp.Or(v, "_"))
+	})
+}
+
+func (s *mqttSink) Write(r record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if time.Since(s.lastTry) < mqttRetry {
+			s.dropped++
+			return nil
+		}
+		if err := s.connect(); err != nil {
+			s.dropped++
+			return err
+		}
+	}
+	payload, err := json.Marshal(apiRecord{
+		Timestamp: r.Timestamp, Container: r.Container,
+		CPUPct: r.CPUPct, MemUsageMB: r.MemUsageMB, MemLimitMB: r.MemLimitMB, MemPct: r.MemPct,
+		Extra: r.Extra, Attrs: r.Attrs,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.publish(s.topicFor(r), payload); err != nil {
+		s.drop()
+		s.dropped++
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	return nil
+}
+
+// Flush reports samples dropped while disconnected, once reconnected.
+func (s *mqttSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped > 0 && s.conn != nil {
+		warnf("mqtt: reconnected to %s, %d samples dropped", s.addr, s.dropped)
+		s.dropped = 0
+	}
+	return nil
+}
+
+// pinger sends a PINGREQ once the connection has been idle for half the
+// keepalive, until Close.
+func (s *mqttSink) pinger() {
+	t := time.NewTicker(s.keepAlive / 4)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		if s.conn != nil && time.Since(s.lastSend) >= s.keepAlive/2 {
+			err := s.send(0xc0, nil)
+			if err == nil {
+				_, err = s.await(0xd0, 0)
+			}
+			if err != nil {
+				s.drop()
+				warnf("mqtt: keepalive to %s: %v", s.addr, err)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *mqttSink) Close() error {
+	close(s.stop)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	s.send(0xe0, nil) // DISCONNECT
+	return s.conn.Close()
+}
+
+// connect dials the broker and completes the CONNECT handshake with a
+// clean session.
+func (s *mqttSink) connect() error {
+	s.lastTry = time.Now()
+	d := &net.Dialer{Timeout: apiTimeout}
+	var conn net.Conn
+	var err error
+	if s.tls {
+		host, _, _ := net.SplitHostPort(s.addr)
+		conn, err = tls.DialWithDialer(d, "tcp", s.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = d.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	s.conn, s.r = conn, bufio.NewReader(conn)
+
+	flags := byte(0x02) // clean session
+	payload := mqttString(s.clientID)
+	if s.user != nil {
+		flags |= 0x80
+		payload = append(payload, mqttString(s.user.Username())...)
+		if pw, ok := s.user.Password(); ok {
+			flags |= 0x40
+			payload = append(payload, mqttString(pw)...)
+		}
+	}
+	body := append(mqttString("MQTT"), 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(s.keepAlive/time.Second))
+	body = append(body, payload...)
+	if err := s.send(0x10, body); err != nil {
+		s.drop()
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	ack, err := s.await(0x20, 0)
+	if err == nil && len(ack) == 2 && ack[1] != 0 {
+		err = fmt.Errorf("connection refused: %s", mqttConnackReason(ack[1]))
+	}
+	if err != nil {
+		s.drop()
+		return fmt.Errorf("mqtt %s: %w", s.addr, err)
+	}
+	return nil
+}
+
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return "code " + strconv.Itoa(int(code))
+}
+
+// publish sends a PUBLISH and, for QoS 1 and 2, completes its
+// acknowledgement flow.
+func (s *mqttSink) publish(topic string, payload []byte) error {
+	body := mqttString(topic)
+	if s.qos > 0 {
+		s.id++
+		if s.id == 0 {
+			s.id = 1
+		}
+		body = binary.BigEndian.AppendUint16(body, s.id)
+	}
+	header := 0x30 | s.qos<<1
+	if s.retain {
+		header |= 0x01
+	}
+	if err := s.send(header, append(body, payload...)); err != nil {
+		return err
+	}
+	switch s.qos {
+	case 1:
+		_, err := s.await(0x40, s.id) // PUBACK
+		return err
+	case 2:
+		if _, err := s.await(0x50, s.id); err != nil { // PUBREC
+			return err
+		}
+		if err := s.send(0x62, binary.BigEndian.AppendUint16(nil, s.id)); err != nil { // PUBREL
+			return err
+		}
+		_, err := s.await(0x70, s.id) // PUBCOMP
+		return err
+	}
+	return nil
+}
+
+// send writes a packet with the given fixed header byte.
+func (s *mqttSink) send(header byte, body []byte) error {
+	pkt := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(apiTimeout))
+	if _, err := s.conn.Write(append(pkt, body...)); err != nil {
+		return err
+	}
+	s.lastSend = time.Now()
+	return nil
+}
+
+// await reads packets until one of type typ (and packet id, if non-zero)
+// arrives, returning its body. Others, like stray PINGRESPs, are skipped.
+func (s *mqttSink) await(typ byte, id uint16) ([]byte, error) {
+	s.conn.SetReadDeadline(time.Now().Add(apiTimeout))
+	for {
+		header, err := s.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n, mult := 0, 1
+		for {
+			b, err := s.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			n += int(b&0x7f) * mult
+			if b&0x80 == 0 {
+				break
+			}
+			if mult *= 128; mult > 128*128*128 {
+				return nil, errors.New("malformed packet length")
+			}
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(s.r, body); err != nil {
+			return nil, err
+		}
+		if header&0xf0 != typ {
+			continue
+		}
+		if id != 0 && (len(body) < 2 || binary.BigEndian.Uint16(body) != id) {
+			continue
+		}
+		return body, nil
+	}
+}
+
+// drop closes a broken connection, to be redialed on a later write.
+func (s *mqttSink) drop() {
+	s.lastTry = time.Now()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// mqttString encodes s as a length-prefixed UTF-8 string.
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func init() {
+	sink.Register(sink.Kind{
+		Name:   "mqtt",
+		Help:   "JSON messages to an MQTT broker; arg: url=mqtt[s]://[user:pass@]host[:port], topic=<template with {container}, {host} or {column}>, qos=0|1|2, retain=true, client=<id>, keepalive=<duration> (default 60s)",
+		Remote: true,
+		Open:   func(arg string, cols []string) (sink.Sink, error) { return openMQTTSink(arg) },
+	})
+}
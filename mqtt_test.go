@@ -0,0 +1,174 @@
+package cstats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mqttBroker is the broker side of one MQTT connection, for tests.
+type mqttBroker struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// listenMQTT accepts one connection, handed to serve.
+func listenMQTT(t *testing.T, serve func(b *mqttBroker)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		serve(&mqttBroker{t: t, conn: conn, r: bufio.NewReader(conn)})
+	}()
+	return ln.Addr().String()
+}
+
+// read returns the next packet: its fixed header byte and body.
+func (b *mqttBroker) read() (byte, []byte) {
+	header, err := b.r.ReadByte()
+	if err != nil {
+		b.t.Errorf("broker: %v", err)
+		return 0, nil
+	}
+	n, mult := 0, 1
+	for {
+		c, _ := b.r.ReadByte()
+		n += int(c&0x7f) * mult
+		if c&0x80 == 0 {
+			break
+		}
+		mult *= 128
+	}
+	body := make([]byte, n)
+	io.ReadFull(b.r, body)
+	return header, body
+}
+
+func (b *mqttBroker) write(header byte, body ...byte) {
+	b.conn.Write(append([]byte{header, byte(len(body))}, body...))
+}
+
+// connect reads the CONNECT, checks it and accepts it.
+func (b *mqttBroker) connect(keepAlive uint16, user, pass string) {
+	header, body := b.read()
+	if header != 0x10 {
+		b.t.Errorf("first packet %#x, want CONNECT", header)
+		return
+	}
+	if string(body[2:6]) != "MQTT" || body[6] != 4 {
+		b.t.Errorf("protocol %q level %d, want MQTT 4", body[2:6], body[6])
+	}
+	wantFlags := byte(0x02)
+	if user != "" {
+		wantFlags |= 0xc0
+	}
+	if body[7] != wantFlags {
+		b.t.Errorf("connect flags %#x, want %#x", body[7], wantFlags)
+	}
+	if got := binary.BigEndian.Uint16(body[8:]); got != keepAlive {
+		b.t.Errorf("keepalive %d, want %d", got, keepAlive)
+	}
+	if user != "" && !strings.HasSuffix(string(body), string(mqttString(user))+string(mqttString(pass))) {
+		b.t.Errorf("connect payload %q lacks the credentials", body[10:])
+	}
+	b.write(0x20, 0, 0)
+}
+
+func TestMQTTPublish(t *testing.T) {
+	for _, qos := range []byte{0, 1, 2} {
+		got := make(chan apiRecord, 1)
+		addr := listenMQTT(t, func(b *mqttBroker) {
+			b.connect(60, "edge", "secret")
+			header, body := b.read()
+			if header != 0x30|qos<<1 {
+				t.Errorf("qos %d: publish header %#x", qos, header)
+			}
+			n := int(binary.BigEndian.Uint16(body))
+			if topic := string(body[2 : 2+n]); topic != "stats/gw_1/web" {
+				t.Errorf("qos %d: topic %q", qos, topic)
+			}
+			body = body[2+n:]
+			var id []byte
+			if qos > 0 {
+				id, body = body[:2], body[2:]
+			}
+			var rec apiRecord
+			json.Unmarshal(body, &rec)
+			switch qos {
+			case 1:
+				b.write(0x40, id...) // PUBACK
+			case 2:
+				b.write(0x50, id...) // PUBREC
+				if header, body := b.read(); header != 0x62 || string(body) != string(id) {
+					t.Errorf("got %#x %v, want PUBREL %v", header, body, id)
+				}
+				b.write(0x70, id...) // PUBCOMP
+			}
+			got <- rec
+			b.read() // DISCONNECT
+		})
+		s, err := openMQTTSink("url=mqtt://edge:secret@" + addr + ",topic=stats/{host}/{container},qos=" + string('0'+qos))
+		if err != nil {
+			t.Fatalf("qos %d: %v", qos, err)
+		}
+		err = s.Write(record{Timestamp: time.Unix(0, 0), Container: "web", CPUPct: 12.5, Attrs: map[string]string{"host": "gw/1"}})
+		if err != nil {
+			t.Errorf("qos %d: %v", qos, err)
+		}
+		if rec := <-got; rec.Container != "web" || rec.CPUPct != 12.5 {
+			t.Errorf("qos %d: published %+v", qos, rec)
+		}
+		s.Close()
+	}
+}
+
+// An idle connection is pinged without samples coming in.
+func TestMQTTKeepAlive(t *testing.T) {
+	pinged := make(chan bool, 1)
+	addr := listenMQTT(t, func(b *mqttBroker) {
+		b.connect(1, "", "")
+		header, _ := b.read()
+		if header == 0xc0 {
+			b.write(0xd0)
+		}
+		pinged <- header == 0xc0
+	})
+	s, err := openMQTTSink("url=mqtt://" + addr + ",keepalive=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	select {
+	case ok := <-pinged:
+		if !ok {
+			t.Error("the first packet after CONNECT is not a PINGREQ")
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("no PINGREQ on an idle connection")
+	}
+}
+
+func TestMQTTConnectRefused(t *testing.T) {
+	addr := listenMQTT(t, func(b *mqttBroker) {
+		b.read()
+		b.write(0x20, 0, 5)
+	})
+	_, err := openMQTTSink("url=mqtt://" + addr)
+	if err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Fatalf("err = %v, want not authorized", err)
+	}
+}
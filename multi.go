@@ -0,0 +1,127 @@
+package cstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// multiCollector collects from several backends at once: the clusters of
+// --context, or the sources of daemon --sources. A member that is down is
+// skipped, and retried with backoff so it does not stall the others every
+// tick; only all of them down is an outage. With tag set, each sample
+// records its member's name in that column.
+type multiCollector struct {
+	what    string // "cluster" or "source", for messages
+	tag     string // column naming the member, if any
+	names   []string
+	cs      []collector.Collector
+	up      []bool // by the last Discover
+	backoff []time.Duration
+	retryAt []time.Time
+}
+
+func (m *multiCollector) add(name string, c collector.Collector) {
+	m.names = append(m.names, name)
+	m.cs = append(m.cs, c)
+	m.up = append(m.up, true)
+	m.backoff = append(m.backoff, 0)
+	m.retryAt = append(m.retryAt, time.Time{})
+}
+
+// Columns is the tag column, then the columns of every member in order of
+// first appearance.
+func (m *multiCollector) Columns() []string {
+	var cols []string
+	if m.tag != "" {
+		cols = append(cols, m.tag)
+	}
+	for _, c := range m.cs {
+		for _, col := range c.Columns() {
+			if !slices.Contains(cols, col) {
+				cols = append(cols, col)
+			}
+		}
+	}
+	return cols
+}
+
+func (m *multiCollector) Discover(ctx context.Context) ([]string, error) {
+	var names []string
+	var errs []error
+	for i, c := range m.cs {
+		if !m.up[i] && time.Now().Before(m.retryAt[i]) {
+			errs = append(errs, fmt.Errorf("%s %s: %w", m.what, m.names[i], collector.ErrUnreachable))
+			continue
+		}
+		if r, ok := c.(collector.Reconnector); ok && !m.up[i] {
+			if err := r.Reconnect(ctx); err != nil {
+				logf("%s %s: reconnect: %v", m.what, m.names[i], err)
+			}
+		}
+		found, err := c.Discover(ctx)
+		if err != nil {
+			if m.up[i] {
+				warnf("%s %s: %v", m.what, m.names[i], err)
+			}
+			m.up[i] = false
+			m.backoff[i] = min(max(2*m.backoff[i], 5*time.Second), maxBackoff)
+			m.retryAt[i] = time.Now().Add(m.backoff[i])
+			errs = append(errs, fmt.Errorf("%s %s: %w", m.what, m.names[i], err))
+			continue
+		}
+		if !m.up[i] {
+			infof("%s %s is back", m.what, m.names[i])
+		}
+		m.up[i], m.backoff[i] = true, 0
+		names = append(names, found...)
+	}
+	if len(errs) == len(m.cs) {
+		return nil, errors.Join(errs...)
+	}
+	return names, nil
+}
+
+func (m *multiCollector) Sample(ctx context.Context) ([]record, error) {
+	var out []record
+	for i, c := range m.cs {
+		if !m.up[i] {
+			continue
+		}
+		recs, err := c.Sample(ctx)
+		if err != nil {
+			logf("%s %s: sample: %v", m.what, m.names[i], err)
+			continue
+		}
+		if m.tag != "" {
+			for j := range recs {
+				withAttr(&recs[j], m.tag, m.names[i])
+			}
+		}
+		out = append(out, recs...)
+	}
+	return out, nil
+}
+
+func (m *multiCollector) ReportEvents(report func(event)) {
+	for _, c := range m.cs {
+		if r, ok := c.(collector.EventReporter); ok {
+			r.ReportEvents(report)
+		}
+	}
+}
+
+func (m *multiCollector) Close() error {
+	var errs []error
+	for _, c := range m.cs {
+		if closer, ok := c.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
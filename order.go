@@ -0,0 +1,128 @@
+package cstats
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// dedupeMode is how duplicate samples (the same container at the same
+// timestamp, as merged or restarted captures contain) are combined: "last"
+// keeps the one further down the capture, "avg" averages them.
+type dedupeMode string
+
+func (m *dedupeMode) String() string { return string(*m) }
+
+func (m *dedupeMode) Set(v string) error {
+	if v != "last" && v != "avg" {
+		return fmt.Errorf("must be last or avg, got %q", v)
+	}
+	*m = dedupeMode(v)
+	return nil
+}
+
+// dedupe is the --dedupe mode of the command.
+var dedupe = dedupeMode("last")
+
+// dedupeFlag registers --dedupe on fs.
+func dedupeFlag(fs *flag.FlagSet) {
+	fs.Var(&dedupe, "dedupe", "How to combine duplicate samples of a container at the same timestamp: last or avg")
+}
+
+// combineDuplicate folds dup into kept, a sample of the same container and
+// time standing for n samples already.
+func combineDuplicate(kept, dup record, n int) record {
+	if dedupe == "last" {
+		return dup
+	}
+	w := 1 / float64(n+1)
+	mean := func(a, b float64) float64 { return a + (b-a)*w }
+	out := dup
+	out.CPUPct = mean(kept.CPUPct, dup.CPUPct)
+	out.MemUsageMB = mean(kept.MemUsageMB, dup.MemUsageMB)
+	out.MemLimitMB = mean(kept.MemLimitMB, dup.MemLimitMB)
+	out.MemPct = mean(kept.MemPct, dup.MemPct)
+	if len(kept.Extra) > 0 {
+		out.Extra = make(map[string]float64, len(dup.Extra))
+		for name, v := range dup.Extra {
+			out.Extra[name] = mean(kept.Extra[name], v)
+		}
+	}
+	return out
+}
+
+// sampleKey identifies the series of a sample when combining duplicates:
+// its container, told apart by host, cluster and namespace when the capture
+// records them, so same-named containers of a fleet are not combined.
+func sampleKey(r record) string {
+	key := r.Container
+	for _, col := range []string{"host", "cluster", "namespace"} {
+		if v := r.Attrs[col]; v != "" {
+			key += "\x00" + v
+		}
+	}
+	return key
+}
+
+// settleRecords keeps records in time order without duplicates once
+// records[from:] were appended to a settled slice. Appending in order, as
+// collectors do, costs one pass over the new records; otherwise a sorted
+// copy is returned, so slices handed out before stay untouched. It returns
+// how many of the new records were out of order and how many duplicates
+// were combined.
+func settleRecords(records []record, from int) (out []record, unordered, dups int) {
+	if from >= len(records) {
+		return records, 0, 0
+	}
+	// Start at the samples sharing the first new timestamp, which a read
+	// ending mid-interval splits.
+	start := from
+	for start > 0 && records[start-1].Timestamp.Equal(records[from].Timestamp) {
+		start--
+	}
+	if start > 0 && records[start-1].Timestamp.After(records[from].Timestamp) {
+		unordered++
+	}
+	seen := map[string]bool{}
+	for i := start; i < len(records); i++ {
+		if i > start && !records[i].Timestamp.Equal(records[i-1].Timestamp) {
+			if records[i].Timestamp.Before(records[i-1].Timestamp) {
+				unordered++
+			}
+			clear(seen)
+		}
+		key := sampleKey(records[i])
+		if seen[key] {
+			dups++
+		}
+		seen[key] = true
+	}
+	if unordered == 0 && dups == 0 {
+		return records, 0, 0
+	}
+
+	sorted := make([]record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+	out = sorted[:0]
+	dups = 0
+	n := map[string]int{}
+	at := map[string]int{}
+	for _, r := range sorted {
+		if len(out) > 0 && !r.Timestamp.Equal(out[len(out)-1].Timestamp) {
+			clear(n)
+			clear(at)
+		}
+		key := sampleKey(r)
+		if i, ok := at[key]; ok {
+			out[i] = combineDuplicate(out[i], r, n[key])
+			n[key]++
+			dups++
+			continue
+		}
+		at[key] = len(out)
+		n[key] = 1
+		out = append(out, r)
+	}
+	return out, unordered, dups
+}
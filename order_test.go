@@ -0,0 +1,66 @@
+package cstats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSettleRecords(t *testing.T) {
+	sample := func(s int, container string, cpu float64, host string) record {
+		r := record{Timestamp: time.Unix(int64(s), 0), Container: container, CPUPct: cpu}
+		if host != "" {
+			r.Attrs = map[string]string{"host": host}
+		}
+		return r
+	}
+	tests := []struct {
+		name           string
+		mode           dedupeMode
+		records        []record
+		from           int
+		want           string // container@second=cpu
+		unordered, dup int
+	}{
+		{name: "in order", records: []record{sample(0, "web", 1, ""), sample(0, "db", 2, ""), sample(5, "web", 3, "")},
+			want: "web@0=1 db@0=2 web@5=3"},
+		{name: "nothing new", records: []record{sample(5, "web", 1, ""), sample(0, "web", 2, "")}, from: 2,
+			want: "web@5=1 web@0=2"},
+		{name: "late sample sorted", records: []record{sample(0, "web", 1, ""), sample(10, "web", 3, ""), sample(5, "web", 2, "")},
+			want: "web@0=1 web@5=2 web@10=3", unordered: 1},
+		{name: "late batch behind the settled part", records: []record{sample(10, "web", 1, ""), sample(0, "web", 2, ""), sample(5, "web", 3, "")}, from: 1,
+			want: "web@0=2 web@5=3 web@10=1", unordered: 1},
+		{name: "only the new part checked", records: []record{sample(10, "web", 1, ""), sample(0, "web", 2, ""), sample(20, "web", 3, "")}, from: 2,
+			want: "web@10=1 web@0=2 web@20=3"},
+		{name: "last duplicate wins", mode: "last", records: []record{sample(0, "web", 1, ""), sample(0, "web", 3, "")},
+			want: "web@0=3", dup: 1},
+		{name: "duplicates averaged", mode: "avg", records: []record{sample(0, "web", 1, ""), sample(0, "web", 2, ""), sample(0, "web", 6, "")},
+			want: "web@0=3", dup: 2},
+		// A read can end between the samples of one timestamp.
+		{name: "duplicate across the split", mode: "avg", records: []record{sample(0, "web", 2, ""), sample(0, "db", 1, ""), sample(0, "web", 4, "")}, from: 2,
+			want: "web@0=3 db@0=1", dup: 1},
+		{name: "same name on other hosts", records: []record{sample(0, "web", 1, "a"), sample(0, "web", 2, "b"), sample(0, "web", 3, "a")},
+			want: "web@0=3 web@0=2", dup: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mode != "" {
+				defer func(m dedupeMode) { dedupe = m }(dedupe)
+				dedupe = tt.mode
+			}
+			before := fmt.Sprint(tt.records)
+			out, unordered, dups := settleRecords(tt.records, tt.from)
+			var got []string
+			for _, r := range out {
+				got = append(got, fmt.Sprintf("%s@%d=%g", r.Container, r.Timestamp.Unix(), r.CPUPct))
+			}
+			if g := strings.Join(got, " "); g != tt.want || unordered != tt.unordered || dups != tt.dup {
+				t.Errorf("settled %q with %d unordered and %d duplicates, want %q with %d and %d", g, unordered, dups, tt.want, tt.unordered, tt.dup)
+			}
+			if fmt.Sprint(tt.records) != before {
+				t.Error("the records passed in were changed")
+			}
+		})
+	}
+}
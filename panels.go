@@ -0,0 +1,79 @@
+package cstats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reserveBottom compresses the existing subplot grid of fig into the top
+// (1-frac) of the figure and grows the figure height so existing panels keep
+// their size, freeing the paper range [0, frac) for extra panels.
+func reserveBottom(fig map[string]any, frac float64) {
+	layout := fig["layout"].(map[string]any)
+	squeeze := func(y float64) float64 { return frac + y*(1-frac) }
+
+	for key, v := range layout {
+		ax, ok := v.(map[string]any)
+		if !ok || !strings.HasPrefix(key, "yaxis") {
+			continue
+		}
+		if d, ok := ax["domain"].([]float64); ok {
+			ax["domain"] = []float64{squeeze(d[0]), squeeze(d[1])}
+		}
+	}
+	if notes, ok := layout["annotations"].([]map[string]any); ok {
+		for _, n := range notes {
+			if n["yref"] != "paper" {
+				continue
+			}
+			if y, ok := n["y"].(float64); ok {
+				n["y"] = squeeze(y)
+			}
+		}
+	}
+	if traces, ok := fig["data"].([]map[string]any); ok {
+		for _, t := range traces {
+			d, ok := t["domain"].(map[string]any)
+			if !ok {
+				continue
+			}
+			if y, ok := d["y"].([]float64); ok {
+				d["y"] = []float64{squeeze(y[0]), squeeze(y[1])}
+			}
+		}
+	}
+	if h, ok := layout["height"].(int); ok {
+		layout["height"] = int(float64(h) / (1 - frac))
+	}
+}
+
+// addRow appends a row of heightPx pixels below the existing panels, spanning
+// the time-series column, and returns the new axis ids (e.g. "x6", "y6").
+// The x axis is linked to the main time axis so zoom stays in sync.
+func addRow(fig map[string]any, title string, heightPx int) (xaxis, yaxis string) {
+	layout := fig["layout"].(map[string]any)
+	n := 2
+	for key := range layout {
+		if i, err := strconv.Atoi(strings.TrimPrefix(key, "xaxis")); err == nil && i >= n {
+			n = i + 1
+		}
+	}
+
+	h, _ := layout["height"].(int)
+	frac := float64(heightPx) / float64(h+heightPx)
+	reserveBottom(fig, frac)
+
+	top := frac * 0.8 // leave room for the subplot title
+	layout[fmt.Sprintf("xaxis%d", n)] = map[string]any{
+		"domain":  []float64{0.0, 0.62},
+		"anchor":  fmt.Sprintf("y%d", n),
+		"matches": "x",
+	}
+	layout[fmt.Sprintf("yaxis%d", n)] = map[string]any{
+		"domain": []float64{0.0, top},
+		"anchor": fmt.Sprintf("x%d", n),
+	}
+	layout["annotations"] = append(layout["annotations"].([]map[string]any), subplotTitle(title, 0.31, top))
+	return fmt.Sprintf("x%d", n), fmt.Sprintf("y%d", n)
+}
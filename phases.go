@@ -0,0 +1,230 @@
+package cstats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// phase is a stretch of a run bracketed by "<name> start" and "<name> end"
+// markers. A phase never ended lasts until the last sample.
+type phase struct {
+	Name       string
+	Start, End time.Time
+}
+
+// phasesFrom pairs the start and end markers of events into phases, in
+// start order. Phases may overlap; other markers are ignored.
+func phasesFrom(events []event, last time.Time) []phase {
+	var phases []phase
+	open := map[string]int{} // name -> index of its unended phase
+	for _, ev := range events {
+		label := strings.ToLower(ev.Label)
+		switch {
+		case strings.HasSuffix(label, " start"):
+			name := strings.TrimSpace(ev.Label[:len(ev.Label)-len(" start")])
+			if i, ok := open[name]; ok {
+				phases[i].End = ev.Timestamp
+			}
+			open[name] = len(phases)
+			phases = append(phases, phase{Name: name, Start: ev.Timestamp})
+		case strings.HasSuffix(label, " end"):
+			name := strings.TrimSpace(ev.Label[:len(ev.Label)-len(" end")])
+			if i, ok := open[name]; ok {
+				phases[i].End = ev.Timestamp
+				delete(open, name)
+			}
+		}
+	}
+	for _, i := range open {
+		phases[i].End = last
+	}
+	slices.SortStableFunc(phases, func(a, b phase) int { return a.Start.Compare(b.Start) })
+	return phases
+}
+
+// phaseStats computes the stats of each phase from the samples inside it.
+func phaseStats(records []record, phases []phase) []map[string]*containerStats {
+	out := make([]map[string]*containerStats, len(phases))
+	for i, p := range phases {
+		var in []record
+		for _, r := range records {
+			if !r.Timestamp.Before(p.Start) && !r.Timestamp.After(p.End) {
+				in = append(in, r)
+			}
+		}
+		out[i] = computeStats(in)
+	}
+	return out
+}
+
+// phaseEntry is the machine-readable form of a container's stats in a phase.
+type phaseEntry struct {
+	Phase     string    `json:"phase"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Container string    `json:"container"`
+	Samples   int       `json:"samples"`
+	CPUAvg    float64   `json:"cpu_avg_pct"`
+	CPUMax    float64   `json:"cpu_max_pct"`
+	MemAvg    float64   `json:"mem_avg_mb"`
+	MemMax    float64   `json:"mem_max_mb"`
+}
+
+var phaseHeader = []string{"Phase", "Duration", "Container", "Samples", "CPU avg%", "CPU max%", "RAM avg MB", "RAM max MB"}
+
+// writePhaseSummary renders the per-phase avg/max of each container as
+// table, csv, json or md.
+func writePhaseSummary(w io.Writer, format string, phases []phase, stats []map[string]*containerStats) error {
+	peak := 0.0
+	for _, ps := range stats {
+		for _, s := range ps {
+			peak = max(peak, s.MemMax)
+		}
+	}
+	u := memUnitFor(peak)
+	header := make([]string, len(phaseHeader))
+	for i, h := range phaseHeader {
+		header[i] = u.label(h)
+	}
+	var rows [][]string
+	var entries []phaseEntry
+	for i, p := range phases {
+		for _, c := range slices.Sorted(maps.Keys(stats[i])) {
+			s := stats[i][c]
+			rows = append(rows, []string{
+				p.Name, p.End.Sub(p.Start).Round(time.Second).String(), c, strconv.Itoa(s.Count),
+				fmt.Sprintf("%.1f", s.CPUAvg()), fmt.Sprintf("%.1f", s.CPUMax),
+				u.format(s.MemAvg()), u.format(s.MemMax),
+			})
+			entries = append(entries, phaseEntry{
+				Phase: p.Name, Start: p.Start, End: p.End, Container: c, Samples: s.Count,
+				CPUAvg: round2(s.CPUAvg()), CPUMax: round2(s.CPUMax),
+				MemAvg: round2(s.MemAvg()), MemMax: round2(s.MemMax),
+			})
+		}
+	}
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "md":
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "| :--- | ---: | :--- |%s\n", strings.Repeat(" ---: |", len(header)-3))
+		for _, row := range rows {
+			for j := range row {
+				row[j] = strings.ReplaceAll(row[j], "|", `\|`)
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown summary format %q (use table, csv, json or md)", format)
+}
+
+// phaseShapes shades the phases across the given time-series axes and
+// labels them on the first one.
+func phaseShapes(phases []phase, axes [][2]string, th theme) (shapes, annotations []map[string]any) {
+	for i, p := range phases {
+		x0, x1 := p.Start.Format(time.RFC3339), p.End.Format(time.RFC3339)
+		for j, ax := range axes {
+			shapes = append(shapes, map[string]any{
+				"type":      "rect",
+				"xref":      ax[0],
+				"yref":      ax[1] + " domain",
+				"x0":        x0,
+				"x1":        x1,
+				"y0":        0,
+				"y1":        1,
+				"fillcolor": th.Marker,
+				"opacity":   0.06 + 0.04*float64(i%2),
+				"layer":     "below",
+				"line":      map[string]any{"width": 0},
+			})
+			if j == 0 {
+				annotations = append(annotations, map[string]any{
+					"x":         x0,
+					"y":         0.98,
+					"xref":      ax[0],
+					"yref":      ax[1] + " domain",
+					"xanchor":   "left",
+					"yanchor":   "top",
+					"showarrow": false,
+					"text":      p.Name,
+					"hovertext": fmt.Sprintf("%s: %s – %s", p.Name, p.Start.Format("15:04:05"), p.End.Format("15:04:05")),
+					"font":      map[string]any{"size": 10, "color": th.Muted},
+				})
+			}
+		}
+	}
+	return shapes, annotations
+}
+
+// markHandler appends the marker POSTed as the label form value (or as a
+// plain-text body) to the events file at path.
+func markHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		label := r.FormValue("label")
+		if label == "" && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			body, _ := io.ReadAll(io.LimitReader(r.Body, 4096))
+			label = string(body)
+		}
+		label = strings.TrimSpace(label)
+		if label == "" {
+			http.Error(w, "missing label", http.StatusBadRequest)
+			return
+		}
+		ev := event{Timestamp: time.Now().UTC(), Label: label}
+		if err := recordEvent(path, ev, "marker"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"timestamp": ev.Timestamp.Format(time.RFC3339), "label": label})
+	}
+}
+
+// startMarkServer serves POST /mark on addr (--mark-addr), appending to
+// eventsFile, when addr is set.
+func startMarkServer(addr, eventsFile string) {
+	if addr == "" {
+		return
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("--mark-addr: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/mark", markHandler(eventsFile))
+	fmt.Printf("Markers: POST http://%s/mark?label=...\n", ln.Addr())
+	go func() {
+		warnf("marker server: %v", http.Serve(ln, mux))
+	}()
+}
@@ -0,0 +1,205 @@
+package cstats
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promConfig reads a capture from Prometheus instead of a CSV, using the
+// cAdvisor container_* metrics by default.
+type promConfig struct {
+	URL   string
+	Since time.Duration
+	Start string
+	End   string
+	Step  time.Duration
+	By    string
+
+	Selector string
+	CPUQuery string
+	MemQuery string
+	LimQuery string
+}
+
+// promFlags registers the --prometheus flags on fs.
+func promFlags(fs *flag.FlagSet) *promConfig {
+	c := &promConfig{}
+	fs.StringVar(&c.URL, "prometheus", "", "Read samples from this Prometheus server instead of a CSV")
+	fs.DurationVar(&c.Since, "since", time.Hour, "With --prometheus, query this far back from now")
+	fs.StringVar(&c.Start, "start", "", "With --prometheus, range start (RFC3339; overrides --since)")
+	fs.StringVar(&c.End, "end", "", "With --prometheus, range end (RFC3339, default now)")
+	fs.DurationVar(&c.Step, "step", 15*time.Second, "With --prometheus, query resolution")
+	fs.StringVar(&c.By, "prom-by", "namespace,pod", "Labels identifying a container (use \"name\" for plain Docker cAdvisor)")
+	fs.StringVar(&c.Selector, "prom-selector", `container!="",container!="POD"`, "Label matchers added to the default queries")
+	fs.StringVar(&c.CPUQuery, "prom-cpu-query", "", "PromQL for CPU % (overrides the default)")
+	fs.StringVar(&c.MemQuery, "prom-mem-query", "", "PromQL for memory usage in MB (overrides the default)")
+	fs.StringVar(&c.LimQuery, "prom-limit-query", "", "PromQL for the memory limit in MB (overrides the default)")
+	return c
+}
+
+// queries returns the CPU, memory and limit queries, filling in defaults
+// built from the selector and --prom-by.
+func (c *promConfig) queries() (cpu, mem, limit string) {
+	rateWindow := max(4*c.Step, time.Minute)
+	sel := "{" + c.Selector + "}"
+	cpu, mem, limit = c.CPUQuery, c.MemQuery, c.LimQuery
+	if cpu == "" {
+		cpu = fmt.Sprintf("sum by (%s) (rate(container_cpu_usage_seconds_total%s[%s])) * 100", c.By, sel, promDuration(rateWindow))
+	}
+	if mem == "" {
+		mem = fmt.Sprintf("sum by (%s) (container_memory_working_set_bytes%s) / 1048576", c.By, sel)
+	}
+	if limit == "" {
+		limit = fmt.Sprintf("sum by (%s) (container_spec_memory_limit_bytes%s) / 1048576", c.By, sel)
+	}
+	return cpu, mem, limit
+}
+
+// promDuration formats d in PromQL duration syntax (whole seconds).
+func promDuration(d time.Duration) string {
+	return strconv.Itoa(int(d.Seconds())) + "s"
+}
+
+// timeRange resolves --since/--start/--end.
+func (c *promConfig) timeRange() (start, end time.Time, err error) {
+	end = time.Now()
+	if c.End != "" {
+		if end, err = time.Parse(time.RFC3339, c.End); err != nil {
+			return start, end, fmt.Errorf("invalid --end: %w", err)
+		}
+	}
+	start = end.Add(-c.Since)
+	if c.Start != "" {
+		if start, err = time.Parse(time.RFC3339, c.Start); err != nil {
+			return start, end, fmt.Errorf("invalid --start: %w", err)
+		}
+	}
+	if !start.Before(end) {
+		return start, end, fmt.Errorf("empty time range %s .. %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+// promSeries is one series of a query_range matrix result.
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]any          `json:"values"`
+}
+
+// queryRange runs a PromQL range query.
+func (c *promConfig) queryRange(query string, start, end time.Time) ([]promSeries, error) {
+	q := neturl.Values{}
+	q.Set("query", query)
+	q.Set("start", strconv.FormatInt(start.Unix(), 10))
+	q.Set("end", strconv.FormatInt(end.Unix(), 10))
+	q.Set("step", promDuration(c.Step))
+	resp, err := remoteClient.Get(strings.TrimSuffix(c.URL, "/") + "/api/v1/query_range?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string       `json:"resultType"`
+			Result     []promSeries `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("query %q: %s: %w", query, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Status != "success" {
+		return nil, fmt.Errorf("query %q: %s %s", query, resp.Status, body.Error)
+	}
+	return body.Data.Result, nil
+}
+
+// seriesName joins the --prom-by label values: {namespace="prod",pod="web-1"}
+// becomes "prod/web-1", matching the Kubernetes daemon's naming.
+func (c *promConfig) seriesName(metric map[string]string) string {
+	var parts []string
+	for _, l := range strings.Split(c.By, ",") {
+		if v := metric[strings.TrimSpace(l)]; v != "" {
+			parts = append(parts, v)
+		}
+	}
+	if len(parts) == 0 {
+		return "(none)"
+	}
+	return strings.Join(parts, "/")
+}
+
+// load queries Prometheus and converts the results into records.
+func (c *promConfig) load() ([]record, error) {
+	start, end, err := c.timeRange()
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		name string
+		ts   int64
+	}
+	recs := map[key]*record{}
+	cpuQ, memQ, limQ := c.queries()
+	for _, q := range []struct {
+		query string
+		set   func(r *record, v float64)
+	}{
+		{cpuQ, func(r *record, v float64) { r.CPUPct = v }},
+		{memQ, func(r *record, v float64) { r.MemUsageMB = v }},
+		{limQ, func(r *record, v float64) { r.MemLimitMB = v }},
+	} {
+		series, err := c.queryRange(q.query, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			name := c.seriesName(s.Metric)
+			for _, pair := range s.Values {
+				ts, ok := pair[0].(float64)
+				str, ok2 := pair[1].(string)
+				if !ok || !ok2 {
+					continue
+				}
+				v, err := strconv.ParseFloat(str, 64)
+				if err != nil {
+					continue
+				}
+				k := key{name, int64(ts)}
+				r, ok := recs[k]
+				if !ok {
+					r = &record{Timestamp: time.Unix(int64(ts), 0).In(displayLoc), Container: name}
+					recs[k] = r
+				}
+				q.set(r, v)
+			}
+		}
+	}
+
+	records := make([]record, 0, len(recs))
+	for _, r := range recs {
+		// cAdvisor reports no limit as 0 (or a huge value on some kernels).
+		if r.MemLimitMB > 0 && r.MemLimitMB < 1<<40 {
+			r.MemPct = r.MemUsageMB / r.MemLimitMB * 100
+		} else {
+			r.MemLimitMB = 0
+		}
+		records = append(records, *r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Timestamp.Equal(records[j].Timestamp) {
+			return records[i].Timestamp.Before(records[j].Timestamp)
+		}
+		return records[i].Container < records[j].Container
+	})
+	return records, nil
+}
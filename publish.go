@@ -0,0 +1,343 @@
+package cstats
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// publishTimeout bounds the upload of one file.
+const publishTimeout = 2 * time.Minute
+
+// publisher uploads one-shot dashboards for plot --publish: to S3
+// (s3://bucket/prefix), Google Cloud Storage (gs://bucket/prefix) or any
+// server taking PUT (an http(s) URL). Files keep their names, and their
+// paths relative to the dashboard, under the prefix.
+//
+// Buckets are usually private, so the printed links are ones that work
+// there: presigned for S3 and, for GCS, the download links of signed-in
+// users with access. With --publish-base they are plain links under it.
+type publisher struct {
+	target  string
+	base    string        // --publish-base
+	headers stringList    // --publish-header
+	expires time.Duration // --publish-expires
+
+	scheme, bucket, prefix string
+	client                 *http.Client
+	aws                    *awsCredentials
+	region                 string // of the S3 bucket, corrected by S3
+	gcsToken               string
+}
+
+// publishFlags registers --publish and its options on fs.
+func publishFlags(fs *flag.FlagSet) *publisher {
+	p := &publisher{}
+	fs.StringVar(&p.target, "publish", "", "Upload the dashboard and its summary JSON to `URL`: s3://bucket/prefix, gs://bucket/prefix or an http(s) URL taking PUT, and print their URLs")
+	fs.StringVar(&p.base, "publish-base", "", "`URL` the --publish prefix is served under (a CDN, a static site), for the printed links (default: the storage's own URL)")
+	fs.Var(&p.headers, "publish-header", `Request header of an http(s) --publish, e.g. "Authorization: Bearer ..." (repeatable)`)
+	fs.DurationVar(&p.expires, "publish-expires", 7*24*time.Hour, "How long the presigned links of an s3:// --publish work, at most 168h (--pages drilldowns need --publish-base or a public bucket)")
+	return p
+}
+
+// enabled reports whether --publish was given.
+func (p *publisher) enabled() bool { return p.target != "" }
+
+// validate checks the flags and the credentials of the storage.
+func (p *publisher) validate() error {
+	if !p.enabled() {
+		if p.base != "" || len(p.headers) > 0 {
+			return errors.New("--publish-base and --publish-header need --publish")
+		}
+		return nil
+	}
+	if p.expires <= 0 || p.expires > 7*24*time.Hour {
+		return fmt.Errorf("--publish-expires must be between 1s and 168h, got %s", p.expires)
+	}
+	u, err := neturl.Parse(p.target)
+	if err != nil {
+		return fmt.Errorf("--publish: %w", err)
+	}
+	p.scheme = u.Scheme
+	p.client = &http.Client{Timeout: publishTimeout}
+	switch u.Scheme {
+	case "s3", "gs":
+		if u.Host == "" {
+			return fmt.Errorf("--publish: want %s://bucket/prefix, got %q", u.Scheme, p.target)
+		}
+		p.bucket, p.prefix = u.Host, strings.Trim(u.Path, "/")
+	case "http", "https":
+		p.prefix = strings.TrimSuffix(p.target, "/")
+	default:
+		return fmt.Errorf("--publish: want s3://, gs:// or an http(s) URL, got %q", p.target)
+	}
+	if len(p.headers) > 0 && p.bucket != "" {
+		return errors.New("--publish-header is for http(s) --publish URLs")
+	}
+	for _, h := range p.headers {
+		if _, _, ok := strings.Cut(h, ":"); !ok {
+			return fmt.Errorf("invalid --publish-header %q, want \"Name: value\"", h)
+		}
+	}
+	switch u.Scheme {
+	case "s3":
+		p.aws = &awsCredentials{client: p.client}
+		p.region = cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+		if _, err := p.aws.get(); err != nil {
+			return fmt.Errorf("--publish: %w", err)
+		}
+	case "gs":
+		if p.gcsToken, err = gcsAccessToken(p.client); err != nil {
+			return fmt.Errorf("--publish: %w", err)
+		}
+	}
+	return nil
+}
+
+// publish uploads files, which are under dir, and returns their URLs.
+func (p *publisher) publish(dir string, files []string) ([]string, error) {
+	var urls []string
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return urls, err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return urls, err
+		}
+		rel = filepath.ToSlash(rel)
+		url, err := p.upload(rel, data, cmp.Or(mime.TypeByExtension(filepath.Ext(file)), "application/octet-stream"))
+		if err != nil {
+			return urls, fmt.Errorf("publish %s: %w", file, err)
+		}
+		if p.base != "" {
+			url = strings.TrimSuffix(p.base, "/") + "/" + escapeKey(rel)
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+// publishDir returns the files of a directory written next to the
+// dashboard (the --pages drilldown), for publish.
+func publishDir(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, p)
+		}
+		return err
+	})
+	return files, err
+}
+
+// upload stores a file under the prefix and returns its URL.
+func (p *publisher) upload(name string, data []byte, contentType string) (string, error) {
+	switch p.scheme {
+	case "s3":
+		key := path.Join(p.prefix, name)
+		if err := p.putS3(key, data, contentType); err != nil {
+			return "", err
+		}
+		return p.presignS3(key)
+	case "gs":
+		host, share := "https://storage.googleapis.com", "https://storage.cloud.google.com"
+		if emu := os.Getenv("STORAGE_EMULATOR_HOST"); emu != "" {
+			host = "http://" + strings.TrimPrefix(emu, "http://")
+			share = host
+		}
+		obj := "/" + p.bucket + "/" + escapeKey(path.Join(p.prefix, name))
+		return share + obj, p.put(host+obj, data, contentType, func(req *http.Request) {
+			if p.gcsToken != "" {
+				req.Header.Set("Authorization", "Bearer "+p.gcsToken)
+			}
+		})
+	default:
+		url := p.prefix + "/" + escapeKey(name)
+		return url, p.put(url, data, contentType, func(req *http.Request) {
+			for _, h := range p.headers {
+				k, v, _ := strings.Cut(h, ":")
+				req.Header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+			}
+		})
+	}
+}
+
+// put sends data with PUT, after prepare set the credentials.
+func (p *publisher) put(url string, data []byte, contentType string, prepare func(*http.Request)) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	prepare(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// s3URL returns the URL of an object in the S3 bucket, or the bucket of an
+// S3-compatible store at $AWS_ENDPOINT_URL_S3 or $AWS_ENDPOINT_URL (MinIO),
+// addressed by path there. Bucket names with dots are addressed by path
+// too, since they do not match the certificate of the virtual hosts.
+func (p *publisher) s3URL(key string) string {
+	if endpoint := cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/" + p.bucket + "/" + escapeKey(key)
+	}
+	if strings.Contains(p.bucket, ".") {
+		return "https://s3." + p.region + ".amazonaws.com/" + p.bucket + "/" + escapeKey(key)
+	}
+	return "https://" + p.bucket + ".s3." + p.region + ".amazonaws.com/" + escapeKey(key)
+}
+
+// putS3 stores an object in the bucket. A bucket in another region than
+// $AWS_REGION is retried in its own.
+func (p *publisher) putS3(key string, data []byte, contentType string) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPut, p.s3URL(key), bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Amz-Content-Sha256", sha256Hex(string(data)))
+		creds, err := p.aws.get()
+		if err != nil {
+			return err
+		}
+		signAWSv4(req, string(data), creds, p.region, "s3", time.Now())
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return err
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		if region := resp.Header.Get("X-Amz-Bucket-Region"); region != "" && region != p.region && attempt == 0 {
+			p.region = region
+			continue
+		}
+		if m := awsErrorMessage.FindSubmatch(msg); m != nil {
+			msg = m[1]
+		}
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+}
+
+// presignS3 returns a link to an object that works for --publish-expires,
+// or until temporary credentials expire.
+func (p *publisher) presignS3(key string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, p.s3URL(key), nil)
+	if err != nil {
+		return "", err
+	}
+	creds, err := p.aws.get()
+	if err != nil {
+		return "", err
+	}
+	return presignAWSv4(req, creds, p.region, "s3", time.Now(), p.expires), nil
+}
+
+// escapeKey escapes an object name for a URL path the way S3 signs it:
+// everything but unreserved characters and the slashes.
+func escapeKey(key string) string { return uriEncode(key, false) }
+
+// gcsMetadataURL is the token endpoint of the GCE metadata server.
+const gcsMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcsAccessToken returns an OAuth token for Cloud Storage: from
+// $GOOGLE_OAUTH_ACCESS_TOKEN, the metadata server of a GCE/GKE instance, or
+// gcloud. An emulator ($STORAGE_EMULATOR_HOST) needs none.
+func gcsAccessToken(client *http.Client) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, gcsMetadataURL, nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	if resp, err := client.Do(req); err == nil {
+		defer resp.Body.Close()
+		var v struct {
+			AccessToken string `json:"access_token"`
+		}
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&v) == nil && v.AccessToken != "" {
+			return v.AccessToken, nil
+		}
+	}
+	out, err := exec.Command("gcloud", "auth", "print-access-token").Output()
+	if token := strings.TrimSpace(string(out)); err == nil && token != "" {
+		return token, nil
+	}
+	return "", errors.New("no Google credentials: set GOOGLE_OAUTH_ACCESS_TOKEN, run on GCE/GKE or log in with gcloud")
+}
+
+// publishDashboard uploads a dashboard written to html with its summaries
+// and drilldown pages, if any, and prints their URLs. Failing to is fatal,
+// so a CI job does not link a dashboard that is not there.
+func (p *publisher) publishDashboard(html string, summaries []string, pagesDir string) {
+	if !p.enabled() {
+		return
+	}
+	files := append([]string{html}, summaries...)
+	if pagesDir != "" {
+		pages, err := publishDir(pagesDir)
+		if err != nil {
+			log.Fatalf("--publish: %v", err)
+		}
+		files = append(files, pages...)
+	}
+	urls, err := p.publish(filepath.Dir(html), files)
+	if err != nil {
+		log.Fatalf("--publish: %v", err)
+	}
+	for i, url := range urls {
+		switch {
+		case i == 0:
+			fmt.Printf("Published dashboard -> %s\n", url)
+		case i <= len(summaries):
+			fmt.Printf("Published summary -> %s\n", url)
+		}
+	}
+	if n := len(urls) - 1 - len(summaries); n > 0 {
+		fmt.Printf("Published %d drilldown pages\n", n)
+	}
+	if p.scheme == "s3" && p.base == "" {
+		until := time.Now().Add(p.expires)
+		if creds, err := p.aws.get(); err == nil && !creds.Expires.IsZero() && creds.Expires.Before(until) {
+			until = creds.Expires // with the temporary credentials they are signed with
+		}
+		fmt.Printf("Presigned links expire %s\n", until.UTC().Format(time.RFC3339))
+		if pagesDir != "" {
+			warnf("--publish: a presigned dashboard cannot link to its drilldown pages; use --publish-base or a public bucket")
+		}
+	}
+}
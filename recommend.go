@@ -0,0 +1,89 @@
+package cstats
+
+import (
+	"fmt"
+	"math"
+)
+
+// recommendation is a suggested Kubernetes-style resource spec for one
+// container, derived from its captured usage. The CPU fields are 0 when the
+// CPU used is not known.
+type recommendation struct {
+	CPURequestMilli int64 `json:"cpu_request_millicores"`
+	CPULimitMilli   int64 `json:"cpu_limit_millicores"`
+	MemRequestMiB   int64 `json:"mem_request_mib"`
+	MemLimitMiB     int64 `json:"mem_limit_mib"`
+}
+
+// recommendHeader lists the columns appended by recommendation.cells.
+var recommendHeader = []string{"CPU req", "CPU lim", "Mem req", "Mem lim"}
+
+// recommend sizes requests from p95 and limits from p99 (CPU) and the peak
+// (memory, since exceeding it means an OOM kill), each plus headroom.
+// cpu_pct is a percentage of one core, as the Docker collector writes it, or
+// of the CPU limit for the Kubernetes ones; without a limit they record no
+// CPU, so only memory is sized.
+func recommend(s *containerStats, headroom float64) recommendation {
+	f := 1 + headroom
+	perPct := 10.0 // millicores per cpu_pct point: 100% of a core = 1000m
+	if s.CPUOfLimit {
+		perPct = s.CPULimitM / 100
+	}
+	cpuMilli := func(pct float64) int64 {
+		if perPct == 0 {
+			return 0
+		}
+		m := int64(math.Ceil(pct*perPct*f/10)) * 10 // rounded up to 10m
+		return max(m, 10)
+	}
+	memMiB := func(mb float64) int64 {
+		m := int64(math.Ceil(mb*f/8)) * 8 // rounded up to 8Mi
+		return max(m, 8)
+	}
+	r := recommendation{
+		CPURequestMilli: cpuMilli(s.CPUP95),
+		CPULimitMilli:   cpuMilli(s.CPUP99),
+		MemRequestMiB:   memMiB(s.MemP95),
+		MemLimitMiB:     memMiB(s.MemMax),
+	}
+	r.CPULimitMilli = max(r.CPULimitMilli, r.CPURequestMilli)
+	r.MemLimitMiB = max(r.MemLimitMiB, r.MemRequestMiB)
+	return r
+}
+
+// cells formats the recommendation in recommendHeader order.
+func (r recommendation) cells() []string {
+	cpu := func(m int64) string {
+		if m == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%dm", m)
+	}
+	return []string{
+		cpu(r.CPURequestMilli),
+		cpu(r.CPULimitMilli),
+		fmt.Sprintf("%dMi", r.MemRequestMiB),
+		fmt.Sprintf("%dMi", r.MemLimitMiB),
+	}
+}
+
+// applyRecommendations attaches a recommendation to every container.
+func applyRecommendations(stats map[string]*containerStats, headroom float64) {
+	for _, s := range stats {
+		r := recommend(s, headroom)
+		s.Rec = &r
+	}
+}
+
+// checkRecommendable refuses to size a capture the Kubernetes collectors
+// took before they recorded cpu_limit_m (ofLimit is whether its samples
+// have it): its cpu_pct is a percentage of CPU limits that are not known.
+func checkRecommendable(csvPath string, ofLimit bool) error {
+	switch collector := captureCollector(csvPath); collector {
+	case "kubernetes", "kubelet":
+		if !ofLimit {
+			return fmt.Errorf("--recommend: %s was taken by the %s collector before it recorded %s, so its CPU percentages of the limits cannot be converted to cores; capture it again", csvPath, collector, cpuLimitColumn)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cstats
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// redactor pseudonymizes a capture for sharing (--redact): container and
+// pod names, namespaces, clusters, Compose projects and services and label
+// values become stable aliases, the same in every run, and hosts and
+// images are dropped. A stable hash can be confirmed by hashing a guessed
+// name; names that must not be guessable belong in the --redact-map file.
+type redactor struct {
+	mapping map[string]string // from --redact-map, by original name
+
+	mu      sync.Mutex
+	aliases map[string]string // every name redacted so far
+}
+
+// redactedAttrs are the text columns whose values are pseudonymized; other
+// attribute columns keep their values, but for strippedAttrs.
+var redactedAttrs = map[string]string{
+	"namespace":       "ns",
+	"cluster":         "cluster",
+	"compose_project": "project",
+	"compose_service": "service",
+}
+
+// strippedAttrs are the text columns dropped from redacted records.
+var strippedAttrs = []string{"host", "image", "image_id"}
+
+// newRedactor reads the mapping file, "name = alias" lines, if any.
+func newRedactor(mapFile string) (*redactor, error) {
+	r := &redactor{mapping: map[string]string{}, aliases: map[string]string{}}
+	if mapFile == "" {
+		return r, nil
+	}
+	f, err := os.Open(mapFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, alias, ok := strings.Cut(line, "=")
+		name, alias = strings.TrimSpace(name), strings.TrimSpace(alias)
+		if !ok || name == "" || alias == "" {
+			return nil, fmt.Errorf("%s:%d: want name = alias, got %q", mapFile, n, line)
+		}
+		r.mapping[name] = alias
+	}
+	return r, sc.Err()
+}
+
+// alias returns the alias of name: its mapping, else kind and a hash.
+func (r *redactor) alias(name, kind string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.mapping[name]
+	if !ok {
+		sum := sha256.Sum256([]byte(name))
+		a = kind + "-" + hex.EncodeToString(sum[:4])
+	}
+	r.aliases[name] = a
+	return a
+}
+
+// records returns redacted copies of records; the originals, which a live
+// server keeps cached, are left alone.
+func (r *redactor) records(records []record) []record {
+	out := make([]record, len(records))
+	for i, rec := range records {
+		if rec.Container != selfContainer {
+			rec.Container = r.alias(rec.Container, "container")
+		}
+		if rec.Attrs != nil {
+			attrs := make(map[string]string, len(rec.Attrs))
+			for col, v := range rec.Attrs {
+				if slices.Contains(strippedAttrs, col) {
+					continue
+				}
+				if kind, ok := redactedAttrs[col]; ok {
+					v = r.alias(v, kind)
+				} else if strings.HasPrefix(col, "label_") {
+					v = r.alias(v, "value")
+				}
+				attrs[col] = v
+			}
+			rec.Attrs = attrs
+		}
+		out[i] = rec
+	}
+	return out
+}
+
+// nameToken matches the words of an event label that may be names.
+var nameToken = regexp.MustCompile(`[\w.:-]+`)
+
+// events replaces the names redacted so far in event labels ("db
+// unhealthy", "OOMKilled shop/api-1") with their aliases. Only whole words
+// are replaced, or the parts of a word between colons ("prod:", a cluster
+// prefix, or "pod:container").
+func (r *redactor) events(events []event) []event {
+	r.mu.Lock()
+	aliases := maps.Clone(r.aliases)
+	r.mu.Unlock()
+	if len(aliases) == 0 {
+		return events
+	}
+	replace := func(word string) string {
+		if a, ok := aliases[word]; ok {
+			return a
+		}
+		parts := strings.Split(word, ":")
+		for i, p := range parts {
+			if a, ok := aliases[p]; ok {
+				parts[i] = a
+			}
+		}
+		return strings.Join(parts, ":")
+	}
+	out := make([]event, len(events))
+	for i, ev := range events {
+		ev.Label = nameToken.ReplaceAllStringFunc(ev.Label, replace)
+		out[i] = ev
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package cstats
+
+import "fmt"
+
+const exceededColor = "#EF553B"
+
+// hline is a horizontal reference line across a time-series panel.
+func hline(xaxis, yaxis string, y float64, color, text string) map[string]any {
+	return map[string]any{
+		"type":  "line",
+		"xref":  xaxis + " domain",
+		"yref":  yaxis,
+		"x0":    0,
+		"x1":    1,
+		"y0":    y,
+		"y1":    y,
+		"layer": "below",
+		"line":  map[string]any{"color": color, "width": 1.5, "dash": "dash"},
+		"label": map[string]any{
+			"text":         text,
+			"textposition": "end",
+			"font":         map[string]any{"size": 10, "color": color},
+			"yanchor":      "bottom",
+		},
+	}
+}
+
+// referenceLines draws each container's memory limit on the RAM panel and the
+// optional CPU/RAM thresholds. Lines turn red when a series crosses them.
+func referenceLines(containers []string, stats map[string]*containerStats, colorMap map[string]string, opts FigureOptions) []map[string]any {
+	var shapes []map[string]any
+	var cpuMax, memMax float64
+	u := statsMemUnit(stats)
+	for _, c := range containers {
+		s := stats[c]
+		cpuMax = max(cpuMax, s.CPUMax)
+		memMax = max(memMax, s.MemMax)
+
+		// Skip effectively unlimited containers (limit = host memory):
+		// the line would flatten every other series on the panel.
+		if s.MemLimit <= 0 || s.MemMax < s.MemLimit*0.1 {
+			continue
+		}
+		color := colorMap[c]
+		if s.MemMax >= s.MemLimit {
+			color = exceededColor
+		}
+		shapes = append(shapes, hline("x3", "y3", u.of(s.MemLimit), color, fmt.Sprintf("%s limit %s %s", c, u.format(s.MemLimit), u.Label)))
+	}
+
+	if opts.CPUThreshold > 0 {
+		color := themeFor(opts.Theme).Muted
+		if cpuMax > opts.CPUThreshold {
+			color = exceededColor
+		}
+		shapes = append(shapes, hline("x", "y", opts.CPUThreshold, color, fmt.Sprintf("threshold %.0f%%", opts.CPUThreshold)))
+	}
+	if opts.MemThresholdMB > 0 {
+		color := themeFor(opts.Theme).Muted
+		if memMax > opts.MemThresholdMB {
+			color = exceededColor
+		}
+		shapes = append(shapes, hline("x3", "y3", u.of(opts.MemThresholdMB), color, fmt.Sprintf("threshold %s %s", u.format(opts.MemThresholdMB), u.Label)))
+	}
+	return shapes
+}
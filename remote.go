@@ -0,0 +1,204 @@
+package cstats
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// csvHeaders are extra request headers ("Name: value", e.g. Authorization)
+// sent when --csv is an http(s) URL.
+var csvHeaders stringList
+
+// remoteFlags registers --csv-header on fs.
+func remoteFlags(fs *flag.FlagSet) {
+	fs.Var(&csvHeaders, "csv-header", `Request header for http(s) CSV sources, e.g. "Authorization: Bearer ..." (repeatable)`)
+}
+
+// addCSVHeaders adds the --csv-header headers to req.
+func addCSVHeaders(req *http.Request) error {
+	for _, h := range csvHeaders {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return fmt.Errorf("invalid --csv-header %q, want \"Name: value\"", h)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return nil
+}
+
+// isURL reports whether a CSV path is an http(s) URL.
+func isURL(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
+
+// localBase returns the path (without .csv) that outputs derived from a
+// capture are written next to. Remote captures are written to the current
+// directory, named after the last URL path element.
+func localBase(csvPath string) string {
+	if isURL(csvPath) {
+		if u, err := neturl.Parse(csvPath); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			return strings.TrimSuffix(path.Base(u.Path), ".csv")
+		}
+		return "remote"
+	}
+	return strings.TrimSuffix(csvPath, ".csv")
+}
+
+// remoteCSV mirrors a CSV served over HTTP. Each fetch asks only for the
+// bytes past what is already held (Range: bytes=N-), so polling a growing
+// capture transfers just the new rows, and only those are parsed.
+type remoteCSV struct {
+	url string
+
+	mu      sync.Mutex
+	data    []byte
+	modTime time.Time
+	err     error
+	gen     int // bumped when the data is replaced rather than appended to
+
+	tail    csvTail
+	tailGen int
+}
+
+var (
+	remotesMu sync.Mutex
+	remotes   = map[string]*remoteCSV{}
+)
+
+// remoteFor returns the shared mirror for url.
+func remoteFor(url string) *remoteCSV {
+	remotesMu.Lock()
+	defer remotesMu.Unlock()
+	rc, ok := remotes[url]
+	if !ok {
+		rc = &remoteCSV{url: url}
+		remotes[url] = rc
+	}
+	return rc
+}
+
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// fetch brings the mirror up to date and returns its complete rows (a
+// trailing partial line still being written is held back).
+func (rc *remoteCSV) fetch() ([]byte, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.err = rc.update()
+	if rc.err != nil {
+		return nil, rc.err
+	}
+	data := rc.data
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[:i+1]
+	}
+	return data, nil
+}
+
+// records brings the mirror up to date and returns its parsed rows,
+// parsing only what was appended since the last call.
+func (rc *remoteCSV) records() ([]record, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.err = rc.update()
+	if rc.err != nil {
+		return nil, rc.err
+	}
+	if rc.tailGen != rc.gen || !bytes.HasPrefix(rc.data, rc.tail.header) {
+		rc.tail.reset()
+		rc.tailGen = rc.gen
+	}
+	if err := rc.tail.feed(rc.data[rc.tail.offset:]); err != nil {
+		return nil, err
+	}
+	return rc.tail.rows(), nil
+}
+
+func (rc *remoteCSV) update() error {
+	req, err := http.NewRequest(http.MethodGet, rc.url, nil)
+	if err != nil {
+		return err
+	}
+	if err := addCSVHeaders(req); err != nil {
+		return err
+	}
+	// The range starts a few bytes early: if those no longer match, the
+	// file was truncated and refilled (or replaced) since the last fetch.
+	overlap := min(len(rc.data), tailMarkSize)
+	if len(rc.data) > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(rc.data)-overlap))
+	}
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Full body: first fetch, or the server ignores ranges.
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(body, rc.data) {
+			rc.gen++
+		}
+		rc.data = body
+	case http.StatusPartialContent:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(body, rc.data[len(rc.data)-overlap:]) {
+			rc.data = nil
+			rc.gen++
+			return rc.update()
+		}
+		rc.data = append(rc.data, body[overlap:]...)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The file shrank (rotated or rewritten).
+		if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok && size < int64(len(rc.data)-overlap) {
+			rc.data = nil
+			rc.gen++
+			return rc.update()
+		}
+		return nil
+	default:
+		return fmt.Errorf("GET %s: %s", rc.url, resp.Status)
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		rc.modTime = t
+	}
+	return nil
+}
+
+// contentRangeSize parses the total size from "bytes */N".
+func contentRangeSize(v string) (int64, bool) {
+	_, total, ok := strings.Cut(v, "/")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	return n, err == nil
+}
+
+// state reports the mirror like a local file for change detection.
+func (rc *remoteCSV) state() fileState {
+	if _, err := rc.fetch(); err != nil {
+		return fileState{}
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return fileState{size: int64(len(rc.data)), modTime: rc.modTime, exists: true}
+}
@@ -0,0 +1,109 @@
+package cstats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// renameRule is one sed-style s/regex/replacement/ rule.
+type renameRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// parseRenameRule parses "s/re/repl/". Any delimiter may follow the "s"
+// (s|a/b|c|), and an escaped delimiter is taken literally. The replacement
+// uses Go's $1 / ${name} syntax.
+func parseRenameRule(rule string) (renameRule, error) {
+	if len(rule) < 2 || rule[0] != 's' {
+		return renameRule{}, fmt.Errorf("invalid rename rule %q, want s/regex/replacement/", rule)
+	}
+	delim := rule[1]
+	var parts []string
+	var cur strings.Builder
+	for i := 2; i < len(rule); i++ {
+		switch {
+		case rule[i] == '\\' && i+1 < len(rule) && rule[i+1] == delim:
+			cur.WriteByte(delim)
+			i++
+		case rule[i] == delim:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(rule[i])
+		}
+	}
+	if cur.Len() > 0 || len(parts) < 2 {
+		parts = append(parts, cur.String())
+	}
+	if len(parts) != 2 {
+		return renameRule{}, fmt.Errorf("invalid rename rule %q, want s/regex/replacement/", rule)
+	}
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return renameRule{}, fmt.Errorf("rename rule %q: %w", rule, err)
+	}
+	return renameRule{re: re, repl: parts[1]}, nil
+}
+
+// loadRenameFile reads one rule per line; blank lines and # comments are
+// skipped.
+func loadRenameFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules = append(rules, line)
+	}
+	return rules, sc.Err()
+}
+
+// renameContainer applies the rules in order, each to the result of the
+// previous one, like chained sed -e expressions.
+func renameContainer(name string, rules []renameRule) string {
+	for _, r := range rules {
+		name = r.re.ReplaceAllString(name, r.repl)
+	}
+	return name
+}
+
+// seriesKeys are the --series-key choices, mapped to the capture column
+// appended to the name ("" keeps the name alone). auto, the default, is
+// namespace: pods are only unique within theirs, and captures without the
+// column keep plain names.
+var seriesKeys = map[string]string{"auto": "namespace", "name": "", "id": "container_id", "host": "host", "cluster": "cluster", "namespace": "namespace"}
+
+// keyedName appends a sample's container ID, host, cluster or namespace to
+// name, so containers that share a name (on different hosts, in different
+// clusters or namespaces, or recreated) stay apart. Captures
+// without the column keep plain names.
+func keyedName(name string, r record, key string) string {
+	if v := r.Attrs[seriesKeys[key]]; v != "" {
+		return name + " (" + v + ")"
+	}
+	return name
+}
+
+// renameRecords renames containers, keys them by --series-key, and merges
+// the series that collapse onto the same name (e.g. scaled compose
+// replicas) using agg.
+func renameRecords(records []record, rules []renameRule, key, agg string) []record {
+	if len(rules) == 0 && seriesKeys[key] == "" {
+		return records
+	}
+	return mergeRecords(records, func(r record) string {
+		return keyedName(renameContainer(r.Container, rules), r, key)
+	}, agg)
+}
@@ -0,0 +1,140 @@
+package cstats
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// reportPoints bounds the points per series of a periodic report.
+const reportPoints = 2000
+
+// reportSink renders an HTML report and a summary JSON of every period of
+// a capture into dir, for daemon --report-every. Periods are aligned to
+// multiples of every (midnight UTC for 24h) and named by their start; the
+// last one, cut short by the daemon stopping, is reported too. A daemon
+// restarted within a period picks up its earlier samples from the capture,
+// so the report of the period is rewritten whole. Samples are folded into a
+// bounded-memory summary as they come, like plot --stream.
+type reportSink struct {
+	every    time.Duration
+	dir      string
+	outfile  string
+	base     string // capture file name without .csv, prefixing the reports
+	events   string // events file of the capture
+	interval time.Duration
+
+	start, end time.Time // the current period
+	first      time.Time // first sample of the period
+	last       time.Time // last sample of the period
+	summary    *streamSummary
+	resumed    bool // the capture was read for the first period
+}
+
+func newReportSink(outfile, dir string, every, interval time.Duration) (*reportSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("--report-dir: %w", err)
+	}
+	return &reportSink{
+		every:    every,
+		dir:      dir,
+		outfile:  outfile,
+		base:     strings.TrimSuffix(filepath.Base(outfile), ".csv"),
+		events:   eventsPath(outfile),
+		interval: interval,
+	}, nil
+}
+
+func (s *reportSink) Write(r record) error {
+	var err error
+	if s.summary != nil && !r.Timestamp.Before(s.end) {
+		err = s.render()
+	}
+	if s.summary == nil {
+		s.start = r.Timestamp.Truncate(s.every)
+		s.end = s.start.Add(s.every)
+		s.first = r.Timestamp
+		s.summary = newStreamSummary(reportPoints)
+		if !s.resumed {
+			s.resumed = true
+			s.resume(r.Timestamp)
+		}
+	}
+	s.summary.add(r)
+	s.last = r.Timestamp
+	return err
+}
+
+// resume adds the samples of the capture from the start of the period up
+// to the first one written, left by an earlier run of the daemon.
+func (s *reportSink) resume(until time.Time) {
+	err := streamCSV(s.outfile, func(r record) {
+		if r.Timestamp.Before(s.start) || !r.Timestamp.Before(until) {
+			return
+		}
+		s.summary.add(r)
+		if r.Timestamp.Before(s.first) {
+			s.first = r.Timestamp
+		}
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		warnf("report: %v", err)
+	}
+}
+
+func (s *reportSink) Flush() error { return nil }
+
+// Close reports the period in progress.
+func (s *reportSink) Close() error {
+	if s.summary == nil {
+		return nil
+	}
+	return s.render()
+}
+
+// render writes the report of the current period and starts afresh.
+func (s *reportSink) render() error {
+	stats, records := s.summary.finish()
+	from, to := s.first, s.last
+	s.summary = nil
+	if len(records) == 0 {
+		return nil
+	}
+	applyInterval(stats, s.interval)
+
+	var events []event
+	all, err := loadEvents(s.events)
+	if err != nil {
+		warnf("report: %v", err)
+	}
+	for _, ev := range all {
+		if !ev.Timestamp.Before(from) && !ev.Timestamp.After(to) {
+			events = append(events, ev)
+		}
+	}
+
+	name := filepath.Join(s.dir, s.base+"-"+s.start.Format("20060102-150405"))
+	opts := FigureOptions{
+		MaxPoints: reportPoints,
+		Events:    events,
+		Stats:     stats,
+		Interval:  s.interval,
+		Meta:      [][2]string{{"from", from.Format(time.RFC3339)}, {"to", to.Format(time.RFC3339)}},
+	}
+	err = writeFigureHTML(name+".html", "auto", dashboardTitle(opts), func(theme string) map[string]any {
+		opts.Theme = theme
+		return buildFigure(records, opts)
+	})
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	if _, err := writeSummaryFiles(name, "json", containerNames(records), stats); err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	infof("report of %s to %s -> %s.html", from.Format(time.RFC3339), to.Format(time.RFC3339), name)
+	return nil
+}
@@ -0,0 +1,119 @@
+package cstats
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// metaPath is the sidecar where collectors record how a capture is taken.
+func metaPath(csvPath string) string { return csvPath + ".meta" }
+
+// writeCaptureMeta records the collector and its intended sampling interval
+// next to the capture, as key=value lines.
+func writeCaptureMeta(csvPath, collector string, interval time.Duration) error {
+	body := fmt.Sprintf("collector=%s\ninterval=%s\n", collector, interval)
+	return os.WriteFile(metaPath(csvPath), []byte(body), 0644)
+}
+
+// captureMeta returns the value of key in the sidecar of a local capture,
+// or "" when there is none (no sidecar, or a URL).
+func captureMeta(csvPath, key string) string {
+	if isURL(csvPath) {
+		return ""
+	}
+	f, err := os.Open(metaPath(csvPath))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if k, v, _ := strings.Cut(sc.Text(), "="); strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// captureInterval returns the intended sampling interval recorded for a
+// local capture, or 0 when it is unknown.
+func captureInterval(csvPath string) time.Duration {
+	if d, err := time.ParseDuration(captureMeta(csvPath, "interval")); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// captureCollector returns the collector recorded for a local capture, or
+// "" when it is unknown.
+func captureCollector(csvPath string) string {
+	return captureMeta(csvPath, "collector")
+}
+
+// applyInterval sets the intended sampling interval the coverage of each
+// container is measured against (0 keeps its median spacing).
+func applyInterval(stats map[string]*containerStats, interval time.Duration) {
+	for _, s := range stats {
+		s.Interval = interval
+	}
+}
+
+// expectedSamples is how many samples the container's time span should
+// hold at the intended interval, or at its median spacing when that is
+// unknown.
+func (s *containerStats) expectedSamples() int {
+	iv := s.Interval
+	if iv <= 0 {
+		iv = s.Spacing
+	}
+	if iv <= 0 || s.Count < 2 {
+		return s.Count
+	}
+	return int(math.Round(float64(s.Last.Sub(s.First))/float64(iv))) + 1
+}
+
+// Coverage is the percentage of expected samples present, so averages over
+// a gappy series are not mistaken for ones over the whole span.
+func (s *containerStats) Coverage() float64 {
+	e := s.expectedSamples()
+	if e == 0 {
+		return 0
+	}
+	return min(100*float64(s.Count)/float64(e), 100)
+}
+
+// Missed is how many expected samples are absent.
+func (s *containerStats) Missed() int {
+	return max(s.expectedSamples()-s.Count, 0)
+}
+
+// driftTolerance is how far the median spacing may stray from the intended
+// interval before it is reported.
+const driftTolerance = 0.1
+
+// samplingReport describes the containers sampled off their interval or
+// with missed ticks, one line each.
+func samplingReport(containers []string, stats map[string]*containerStats) []string {
+	var lines []string
+	for _, c := range containers {
+		s := stats[c]
+		var parts []string
+		if missed := s.Missed(); missed > 0 {
+			parts = append(parts, fmt.Sprintf("%.0f%% of expected samples (%d missed)", s.Coverage(), missed))
+		}
+		if s.Interval > 0 && s.Spacing > 0 {
+			drift := float64(s.Spacing-s.Interval) / float64(s.Interval)
+			if math.Abs(drift) > driftTolerance {
+				parts = append(parts, fmt.Sprintf("sampled every %s instead of %s (%+.0f%%)", s.Spacing, s.Interval, 100*drift))
+			}
+		}
+		if len(parts) > 0 {
+			lines = append(lines, c+": "+strings.Join(parts, ", "))
+		}
+	}
+	return lines
+}
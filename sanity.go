@@ -0,0 +1,98 @@
+package cstats
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Bounds beyond which a sample value cannot be real. Docker occasionally
+// reports such values (CPU deltas against a missing baseline, counters
+// wrapping), and a single one flattens every chart it lands in.
+const (
+	maxCPUPct = 100 * 1024 // a 1024-core host at full load
+	maxMemMB  = 1 << 30    // 1 PiB
+	maxMemPct = 1000
+)
+
+func finite(v float64) bool { return !math.IsNaN(v) && !math.IsInf(v, 0) }
+
+// implausible returns why the core values of a sample cannot be real, or ""
+// when they can.
+func implausible(cpuPct, memUsageMB, memLimitMB, memPct float64) string {
+	for _, c := range []struct {
+		name  string
+		v, hi float64
+	}{
+		{"cpu_pct", cpuPct, maxCPUPct},
+		{"mem_usage_mb", memUsageMB, maxMemMB},
+		{"mem_limit_mb", memLimitMB, maxMemMB},
+		{"mem_pct", memPct, maxMemPct},
+	} {
+		if !finite(c.v) || c.v < 0 || c.v > c.hi {
+			return fmt.Sprintf("%s=%g", c.name, c.v)
+		}
+	}
+	return ""
+}
+
+// noLimit maps the "unlimited" memory limits cgroups report (close to 8 EiB
+// on cgroup v1) to 0, which is how captures mark containers without one.
+func noLimit(limitMB float64) float64 {
+	if limitMB >= maxMemMB {
+		return 0
+	}
+	return limitMB
+}
+
+// scrubFigure replaces NaN and infinite numbers anywhere in a figure with
+// nulls, which Plotly draws as gaps (and encoding/json cannot encode them
+// otherwise). It returns the scrubbed value and how many it replaced.
+func scrubFigure(v any) (any, int) {
+	bad := func(f float64) bool { return !finite(f) }
+	n := 0
+	switch x := v.(type) {
+	case float64:
+		if bad(x) {
+			return nil, 1
+		}
+	case []float64:
+		if slices.ContainsFunc(x, bad) {
+			out := make([]any, len(x))
+			for i, f := range x {
+				var m int
+				out[i], m = scrubFigure(f)
+				n += m
+			}
+			return out, n
+		}
+	case [][]float64:
+		if slices.ContainsFunc(x, func(row []float64) bool { return slices.ContainsFunc(row, bad) }) {
+			out := make([]any, len(x))
+			for i, row := range x {
+				var m int
+				out[i], m = scrubFigure(row)
+				n += m
+			}
+			return out, n
+		}
+	case []any:
+		for i := range x {
+			var m int
+			x[i], m = scrubFigure(x[i])
+			n += m
+		}
+	case []map[string]any:
+		for _, t := range x {
+			_, m := scrubFigure(t)
+			n += m
+		}
+	case map[string]any:
+		for k := range x {
+			var m int
+			x[k], m = scrubFigure(x[k])
+			n += m
+		}
+	}
+	return v, n
+}
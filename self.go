@@ -0,0 +1,102 @@
+package cstats
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// selfContainer names the pseudo-container of cstats's own usage, recorded
+// with --self.
+const selfContainer = "(cstats)"
+
+// recordSelf is set by --self.
+var recordSelf bool
+
+// selfFlag registers --self on fs.
+func selfFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&recordSelf, "self", false, "Also record the CPU and memory of cstats itself, as the pseudo-container "+selfContainer+", to show its overhead")
+}
+
+// selfCollector adds a sample of this process to every Sample of the
+// collector it wraps. CPU is measured like a container's, 100% being one
+// core, over the time since the previous sample.
+type selfCollector struct {
+	collector.Collector
+	cpu time.Duration // process CPU time at the previous sample
+	at  time.Time
+}
+
+func withSelf(c collector.Collector) *selfCollector {
+	return &selfCollector{Collector: c, cpu: processCPU(), at: time.Now()}
+}
+
+func (s *selfCollector) Sample(ctx context.Context) ([]record, error) {
+	recs, err := s.Collector.Sample(ctx)
+	if err != nil {
+		return recs, err
+	}
+	return append(recs, s.sample()), nil
+}
+
+// sample reads the usage of this process.
+func (s *selfCollector) sample() record {
+	cpu, now := processCPU(), time.Now()
+	r := record{Container: selfContainer, MemUsageMB: float64(processRSS()) / (1 << 20)}
+	if wall := now.Sub(s.at); wall > 0 {
+		r.CPUPct = float64(cpu-s.cpu) / float64(wall) * 100
+	}
+	s.cpu, s.at = cpu, now
+	return r
+}
+
+// The optional interfaces of the wrapped collector are passed on.
+
+func (s *selfCollector) Reconnect(ctx context.Context) error {
+	if r, ok := s.Collector.(collector.Reconnector); ok {
+		return r.Reconnect(ctx)
+	}
+	return nil
+}
+
+func (s *selfCollector) ReportEvents(report func(event)) {
+	if r, ok := s.Collector.(collector.EventReporter); ok {
+		r.ReportEvents(report)
+	}
+}
+
+func (s *selfCollector) Close() error {
+	if closer, ok := s.Collector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// processRSS returns the resident memory of this process in bytes: from
+// /proc on Linux, else the memory the Go runtime holds from the OS.
+func processRSS() uint64 {
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if f := strings.Fields(string(data)); len(f) > 1 {
+			if pages, err := strconv.ParseUint(f[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+	samples := []metrics.Sample{{Name: "/memory/classes/total:bytes"}, {Name: "/memory/classes/heap/released:bytes"}}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// selfOverhead describes the usage of the pseudo-container for the
+// dashboard's subtitle.
+func selfOverhead(s *containerStats) string {
+	return fmt.Sprintf("CPU avg %.2f%% max %.2f%%, memory max %.1f MB", s.CPUSum/float64(s.Count), s.CPUMax, s.MemMax)
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package cstats
+
+import "time"
+
+// processCPU is unknown where neither getrusage nor GetProcessTimes exist.
+func processCPU() time.Duration {
+	return 0
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package cstats
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// processCPU returns the CPU time this process has used, user and kernel.
+func processCPU() time.Duration {
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(windows.CurrentProcess(), &creation, &exit, &kernel, &user); err != nil {
+		return 0
+	}
+	// Filetimes count 100ns intervals.
+	ticks := func(t windows.Filetime) int64 { return int64(t.HighDateTime)<<32 | int64(t.LowDateTime) }
+	return time.Duration((ticks(kernel) + ticks(user)) * 100)
+}
@@ -0,0 +1,270 @@
+package cstats
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// LiveOptions configures a LiveServer.
+type LiveOptions struct {
+	Sources        []string      // capture CSVs or URLs, served as ?source=<name>
+	EventsFile     string        // events of a single source (default: next to it)
+	Interval       time.Duration // page refresh, and polling where files cannot be watched
+	Theme          string        // dark, light or auto
+	Kiosk          bool          // pages without header or mode bar
+	FrameAncestors string        // CSP frame-ancestors of the page, when set
+	IngestToken    string        // accept POST /api/ingest with this bearer token, when set
+
+	// Stores hold sources in memory, keyed by their entry in Sources: the
+	// samples are read from the store instead of the file, which need not
+	// exist, and pages update as samples are written to it.
+	Stores map[string]*MemStore
+
+	// Figure returns the figure options for a theme and events; nil uses
+	// the defaults with MaxPoints 2000.
+	Figure func(events []collector.Event, theme string) FigureOptions
+	// View reshapes the records before they are served (renames, --top);
+	// nil serves them as captured.
+	View func([]collector.Record) []collector.Record
+}
+
+// LiveServer is the live dashboard and its JSON APIs as an http.Handler.
+// Handler leaves authentication and CORS to the caller and uses relative
+// URLs, so a Go service importing this package can mount it under a path
+// prefix with http.StripPrefix. Sources collected in the same process
+// (monitor) or given a MemStore are read from memory. Close stops watching
+// the sources.
+type LiveServer struct {
+	opts    LiveOptions
+	sources []*liveSource
+	mux     *http.ServeMux
+}
+
+// NewLiveServer starts watching the sources and sets up the routes.
+func NewLiveServer(opts LiveOptions) *LiveServer {
+	if len(opts.Sources) == 0 {
+		opts.Sources = []string{"docker-stats.csv"}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+	if opts.Theme == "" {
+		opts.Theme = "dark"
+	}
+	if opts.Figure == nil {
+		opts.Figure = func(events []event, theme string) FigureOptions {
+			return FigureOptions{MaxPoints: 2000, Events: events, Theme: theme}
+		}
+	}
+	if opts.View == nil {
+		opts.View = func(records []record) []record { return records }
+	}
+	s := &LiveServer{
+		opts:    opts,
+		sources: newLiveSources(opts.Sources, opts.Stores, opts.EventsFile, opts.Interval),
+		mux:     http.NewServeMux(),
+	}
+	s.routes()
+	return s
+}
+
+// Handler serves the page at / and the APIs under /api/.
+func (s *LiveServer) Handler() http.Handler { return s.mux }
+
+// Close stops watching the sources. Open /api/stream connections get no
+// more updates; the handler still answers other requests.
+func (s *LiveServer) Close() error {
+	for _, src := range s.sources {
+		src.close()
+	}
+	return nil
+}
+
+// load returns the current samples of a source.
+func (s *LiveServer) load(src *liveSource) []record {
+	if src.store != nil {
+		return s.opts.View(src.store.snapshot())
+	}
+	records, err := loadCSV(src.CSVPath)
+	if err != nil {
+		return nil
+	}
+	return s.opts.View(records)
+}
+
+// loadFiltered returns the samples of a source narrowed by f. For a
+// ?window= of a large capture not read in full yet, only the rows from the
+// time index entry before the window are read.
+func (s *LiveServer) loadFiltered(src *liveSource, f recordFilter) []record {
+	if f.Window > 0 && src.store == nil {
+		if records, ok := loadCSVWindow(src.CSVPath, f.Window); ok {
+			return f.apply(s.opts.View(records))
+		}
+	}
+	return f.apply(s.load(src))
+}
+
+// figureOptions returns the figure options for a source, with the stats of
+// the whole capture when it is followed with --stream and f keeps all of it.
+func (s *LiveServer) figureOptions(src *liveSource, f recordFilter, events []event, theme string) FigureOptions {
+	opts := s.opts.Figure(events, theme)
+	if stats := streamedStats(src.CSVPath); stats != nil && f.Window == 0 {
+		opts.Stats = stats
+	}
+	return opts
+}
+
+func (s *LiveServer) routes() {
+	srcs, figOpts, themeName := s.sources, s.opts.Figure, s.opts.Theme
+
+	s.mux.HandleFunc("/api/stream", withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+		streamHandler(src.watcher, src.paused.Load)(w, r)
+	}))
+	s.mux.HandleFunc("/api/pause", withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+		if r.Method == http.MethodPost {
+			paused, err := strconv.ParseBool(r.FormValue("paused"))
+			if err != nil {
+				http.Error(w, "paused must be true or false", http.StatusBadRequest)
+				return
+			}
+			src.setPaused(paused)
+		}
+		writeJSON(w, map[string]bool{"paused": src.paused.Load()})
+	}))
+
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if p != "/" && p != "/index.html" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if s.opts.FrameAncestors != "" {
+			w.Header().Set("Content-Security-Policy", "frame-ancestors "+s.opts.FrameAncestors)
+		}
+		embed := s.opts.Kiosk || r.URL.Query().Get("embed") == "1"
+		fmt.Fprint(w, liveHTML(s.opts.Interval.Seconds(), srcs, themeName, figOpts(nil, themeName), embed))
+	})
+
+	// sourceAPI adapts a handler over the selected source's records, narrowed
+	// by ?window= and ?containers=.
+	sourceAPI := func(h func(load func() []record) http.HandlerFunc) http.HandlerFunc {
+		return withGzip(withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+			withFilter(func(w http.ResponseWriter, r *http.Request, f recordFilter) {
+				h(func() []record { return s.loadFiltered(src, f) })(w, r)
+			})(w, r)
+		}))
+	}
+	s.mux.HandleFunc("/api/records", sourceAPI(recordsHandler))
+	s.mux.HandleFunc("/api/series", sourceAPI(seriesHandler))
+	s.mux.HandleFunc("/api/summary", withGzip(withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+		withFilter(func(w http.ResponseWriter, r *http.Request, f recordFilter) {
+			records := s.loadFiltered(src, f) // before the options: it feeds a --stream summary
+			summaryHandler(func() []record { return records }, s.figureOptions(src, f, nil, ""))(w, r)
+		})(w, r)
+	})))
+	s.mux.HandleFunc("/api/csv", sourceAPI(func(load func() []record) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			name := r.URL.Query().Get("source")
+			if name == "" {
+				name = srcs[0].Name
+			}
+			if v := r.URL.Query().Get("window"); v != "" && v != "all" {
+				name += "-last-" + v
+			}
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".csv"}))
+			writeCSV(w, load())
+		}
+	}))
+	s.mux.HandleFunc("/api/snapshot", withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		withFilter(func(w http.ResponseWriter, r *http.Request, f recordFilter) {
+			records := s.loadFiltered(src, f)
+			events, _ := loadEvents(src.EventsPath)
+			path := strings.TrimSuffix(src.CSVPath, ".csv") + "-snapshot-" + time.Now().Format("20060102-150405") + ".html"
+			err := writeFigureHTML(path, themeName, dashboardTitle(figOpts(nil, "")), func(theme string) map[string]any {
+				return buildFigure(records, figOpts(events, theme))
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Printf("Saved snapshot -> %s\n", path)
+			writeJSON(w, map[string]string{"path": path})
+		})(w, r)
+	}))
+	s.mux.HandleFunc("/api/mark", withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+		if isURL(src.CSVPath) {
+			http.Error(w, "cannot mark a remote source", http.StatusBadRequest)
+			return
+		}
+		markHandler(src.EventsPath)(w, r)
+	}))
+	if s.opts.IngestToken != "" {
+		in := &ingester{token: s.opts.IngestToken, sinks: map[string]*csvSink{}}
+		s.mux.HandleFunc("/api/ingest", withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+			in.handler(src)(w, r)
+		}))
+	}
+	s.mux.HandleFunc("/api/containers", withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+		writeJSON(w, containerNames(s.load(src)))
+	}))
+
+	s.mux.HandleFunc("/api/figure", withGzip(withSource(srcs, func(w http.ResponseWriter, r *http.Request, src *liveSource) {
+		start := time.Now()
+		defer timed(figuresServed, serveSeconds, start)
+		filter, err := parseRecordFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		theme := themeName
+		if v := r.URL.Query().Get("theme"); v != "" && theme == "auto" {
+			theme = v
+		}
+		points := figOpts(nil, theme).MaxPoints
+		if v := r.URL.Query().Get("points"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid points parameter", http.StatusBadRequest)
+				return
+			}
+			points = n
+		}
+		key := fmt.Sprintf("%s/%d/%s", theme, points, filter.key())
+		fig, modTime, err := src.figures.get(key, func() (any, time.Time) {
+			records := s.loadFiltered(src, filter)
+			events, _ := loadEvents(src.EventsPath)
+			opts := s.figureOptions(src, filter, events, theme)
+			opts.MaxPoints = points
+			opts.Interval = captureInterval(src.CSVPath)
+			if n := figuresBuilt.Value(); n > 0 && slices.ContainsFunc(records, func(r record) bool { return r.Container == selfContainer }) {
+				// The server's share of the overhead the pseudo-container shows.
+				opts.Meta = append(slices.Clip(opts.Meta), [2]string{"figure build", fmt.Sprintf("avg %.1f ms over %d", figureSeconds.Value()/float64(n)*1000, n)})
+			}
+			return buildFigure(records, opts), lastSample(records)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if issues := csvIssues(src.CSVPath).String(); issues != "" {
+			w.Header().Set("X-Parse-Issues", issues)
+		}
+		w.Header().Set("Server-Timing", fmt.Sprintf("figure;dur=%.1f", time.Since(start).Seconds()*1000))
+		fig.serve(w, r, modTime)
+	})))
+}
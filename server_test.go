@@ -0,0 +1,99 @@
+package cstats
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A source held in a MemStore is served without a file, and pages are told
+// of the samples written to it.
+func TestLiveServerStore(t *testing.T) {
+	store := NewMemStore(0)
+	path := filepath.Join(t.TempDir(), "api.csv")
+	srv := NewLiveServer(LiveOptions{Sources: []string{path}, Stores: map[string]*MemStore{path: store}})
+	defer srv.Close()
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	stream, err := http.Get(ts.URL + "/api/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	events := make(chan string, 10)
+	go func() {
+		sc := bufio.NewScanner(stream.Body)
+		for sc.Scan() {
+			if name, ok := strings.CutPrefix(sc.Text(), "event: "); ok {
+				events <- name
+			}
+		}
+	}()
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+	if e := next(); e != "pause" {
+		t.Fatalf("first event %q, want the paused state", e)
+	}
+	if e := next(); e != "update" {
+		t.Fatalf("second event %q, want update", e)
+	}
+
+	figure := func() string {
+		resp, err := http.Get(ts.URL + "/api/figure")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.Header.Get("ETag")
+	}
+	empty := figure()
+	store.Write(record{Timestamp: time.Unix(60, 0), Container: "web", CPUPct: 12.5, MemUsageMB: 100})
+	if e := next(); e != "update" {
+		t.Fatalf("event %q after a write, want update", e)
+	}
+	if figure() == empty {
+		t.Error("the cached figure was served after a write")
+	}
+
+	resp, err := http.Get(ts.URL + "/api/records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct{ Records []apiRecord }
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Records) != 1 || body.Records[0].Container != "web" || body.Records[0].CPUPct != 12.5 {
+		t.Errorf("records = %+v, want the one written to the store", body.Records)
+	}
+}
+
+func TestLiveServerClose(t *testing.T) {
+	dir := t.TempDir()
+	before := runtime.NumGoroutine()
+	for range 10 {
+		srv := NewLiveServer(LiveOptions{Sources: []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")}})
+		srv.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines after closing, %d before", n, before)
+	}
+}
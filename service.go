@@ -0,0 +1,358 @@
+package cstats
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// service is a daemon registered to run on boot by daemon install: a
+// systemd unit on Linux, a launchd plist on macOS, a Windows service.
+type service struct {
+	action string // install or uninstall
+	name   string
+	user   bool     // a per-user service (systemd --user, launchd agent)
+	print  bool     // print the definition instead of installing it
+	args   []string // the daemon's arguments: a collector and its flags
+	kind   string   // the collector's name, once the arguments are parsed
+}
+
+// parseService parses the flags of daemon install and uninstall.
+func parseService(action string, args []string) *service {
+	s := &service{action: action}
+	fs := newFlagSet("daemon " + action)
+	fs.StringVar(&s.name, "name", "cstats", "Service `name`")
+	fs.BoolVar(&s.user, "user", false, "A per-user service (systemd --user, a launchd agent) instead of a system one")
+	if action == "install" {
+		fs.BoolVar(&s.print, "print", false, "Print the service definition instead of installing it")
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), `Usage: cstats daemon install [flags] <collector> [daemon flags]
+
+Registers cstats daemon <collector> [daemon flags] as a service started on
+boot, run from the current directory with the global --config, if any:
+  cstats daemon install docker --interval 10 --report-every 24h
+  cstats daemon install --user -- --sources docker,kubernetes
+
+Flags:
+`)
+			fs.PrintDefaults()
+		}
+	}
+	parseFlags(fs, args)
+	s.args = fs.Args()
+	if s.name == "" || strings.ContainsAny(s.name, `/\ `) {
+		log.Fatalf("--name: want a name without spaces or slashes, got %q", s.name)
+	}
+	if action == "install" && len(s.args) == 0 {
+		log.Fatal("daemon install: name the collector to run, e.g. cstats daemon install docker --interval 10")
+	}
+	if action == "uninstall" && len(s.args) > 0 {
+		log.Fatalf("daemon uninstall: unexpected arguments %q", s.args)
+	}
+	return s
+}
+
+// command returns the arguments of cstats running the daemon; the config
+// file, if any, is passed by absolute path.
+func (s *service) command() []string {
+	var cmd []string
+	if configPath != "" {
+		abs, err := filepath.Abs(configPath)
+		if err != nil {
+			log.Fatalf("--config: %v", err)
+		}
+		cmd = append(cmd, "--config", abs)
+	}
+	if logLevelName != "info" {
+		cmd = append(cmd, "--log-level", logLevelName)
+	}
+	return append(append(cmd, "daemon"), s.args...)
+}
+
+// run installs or uninstalls the service.
+func (s *service) run() {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		log.Fatalf("daemon %s: %v", s.action, err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("daemon %s: %v", s.action, err)
+	}
+	var m serviceManager
+	switch runtime.GOOS {
+	case "linux":
+		m = systemd{s}
+	case "darwin":
+		m = launchd{s}
+	case "windows":
+		m = windowsService{s}
+	default:
+		log.Fatalf("daemon %s: services are supported on Linux (systemd), macOS (launchd) and Windows, not %s", s.action, runtime.GOOS)
+	}
+	switch {
+	case s.action == "uninstall":
+		err = m.uninstall()
+	case s.print:
+		fmt.Print(m.definition(exe, dir))
+	default:
+		err = m.install(exe, dir)
+	}
+	if errors.Is(err, fs.ErrPermission) && !s.user {
+		err = fmt.Errorf("%w (run as root, or use --user)", err)
+	}
+	if err != nil {
+		log.Fatalf("daemon %s: %v", s.action, err)
+	}
+}
+
+// serviceManager registers services with the init system of a platform.
+type serviceManager interface {
+	definition(exe, dir string) string
+	install(exe, dir string) error
+	uninstall() error
+}
+
+// serviceTool runs a command of the init system, such as systemctl.
+func serviceTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// systemd manages a unit in /etc/systemd/system, or the user's units.
+type systemd struct{ *service }
+
+func (d systemd) path() (string, error) {
+	if !d.user {
+		return filepath.Join("/etc/systemd/system", d.name+".service"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", d.name+".service"), nil
+}
+
+// systemctl runs systemctl, with --user for a user service.
+func (d systemd) systemctl(args ...string) error {
+	if d.user {
+		args = append([]string{"--user"}, args...)
+	}
+	return serviceTool("systemctl", args...)
+}
+
+func (d systemd) definition(exe, dir string) string {
+	argv := []string{systemdQuote(exe)}
+	for _, a := range d.command() {
+		argv = append(argv, systemdQuote(a))
+	}
+	target := "multi-user.target"
+	if d.user {
+		target = "default.target"
+	}
+	return fmt.Sprintf(`[Unit]
+Description=cstats daemon %s
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart=%s
+WorkingDirectory=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=%s
+`, d.kind, strings.Join(argv, " "), systemdQuote(dir), target)
+}
+
+// systemdQuote quotes an argument of a unit's command line, escaping the
+// specifiers (%) and variables ($) systemd would expand.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (d systemd) install(exe, dir string) error {
+	path, err := d.path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(d.definition(exe, dir)), 0644); err != nil {
+		return err
+	}
+	// restart rather than start, so a reinstall runs the new arguments.
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", d.name}, {"restart", d.name}} {
+		if err := d.systemctl(args...); err != nil {
+			return err
+		}
+	}
+	if d.user {
+		infof("installed %s and started it; logs: journalctl --user -u %s", path, d.name)
+		infof("user services start at login; loginctl enable-linger starts them on boot")
+	} else {
+		infof("installed %s and started it; logs: journalctl -u %s", path, d.name)
+	}
+	return nil
+}
+
+func (d systemd) uninstall() error {
+	path, err := d.path()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no service %s: %w", d.name, err)
+	}
+	if err := d.systemctl("disable", "--now", d.name); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	infof("removed %s", path)
+	return d.systemctl("daemon-reload")
+}
+
+// launchd manages a plist in /Library/LaunchDaemons, or the user's
+// LaunchAgents.
+type launchd struct{ *service }
+
+// label is the launchd label of the service, in reverse DNS unless the
+// name already has dots.
+func (d launchd) label() string {
+	if strings.Contains(d.name, ".") {
+		return d.name
+	}
+	return "com.github.saveugene." + d.name
+}
+
+func (d launchd) path() (string, error) {
+	if !d.user {
+		return filepath.Join("/Library/LaunchDaemons", d.label()+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", d.label()+".plist"), nil
+}
+
+func (d launchd) definition(exe, dir string) string {
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	var args strings.Builder
+	for _, a := range append([]string{exe}, d.command()...) {
+		fmt.Fprintf(&args, "\t\t<string>%s</string>\n", esc(a))
+	}
+	logFile := filepath.Join(dir, d.name+".log")
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, esc(d.label()), args.String(), esc(dir), esc(logFile), esc(logFile))
+}
+
+func (d launchd) install(exe, dir string) error {
+	path, err := d.path()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		// A reinstall: launchd keeps the old definition until unloaded.
+		serviceTool("launchctl", "unload", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(d.definition(exe, dir)), 0644); err != nil {
+		return err
+	}
+	if err := serviceTool("launchctl", "load", "-w", path); err != nil {
+		return err
+	}
+	infof("installed %s and started it; logs: %s", path, filepath.Join(dir, d.name+".log"))
+	return nil
+}
+
+func (d launchd) uninstall() error {
+	path, err := d.path()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no service %s: %w", d.name, err)
+	}
+	if err := serviceTool("launchctl", "unload", "-w", path); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	infof("removed %s", path)
+	return nil
+}
+
+// windowsService manages a service of the Windows service manager. The
+// service runs in the system directory, so the daemon is passed the
+// current one with --chdir.
+type windowsService struct{ *service }
+
+// windowsArgs returns the arguments of the service's command line.
+func (w windowsService) windowsArgs(dir string) []string {
+	return append(w.command(), "--chdir", dir)
+}
+
+func (w windowsService) definition(exe, dir string) string {
+	argv := []string{exe}
+	for _, a := range w.windowsArgs(dir) {
+		if strings.ContainsAny(a, " \t\"") {
+			a = `"` + strings.ReplaceAll(a, `"`, `\"`) + `"`
+		}
+		argv = append(argv, a)
+	}
+	return fmt.Sprintf("Service %s, started automatically:\n  %s\n", w.name, strings.Join(argv, " "))
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package cstats
+
+import (
+	"errors"
+	"os"
+)
+
+var errNotWindows = errors.New("Windows services are only available on Windows")
+
+func (w windowsService) install(exe, dir string) error { return errNotWindows }
+
+func (w windowsService) uninstall() error { return errNotWindows }
+
+// notifyService is a no-op outside Windows, where daemons stop on signals.
+func notifyService(sigCh chan<- os.Signal) (stopped func()) { return func() {} }
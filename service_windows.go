@@ -0,0 +1,117 @@
+//go:build windows
+
+package cstats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func (w windowsService) install(exe, dir string) error {
+	if w.user {
+		return errors.New("--user: Windows services are system-wide")
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("service manager: %w (run as Administrator)", err)
+	}
+	defer m.Disconnect()
+	s, err := m.CreateService(w.name, exe, mgr.Config{
+		DisplayName: "cstats daemon " + w.kind,
+		Description: "Collects container stats into " + dir,
+		StartType:   mgr.StartAutomatic,
+	}, w.windowsArgs(dir)...)
+	if err != nil {
+		return fmt.Errorf("%s: %w (cstats daemon uninstall --name %s removes an old one)", w.name, err, w.name)
+	}
+	defer s.Close()
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("%s: start: %w", w.name, err)
+	}
+	infof("installed service %s and started it", w.name)
+	return nil
+}
+
+func (w windowsService) uninstall() error {
+	if w.user {
+		return errors.New("--user: Windows services are system-wide")
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("service manager: %w (run as Administrator)", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(w.name)
+	if err != nil {
+		return fmt.Errorf("no service %s: %w", w.name, err)
+	}
+	defer s.Close()
+	if status, err := s.Control(svc.Stop); err == nil {
+		// Give the daemon time to flush its capture.
+		for deadline := time.Now().Add(10 * time.Second); status.State != svc.Stopped && time.Now().Before(deadline); {
+			time.Sleep(300 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("%s: %w", w.name, err)
+	}
+	infof("removed service %s", w.name)
+	return nil
+}
+
+// notifyService connects a daemon started by the Windows service manager to
+// it: stop and shutdown requests arrive on sigCh as SIGTERM. The returned
+// func reports the service stopped, once the daemon is done.
+func notifyService(sigCh chan<- os.Signal) (stopped func()) {
+	if ok, err := svc.IsWindowsService(); err != nil || !ok {
+		return func() {}
+	}
+	h := &serviceHandler{sigCh: sigCh, done: make(chan struct{})}
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := svc.Run("", h); err != nil {
+			warnf("service: %v", err)
+		}
+	}()
+	return func() {
+		close(h.done)
+		<-exited
+	}
+}
+
+// serviceHandler answers the Windows service manager.
+type serviceHandler struct {
+	sigCh chan<- os.Signal
+	done  chan struct{}
+}
+
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s <- svc.Status{State: svc.StopPending}
+				select {
+				case h.sigCh <- syscall.SIGTERM:
+				default:
+				}
+			}
+		case <-h.done:
+			return false, 0
+		}
+	}
+}
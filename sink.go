@@ -0,0 +1,176 @@
+package cstats
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/saveugene/cstats/sink"
+)
+
+// sinkQueue is the most ticks of samples queued for a remote sink.
+const sinkQueue = 64
+
+// sinkSpecs are the extra sinks given with --sink, besides --outfile.
+var sinkSpecs stringList
+
+// sinksFlag registers the repeatable --sink flag.
+func sinksFlag(fs *flag.FlagSet) {
+	var help strings.Builder
+	help.WriteString("Also send samples to `name:arg` (repeatable):")
+	for _, k := range sink.Kinds() {
+		fmt.Fprintf(&help, "\n  %s: %s", k.Name, k.Help)
+	}
+	fs.Var(&sinkSpecs, "sink", help.String())
+}
+
+// openSinks opens the sinks given with --sink. On error the ones already
+// opened are closed.
+func openSinks(cols []string) ([]sink.Sink, error) {
+	var sinks []sink.Sink
+	for _, spec := range sinkSpecs {
+		name, arg, _ := strings.Cut(spec, ":")
+		kind, ok := sink.Lookup(name)
+		var s sink.Sink
+		err := fmt.Errorf("unknown sink %q", name)
+		if ok {
+			s, err = kind.Open(arg, cols)
+		}
+		if err != nil {
+			closeSinks(sinks)
+			return nil, fmt.Errorf("--sink %s: %w", spec, err)
+		}
+		if kind.Remote {
+			s = sink.Async(name, s, sinkQueue)
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// parseSinkArgs parses a sink argument of comma-separated key=value
+// options, rejecting keys not in keys. A key may repeat.
+func parseSinkArgs(arg string, keys ...string) (url.Values, error) {
+	opts := url.Values{}
+	for _, kv := range strings.Split(arg, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("want key=value options, got %q", kv)
+		}
+		if !slices.Contains(keys, k) {
+			return nil, fmt.Errorf("unknown option %q (use %s)", k, strings.Join(keys, ", "))
+		}
+		opts.Add(k, v)
+	}
+	return opts, nil
+}
+
+// closeSinks flushes and closes sinks, returning the first error.
+func closeSinks(sinks []sink.Sink) error {
+	var errs []error
+	for _, s := range sinks {
+		errs = append(errs, s.Flush(), s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// csvSink appends samples to a capture CSV, one flushed row at a time so
+// readers never see a torn row.
+type csvSink struct {
+	f    *os.File
+	w    *csv.Writer
+	cols []string
+	// nsInName names containers "namespace/pod", for captures from before
+	// the namespace column.
+	nsInName bool
+}
+
+// implicitColumns are the optional columns collectors add without a flag.
+// Captures started before they were added lack them; samples are appended
+// to those without them.
+var implicitColumns = []string{"namespace", cpuLimitColumn}
+
+func openCSVSink(path string, cols []string) (*csvSink, error) {
+	cols, dropped := existingColumns(path, cols)
+	f, w, err := openCSV(path, cols...)
+	if err != nil {
+		return nil, err
+	}
+	if len(dropped) > 0 {
+		warnf("%s predates the %s columns: appending without them (use a new --outfile to record them)", path, strings.Join(dropped, ", "))
+	}
+	return &csvSink{f: f, w: w, cols: cols, nsInName: slices.Contains(dropped, "namespace")}, nil
+}
+
+// existingColumns returns the optional columns of the capture at path when
+// they are cols less some implicit ones, and those it lacks. Otherwise it
+// returns cols, for openCSV to refuse a capture with other columns.
+func existingColumns(path string, cols []string) (existing, dropped []string) {
+	header, err := readCSVHeader(path)
+	if err != nil || len(header) < len(csvHeader) || !slices.Equal(header[:len(csvHeader)], csvHeader) {
+		return cols, nil
+	}
+	existing = header[len(csvHeader):]
+	for _, col := range cols {
+		if slices.Contains(existing, col) {
+			continue
+		}
+		if !slices.Contains(implicitColumns, col) {
+			return cols, nil
+		}
+		dropped = append(dropped, col)
+	}
+	if len(existing)+len(dropped) != len(cols) {
+		return cols, nil
+	}
+	return existing, dropped
+}
+
+func (s *csvSink) Write(r record) error {
+	if ns := r.Attrs["namespace"]; s.nsInName && ns != "" {
+		r.Container = ns + "/" + r.Container
+	}
+	vals := make([]string, len(s.cols))
+	for i, col := range s.cols {
+		if v, ok := r.Attrs[col]; ok {
+			vals[i] = v
+		} else if v, ok := r.Extra[col]; ok {
+			vals[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	writeRow(s.w, r.Timestamp, r.Container, r.CPUPct, r.MemUsageMB, r.MemLimitMB, r.MemPct, vals...)
+	if err := s.w.Error(); err != nil {
+		return err
+	}
+	rowsWritten.Add(1)
+	return nil
+}
+
+func (s *csvSink) Flush() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvSink) Close() error { return s.f.Close() }
+
+func init() {
+	sink.Register(sink.Kind{
+		Name: "csv",
+		Help: "another capture CSV at path arg",
+		Open: func(arg string, cols []string) (sink.Sink, error) {
+			if arg == "" {
+				return nil, errors.New("missing path, want csv:path")
+			}
+			return openCSVSink(arg, cols)
+		},
+	})
+}
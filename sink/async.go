@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// asyncSink runs a sink on a goroutine of its own. The samples of a tick are
+// queued on Flush; with the queue full the oldest tick is dropped, so the
+// collection loop never waits on the network.
+type asyncSink struct {
+	name  string
+	s     Sink
+	queue chan []collector.Record
+	done  chan struct{}
+
+	tick []collector.Record // being written, not queued yet
+
+	mu      sync.Mutex
+	errs    []error // of the worker, since the last Flush
+	dropped int     // samples dropped from the full queue, since the last Flush
+}
+
+// Async wraps s, named name in errors, to write and flush on a goroutine of
+// its own, queueing up to ticks ticks of samples. Errors of the worker and
+// drops are returned by the next Flush; Close waits for the queue to drain.
+func Async(name string, s Sink, ticks int) Sink {
+	a := &asyncSink{name: name, s: s, queue: make(chan []collector.Record, max(ticks, 1)), done: make(chan struct{})}
+	go a.run()
+	return a
+}
+
+func (a *asyncSink) run() {
+	defer close(a.done)
+	for tick := range a.queue {
+		var errs []error
+		for _, r := range tick {
+			if err := a.s.Write(r); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		errs = append(errs, a.s.Flush())
+		a.report(errs...)
+	}
+}
+
+// report keeps errors of the worker for the next Flush.
+func (a *asyncSink) report(errs ...error) {
+	if err := errors.Join(errs...); err != nil {
+		a.mu.Lock()
+		a.errs = append(a.errs, err)
+		a.mu.Unlock()
+	}
+}
+
+func (a *asyncSink) Write(r collector.Record) error {
+	a.tick = append(a.tick, r)
+	return nil
+}
+
+// Flush queues the samples of the tick, dropping the oldest queued tick if
+// the sink is behind, and returns what went wrong since the last Flush.
+func (a *asyncSink) Flush() error {
+	tick := a.tick
+	a.tick = nil
+	for {
+		select {
+		case a.queue <- tick:
+			return a.takeErrs()
+		default:
+		}
+		select {
+		case old := <-a.queue:
+			a.mu.Lock()
+			a.dropped += len(old)
+			a.mu.Unlock()
+		default:
+		}
+	}
+}
+
+func (a *asyncSink) takeErrs() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	errs := a.errs
+	if a.dropped > 0 {
+		errs = append(errs, fmt.Errorf("%s is behind: %d samples dropped from its queue", a.name, a.dropped))
+	}
+	a.errs, a.dropped = nil, 0
+	return errors.Join(errs...)
+}
+
+// Close queues what is left, waits for the worker and closes the sink.
+func (a *asyncSink) Close() error {
+	if len(a.tick) > 0 {
+		a.queue <- a.tick
+		a.tick = nil
+	}
+	close(a.queue)
+	<-a.done
+	a.report(a.s.Close())
+	return a.takeErrs()
+}
@@ -0,0 +1,57 @@
+// Package sink is the plug-in point for the destinations of collected
+// samples. The capture CSV is the built-in one; others (a time-series
+// database, a message bus, ...) live in a package of their own that calls
+// Register from an init function, and are enabled with --sink name:arg in a
+// cstats built with that package (see the collector package).
+package sink
+
+import (
+	"slices"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// Sink is a destination of collected samples.
+type Sink interface {
+	// Write receives each sample as it is collected, timestamp set and
+	// optional columns in Attrs.
+	Write(r collector.Record) error
+	// Flush is called once the samples of a tick are written.
+	Flush() error
+	// Close is called when collection stops.
+	Close() error
+}
+
+// Kind describes a registered sink.
+type Kind struct {
+	Name string // as in --sink name:arg
+	Help string // one-line description for usage, including what arg is
+	// Remote marks a sink doing network I/O. It is run through Async, so a
+	// slow or unreachable endpoint does not hold up collection.
+	Remote bool
+	// Open creates the sink from the argument after the colon, for samples
+	// with the given optional columns.
+	Open func(arg string, cols []string) (Sink, error)
+}
+
+// kinds are the registered sinks, in registration order.
+var kinds []Kind
+
+// Register makes a sink available to daemon and monitor.
+func Register(k Kind) {
+	kinds = append(kinds, k)
+}
+
+// Lookup returns the sink registered under name.
+func Lookup(name string) (Kind, bool) {
+	i := slices.IndexFunc(kinds, func(k Kind) bool { return k.Name == name })
+	if i < 0 {
+		return Kind{}, false
+	}
+	return kinds[i], true
+}
+
+// Kinds returns the registered sinks, in registration order.
+func Kinds() []Kind {
+	return slices.Clone(kinds)
+}
@@ -0,0 +1,57 @@
+package cstats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVSinkAppend(t *testing.T) {
+	const old = "timestamp,container,cpu_pct,mem_usage_mb,mem_limit_mb,mem_pct,image\n" +
+		"2026-01-01T00:00:00Z,shop/web,1.00,2.00,3.00,4.00,nginx\n"
+	sample := record{Timestamp: time.Date(2026, 1, 1, 0, 0, 5, 0, time.UTC), Container: "web", CPUPct: 1, MemUsageMB: 2, MemLimitMB: 3, MemPct: 4,
+		Attrs: map[string]string{"namespace": "shop", "image": "nginx"}, Extra: map[string]float64{cpuLimitColumn: 500}}
+	tests := []struct {
+		name    string
+		capture string
+		cols    []string
+		want    string // rows appended, or the error
+	}{
+		{name: "new capture", cols: []string{"namespace", "image", cpuLimitColumn},
+			want: "timestamp,container,cpu_pct,mem_usage_mb,mem_limit_mb,mem_pct,namespace,image,cpu_limit_m\n" +
+				"2026-01-01T00:00:05Z,web,1.00,2.00,3.00,4.00,shop,nginx,500\n"},
+		{name: "same columns", capture: "timestamp,container,cpu_pct,mem_usage_mb,mem_limit_mb,mem_pct,namespace,image,cpu_limit_m\n",
+			cols: []string{"namespace", "image", cpuLimitColumn}, want: "2026-01-01T00:00:05Z,web,1.00,2.00,3.00,4.00,shop,nginx,500\n"},
+		{name: "before the namespace column", capture: old, cols: []string{"namespace", "image", cpuLimitColumn},
+			want: "2026-01-01T00:00:05Z,shop/web,1.00,2.00,3.00,4.00,nginx\n"},
+		{name: "requested column missing", capture: old, cols: []string{"namespace", "image", "container_id"},
+			want: "use a new --outfile"},
+		{name: "column no longer recorded", capture: old, cols: []string{"namespace"},
+			want: "use a new --outfile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "capture.csv")
+			if tt.capture != "" {
+				os.WriteFile(path, []byte(tt.capture), 0o644)
+			}
+			s, err := openCSVSink(path, tt.cols)
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("err = %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err := s.Write(sample); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			b, _ := os.ReadFile(path)
+			if got := strings.TrimPrefix(string(b), tt.capture); got != tt.want {
+				t.Errorf("appended %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package cstats
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/saveugene/cstats/collector"
+)
+
+// sourceSet holds the flags of every collector for daemon --sources, each
+// registered on the daemon's flag set prefixed with the collector's name
+// (--docker.labels, --kubernetes.namespace). A source also reads its flags
+// from the [daemon <name>] section of --config.
+type sourceSet struct {
+	main  *flag.FlagSet
+	fs    map[string]*flag.FlagSet // by collector name
+	build map[string]func(ctx context.Context) (collector.Collector, error)
+	kinds []collector.Kind // by resolve
+}
+
+func newSourceSet(fs *flag.FlagSet) *sourceSet {
+	s := &sourceSet{main: fs, fs: map[string]*flag.FlagSet{}, build: map[string]func(ctx context.Context) (collector.Collector, error){}}
+	for _, k := range collector.Kinds() {
+		sub := flag.NewFlagSet("daemon "+k.Name, flag.ContinueOnError)
+		s.build[k.Name] = k.Flags(sub)
+		s.fs[k.Name] = sub
+		sub.VisitAll(func(f *flag.Flag) {
+			fs.Var(f.Value, k.Name+"."+f.Name, f.Usage)
+		})
+	}
+	return s
+}
+
+// resolve picks the comma-separated sources for collector and returns the
+// kind describing them together.
+func (s *sourceSet) resolve(sources string) (collector.Kind, error) {
+	s.kinds = nil
+	for _, name := range strings.Split(sources, ",") {
+		k, ok := collector.Lookup(strings.TrimSpace(name))
+		if !ok {
+			return collector.Kind{}, fmt.Errorf("--sources: unknown source %q (use %s)", name, strings.ReplaceAll(collectorNames(), "|", ", "))
+		}
+		if slices.ContainsFunc(s.kinds, func(o collector.Kind) bool { return o.Name == k.Name }) {
+			return collector.Kind{}, fmt.Errorf("--sources: %s is listed twice", k.Name)
+		}
+		s.kinds = append(s.kinds, k)
+	}
+	var names, titles, backends []string
+	for _, k := range s.kinds {
+		names = append(names, k.Name)
+		titles = append(titles, k.Title)
+		backends = append(backends, k.Backend)
+	}
+	return collector.Kind{
+		Name:    strings.Join(names, "+"),
+		Title:   strings.Join(titles, " + "),
+		Backend: strings.Join(backends, " and "),
+		Outfile: strings.Join(names, "-") + "-stats.csv",
+	}, nil
+}
+
+// collector builds the collectors of the resolved sources into one, naming
+// the source of each sample in the source column.
+func (s *sourceSet) collector(ctx context.Context) (collector.Collector, error) {
+	m := &multiCollector{what: "source", tag: "source"}
+	for _, k := range s.kinds {
+		// The values are shared with the daemon's flag set, which knows
+		// which were given.
+		given := map[string]bool{}
+		s.main.Visit(func(f *flag.Flag) {
+			if name, ok := strings.CutPrefix(f.Name, k.Name+"."); ok {
+				given[name] = true
+			}
+		})
+		if err := applyConfigExcept(s.fs[k.Name], given); err != nil {
+			m.Close()
+			return nil, err
+		}
+		c, err := s.build[k.Name](ctx)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("%s: %w", k.Name, err)
+		}
+		m.add(k.Name, c)
+	}
+	return m, nil
+}
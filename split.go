@@ -0,0 +1,67 @@
+package cstats
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// splitSink writes each sample to a capture of its own per value of a
+// column as well, <outfile>-<value>.csv, opening them as values appear.
+// Samples without the column only go to the main capture.
+type splitSink struct {
+	base      string // outfile without .csv
+	col       string
+	cols      []string
+	collector string
+	interval  time.Duration
+	files     map[string]*csvSink
+}
+
+func newSplitSink(outfile, col string, cols []string, collector string, interval time.Duration) *splitSink {
+	return &splitSink{
+		base:      strings.TrimSuffix(outfile, ".csv"),
+		col:       col,
+		cols:      cols,
+		collector: collector,
+		interval:  interval,
+		files:     map[string]*csvSink{},
+	}
+}
+
+func (s *splitSink) Write(r record) error {
+	v := r.Attrs[s.col]
+	if v == "" {
+		return nil
+	}
+	f := s.files[v]
+	if f == nil {
+		path := s.base + "-" + pageSlug(v) + ".csv"
+		var err error
+		if f, err = openCSVSink(path, s.cols); err != nil {
+			return err
+		}
+		if err := writeCaptureMeta(path, s.collector, s.interval); err != nil {
+			warnf("capture metadata: %v", err)
+		}
+		logf("split: %s=%s -> %s", s.col, v, path)
+		s.files[v] = f
+	}
+	return f.Write(r)
+}
+
+func (s *splitSink) Flush() error {
+	var errs []error
+	for _, f := range s.files {
+		errs = append(errs, f.Flush())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *splitSink) Close() error {
+	var errs []error
+	for _, f := range s.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
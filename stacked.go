@@ -0,0 +1,107 @@
+package cstats
+
+import (
+	"sort"
+	"time"
+)
+
+// stackedTraces renders CPU and RAM as stacked areas (one band per
+// container) plus a total line. Series are aligned on the union of all
+// sample timestamps (missing samples count as 0) and downsampled with the
+// same indices so the bands stay stackable.
+func stackedTraces(containers []string, grouped map[string][]record, colorMap map[string]string, maxPoints int, th theme, u memUnit) []map[string]any {
+	tsSet := map[time.Time]bool{}
+	for _, recs := range grouped {
+		for _, r := range recs {
+			tsSet[r.Timestamp] = true
+		}
+	}
+	grid := make([]time.Time, 0, len(tsSet))
+	for ts := range tsSet {
+		grid = append(grid, ts)
+	}
+	sort.Slice(grid, func(i, j int) bool { return grid[i].Before(grid[j]) })
+	pos := make(map[time.Time]int, len(grid))
+	for i, ts := range grid {
+		pos[ts] = i
+	}
+
+	cpu := make(map[string][]float64, len(containers))
+	mem := make(map[string][]float64, len(containers))
+	cpuTotal := make([]float64, len(grid))
+	memTotal := make([]float64, len(grid))
+	for _, c := range containers {
+		cpu[c] = make([]float64, len(grid))
+		mem[c] = make([]float64, len(grid))
+		for _, r := range grouped[c] {
+			i := pos[r.Timestamp]
+			cpu[c][i] = r.CPUPct
+			mem[c][i] = r.MemUsageMB
+			cpuTotal[i] += r.CPUPct
+			memTotal[i] += r.MemUsageMB
+		}
+	}
+
+	// Pick indices from the CPU total; peaks in the total are kept.
+	xs := make([]float64, len(grid))
+	for i, ts := range grid {
+		xs[i] = float64(ts.UnixMilli())
+	}
+	idx := lttb(xs, cpuTotal, maxPoints)
+	timestamps := make([]string, len(idx))
+	for k, i := range idx {
+		timestamps[k] = grid[i].Format(time.RFC3339)
+	}
+	pick := func(vals []float64, per float64) []float64 {
+		out := make([]float64, len(idx))
+		for k, i := range idx {
+			out[k] = vals[i] / per
+		}
+		return out
+	}
+
+	var traces []map[string]any
+	panels := []struct {
+		group        string
+		series       map[string][]float64
+		total        []float64
+		hover        string
+		per          float64
+		xaxis, yaxis string
+	}{
+		{"cpu", cpu, cpuTotal, "CPU: %{y:.1f}%", 1, "x", "y"},
+		{"mem", mem, memTotal, "RAM: " + u.hover(), u.Per, "x3", "y3"},
+	}
+	for p, panel := range panels {
+		for _, c := range containers {
+			traces = append(traces, map[string]any{
+				"type":          "scatter",
+				"x":             timestamps,
+				"y":             pick(panel.series[c], panel.per),
+				"name":          c,
+				"legendgroup":   c,
+				"showlegend":    p == 0,
+				"mode":          "lines",
+				"stackgroup":    panel.group,
+				"line":          map[string]any{"color": colorMap[c], "width": 0.5},
+				"hovertemplate": "%{x|%H:%M:%S}<br>" + panel.hover + "<extra>" + c + "</extra>",
+				"xaxis":         panel.xaxis,
+				"yaxis":         panel.yaxis,
+			})
+		}
+		traces = append(traces, map[string]any{
+			"type":          "scatter",
+			"x":             timestamps,
+			"y":             pick(panel.total, panel.per),
+			"name":          "total",
+			"legendgroup":   "total",
+			"showlegend":    p == 0,
+			"mode":          "lines",
+			"line":          map[string]any{"color": th.Foreground, "width": 1.5, "dash": "dot"},
+			"hovertemplate": "%{x|%H:%M:%S}<br>Total " + panel.hover + "<extra>total</extra>",
+			"xaxis":         panel.xaxis,
+			"yaxis":         panel.yaxis,
+		})
+	}
+	return traces
+}
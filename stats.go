@@ -0,0 +1,514 @@
+package cstats
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type containerStats struct {
+	CPUMax    float64
+	CPUSum    float64
+	MemMax    float64
+	MemSum    float64
+	MemPctMax float64
+	MemLimit  float64
+	Count     int
+
+	// CPULimitM is the largest CPU limit recorded, in millicores, when
+	// cpu_pct is a percentage of it (CPUOfLimit, see cpuLimitColumn).
+	CPULimitM  float64
+	CPUOfLimit bool
+
+	CPUP50, CPUP95, CPUP99 float64
+	MemP50, MemP95, MemP99 float64
+
+	// Integrated consumption over the capture, and its estimated cost when
+	// unit prices were supplied (Priced).
+	CPUCoreSeconds float64
+	MemMBHours     float64
+	Cost           float64
+	Priced         bool
+
+	// Budget is OK, WARN or FAIL against the --budgets file, "-" for a
+	// container no budget covers and "" without budgets.
+	Budget string
+
+	// Rec is the right-sizing recommendation, when requested.
+	Rec *recommendation
+
+	// Images are the image references the samples recorded, with the image
+	// ID when there is one, in order of appearance: more than one when the
+	// container was updated during the capture, even to the same tag. ImageCol is set on every container when any has one (see
+	// markImages).
+	Images   []string
+	ImageCol bool
+
+	// First and Last bound the samples in time; Spacing is their median
+	// interval and Interval the intended one, when known (see Coverage).
+	First, Last time.Time
+	Spacing     time.Duration
+	Interval    time.Duration
+
+	cpuVals []float64
+	memVals []float64
+}
+
+func (s *containerStats) add(r record) {
+	s.accumulate(r)
+	s.cpuVals = append(s.cpuVals, r.CPUPct)
+	s.memVals = append(s.memVals, r.MemUsageMB)
+}
+
+// accumulate updates the running totals and peaks, everything but the
+// samples kept for percentiles.
+func (s *containerStats) accumulate(r record) {
+	s.CPUSum += r.CPUPct
+	if r.CPUPct > s.CPUMax {
+		s.CPUMax = r.CPUPct
+	}
+	s.MemSum += r.MemUsageMB
+	if r.MemUsageMB > s.MemMax {
+		s.MemMax = r.MemUsageMB
+	}
+	if r.MemPct > s.MemPctMax {
+		s.MemPctMax = r.MemPct
+	}
+	if r.MemLimitMB > s.MemLimit {
+		s.MemLimit = r.MemLimitMB
+	}
+	if lim, ok := r.Extra[cpuLimitColumn]; ok {
+		s.CPUOfLimit = true
+		s.CPULimitM = max(s.CPULimitM, lim)
+	}
+	img := r.Attrs["image"]
+	if id := r.Attrs["image_id"]; img != "" && id != "" {
+		img += " (" + id + ")"
+	}
+	if img != "" && !slices.Contains(s.Images, img) {
+		s.Images = append(s.Images, img)
+	}
+	if s.Count == 0 || r.Timestamp.Before(s.First) {
+		s.First = r.Timestamp
+	}
+	if r.Timestamp.After(s.Last) {
+		s.Last = r.Timestamp
+	}
+	s.Count++
+}
+
+// finish computes the percentiles from the collected samples.
+func (s *containerStats) finish() {
+	sort.Float64s(s.cpuVals)
+	sort.Float64s(s.memVals)
+	s.CPUP50 = percentile(s.cpuVals, 50)
+	s.CPUP95 = percentile(s.cpuVals, 95)
+	s.CPUP99 = percentile(s.cpuVals, 99)
+	s.MemP50 = percentile(s.memVals, 50)
+	s.MemP95 = percentile(s.memVals, 95)
+	s.MemP99 = percentile(s.memVals, 99)
+}
+
+func (s *containerStats) CPUAvg() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.CPUSum / float64(s.Count)
+}
+
+func (s *containerStats) MemAvg() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.MemSum / float64(s.Count)
+}
+
+// computeStats aggregates records into per-container summary stats.
+func computeStats(records []record) map[string]*containerStats {
+	stats := map[string]*containerStats{}
+	for _, r := range records {
+		s, ok := stats[r.Container]
+		if !ok {
+			s = &containerStats{}
+			stats[r.Container] = s
+		}
+		s.add(r)
+	}
+	for _, s := range stats {
+		s.finish()
+	}
+	for c, recs := range groupByContainer(records) {
+		stats[c].CPUCoreSeconds, stats[c].MemMBHours = integrate(recs)
+		ts := make([]time.Time, len(recs))
+		for i, r := range recs {
+			ts[i] = r.Timestamp
+		}
+		stats[c].Spacing = medianInterval(ts)
+	}
+	markImages(stats)
+	return stats
+}
+
+// markImages sets ImageCol on all stats when any container recorded its
+// image, so every summary row has the Image column.
+func markImages(stats map[string]*containerStats) {
+	found := anyImages(stats)
+	for _, s := range stats {
+		s.ImageCol = found
+	}
+}
+
+// anyImages reports whether any container recorded its image.
+func anyImages(stats map[string]*containerStats) bool {
+	for _, s := range stats {
+		if len(s.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// image is the Image column: the images the container ran, comma-separated.
+func (s *containerStats) image() string {
+	return strings.Join(s.Images, ", ")
+}
+
+// integrate computes CPU core-seconds and MB-hours over time-ordered samples
+// using the trapezoidal rule. Intervals longer than 3x the median spacing
+// are treated as gaps (container stopped, collector down) and skipped.
+func integrate(recs []record) (coreSeconds, mbHours float64) {
+	if len(recs) < 2 {
+		return 0, 0
+	}
+	dts := make([]float64, len(recs)-1)
+	for i := 1; i < len(recs); i++ {
+		dts[i-1] = recs[i].Timestamp.Sub(recs[i-1].Timestamp).Seconds()
+	}
+	sorted := slices.Clone(dts)
+	sort.Float64s(sorted)
+	maxDT := 3 * percentile(sorted, 50)
+
+	for i, dt := range dts {
+		if dt <= 0 || dt > maxDT {
+			continue
+		}
+		a, b := recs[i], recs[i+1]
+		coreSeconds += (cores(a) + cores(b)) / 2 * dt
+		mbHours += (a.MemUsageMB + b.MemUsageMB) / 2 * dt / 3600
+	}
+	return coreSeconds, mbHours
+}
+
+// cores is the CPU a sample used, in cores: cpu_pct is a percentage of one
+// core, or of the CPU limit in samples recording one.
+func cores(r record) float64 {
+	if lim, ok := r.Extra[cpuLimitColumn]; ok {
+		return r.CPUPct / 100 * lim / 1000
+	}
+	return r.CPUPct / 100
+}
+
+// pricing holds optional unit prices for the estimated cost column.
+type pricing struct {
+	CPUCoreHour float64
+	GBHour      float64
+}
+
+// pricingFlags registers --price-cpu-hour and --price-gb-hour on fs.
+func pricingFlags(fs *flag.FlagSet) *pricing {
+	p := &pricing{}
+	fs.Float64Var(&p.CPUCoreHour, "price-cpu-hour", 0, "Price per CPU core-hour for the estimated cost column")
+	fs.Float64Var(&p.GBHour, "price-gb-hour", 0, "Price per GB-hour of memory for the estimated cost column")
+	return p
+}
+
+// applyPricing fills in the estimated cost when any unit price is set.
+func applyPricing(stats map[string]*containerStats, p pricing) {
+	if p.CPUCoreHour <= 0 && p.GBHour <= 0 {
+		return
+	}
+	for _, s := range stats {
+		s.Cost = s.CPUCoreSeconds/3600*p.CPUCoreHour + s.MemMBHours/1024*p.GBHour
+		s.Priced = true
+	}
+}
+
+// percentile returns the p-th percentile (0-100) of an ascending slice,
+// interpolating linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if lo == hi {
+		return sorted[lo]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// containerNames returns the sorted unique container names in records.
+func containerNames(records []record) []string {
+	seen := map[string]bool{}
+	for _, r := range records {
+		seen[r.Container] = true
+	}
+	containers := make([]string, 0, len(seen))
+	for c := range seen {
+		containers = append(containers, c)
+	}
+	sort.Strings(containers)
+	return containers
+}
+
+// groupByContainer splits records per container, each sorted by timestamp.
+func groupByContainer(records []record) map[string][]record {
+	grouped := map[string][]record{}
+	for _, r := range records {
+		grouped[r.Container] = append(grouped[r.Container], r)
+	}
+	for _, recs := range grouped {
+		sort.Slice(recs, func(i, j int) bool {
+			return recs[i].Timestamp.Before(recs[j].Timestamp)
+		})
+	}
+	return grouped
+}
+
+// summaryHeader is shared by the HTML table, the TUI table and `cstats summary`.
+var summaryHeader = []string{
+	"Container",
+	"CPU avg%", "CPU p50%", "CPU p95%", "CPU p99%", "CPU max%",
+	"RAM avg MB", "RAM p50 MB", "RAM p95 MB", "RAM p99 MB", "RAM max MB",
+	"Mem max%", "CPU core-s", "RAM MB-h", "Coverage",
+}
+
+// summaryHeaderFor returns summaryHeader in the memory unit of stats, plus
+// the optional cost and recommendation columns present in stats.
+func summaryHeaderFor(stats map[string]*containerStats) []string {
+	u := statsMemUnit(stats)
+	header := make([]string, len(summaryHeader))
+	for i, h := range summaryHeader {
+		header[i] = u.label(h)
+	}
+	for _, s := range stats {
+		// Optional columns are applied to all containers alike.
+		if s.Priced {
+			header = append(header, "Est. cost")
+		}
+		if s.Budget != "" {
+			header = append(header, "Budget")
+		}
+		if s.Rec != nil {
+			header = append(header, recommendHeader...)
+		}
+		if s.ImageCol {
+			header = append(header, "Image")
+		}
+		break
+	}
+	return header
+}
+
+// summaryRow formats one container's stats in summaryHeaderFor order, memory
+// in u.
+func summaryRow(name string, s *containerStats, u memUnit) []string {
+	row := []string{
+		name,
+		fmt.Sprintf("%.1f", s.CPUAvg()),
+		fmt.Sprintf("%.1f", s.CPUP50),
+		fmt.Sprintf("%.1f", s.CPUP95),
+		fmt.Sprintf("%.1f", s.CPUP99),
+		fmt.Sprintf("%.1f", s.CPUMax),
+		u.format(s.MemAvg()),
+		u.format(s.MemP50),
+		u.format(s.MemP95),
+		u.format(s.MemP99),
+		u.format(s.MemMax),
+		fmt.Sprintf("%.2f", s.MemPctMax),
+		fmt.Sprintf("%.1f", s.CPUCoreSeconds),
+		u.format(s.MemMBHours),
+		fmt.Sprintf("%.0f%%", s.Coverage()),
+	}
+	if s.Priced {
+		row = append(row, fmt.Sprintf("%.4f", s.Cost))
+	}
+	if s.Budget != "" {
+		row = append(row, s.Budget)
+	}
+	if s.Rec != nil {
+		row = append(row, s.Rec.cells()...)
+	}
+	if s.ImageCol {
+		row = append(row, s.image())
+	}
+	return row
+}
+
+// statsTracker keeps per-container stats current for a capture that only
+// grows, so a refresh aggregates just the appended records. It relies on
+// loadLocalCSV appending to the same slice: anything else (a rewritten file,
+// a filtered view, out-of-order samples) rebuilds from scratch.
+type statsTracker struct {
+	base      *record // &records[0] of the previous call
+	n         int
+	stats     map[string]*containerStats
+	integrals map[string]*integrator
+}
+
+// update returns the stats for records, aggregating only what was appended
+// since the previous call.
+func (t *statsTracker) update(records []record) map[string]*containerStats {
+	if len(records) == 0 {
+		*t = statsTracker{}
+		return map[string]*containerStats{}
+	}
+	appended := t.stats != nil && &records[0] == t.base && len(records) >= t.n
+	if !appended || !t.add(records[t.n:]) {
+		t.rebuild(records)
+	}
+	t.base, t.n = &records[0], len(records)
+	markImages(t.stats)
+	return t.stats
+}
+
+// rebuild aggregates records from scratch.
+func (t *statsTracker) rebuild(records []record) {
+	t.stats = map[string]*containerStats{}
+	t.integrals = map[string]*integrator{}
+	for _, recs := range groupByContainer(records) {
+		t.add(recs)
+	}
+}
+
+// add folds new records into the stats. It reports false, leaving the
+// tracker to be rebuilt, when a record is older than its container's latest.
+func (t *statsTracker) add(records []record) bool {
+	sorted := map[string]int{} // samples already in order, per changed container
+	for _, r := range records {
+		s, ok := t.stats[r.Container]
+		if !ok {
+			s = &containerStats{}
+			t.stats[r.Container] = s
+			t.integrals[r.Container] = &integrator{}
+		}
+		if !t.integrals[r.Container].add(r) {
+			return false
+		}
+		if _, ok := sorted[r.Container]; !ok {
+			sorted[r.Container] = s.Count
+		}
+		s.add(r)
+	}
+	for c, n := range sorted {
+		s := t.stats[c]
+		// Merge the new samples in so finish does not re-sort everything.
+		s.cpuVals = mergeSorted(s.cpuVals, n)
+		s.memVals = mergeSorted(s.memVals, n)
+		s.finish()
+		s.CPUCoreSeconds, s.MemMBHours = t.integrals[c].totals()
+		s.Spacing = t.integrals[c].spacing()
+	}
+	return true
+}
+
+// mergeSorted sorts vals given that vals[:n] already is.
+func mergeSorted(vals []float64, n int) []float64 {
+	slices.Sort(vals[n:])
+	if n == 0 || n == len(vals) || vals[n-1] <= vals[n] {
+		return vals
+	}
+	// Merge from the back; only the (short) tail needs a copy.
+	tail := slices.Clone(vals[n:])
+	i, j := n-1, len(tail)-1
+	for k := len(vals) - 1; j >= 0; k-- {
+		if i >= 0 && vals[i] > tail[j] {
+			vals[k] = vals[i]
+			i--
+		} else {
+			vals[k] = tail[j]
+			j--
+		}
+	}
+	return vals
+}
+
+// integrator is integrate for one container's samples arriving in time
+// order: intervals are summed as they come and only re-summed when the gap
+// threshold (3x the median spacing) moves.
+type integrator struct {
+	prev      record
+	started   bool
+	intervals []interval
+	dts       []float64 // sorted up to sortedN
+	sortedN   int
+	maxDT     float64
+	cpu, mem  float64
+}
+
+// interval is the spacing and trapezoid areas between two samples.
+type interval struct {
+	dt, cpu, mem float64
+}
+
+// add appends r; it reports false if r is older than the previous sample.
+func (g *integrator) add(r record) bool {
+	if !g.started {
+		g.prev, g.started = r, true
+		return true
+	}
+	if r.Timestamp.Before(g.prev.Timestamp) {
+		return false
+	}
+	a := g.prev
+	dt := r.Timestamp.Sub(a.Timestamp).Seconds()
+	iv := interval{
+		dt:  dt,
+		cpu: (cores(a) + cores(r)) / 2 * dt,
+		mem: (a.MemUsageMB + r.MemUsageMB) / 2 * dt / 3600,
+	}
+	g.intervals = append(g.intervals, iv)
+	g.dts = append(g.dts, dt)
+	if g.include(iv) {
+		g.cpu += iv.cpu
+		g.mem += iv.mem
+	}
+	g.prev = r
+	return true
+}
+
+// spacing returns the median interval of the samples added; call after
+// totals, which sorts them.
+func (g *integrator) spacing() time.Duration {
+	return time.Duration(percentile(g.dts, 50) * float64(time.Second))
+}
+
+func (g *integrator) include(iv interval) bool {
+	return iv.dt > 0 && iv.dt <= g.maxDT
+}
+
+// totals returns core-seconds and MB-hours, re-summing when the threshold
+// changed since the intervals were added.
+func (g *integrator) totals() (coreSeconds, mbHours float64) {
+	g.dts = mergeSorted(g.dts, g.sortedN)
+	g.sortedN = len(g.dts)
+	if maxDT := 3 * percentile(g.dts, 50); maxDT != g.maxDT {
+		g.maxDT = maxDT
+		g.cpu, g.mem = 0, 0
+		for _, iv := range g.intervals {
+			if g.include(iv) {
+				g.cpu += iv.cpu
+				g.mem += iv.mem
+			}
+		}
+	}
+	return g.cpu, g.mem
+}
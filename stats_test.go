@@ -0,0 +1,63 @@
+package cstats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{name: "empty", p: 50, want: 0},
+		{name: "single sample", sorted: []float64{7}, p: 99, want: 7},
+		{name: "minimum", sorted: []float64{1, 2, 3, 4}, p: 0, want: 1},
+		{name: "maximum", sorted: []float64{1, 2, 3, 4}, p: 100, want: 4},
+		{name: "exact rank", sorted: []float64{10, 20, 30}, p: 50, want: 20},
+		{name: "between ranks", sorted: []float64{1, 2, 3, 4}, p: 50, want: 2.5},
+		{name: "p95 interpolates", sorted: []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, p: 95, want: 95},
+		{name: "p99 of a flat series", sorted: []float64{5, 5, 5, 5}, p: 99, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+// The summary percentiles are per container and do not depend on the order
+// samples arrive in.
+func TestComputeStatsPercentiles(t *testing.T) {
+	var records []record
+	for i, cpu := range []float64{40, 10, 30, 20, 0} {
+		ts := time.Unix(int64(60*i), 0)
+		records = append(records,
+			record{Timestamp: ts, Container: "web", CPUPct: cpu, MemUsageMB: 100 + cpu},
+			record{Timestamp: ts, Container: "db", CPUPct: 99, MemUsageMB: 500})
+	}
+	stats := computeStats(records)
+	tests := []struct {
+		container     string
+		p50, p95, p99 float64
+		memP50        float64
+	}{
+		{container: "web", p50: 20, p95: 38, p99: 39.6, memP50: 120},
+		{container: "db", p50: 99, p95: 99, p99: 99, memP50: 500},
+	}
+	for _, tt := range tests {
+		s := stats[tt.container]
+		if s.CPUP50 != tt.p50 || s.CPUP95 != tt.p95 || !approx(s.CPUP99, tt.p99) || s.MemP50 != tt.memP50 {
+			t.Errorf("%s: cpu p50/p95/p99 %v/%v/%v mem p50 %v, want %v/%v/%v %v",
+				tt.container, s.CPUP50, s.CPUP95, s.CPUP99, s.MemP50, tt.p50, tt.p95, tt.p99, tt.memP50)
+		}
+	}
+}
+
+func approx(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
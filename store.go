@@ -0,0 +1,122 @@
+package cstats
+
+import (
+	"flag"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+// retention is the --window of long-running modes: when set, only the
+// samples of the last retention are kept in memory (the CSV still has the
+// full history).
+var retention time.Duration
+
+// retentionFlag registers --window on fs.
+func retentionFlag(fs *flag.FlagSet) {
+	fs.DurationVar(&retention, "window", 0, "Keep only the last window of samples in memory, e.g. 2h (0 = the whole capture)")
+}
+
+// sampleRing is a growable ring buffer of one container's samples, oldest
+// first.
+type sampleRing struct {
+	buf  []record
+	head int // index of the oldest sample
+	n    int
+}
+
+func (r *sampleRing) push(rec record) {
+	if r.n == len(r.buf) {
+		buf := make([]record, max(16, 2*len(r.buf)))
+		for i := range r.n {
+			buf[i] = r.buf[(r.head+i)%len(r.buf)]
+		}
+		r.buf, r.head = buf, 0
+	}
+	r.buf[(r.head+r.n)%len(r.buf)] = rec
+	r.n++
+}
+
+// insert puts a sample that is not newer than the newest held in its place,
+// combining it with a sample of the same time. It reports which of the two
+// happened.
+func (r *sampleRing) insert(rec record) (unordered, dup bool) {
+	samples := make([]record, r.n, r.n+1)
+	for i := range r.n {
+		samples[i] = r.buf[(r.head+i)%len(r.buf)]
+	}
+	i := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(rec.Timestamp) })
+	if i < len(samples) && samples[i].Timestamp.Equal(rec.Timestamp) {
+		samples[i] = combineDuplicate(samples[i], rec, 1)
+		dup = true
+	} else {
+		samples = slices.Insert(samples, i, rec)
+		unordered = true
+	}
+	r.buf, r.head, r.n = samples, 0, len(samples)
+	return unordered, dup
+}
+
+// dropBefore evicts the oldest samples taken before t.
+func (r *sampleRing) dropBefore(t time.Time) {
+	for r.n > 0 && r.buf[r.head].Timestamp.Before(t) {
+		r.buf[r.head] = record{}
+		r.head = (r.head + 1) % len(r.buf)
+		r.n--
+	}
+}
+
+// seriesStore keeps the samples of the last window per container (by
+// sampleKey). Each
+// ring only grows to what the window holds at the sampling rate, so memory
+// stays flat however long a capture runs.
+type seriesStore struct {
+	window time.Duration
+	latest time.Time
+	series map[string]*sampleRing
+}
+
+func newSeriesStore(window time.Duration) *seriesStore {
+	return &seriesStore{window: window, series: map[string]*sampleRing{}}
+}
+
+// add stores a sample. Samples older than the newest of their container
+// are put in order and duplicates combined, which add reports.
+func (s *seriesStore) add(rec record) (unordered, dup bool) {
+	key := sampleKey(rec)
+	ring, ok := s.series[key]
+	if !ok {
+		ring = &sampleRing{}
+		s.series[key] = ring
+	}
+	if ring.n > 0 && !rec.Timestamp.After(ring.buf[(ring.head+ring.n-1)%len(ring.buf)].Timestamp) {
+		unordered, dup = ring.insert(rec)
+	} else {
+		ring.push(rec)
+	}
+	if rec.Timestamp.After(s.latest) {
+		s.latest = rec.Timestamp
+	}
+	ring.dropBefore(s.latest.Add(-s.window))
+	return unordered, dup
+}
+
+// records evicts what fell out of the window, dropping containers with no
+// samples left, and returns a copy of the rest grouped by container.
+func (s *seriesStore) records() []record {
+	start := s.latest.Add(-s.window)
+	var out []record
+	for _, c := range slices.Sorted(maps.Keys(s.series)) {
+		ring := s.series[c]
+		ring.dropBefore(start)
+		if ring.n == 0 {
+			delete(s.series, c)
+			continue
+		}
+		for i := range ring.n {
+			out = append(out, ring.buf[(ring.head+i)%len(ring.buf)])
+		}
+	}
+	return out
+}
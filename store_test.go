@@ -0,0 +1,113 @@
+package cstats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ringSeconds lists the sample times of r, oldest first.
+func ringSeconds(r *sampleRing) string {
+	var s []string
+	for i := range r.n {
+		s = append(s, fmt.Sprint(r.buf[(r.head+i)%len(r.buf)].Timestamp.Unix()))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestSampleRing(t *testing.T) {
+	at := func(s int) record { return record{Timestamp: time.Unix(int64(s), 0), Container: "web"} }
+	tests := []struct {
+		name   string
+		pushes int    // samples at 0, 1, 2...
+		drop   int    // then dropBefore this second
+		more   int    // then this many samples more
+		want   string // times held
+		bufLen int
+	}{
+		{name: "empty", want: "", bufLen: 0},
+		{name: "under capacity", pushes: 3, want: "0 1 2", bufLen: 16},
+		{name: "grows", pushes: 17, drop: 10, want: "10 11 12 13 14 15 16", bufLen: 32},
+		{name: "drop all", pushes: 5, drop: 99, want: "", bufLen: 16},
+		// Evicting frees slots at the front that new samples wrap into, so
+		// the buffer does not grow.
+		{name: "wraps around", pushes: 16, drop: 10, more: 8, want: "10 11 12 13 14 15 16 17 18 19 20 21 22 23", bufLen: 16},
+		{name: "grows while wrapped", pushes: 16, drop: 4, more: 8, want: "4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23", bufLen: 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r sampleRing
+			for i := range tt.pushes {
+				r.push(at(i))
+			}
+			r.dropBefore(time.Unix(int64(tt.drop), 0))
+			for i := range tt.more {
+				r.push(at(tt.pushes + i))
+			}
+			if got := ringSeconds(&r); got != tt.want || len(r.buf) != tt.bufLen {
+				t.Errorf("holds %q in %d slots, want %q in %d", got, len(r.buf), tt.want, tt.bufLen)
+			}
+		})
+	}
+}
+
+func TestSeriesStore(t *testing.T) {
+	sample := func(s int, container string, cpu float64) record {
+		return record{Timestamp: time.Unix(int64(s), 0), Container: container, CPUPct: cpu}
+	}
+	tests := []struct {
+		name           string
+		mode           dedupeMode
+		samples        []record
+		want           string // container@second=cpu, grouped by container
+		unordered, dup int
+	}{
+		{name: "in order within the window", samples: []record{sample(0, "web", 1), sample(5, "db", 2), sample(10, "web", 3)},
+			want: "db@5=2 web@0=1 web@10=3"},
+		{name: "older samples evicted", samples: []record{sample(0, "web", 1), sample(20, "web", 2), sample(40, "web", 3)},
+			want: "web@20=2 web@40=3"},
+		{name: "a quiet container leaves", samples: []record{sample(0, "db", 1), sample(40, "web", 2)},
+			want: "web@40=2"},
+		{name: "late sample put in order", samples: []record{sample(0, "web", 1), sample(10, "web", 3), sample(5, "web", 2)},
+			want: "web@0=1 web@5=2 web@10=3", unordered: 1},
+		{name: "duplicate replaced", mode: "last", samples: []record{sample(0, "web", 1), sample(10, "web", 2), sample(10, "web", 4)},
+			want: "web@0=1 web@10=4", dup: 1},
+		{name: "duplicate averaged", mode: "avg", samples: []record{sample(0, "web", 1), sample(10, "web", 2), sample(10, "web", 4)},
+			want: "web@0=1 web@10=3", dup: 1},
+		{name: "late samples in a wrapped ring", mode: "avg", samples: func() []record {
+			var recs []record
+			for i := range 30 {
+				recs = append(recs, sample(i, "web", float64(i)))
+			}
+			return append(recs, sample(27, "web", 100), sample(5, "web", 0))
+		}(), want: "web@9=9 web@10=10 web@11=11 web@12=12 web@13=13 web@14=14 web@15=15 web@16=16 web@17=17 web@18=18 web@19=19 " +
+			"web@20=20 web@21=21 web@22=22 web@23=23 web@24=24 web@25=25 web@26=26 web@27=63.5 web@28=28 web@29=29", unordered: 1, dup: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mode != "" {
+				defer func(m dedupeMode) { dedupe = m }(dedupe)
+				dedupe = tt.mode
+			}
+			s := newSeriesStore(20 * time.Second)
+			var unordered, dups int
+			for _, r := range tt.samples {
+				u, d := s.add(r)
+				if u {
+					unordered++
+				}
+				if d {
+					dups++
+				}
+			}
+			var got []string
+			for _, r := range s.records() {
+				got = append(got, fmt.Sprintf("%s@%d=%g", r.Container, r.Timestamp.Unix(), r.CPUPct))
+			}
+			if g := strings.Join(got, " "); g != tt.want || unordered != tt.unordered || dups != tt.dup {
+				t.Errorf("holds %q with %d unordered and %d duplicates, want %q with %d and %d", g, unordered, dups, tt.want, tt.unordered, tt.dup)
+			}
+		})
+	}
+}
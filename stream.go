@@ -0,0 +1,339 @@
+package cstats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// streamCSV calls fn for each record of a capture without holding them all
+// in memory. Remote captures are mirrored as usual.
+func streamCSV(path string, fn func(record)) error {
+	defer timed(csvParses, parseSeconds, time.Now())
+	var in io.Reader
+	if isURL(path) {
+		data, err := remoteFor(path).fetch()
+		if err != nil {
+			return err
+		}
+		in = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	r := csv.NewReader(in)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	p, err := newCSVParser(header)
+	if err != nil {
+		return err
+	}
+	p.eachRow(r, fn)
+	if p.err != nil {
+		return p.err
+	}
+	if s := p.issues.String(); s != "" {
+		warnf("%s: %s", path, s)
+	}
+	return nil
+}
+
+// sketchAccuracy is the relative error of quantileSketch percentiles.
+const sketchAccuracy = 0.01
+
+// quantileSketch approximates percentiles of non-negative values in bounded
+// memory: values are counted in logarithmic buckets, so any percentile is
+// within sketchAccuracy of the exact one (the DDSketch idea).
+type quantileSketch struct {
+	zeros   int
+	buckets map[int]int
+	count   int
+}
+
+var sketchGamma = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+
+func (q *quantileSketch) add(v float64) {
+	q.count++
+	if v <= 0 {
+		q.zeros++
+		return
+	}
+	if q.buckets == nil {
+		q.buckets = map[int]int{}
+	}
+	q.buckets[sketchBucket(v)]++
+}
+
+// sketchBucket is the logarithmic bucket of a positive value.
+func sketchBucket(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(sketchGamma)))
+}
+
+// sketchValue is the value a bucket stands for, its midpoint in relative
+// terms.
+func sketchValue(k int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(k)) / (sketchGamma + 1)
+}
+
+// quantile returns the p-th percentile (0-100).
+func (q *quantileSketch) quantile(p float64) float64 {
+	if q.count == 0 {
+		return 0
+	}
+	rank := int(math.Round(p / 100 * float64(q.count-1)))
+	if rank < q.zeros {
+		return 0
+	}
+	seen := q.zeros
+	for _, k := range slices.Sorted(maps.Keys(q.buckets)) {
+		seen += q.buckets[k]
+		if seen > rank {
+			return sketchValue(k)
+		}
+	}
+	return 0
+}
+
+// streamIntegrator is integrate in bounded memory: trapezoid areas are summed
+// per (sketched) interval length, so the gap threshold of 3x the median
+// spacing can still be applied once the capture is read.
+type streamIntegrator struct {
+	prev    record
+	started bool
+	dts     quantileSketch
+	areas   map[int][2]float64 // dt bucket -> core-seconds, MB-hours
+}
+
+func (g *streamIntegrator) add(r record) {
+	if !g.started {
+		g.prev, g.started = r, true
+		return
+	}
+	a := g.prev
+	g.prev = r
+	dt := r.Timestamp.Sub(a.Timestamp).Seconds()
+	if dt <= 0 {
+		return
+	}
+	g.dts.add(dt)
+	if g.areas == nil {
+		g.areas = map[int][2]float64{}
+	}
+	k := sketchBucket(dt)
+	area := g.areas[k]
+	area[0] += (cores(a) + cores(r)) / 2 * dt
+	area[1] += (a.MemUsageMB + r.MemUsageMB) / 2 * dt / 3600
+	g.areas[k] = area
+}
+
+func (g *streamIntegrator) totals() (coreSeconds, mbHours float64) {
+	if g.dts.count == 0 {
+		return 0, 0
+	}
+	maxDT := 3 * g.dts.quantile(50)
+	for k, area := range g.areas {
+		if sketchValue(k) <= maxDT {
+			coreSeconds += area[0]
+			mbHours += area[1]
+		}
+	}
+	return coreSeconds, mbHours
+}
+
+// seriesReducer keeps a bounded, spike-preserving sample of one container's
+// series: time buckets whose width doubles whenever there are more than
+// capacity of them, each keeping its first sample and its CPU and memory
+// peaks. Samples are expected in time order, as collectors append them.
+type seriesReducer struct {
+	capacity int
+	start    time.Time
+	width    time.Duration
+	buckets  []reducedBucket
+}
+
+type reducedBucket struct {
+	idx                     int64
+	first, cpuPeak, memPeak record
+}
+
+func (b *reducedBucket) merge(o reducedBucket) {
+	if o.first.Timestamp.Before(b.first.Timestamp) {
+		b.first = o.first
+	}
+	if o.cpuPeak.CPUPct > b.cpuPeak.CPUPct {
+		b.cpuPeak = o.cpuPeak
+	}
+	if o.memPeak.MemUsageMB > b.memPeak.MemUsageMB {
+		b.memPeak = o.memPeak
+	}
+}
+
+func (s *seriesReducer) add(r record) {
+	if len(s.buckets) == 0 {
+		s.start, s.width = r.Timestamp, time.Second
+	}
+	b := reducedBucket{idx: max(int64(r.Timestamp.Sub(s.start)/s.width), 0), first: r, cpuPeak: r, memPeak: r}
+	if n := len(s.buckets); n > 0 && b.idx <= s.buckets[n-1].idx {
+		s.buckets[n-1].merge(b)
+		return
+	}
+	s.buckets = append(s.buckets, b)
+	for len(s.buckets) > s.capacity {
+		s.width *= 2
+		merged := s.buckets[:0]
+		for _, b := range s.buckets {
+			b.idx /= 2
+			if n := len(merged); n > 0 && merged[n-1].idx == b.idx {
+				merged[n-1].merge(b)
+				continue
+			}
+			merged = append(merged, b)
+		}
+		s.buckets = merged
+	}
+}
+
+// records returns the kept samples in time order.
+func (s *seriesReducer) records() []record {
+	var out []record
+	for _, b := range s.buckets {
+		kept := []record{b.first, b.cpuPeak, b.memPeak}
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].Timestamp.Before(kept[j].Timestamp) })
+		for i, r := range kept {
+			if i > 0 && r.Timestamp.Equal(kept[i-1].Timestamp) {
+				continue
+			}
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// streamSummary is what one pass over a capture yields: per-container stats
+// with sketched percentiles, and a reduced series of at most about
+// 3 x maxPoints samples per container for the charts.
+type streamSummary struct {
+	maxPoints int
+	stats     map[string]*containerStats
+	cpu, mem  map[string]*quantileSketch
+	integrals map[string]*streamIntegrator
+	series    map[string]*seriesReducer
+}
+
+func newStreamSummary(maxPoints int) *streamSummary {
+	return &streamSummary{
+		maxPoints: maxPoints,
+		stats:     map[string]*containerStats{},
+		cpu:       map[string]*quantileSketch{},
+		mem:       map[string]*quantileSketch{},
+		integrals: map[string]*streamIntegrator{},
+		series:    map[string]*seriesReducer{},
+	}
+}
+
+func (s *streamSummary) add(r record) {
+	c := r.Container
+	st, ok := s.stats[c]
+	if !ok {
+		st = &containerStats{}
+		s.stats[c] = st
+		s.cpu[c] = &quantileSketch{}
+		s.mem[c] = &quantileSketch{}
+		s.integrals[c] = &streamIntegrator{}
+		s.series[c] = &seriesReducer{capacity: s.maxPoints}
+	}
+	st.accumulate(r)
+	s.cpu[c].add(r.CPUPct)
+	s.mem[c].add(r.MemUsageMB)
+	s.integrals[c].add(r)
+	s.series[c].add(r)
+}
+
+// finish fills in the percentiles and integrals and returns the stats and
+// the reduced records.
+func (s *streamSummary) finish() (map[string]*containerStats, []record) {
+	var records []record
+	for c, st := range s.stats {
+		// Bucket midpoints can land just above the exact peak.
+		cpu := func(p float64) float64 { return min(s.cpu[c].quantile(p), st.CPUMax) }
+		mem := func(p float64) float64 { return min(s.mem[c].quantile(p), st.MemMax) }
+		st.CPUP50, st.CPUP95, st.CPUP99 = cpu(50), cpu(95), cpu(99)
+		st.MemP50, st.MemP95, st.MemP99 = mem(50), mem(95), mem(99)
+		st.CPUCoreSeconds, st.MemMBHours = s.integrals[c].totals()
+		st.Spacing = time.Duration(s.integrals[c].dts.quantile(50) * float64(time.Second))
+		if st.Spacing > time.Second {
+			// Captures have whole-second timestamps: undo the sketch's error.
+			st.Spacing = st.Spacing.Round(time.Second)
+		}
+		records = append(records, s.series[c].records()...)
+	}
+	markImages(s.stats)
+	return s.stats, records
+}
+
+// snapshot is finish for a summary still being fed: the stats are copies,
+// which the caller may annotate (pricing, budgets) as it likes.
+func (s *streamSummary) snapshot() (map[string]*containerStats, []record) {
+	stats, records := s.finish()
+	out := make(map[string]*containerStats, len(stats))
+	for c, st := range stats {
+		cp := *st
+		cp.Images = slices.Clone(st.Images)
+		out[c] = &cp
+	}
+	return out, records
+}
+
+// termStreamPoints bounds the samples per container term --stream keeps
+// for its charts, more than a terminal is wide.
+const termStreamPoints = 1000
+
+// streamFollow is set by --stream in term and plot --live: the captures
+// they follow are then summarized in bounded memory as they grow, keeping
+// about 3 x points samples per container for the charts, with series keyed
+// by seriesKey as they are read.
+var streamFollow struct {
+	points    int
+	seriesKey string
+}
+
+// streamedStats returns the stats of a capture followed with --stream, nil
+// when it is not.
+func streamedStats(path string) map[string]*containerStats {
+	var stats map[string]*containerStats
+	withTail(path, func(t *csvTail) {
+		if t.stream != nil {
+			stats, _ = t.stream.snapshot()
+		}
+	})
+	return stats
+}
+
+// loadStreamed reads a capture in one pass with bounded memory, keying the
+// series by seriesKey (name or auto).
+func loadStreamed(path string, maxPoints int, seriesKey string) (map[string]*containerStats, []record, error) {
+	s := newStreamSummary(maxPoints)
+	err := streamCSV(path, func(r record) {
+		r.Container = keyedName(r.Container, r, seriesKey)
+		s.add(r)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	stats, records := s.finish()
+	return stats, records, nil
+}
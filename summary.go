@@ -0,0 +1,276 @@
+package cstats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// summaryEntry is the machine-readable form of one container's stats.
+type summaryEntry struct {
+	Container string  `json:"container"`
+	Samples   int     `json:"samples"`
+	CPUAvg    float64 `json:"cpu_avg_pct"`
+	CPUP50    float64 `json:"cpu_p50_pct"`
+	CPUP95    float64 `json:"cpu_p95_pct"`
+	CPUP99    float64 `json:"cpu_p99_pct"`
+	CPUMax    float64 `json:"cpu_max_pct"`
+	MemAvg    float64 `json:"mem_avg_mb"`
+	MemP50    float64 `json:"mem_p50_mb"`
+	MemP95    float64 `json:"mem_p95_mb"`
+	MemP99    float64 `json:"mem_p99_mb"`
+	MemMax    float64 `json:"mem_max_mb"`
+	MemLimit  float64 `json:"mem_limit_mb"`
+	MemPctMax float64 `json:"mem_pct_max"`
+
+	CPUCoreSeconds float64  `json:"cpu_core_seconds"`
+	MemMBHours     float64  `json:"mem_mb_hours"`
+	Cost           *float64 `json:"est_cost,omitempty"`
+
+	SpacingSeconds  float64  `json:"spacing_s"`
+	IntervalSeconds *float64 `json:"interval_s,omitempty"`
+	CoveragePct     float64  `json:"coverage_pct"`
+	MissedSamples   int      `json:"missed_samples"`
+
+	Budget         string          `json:"budget,omitempty"`
+	Recommendation *recommendation `json:"recommendation,omitempty"`
+
+	Images []string `json:"images,omitempty"`
+}
+
+func summaryEntries(containers []string, stats map[string]*containerStats) []summaryEntry {
+	out := make([]summaryEntry, 0, len(containers))
+	for _, c := range containers {
+		s := stats[c]
+		e := summaryEntry{
+			Container: c,
+			Samples:   s.Count,
+			CPUAvg:    round2(s.CPUAvg()),
+			CPUP50:    round2(s.CPUP50),
+			CPUP95:    round2(s.CPUP95),
+			CPUP99:    round2(s.CPUP99),
+			CPUMax:    round2(s.CPUMax),
+			MemAvg:    round2(s.MemAvg()),
+			MemP50:    round2(s.MemP50),
+			MemP95:    round2(s.MemP95),
+			MemP99:    round2(s.MemP99),
+			MemMax:    round2(s.MemMax),
+			MemLimit:  round2(s.MemLimit),
+			MemPctMax: round2(s.MemPctMax),
+
+			CPUCoreSeconds: round2(s.CPUCoreSeconds),
+			MemMBHours:     round2(s.MemMBHours),
+			Budget:         s.Budget,
+			Recommendation: s.Rec,
+			Images:         s.Images,
+
+			SpacingSeconds: round2(s.Spacing.Seconds()),
+			CoveragePct:    round2(s.Coverage()),
+			MissedSamples:  s.Missed(),
+		}
+		if s.Interval > 0 {
+			iv := s.Interval.Seconds()
+			e.IntervalSeconds = &iv
+		}
+		if s.Priced {
+			cost := math.Round(s.Cost*10000) / 10000
+			e.Cost = &cost
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// summaryFormats maps --format/--summary-out names to file extensions.
+var summaryFormats = map[string]string{
+	"table": ".txt",
+	"csv":   ".csv",
+	"json":  ".json",
+	"md":    ".md",
+}
+
+// writeSummary renders the per-container summary as table, csv, json or md.
+func writeSummary(w io.Writer, format string, containers []string, stats map[string]*containerStats) error {
+	header := summaryHeaderFor(stats)
+	u := statsMemUnit(stats)
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+		for _, c := range containers {
+			fmt.Fprintln(tw, strings.Join(summaryRow(c, stats[c], u), "\t")+"\t")
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		for _, c := range containers {
+			cw.Write(summaryRow(c, stats[c], u))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summaryEntries(containers, stats))
+	case "md":
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "| :--- |%s\n", strings.Repeat(" ---: |", len(header)-1))
+		for _, c := range containers {
+			row := summaryRow(strings.ReplaceAll(c, "|", `\|`), stats[c], u)
+			fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown summary format %q (use table, csv, json or md)", format)
+}
+
+// writeSummaryFiles writes the summary next to base (a path without
+// extension) once per comma-separated format, returning the written paths.
+func writeSummaryFiles(base, formats string, containers []string, stats map[string]*containerStats) ([]string, error) {
+	var paths []string
+	for _, format := range strings.Split(formats, ",") {
+		format = strings.TrimSpace(format)
+		ext, ok := summaryFormats[format]
+		if !ok {
+			return paths, fmt.Errorf("unknown summary format %q (use table, csv, json or md)", format)
+		}
+		path := base + ".summary" + ext
+		f, err := os.Create(path)
+		if err != nil {
+			return paths, err
+		}
+		err = writeSummary(f, format, containers, stats)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func runSummary(args []string) {
+	fs := newFlagSet("summary")
+	csvPath := fs.String("csv", "docker-stats.csv", "Path or http(s) URL of the CSV file")
+	format := fs.String("format", "table", "Output format: table, csv, json or md")
+	prices := pricingFlags(fs)
+	budgetsFile := budgetsFlag(fs)
+	remoteFlags(fs)
+	view := registerViewFlags(fs)
+	recommend := fs.Bool("recommend", false, "Suggest CPU/memory requests and limits (p95/p99/peak + headroom)")
+	headroom := fs.Float64("headroom", 0.2, "Headroom fraction added to --recommend suggestions")
+	stream := fs.Bool("stream", false, "Read the capture in one bounded-memory pass (percentiles approximate to 1%; samples taken as they come, without --dedupe)")
+	eventsFile := fs.String("events", "", "Events file whose \"<name> start\"/\"<name> end\" markers delimit phases (default: <csv>.events.csv)")
+	phasesOnly := fs.Bool("phases", false, "Print only the per-phase avg/max of each container (tables and md list them after the summary anyway)")
+	strictFlag(fs)
+	dedupeFlag(fs)
+	unitsFlag(fs)
+	githubFlag(fs)
+	parseFlags(fs, args)
+	if fs.NArg() > 0 {
+		*csvPath = fs.Arg(0)
+	}
+	if err := view.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *stream && view.reshapes() {
+		log.Fatal("--stream cannot be combined with --rename, --series-key id|host|cluster|namespace, --group-by, --top or --redact")
+	}
+
+	if *stream && *phasesOnly {
+		log.Fatal("--stream cannot be combined with --phases")
+	}
+	budgets := mustLoadBudgets(*budgetsFile)
+	if *eventsFile == "" {
+		*eventsFile = eventsPath(*csvPath)
+	}
+
+	var stats map[string]*containerStats
+	var phases []phase
+	var perPhase []map[string]*containerStats
+	if *stream {
+		var err error
+		stats, _, err = loadStreamed(*csvPath, 1, view.seriesKey)
+		if err != nil {
+			log.Fatalf("Error reading CSV: %v", err)
+		}
+	} else {
+		records, err := loadFinishedCSV(*csvPath)
+		if err != nil {
+			log.Fatalf("Error reading CSV: %v", err)
+		}
+		records = view.apply(records)
+		stats = computeStats(records)
+		events, err := loadEvents(*eventsFile)
+		if err != nil {
+			warnf("events: %v", err)
+		}
+		phases = phasesFrom(view.events(events), lastSample(records))
+		perPhase = phaseStats(records, phases)
+	}
+	if len(stats) == 0 {
+		log.Fatalf("No samples in %s", *csvPath)
+	}
+	if *phasesOnly {
+		if len(phases) == 0 {
+			log.Fatalf("No phases in %s; mark them with cstats mark \"<name> start\" and \"<name> end\"", *eventsFile)
+		}
+		if err := writePhaseSummary(os.Stdout, *format, phases, perPhase); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	applyInterval(stats, captureInterval(*csvPath))
+	applyPricing(stats, *prices)
+	applyBudgets(stats, budgets)
+	if *recommend {
+		ofLimit := slices.ContainsFunc(slices.Collect(maps.Values(stats)), func(s *containerStats) bool { return s.CPUOfLimit })
+		if err := checkRecommendable(*csvPath, ofLimit); err != nil {
+			log.Fatal(err)
+		}
+		applyRecommendations(stats, *headroom)
+	}
+	containers := slices.Sorted(maps.Keys(stats))
+	report := samplingReport(containers, stats)
+	for _, line := range report {
+		warnf("%s", line)
+	}
+	if err := writeSummary(os.Stdout, *format, containers, stats); err != nil {
+		log.Fatal(err)
+	}
+	if len(phases) > 0 && (*format == "table" || *format == "md") {
+		fmt.Println("\nPhases:")
+		if *format == "md" {
+			fmt.Println()
+		}
+		if err := writePhaseSummary(os.Stdout, *format, phases, perPhase); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if githubMode {
+		githubSamplingWarnings(report)
+		err := githubStepSummary(func(w io.Writer) error {
+			fmt.Fprintf(w, "### Resource usage: %s\n\n", *csvPath)
+			if err := writeSummary(w, "md", containers, stats); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintln(w)
+			return err
+		})
+		if err != nil {
+			warnf("%v", err)
+		}
+	}
+}
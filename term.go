@@ -0,0 +1,603 @@
+package cstats
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ui "github.com/gizak/termui/v3"
+	"github.com/gizak/termui/v3/widgets"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// drawUI draws items like ui.Render, but in the terminal's default colors
+// with --no-color; bold and reverse still mark headers and the selection.
+func drawUI(items ...ui.Drawable) {
+	if !noColor {
+		ui.Render(items...)
+		return
+	}
+	for _, item := range items {
+		buf := ui.NewBuffer(item.GetRect())
+		item.Lock()
+		item.Draw(buf)
+		item.Unlock()
+		for point, cell := range buf.CellMap {
+			if point.In(buf.Rectangle) {
+				termbox.SetCell(point.X, point.Y, cell.Rune, termbox.ColorDefault|termbox.Attribute(cell.Style.Modifier), termbox.ColorDefault)
+			}
+		}
+	}
+	termbox.Flush()
+}
+
+// logPanel is the TUI log panel. Unlike a Paragraph it draws Text as is:
+// log lines are full of [brackets] that termui would take for style markup
+// and drop. Err, when set, is shown in red above the lines.
+type logPanel struct {
+	widgets.Paragraph
+	Err error
+}
+
+func newLogPanel() *logPanel {
+	return &logPanel{Paragraph: *widgets.NewParagraph()}
+}
+
+func (p *logPanel) Draw(buf *ui.Buffer) {
+	p.Block.Draw(buf)
+	var cells []ui.Cell
+	if p.Err != nil {
+		cells = ui.RunesToStyledCells([]rune(p.Err.Error()+"\n"), ui.NewStyle(ui.ColorRed))
+	}
+	cells = append(cells, ui.RunesToStyledCells([]rune(p.Text), p.TextStyle)...)
+	if p.WrapText {
+		cells = ui.WrapCells(cells, uint(p.Inner.Dx()))
+	}
+	for y, row := range ui.SplitCells(cells, '\n') {
+		if y+p.Inner.Min.Y >= p.Inner.Max.Y {
+			break
+		}
+		for _, cx := range ui.BuildCellWithXArray(ui.TrimCells(row, p.Inner.Dx())) {
+			buf.SetCell(cx.Cell, image.Pt(cx.X, y).Add(p.Inner.Min))
+		}
+	}
+}
+
+// termWindowKeys maps TUI keys to plotted time windows (0 = whole capture).
+var termWindowKeys = map[string]time.Duration{
+	"1": 5 * time.Minute,
+	"2": 15 * time.Minute,
+	"3": time.Hour,
+	"0": 0,
+}
+
+// termWindow is the slice of the capture the TUI shows: the last Window,
+// shifted back by Offset while panning through history.
+type termWindow struct {
+	Window time.Duration
+	Offset time.Duration
+}
+
+// apply returns the records inside the window and clamps Offset to the
+// capture so panning stops at its start.
+func (w *termWindow) apply(records []record) []record {
+	if w.Window == 0 || len(records) == 0 {
+		w.Offset = 0
+		return records
+	}
+	first, last := runStart(records), lastSample(records)
+	if maxOffset := max(last.Sub(first)-w.Window, 0); w.Offset > maxOffset {
+		w.Offset = maxOffset
+	}
+	end := last.Add(-w.Offset)
+	start := end.Add(-w.Window)
+	out := make([]record, 0, len(records))
+	for _, r := range records {
+		if r.Timestamp.After(start) && !r.Timestamp.After(end) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// pan moves the window by half its width: dir < 0 goes back in time,
+// dir > 0 towards the newest samples.
+func (w *termWindow) pan(dir int) {
+	if w.Window == 0 {
+		return
+	}
+	w.Offset -= time.Duration(dir) * w.Window / 2
+	if w.Offset < 0 {
+		w.Offset = 0
+	}
+}
+
+func (w termWindow) String() string {
+	if w.Window == 0 {
+		return "all"
+	}
+	if w.Offset == 0 {
+		return "last " + shortDuration(w.Window)
+	}
+	return fmt.Sprintf("%s ending -%s", shortDuration(w.Window), shortDuration(w.Offset))
+}
+
+// shortDuration formats d without zero units: 5m, 1h, 1h30m, 45s.
+func shortDuration(d time.Duration) string {
+	s := d.Round(time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// tableScroll pages through the TUI summary table. The header row stays
+// pinned; Offset is the first data row shown.
+type tableScroll struct {
+	Offset int
+	page   int
+}
+
+// visible returns the header plus the fit data rows starting at Offset,
+// and a "rows a-b of n" indicator when not everything fits.
+func (s *tableScroll) visible(rows [][]string, fit int) ([][]string, string) {
+	data := len(rows) - 1
+	if fit <= 0 {
+		// Not laid out yet; the first render clips.
+		return rows, ""
+	}
+	s.page = fit
+	s.Offset = min(s.Offset, max(data-s.page, 0))
+	s.Offset = max(s.Offset, 0)
+	if data <= s.page {
+		return rows, ""
+	}
+	end := min(s.Offset+s.page, data)
+	out := append([][]string{rows[0]}, rows[1+s.Offset:1+end]...)
+	more := ""
+	if s.Offset > 0 {
+		more += "↑"
+	}
+	if end < data {
+		more += "↓"
+	}
+	return out, fmt.Sprintf("rows %d-%d of %d %s", s.Offset+1, end, data, more)
+}
+
+// tableFit returns how many data rows fit below the header in a table
+// whose inner area is height lines tall.
+func tableFit(height int, separated bool) int {
+	if height <= 0 {
+		return 0
+	}
+	if separated {
+		return max((height+1)/2-1, 1)
+	}
+	return max(height-1, 1)
+}
+
+// scroll moves by delta rows; pages scroll by a full page.
+func (s *tableScroll) scroll(delta int, pages bool) {
+	if pages {
+		delta *= s.page
+	}
+	s.Offset = max(s.Offset+delta, 0)
+}
+
+// sparkRunes are the block heights used for sparklines, lowest first.
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the last width values scaled to their own maximum.
+// NaN and infinite values show as the lowest block.
+func sparkline(vals []float64, width int) string {
+	if len(vals) > width {
+		vals = vals[len(vals)-width:]
+	}
+	peak := 0.0
+	for _, v := range vals {
+		if finite(v) {
+			peak = max(peak, v)
+		}
+	}
+	out := make([]rune, len(vals))
+	for i, v := range vals {
+		level := 0
+		if peak > 0 && finite(v) {
+			level = int(v / peak * float64(len(sparkRunes)-1))
+		}
+		out[i] = sparkRunes[min(max(level, 0), len(sparkRunes)-1)]
+	}
+	return string(out)
+}
+
+// sparklineRows builds the compact layout: one row per container with its
+// latest CPU and memory and their recent history. Rows are colored by the
+// caller, like the plot lines. Memory is shown in u.
+func sparklineRows(containers []string, grouped map[string][]record, sparkWidth int, u memUnit) [][]string {
+	rows := [][]string{{"Container", "CPU %", "CPU history", u.label("RAM MB"), "RAM history", "Mem %"}}
+	for _, c := range containers {
+		recs := grouped[c]
+		cpu := make([]float64, len(recs))
+		mem := make([]float64, len(recs))
+		for j, r := range recs {
+			cpu[j] = r.CPUPct
+			mem[j] = r.MemUsageMB
+		}
+		cur := recs[len(recs)-1]
+		rows = append(rows, []string{
+			c,
+			fmt.Sprintf("%.1f", cur.CPUPct),
+			sparkline(cpu, sparkWidth),
+			u.format(cur.MemUsageMB),
+			sparkline(mem, sparkWidth),
+			fmt.Sprintf("%.1f", cur.MemPct),
+		})
+	}
+	return rows
+}
+
+// termIOPanels are the cumulative I/O counters the TUI can chart as rates,
+// in display order.
+var termIOPanels = []struct{ Column, Title string }{
+	{"net_rx_mb", " Net rx MB/s "},
+	{"net_tx_mb", " Net tx MB/s "},
+	{"blkio_read_mb", " Disk read MB/s "},
+	{"blkio_write_mb", " Disk write MB/s "},
+}
+
+// seriesTracker keeps the TUI's chart series current like statsTracker
+// keeps the stats: a refresh of a capture that only grew appends the new
+// samples to the series instead of rebuilding them from all records. A new
+// container or I/O column, a sample older than the latest and a memory
+// unit change rebuild.
+type seriesTracker struct {
+	base *record // &records[0] of the previous call
+	n    int
+
+	containers []string // sorted
+	index      map[string]int
+	timestamps []time.Time // sorted, distinct
+	unit       memUnit
+	peakMB     float64
+	// cpu and ram hold a value per container and timestamp, 0 where the
+	// container has no sample; ram is in unit.
+	cpu, ram [][]float64
+	// ioCols are the termIOPanels columns present, and io their rates per
+	// column, container and timestamp.
+	ioCols  []string
+	io      map[string][][]float64
+	prev    map[string]map[string]record // latest sample with the column, per column and container
+	grouped map[string][]record          // per container, in time order
+}
+
+// update brings the series up to date with records.
+func (t *seriesTracker) update(records []record) {
+	if len(records) == 0 {
+		*t = seriesTracker{}
+		return
+	}
+	appended := t.index != nil && &records[0] == t.base && len(records) >= t.n
+	if !appended || !t.add(records[t.n:]) {
+		t.rebuild(records)
+	}
+	t.base, t.n = &records[0], len(records)
+}
+
+// rebuild builds the series from scratch.
+func (t *seriesTracker) rebuild(records []record) {
+	present := extraMetrics(records)
+	*t = seriesTracker{containers: containerNames(records), index: map[string]int{}, io: map[string][][]float64{}, prev: map[string]map[string]record{}, grouped: map[string][]record{}}
+	for i, c := range t.containers {
+		t.index[c] = i
+	}
+	for _, r := range records {
+		t.peakMB = max(t.peakMB, r.MemUsageMB)
+	}
+	t.unit = memUnitFor(t.peakMB)
+	t.cpu = make([][]float64, len(t.containers))
+	t.ram = make([][]float64, len(t.containers))
+	for _, p := range termIOPanels {
+		if slices.Contains(present, p.Column) {
+			t.ioCols = append(t.ioCols, p.Column)
+			t.io[p.Column] = make([][]float64, len(t.containers))
+			t.prev[p.Column] = map[string]record{}
+		}
+	}
+	sorted := slices.Clone(records)
+	slices.SortStableFunc(sorted, func(a, b record) int { return a.Timestamp.Compare(b.Timestamp) })
+	for _, r := range sorted {
+		t.place(r)
+	}
+}
+
+// add appends samples to the series. It reports false, leaving the tracker
+// to be rebuilt, when they do not only extend them.
+func (t *seriesTracker) add(records []record) bool {
+	latest, peak := time.Time{}, t.peakMB
+	if len(t.timestamps) > 0 {
+		latest = t.timestamps[len(t.timestamps)-1]
+	}
+	for _, r := range records {
+		if _, ok := t.index[r.Container]; !ok || r.Timestamp.Before(latest) {
+			return false
+		}
+		for _, p := range termIOPanels {
+			if _, ok := r.Extra[p.Column]; ok && t.io[p.Column] == nil {
+				return false
+			}
+		}
+		latest, peak = r.Timestamp, max(peak, r.MemUsageMB)
+	}
+	if memUnitFor(peak) != t.unit {
+		return false
+	}
+	t.peakMB = peak
+	for _, r := range records {
+		t.place(r)
+	}
+	return true
+}
+
+// place puts a sample no older than the latest one into the series.
+func (t *seriesTracker) place(r record) {
+	if len(t.timestamps) == 0 || r.Timestamp.After(t.timestamps[len(t.timestamps)-1]) {
+		t.timestamps = append(t.timestamps, r.Timestamp)
+		for i := range t.containers {
+			t.cpu[i] = append(t.cpu[i], 0)
+			t.ram[i] = append(t.ram[i], 0)
+			for _, col := range t.ioCols {
+				t.io[col][i] = append(t.io[col][i], 0)
+			}
+		}
+	}
+	i, j := t.index[r.Container], len(t.timestamps)-1
+	t.cpu[i][j], t.ram[i][j] = 0, 0
+	if finite(r.CPUPct) && finite(r.MemUsageMB) {
+		t.cpu[i][j], t.ram[i][j] = r.CPUPct, t.unit.of(r.MemUsageMB)
+	}
+	// Counters going backwards (container restart) count as zero.
+	for _, col := range t.ioCols {
+		v, ok := r.Extra[col]
+		if !ok || !finite(v) {
+			continue
+		}
+		if prev, ok := t.prev[col][r.Container]; ok {
+			if dt := r.Timestamp.Sub(prev.Timestamp).Seconds(); dt > 0 {
+				t.io[col][i][j] = max(v-prev.Extra[col], 0) / dt
+			}
+		}
+		t.prev[col][r.Container] = r
+	}
+	t.grouped[r.Container] = append(t.grouped[r.Container], r)
+}
+
+// termLayouts are the TUI layouts, in the order the l key cycles through.
+var termLayouts = []string{"panels", "stacked", "sparklines"}
+
+// autoLayout picks a layout for the terminal size: the panel grid needs
+// room, so small windows (an 80x24 SSH session) get the stacked one.
+func autoLayout(width, height int) string {
+	if width < 120 || height < 32 {
+		return "stacked"
+	}
+	return "panels"
+}
+
+// nextLayout returns the layout after current in termLayouts.
+func nextLayout(current string) string {
+	i := slices.Index(termLayouts, current)
+	return termLayouts[(i+1)%len(termLayouts)]
+}
+
+// compactColumns are the summaryRow columns the stacked layout keeps:
+// container, CPU avg/max, RAM avg/max and peak memory %.
+var compactColumns = []int{0, 1, 5, 6, 10, 11}
+
+// compactRow narrows a summary row to compactColumns.
+func compactRow(row []string) []string {
+	out := make([]string, len(compactColumns))
+	for i, c := range compactColumns {
+		out[i] = row[c]
+	}
+	return out
+}
+
+// writeTermSnapshot saves the records the TUI currently shows as an HTML
+// dashboard and a summary CSV, named after the capture and the time, and
+// returns the written paths.
+func writeTermSnapshot(csvPath string, records []record, stats map[string]*containerStats, prices pricing, budgets []budgetRule, redact func([]event) []event) ([]string, error) {
+	base := localBase(csvPath) + "-snapshot-" + time.Now().Format("20060102-150405")
+	opts := FigureOptions{MaxPoints: 2000, Pricing: prices, Budgets: budgets, Interval: captureInterval(csvPath)}
+	if !isURL(csvPath) {
+		events, _ := loadEvents(eventsPath(csvPath))
+		opts.Events = redact(events)
+	}
+	htmlPath := base + ".html"
+	err := writeFigureHTML(htmlPath, "dark", dashboardTitle(opts), func(theme string) map[string]any {
+		opts.Theme = theme
+		return buildFigure(records, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	paths, err := writeSummaryFiles(base, "csv", containerNames(records), stats)
+	return append([]string{htmlPath}, paths...), err
+}
+
+// tableSort orders the TUI table by a clicked column. The zero value keeps
+// containers in name order.
+type tableSort struct {
+	Column int
+	Desc   bool
+}
+
+// toggle sorts by col, flipping the direction when it already is the sort
+// column. Metric columns start descending, heaviest containers on top.
+func (s *tableSort) toggle(col int) {
+	if s.Column == col {
+		s.Desc = !s.Desc
+		return
+	}
+	s.Column, s.Desc = col, col > 0
+}
+
+// apply sorts the data rows below the header in place and marks the sort
+// column in the header.
+func (s tableSort) apply(rows [][]string) {
+	if len(rows) == 0 || s.Column >= len(rows[0]) || (s.Column == 0 && !s.Desc) {
+		return
+	}
+	slices.SortStableFunc(rows[1:], func(a, b []string) int {
+		c := compareCells(a[s.Column], b[s.Column])
+		if s.Desc {
+			c = -c
+		}
+		return c
+	})
+	header := slices.Clone(rows[0])
+	if s.Desc {
+		header[s.Column] += " ▼"
+	} else {
+		header[s.Column] += " ▲"
+	}
+	rows[0] = header
+}
+
+// compareCells compares table cells numerically when both are numbers.
+func compareCells(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return cmp.Compare(x, y)
+	}
+	return strings.Compare(a, b)
+}
+
+// tableCell maps a terminal position to the row and column of t's drawn
+// rows, following the termui table layout.
+func tableCell(t *widgets.Table, x, y int) (row, col int, ok bool) {
+	if len(t.Rows) == 0 || !image.Pt(x, y).In(t.Inner) {
+		return 0, 0, false
+	}
+	row = y - t.Inner.Min.Y
+	if t.RowSeparator {
+		if row%2 == 1 {
+			return 0, 0, false
+		}
+		row /= 2
+	}
+	if row >= len(t.Rows) {
+		return 0, 0, false
+	}
+	widths := t.ColumnWidths
+	if len(widths) == 0 {
+		for range t.Rows[0] {
+			widths = append(widths, t.Inner.Dx()/len(t.Rows[0]))
+		}
+	}
+	left := t.Inner.Min.X
+	for col, w := range widths {
+		if x < left+w {
+			return row, col, true
+		}
+		left += w + 1
+	}
+	return 0, 0, false
+}
+
+// moveToEnd moves s[i] behind the other elements, so a highlighted series
+// is drawn on top.
+func moveToEnd[T any](s []T, i int) {
+	v := s[i]
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = v
+}
+
+// termThresholds are the --warn-cpu/--warn-mem limits (0 = off). A container
+// whose average exceeds a limit is shown red, one that only peaks above it
+// yellow.
+type termThresholds struct {
+	CPU, MemMB float64
+}
+
+// thresholdCells maps table headers to the limit they are checked against
+// and the color of a breach.
+var thresholdCells = map[string]struct {
+	mem   bool
+	color string
+}{
+	"CPU avg%":   {false, "red"},
+	"CPU max%":   {false, "yellow"},
+	"RAM avg MB": {true, "red"},
+	"RAM max MB": {true, "yellow"},
+	// Current values in the sparkline layout.
+	"CPU %":  {false, "red"},
+	"RAM MB": {true, "red"},
+}
+
+// mark colors the cells of rows (header first) that exceed a limit, memory
+// shown in u.
+func (t termThresholds) mark(rows [][]string, u memUnit) {
+	if len(rows) == 0 || (t.CPU <= 0 && t.MemMB <= 0) {
+		return
+	}
+	for col, name := range rows[0] {
+		name = strings.ReplaceAll(strings.TrimRight(name, " ▲▼"), u.Label, "MB")
+		cell, ok := thresholdCells[name]
+		if !ok {
+			continue
+		}
+		limit := t.CPU
+		if cell.mem {
+			limit = u.of(t.MemMB)
+		}
+		if limit <= 0 {
+			continue
+		}
+		for _, row := range rows[1:] {
+			if v, err := strconv.ParseFloat(row[col], 64); err == nil && v > limit {
+				row[col] = fmt.Sprintf("[%s](fg:%s,mod:bold)", row[col], cell.color)
+			}
+		}
+	}
+}
+
+// budgetColors are the TUI colors of the Budget column's statuses.
+var budgetColors = map[string]string{budgetOK: "green", budgetWarn: "yellow", budgetFail: "red"}
+
+// markBudgets colors the Budget column of the summary rows by status.
+func markBudgets(rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+	col := slices.IndexFunc(rows[0], func(h string) bool { return strings.TrimRight(h, " ▲▼") == "Budget" })
+	if col < 0 {
+		return
+	}
+	for _, row := range rows[1:] {
+		if color, ok := budgetColors[row[col]]; ok {
+			row[col] = fmt.Sprintf("[%s](fg:%s,mod:bold)", row[col], color)
+		}
+	}
+}
+
+// barColor returns the bar color for a container's avg and peak against
+// limit, or fallback when neither exceeds it.
+func (t termThresholds) barColor(avg, peak, limit float64, fallback ui.Color) ui.Color {
+	switch {
+	case limit <= 0:
+		return fallback
+	case avg > limit:
+		return ui.ColorRed
+	case peak > limit:
+		return ui.ColorYellow
+	}
+	return fallback
+}
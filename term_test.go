@@ -0,0 +1,48 @@
+package cstats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Refreshing a grown capture gives the series a rebuild would.
+func TestSeriesTrackerAppend(t *testing.T) {
+	at := func(s int) time.Time { return time.Unix(int64(s), 0) }
+	first := []record{
+		{Timestamp: at(0), Container: "web", CPUPct: 1, MemUsageMB: 100, Extra: map[string]float64{"net_rx_mb": 0}},
+		{Timestamp: at(0), Container: "db", CPUPct: 2, MemUsageMB: 200},
+		{Timestamp: at(5), Container: "web", CPUPct: 3, MemUsageMB: 110, Extra: map[string]float64{"net_rx_mb": 10}},
+	}
+	tests := []struct {
+		name  string
+		added []record
+	}{
+		{name: "same timestamp", added: []record{{Timestamp: at(5), Container: "db", CPUPct: 4, MemUsageMB: 210}}},
+		{name: "new timestamps", added: []record{
+			{Timestamp: at(10), Container: "web", CPUPct: 5, MemUsageMB: 120, Extra: map[string]float64{"net_rx_mb": 30}},
+			{Timestamp: at(15), Container: "web", CPUPct: 6, MemUsageMB: 130, Extra: map[string]float64{"net_rx_mb": 5}},
+		}},
+		{name: "new container", added: []record{{Timestamp: at(10), Container: "cache", CPUPct: 7, MemUsageMB: 50}}},
+		{name: "older sample", added: []record{{Timestamp: at(3), Container: "db", CPUPct: 8, MemUsageMB: 205}}},
+		{name: "unit change", added: []record{{Timestamp: at(10), Container: "db", CPUPct: 9, MemUsageMB: 4096}}},
+		{name: "new I/O column", added: []record{{Timestamp: at(10), Container: "db", Extra: map[string]float64{"blkio_read_mb": 1}}}},
+	}
+	dump := func(s *seriesTracker) string {
+		return fmt.Sprint(s.containers, s.timestamps, s.unit, s.cpu, s.ram, s.ioCols, s.io, s.grouped)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := make([]record, len(first), len(first)+len(tt.added))
+			copy(records, first)
+			var got, want seriesTracker
+			got.update(records)
+			records = append(records, tt.added...)
+			got.update(records)
+			want.update(records[:len(records):len(records)])
+			if g, w := dump(&got), dump(&want); g != w {
+				t.Errorf("appended\n%s\nrebuilt\n%s", g, w)
+			}
+		})
+	}
+}
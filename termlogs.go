@@ -0,0 +1,96 @@
+package cstats
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ansiEscape matches terminal color codes that containers write to their logs.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+
+// keyedPod matches a pod keyed by its namespace: "web-1 (shop)".
+var keyedPod = regexp.MustCompile(`^(\S+) \((\S+)\)$`)
+
+// logTail fetches the last lines of a container's logs in the background
+// for the TUI log panel, with `docker logs` or `kubectl logs` depending on
+// where the capture came from. Names must be the collector's (docker name,
+// pod or pod:container, "pod (namespace)" keyed by namespace), so
+// renamed or grouped views have nothing to tail.
+type logTail struct {
+	runtime string // "docker" or "kubernetes"
+	lines   int
+
+	mu      sync.Mutex
+	name    string
+	text    []string
+	err     error
+	running bool
+}
+
+// command builds the logs command for a container name.
+func (t *logTail) command(ctx context.Context, name string) *exec.Cmd {
+	tail := strconv.Itoa(t.lines)
+	if t.runtime == "kubernetes" {
+		args := []string{"logs", "--tail", tail}
+		pod := name
+		if ns, p, ok := strings.Cut(name, "/"); ok {
+			args, pod = append(args, "-n", ns), p
+		} else if m := keyedPod.FindStringSubmatch(name); m != nil {
+			args, pod = append(args, "-n", m[2]), m[1]
+		}
+		if p, container, ok := strings.Cut(pod, ":"); ok {
+			args = append(args, "-c", container, p)
+		} else {
+			args = append(args, "--all-containers", pod)
+		}
+		return exec.CommandContext(ctx, "kubectl", args...)
+	}
+	return exec.CommandContext(ctx, "docker", "logs", "--tail", tail, name)
+}
+
+// refresh starts fetching name's logs unless a fetch is already running.
+func (t *logTail) refresh(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running {
+		return
+	}
+	if name != t.name {
+		t.name, t.text, t.err = name, nil, nil
+	}
+	t.running = true
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		out, err := t.command(ctx, name).CombinedOutput()
+		lines := strings.Split(strings.TrimRight(ansiEscape.ReplaceAllString(string(out), ""), "\n"), "\n")
+		if err != nil {
+			err = fmt.Errorf("%s logs %s: %w", t.runtime, name, err)
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.running = false
+		if name == t.name {
+			t.text, t.err = lines, err
+		}
+	}()
+}
+
+// last returns up to n of the latest lines fetched for the current
+// container, and the error of the last fetch.
+func (t *logTail) last(n int) (name string, lines []string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines = t.text
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return t.name, lines, t.err
+}
@@ -0,0 +1,98 @@
+package cstats
+
+import "fmt"
+
+// theme holds the Plotly template and the page/figure colors for one
+// dashboard color scheme.
+type theme struct {
+	Template string
+
+	PageBG  string
+	ChartBG string
+	Text    string
+	Border  string
+	Code    string
+
+	TableHeaderBG   string
+	TableHeaderText string
+	TableCellBG     string
+	TableCellText   string
+
+	// Foreground is used for total lines; Muted for neutral reference lines
+	// and marker labels.
+	Foreground string
+	Marker     string
+	Muted      string
+}
+
+var themes = map[string]theme{
+	"dark": {
+		Template:        "plotly_dark",
+		PageBG:          "#11161d",
+		ChartBG:         "#0f141b",
+		Text:            "#dce3f0",
+		Border:          "rgba(120, 140, 170, 0.25)",
+		Code:            "#8ed7ff",
+		TableHeaderBG:   "#2a2a2a",
+		TableHeaderText: "white",
+		TableCellBG:     "#1e1e1e",
+		TableCellText:   "#ddd",
+		Foreground:      "#ffffff",
+		Marker:          "rgba(255,255,255,0.45)",
+		Muted:           "#aaaaaa",
+	},
+	"light": {
+		Template:        "plotly_white",
+		PageBG:          "#ffffff",
+		ChartBG:         "#ffffff",
+		Text:            "#1f2933",
+		Border:          "rgba(0, 0, 0, 0.12)",
+		Code:            "#0b6bcb",
+		TableHeaderBG:   "#e5e8ee",
+		TableHeaderText: "#111111",
+		TableCellBG:     "#fafbfc",
+		TableCellText:   "#222222",
+		Foreground:      "#222222",
+		Marker:          "rgba(0,0,0,0.45)",
+		Muted:           "#666666",
+	},
+}
+
+// themeFor returns the named theme, defaulting to dark.
+func themeFor(name string) theme {
+	if t, ok := themes[name]; ok {
+		return t
+	}
+	return themes["dark"]
+}
+
+// validTheme reports whether name is accepted by --theme.
+func validTheme(name string) bool {
+	_, ok := themes[name]
+	return ok || name == "auto"
+}
+
+// themeVars renders the CSS custom properties for a theme.
+func themeVars(t theme) string {
+	return fmt.Sprintf("--bg: %s; --chart-bg: %s; --fg: %s; --border: %s; --code: %s;",
+		t.PageBG, t.ChartBG, t.Text, t.Border, t.Code)
+}
+
+// themeCSS renders the :root variables for name; "auto" follows the
+// browser's prefers-color-scheme.
+func themeCSS(name string) string {
+	if name != "auto" {
+		return fmt.Sprintf(":root { %s }", themeVars(themeFor(name)))
+	}
+	return fmt.Sprintf(":root { %s }\n    @media (prefers-color-scheme: light) { :root { %s } }",
+		themeVars(themes["dark"]), themeVars(themes["light"]))
+}
+
+// themeJS defines pickTheme(), resolving "auto" in the browser.
+func themeJS(name string) string {
+	return fmt.Sprintf(`const THEME = %q;
+    function pickTheme() {
+      if (THEME !== "auto") return THEME;
+      return window.matchMedia("(prefers-color-scheme: light)").matches ? "light" : "dark";
+    }`, name)
+}
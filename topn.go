@@ -0,0 +1,84 @@
+package cstats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// othersName is the aggregate series holding containers outside the top N.
+const othersName = "others"
+
+// rankMetrics maps --by values to the statistic containers are ranked by.
+var rankMetrics = map[string]func(*containerStats) float64{
+	"cpu_avg": (*containerStats).CPUAvg,
+	"cpu_p95": func(s *containerStats) float64 { return s.CPUP95 },
+	"cpu_max": func(s *containerStats) float64 { return s.CPUMax },
+	"mem_avg": (*containerStats).MemAvg,
+	"mem_p95": func(s *containerStats) float64 { return s.MemP95 },
+	"mem_max": func(s *containerStats) float64 { return s.MemMax },
+}
+
+// checkRankMetric validates a --by value.
+func checkRankMetric(by string) error {
+	if _, ok := rankMetrics[by]; ok {
+		return nil
+	}
+	names := make([]string, 0, len(rankMetrics))
+	for k := range rankMetrics {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("--by must be one of %s, got %q", strings.Join(names, ", "), by)
+}
+
+// topN keeps only the records of the n heaviest containers ranked by the
+// given metric. With others set, the remaining containers are summed per
+// timestamp into a single "others" series. n <= 0 keeps everything.
+func topN(records []record, n int, by string, others bool) []record {
+	if n <= 0 {
+		return records
+	}
+	stats := computeStats(records)
+	if n >= len(stats) {
+		return records
+	}
+
+	rank := rankMetrics[by]
+	names := containerNames(records)
+	sort.SliceStable(names, func(i, j int) bool {
+		return rank(stats[names[i]]) > rank(stats[names[j]])
+	})
+	keep := make(map[string]bool, n)
+	for _, c := range names[:n] {
+		keep[c] = true
+	}
+
+	var out []record
+	rest := map[time.Time]*record{}
+	for _, r := range records {
+		if keep[r.Container] {
+			out = append(out, r)
+			continue
+		}
+		if !others {
+			continue
+		}
+		agg, ok := rest[r.Timestamp]
+		if !ok {
+			agg = &record{Timestamp: r.Timestamp, Container: othersName}
+			rest[r.Timestamp] = agg
+		}
+		agg.CPUPct += r.CPUPct
+		agg.MemUsageMB += r.MemUsageMB
+		agg.MemLimitMB += r.MemLimitMB
+	}
+	for _, agg := range rest {
+		if agg.MemLimitMB > 0 {
+			agg.MemPct = agg.MemUsageMB / agg.MemLimitMB * 100
+		}
+		out = append(out, *agg)
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package cstats
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// displayLoc is the --tz time zone samples are shown in. Captures are
+// written in UTC; timestamps are converted when loaded, so charts, tables
+// and the live API all show wall-clock times of this zone.
+var displayLoc = time.UTC
+
+// tzFlag registers --tz on fs; call parseTZ after fs.Parse.
+func tzFlag(fs *flag.FlagSet) *string {
+	return fs.String("tz", "UTC", "Time zone to show timestamps in: UTC, local or an IANA name such as Europe/Berlin")
+}
+
+// parseTZ sets displayLoc from a --tz value.
+func parseTZ(name string) error {
+	switch strings.ToLower(name) {
+	case "", "utc":
+		displayLoc = time.UTC
+	case "local":
+		displayLoc = time.Local
+	default:
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("invalid --tz %q: %w", name, err)
+		}
+		displayLoc = loc
+	}
+	return nil
+}
+
+// tzName labels the display zone in axis titles.
+func tzName() string {
+	if displayLoc == time.Local {
+		name, _ := time.Now().Zone()
+		return name
+	}
+	return displayLoc.String()
+}
+
+// timestampLayouts are the accepted timestamp formats besides epoch
+// numbers. Fractional seconds are accepted after any of them; times without
+// a zone are taken as UTC, like everything the collectors write.
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 -0700 MST",
+}
+
+// parseTimestamp parses a sample timestamp: RFC3339 and similar layouts, or
+// Unix epoch seconds or milliseconds. The result is in displayLoc.
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.In(displayLoc), nil
+		}
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil && v > 0 && !math.IsInf(v, 0) {
+		if v >= 1e12 {
+			v /= 1000 // milliseconds
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))).In(displayLoc), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
@@ -0,0 +1,104 @@
+package cstats
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// memUnit is a unit memory is displayed in. Captures count memory in
+// 2^20-byte units (MiB, whatever the mem_usage_mb column says), so MB and
+// GB are decimal conversions of them and MiB and GiB show them as they are.
+type memUnit struct {
+	Label  string
+	Per    float64 // captured MB per unit
+	Digits int     // decimals shown
+}
+
+// of converts a captured MB value to the unit.
+func (u memUnit) of(mb float64) float64 { return mb / u.Per }
+
+// format renders a captured MB value in the unit, without the label.
+func (u memUnit) format(mb float64) string {
+	return strconv.FormatFloat(u.of(mb), 'f', u.Digits, 64)
+}
+
+// round rounds a captured MB value in the unit to the decimals shown.
+func (u memUnit) round(mb float64) float64 {
+	p := math.Pow10(u.Digits)
+	return math.Round(u.of(mb)*p) / p
+}
+
+// label puts the unit in place of "MB" in a header or axis title.
+func (u memUnit) label(s string) string { return strings.ReplaceAll(s, "MB", u.Label) }
+
+// hover is the Plotly hover template fragment of a value in the unit.
+func (u memUnit) hover() string { return fmt.Sprintf("%%{y:.%df} %s", u.Digits, u.Label) }
+
+var (
+	unitMB  = memUnit{"MB", 1e6 / (1 << 20), 1}
+	unitMiB = memUnit{"MiB", 1, 1}
+	unitGB  = memUnit{"GB", 1e9 / (1 << 20), 2}
+	unitGiB = memUnit{"GiB", 1 << 10, 2}
+)
+
+// unitsMode is the --units choice: a fixed unit, or auto (MB or GB) and
+// auto-iec (MiB or GiB) picking the larger unit once values reach one of it.
+type unitsMode string
+
+var unitModes = map[string][2]memUnit{
+	"mb":       {unitMB, unitMB},
+	"mib":      {unitMiB, unitMiB},
+	"gb":       {unitGB, unitGB},
+	"gib":      {unitGiB, unitGiB},
+	"auto":     {unitMB, unitGB},
+	"auto-iec": {unitMiB, unitGiB},
+}
+
+func (m *unitsMode) String() string { return string(*m) }
+
+func (m *unitsMode) Set(v string) error {
+	v = strings.ToLower(v)
+	if _, ok := unitModes[v]; !ok {
+		return fmt.Errorf("must be mb, mib, gb, gib, auto or auto-iec, got %q", v)
+	}
+	*m = unitsMode(v)
+	return nil
+}
+
+// units is the --units mode of the command.
+var units = unitsMode("mib")
+
+// unitsFlag registers --units on fs.
+func unitsFlag(fs *flag.FlagSet) {
+	fs.Var(&units, "units", "Memory units of tables, axes and the TUI: mib (as captured), mb, gib, gb, auto-iec (MiB or GiB by size) or auto (MB or GB); JSON keeps the captured MiB")
+}
+
+// memUnitFor picks the unit for memory values up to maxMB.
+func memUnitFor(maxMB float64) memUnit {
+	pair := unitModes[string(units)]
+	if maxMB >= pair[1].Per {
+		return pair[1]
+	}
+	return pair[0]
+}
+
+// recordsMemUnit picks the unit for charting records.
+func recordsMemUnit(records []record) memUnit {
+	peak := 0.0
+	for _, r := range records {
+		peak = max(peak, r.MemUsageMB)
+	}
+	return memUnitFor(peak)
+}
+
+// statsMemUnit picks the unit for a table of stats.
+func statsMemUnit(stats map[string]*containerStats) memUnit {
+	peak := 0.0
+	for _, s := range stats {
+		peak = max(peak, s.MemMax)
+	}
+	return memUnitFor(peak)
+}